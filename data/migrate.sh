@@ -43,11 +43,12 @@ echo ""
 echo "Running migrations..."
 echo ""
 
-# Run each migration file in order
+# Run each migration file in order. Every run applies all of them, so each must be
+# safe to re-run; ON_ERROR_STOP makes a failing statement fail the script.
 for migration_file in migrations/*.sql; do
     if [ -f "$migration_file" ]; then
         echo "Applying: $(basename $migration_file)"
-        psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -f "$migration_file"
+        psql -h $DB_HOST -p $DB_PORT -U $DB_USER -d $DB_NAME -v ON_ERROR_STOP=1 -f "$migration_file"
         echo "✓ Completed: $(basename $migration_file)"
         echo ""
     fi
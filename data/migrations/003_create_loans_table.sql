@@ -20,6 +20,7 @@ CREATE INDEX IF NOT EXISTS idx_loans_customer_id ON loans(customer_id);
 CREATE INDEX IF NOT EXISTS idx_loans_status ON loans(status);
 
 -- Create trigger to update updated_at timestamp
+DROP TRIGGER IF EXISTS update_loans_updated_at ON loans;
 CREATE TRIGGER update_loans_updated_at
     BEFORE UPDATE ON loans
     FOR EACH ROW
@@ -1,8 +1,14 @@
 -- Create disbursement method enum type
-CREATE TYPE disbursement_method AS ENUM ('on_chain', 'api');
+DO $$ BEGIN
+    CREATE TYPE disbursement_method AS ENUM ('on_chain', 'api');
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
 
 -- Create disbursement status enum type
-CREATE TYPE disbursement_status AS ENUM ('pending', 'processing', 'completed', 'failed');
+DO $$ BEGIN
+    CREATE TYPE disbursement_status AS ENUM ('pending', 'processing', 'completed', 'failed');
+EXCEPTION WHEN duplicate_object THEN NULL;
+END $$;
 
 -- Create disbursements table
 CREATE TABLE IF NOT EXISTS disbursements (
@@ -27,6 +33,7 @@ CREATE INDEX IF NOT EXISTS idx_disbursements_status ON disbursements(status);
 CREATE INDEX IF NOT EXISTS idx_disbursements_tx_hash ON disbursements(tx_hash);
 
 -- Create trigger to update updated_at timestamp
+DROP TRIGGER IF EXISTS update_disbursements_updated_at ON disbursements;
 CREATE TRIGGER update_disbursements_updated_at
     BEFORE UPDATE ON disbursements
     FOR EACH ROW
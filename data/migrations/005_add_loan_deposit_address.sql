@@ -0,0 +1,8 @@
+-- Add collateral and Taproot deposit address columns to loans
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS collateral_btc DECIMAL(18, 8);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS btc_price_at_creation DECIMAL(18, 2);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS deposit_address VARCHAR(100);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS derivation_path VARCHAR(100);
+
+-- Each loan has its own deposit address
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loans_deposit_address ON loans(deposit_address);
@@ -0,0 +1,13 @@
+-- Create loan status history table
+CREATE TABLE IF NOT EXISTS loan_status_history (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    actor_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create index on loan_id for history lookups
+CREATE INDEX IF NOT EXISTS idx_loan_status_history_loan_id ON loan_status_history(loan_id);
@@ -0,0 +1,9 @@
+-- Add role column to users
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'borrower';
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS valid_user_role;
+ALTER TABLE users ADD CONSTRAINT valid_user_role
+    CHECK (role IN ('borrower', 'lender', 'operator', 'admin'));
+
+-- Create index on role for staff lookups
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
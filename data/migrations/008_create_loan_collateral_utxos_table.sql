@@ -0,0 +1,18 @@
+-- Create loan collateral UTXOs table
+CREATE TABLE IF NOT EXISTS loan_collateral_utxos (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    address VARCHAR(100) NOT NULL,
+    txid VARCHAR(64) NOT NULL,
+    vout INTEGER NOT NULL,
+    amount_sats BIGINT NOT NULL,
+    block_height BIGINT,
+    confirmations BIGINT NOT NULL DEFAULT 0,
+    spent BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(txid, vout)
+);
+
+-- Create index on loan_id for collateral lookups
+CREATE INDEX IF NOT EXISTS idx_loan_collateral_utxos_loan_id ON loan_collateral_utxos(loan_id);
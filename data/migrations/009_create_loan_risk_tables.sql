@@ -0,0 +1,19 @@
+-- Add live risk columns to loans
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS current_lvr DECIMAL(12, 6);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS risk_level VARCHAR(20) DEFAULT 'ok';
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS risk_checked_at TIMESTAMP WITH TIME ZONE;
+
+-- Create loan risk events table
+CREATE TABLE IF NOT EXISTS loan_risk_events (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    from_level VARCHAR(20),
+    to_level VARCHAR(20) NOT NULL,
+    lvr DECIMAL(12, 6) NOT NULL,
+    btc_price DECIMAL(18, 2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for risk lookups
+CREATE INDEX IF NOT EXISTS idx_loan_risk_events_loan_id ON loan_risk_events(loan_id);
+CREATE INDEX IF NOT EXISTS idx_loans_risk_level ON loans(risk_level);
@@ -0,0 +1,27 @@
+-- Add pricing terms and interest accrual columns to loans
+-- Rates are stored as ratios, e.g. 0.099 for 9.90% p.a.
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS annual_interest_rate DECIMAL(8, 6);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS admin_fee_rate DECIMAL(8, 6);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS admin_fee_aud DECIMAL(18, 2);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS principal_outstanding_aud DECIMAL(18, 2);
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS accrued_interest_aud DECIMAL(18, 2) DEFAULT 0;
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS interest_accrued_through DATE;
+
+-- term_months and disbursed_at come from 003; interest accrues from disbursed_at, so it
+-- carries a time zone like the other lifecycle timestamps
+ALTER TABLE loans ALTER COLUMN disbursed_at TYPE TIMESTAMP WITH TIME ZONE;
+
+-- annual_interest_rate replaces the unused percentage interest_rate from 003
+ALTER TABLE loans DROP COLUMN IF EXISTS interest_rate;
+
+-- Create daily interest accruals table
+CREATE TABLE IF NOT EXISTS loan_interest_accruals (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    accrual_date DATE NOT NULL,
+    principal_aud DECIMAL(18, 2) NOT NULL,
+    annual_rate DECIMAL(8, 6) NOT NULL,
+    interest_aud DECIMAL(18, 2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(loan_id, accrual_date)
+);
@@ -0,0 +1,35 @@
+-- Add repayment tracking and BTC return address columns to loans
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS fees_paid_aud DECIMAL(18, 2) DEFAULT 0;
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS interest_paid_aud DECIMAL(18, 2) DEFAULT 0;
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS btc_return_address VARCHAR(100);
+
+-- Create loan repayments table
+CREATE TABLE IF NOT EXISTS loan_repayments (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    currency VARCHAR(10) NOT NULL,
+    amount DECIMAL(18, 8) NOT NULL,
+    amount_aud DECIMAL(18, 2) NOT NULL,
+    fees_aud DECIMAL(18, 2) NOT NULL DEFAULT 0,
+    interest_aud DECIMAL(18, 2) NOT NULL DEFAULT 0,
+    principal_aud DECIMAL(18, 2) NOT NULL DEFAULT 0,
+    reference VARCHAR(255),
+    tx_hash VARCHAR(255),
+    recorded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create collateral releases table
+CREATE TABLE IF NOT EXISTS collateral_releases (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL UNIQUE REFERENCES loans(id) ON DELETE CASCADE,
+    return_address VARCHAR(100),
+    amount_sats BIGINT NOT NULL,
+    status VARCHAR(50) DEFAULT 'awaiting_address',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_loan_repayments_loan_id ON loan_repayments(loan_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loan_repayments_tx_hash ON loan_repayments(tx_hash) WHERE tx_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_collateral_releases_status ON collateral_releases(status);
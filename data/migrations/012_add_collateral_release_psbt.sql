@@ -0,0 +1,5 @@
+-- Store the unsigned release transaction built for offline signing
+ALTER TABLE collateral_releases ADD COLUMN IF NOT EXISTS psbt TEXT;
+ALTER TABLE collateral_releases ADD COLUMN IF NOT EXISTS fee_rate INTEGER;
+ALTER TABLE collateral_releases ADD COLUMN IF NOT EXISTS fee_sats BIGINT;
+ALTER TABLE collateral_releases ADD COLUMN IF NOT EXISTS psbt_created_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,39 @@
+-- Create loan liquidations table
+CREATE TABLE IF NOT EXISTS loan_liquidations (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL UNIQUE REFERENCES loans(id) ON DELETE CASCADE,
+    exchange_address VARCHAR(100) NOT NULL,
+    psbt TEXT NOT NULL,
+    input_sats BIGINT NOT NULL,
+    fee_sats BIGINT NOT NULL,
+    sweep_sats BIGINT NOT NULL,
+    btc_price DECIMAL(18, 2) NOT NULL,
+    lvr DECIMAL(12, 6) NOT NULL,
+    outstanding_aud DECIMAL(18, 2) NOT NULL,
+    expected_proceeds_aud DECIMAL(18, 2) NOT NULL,
+    status VARCHAR(50) DEFAULT 'awaiting_signature',
+    sweep_txid VARCHAR(64),
+    proceeds_aud DECIMAL(18, 2),
+    surplus_aud DECIMAL(18, 2),
+    shortfall_aud DECIMAL(18, 2),
+    initiated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    settled_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    settled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create customer credits table for amounts owed back to borrowers
+CREATE TABLE IF NOT EXISTS customer_credits (
+    id SERIAL PRIMARY KEY,
+    customer_id INTEGER NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    loan_id INTEGER REFERENCES loans(id) ON DELETE SET NULL,
+    amount_aud DECIMAL(18, 2) NOT NULL,
+    reason VARCHAR(100) NOT NULL,
+    status VARCHAR(50) DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_loan_liquidations_status ON loan_liquidations(status);
+CREATE INDEX IF NOT EXISTS idx_customer_credits_customer_id ON customer_credits(customer_id);
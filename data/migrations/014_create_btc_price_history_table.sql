@@ -0,0 +1,13 @@
+-- Create BTC/AUD price history table
+-- Every price produced by the oracle is stored, plus backfilled history from CoinGecko
+CREATE TABLE IF NOT EXISTS btc_price_history (
+    id BIGSERIAL PRIMARY KEY,
+    price_aud DECIMAL(18, 2) NOT NULL,
+    source VARCHAR(50) NOT NULL,
+    source_count INTEGER,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source, recorded_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_btc_price_history_recorded_at ON btc_price_history(recorded_at);
@@ -0,0 +1,17 @@
+-- Create loan quotes table
+-- A quote locks the oracle BTC/AUD price and required collateral for a short time;
+-- loans can only be created from an unexpired, unused quote
+CREATE TABLE IF NOT EXISTS loan_quotes (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    btc_price DECIMAL(18, 2) NOT NULL,
+    lvr DECIMAL(12, 6) NOT NULL,
+    max_amount_aud DECIMAL(18, 2) NOT NULL,
+    collateral_btc DECIMAL(18, 8) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    loan_id INTEGER UNIQUE REFERENCES loans(id) ON DELETE SET NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_loan_quotes_user_id ON loan_quotes(user_id);
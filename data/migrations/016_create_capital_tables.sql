@@ -0,0 +1,32 @@
+-- Create the stablecoin deposit address and capital supply tables that 017 onwards extend.
+-- They were previously only created by init.sql.
+CREATE TABLE IF NOT EXISTS deposit_addresses (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(10) NOT NULL,
+    address VARCHAR(255) NOT NULL UNIQUE,
+    status VARCHAR(50) DEFAULT 'active',
+    swept BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS capital_supplies (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(10) NOT NULL,
+    amount DECIMAL(18, 8) NOT NULL,
+    wallet_address VARCHAR(255) NOT NULL,
+    tx_hash VARCHAR(255),
+    status VARCHAR(50) DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_deposit_addresses_user_id ON deposit_addresses(user_id);
+CREATE INDEX IF NOT EXISTS idx_deposit_addresses_status ON deposit_addresses(status);
+CREATE INDEX IF NOT EXISTS idx_deposit_addresses_swept ON deposit_addresses(swept);
+
+CREATE INDEX IF NOT EXISTS idx_capital_supplies_user_id ON capital_supplies(user_id);
+CREATE INDEX IF NOT EXISTS idx_capital_supplies_status ON capital_supplies(status);
+CREATE INDEX IF NOT EXISTS idx_capital_supplies_token ON capital_supplies(token);
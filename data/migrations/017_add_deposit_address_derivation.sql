@@ -0,0 +1,10 @@
+-- Derive stablecoin deposit addresses from an Ethereum xpub (BIP-44 m/44'/60'/0'/0/i)
+-- The sequence hands out each index once, so no two addresses share a key
+CREATE SEQUENCE IF NOT EXISTS deposit_address_index_seq MINVALUE 0 START WITH 0;
+
+ALTER TABLE deposit_addresses ADD COLUMN IF NOT EXISTS derivation_index INTEGER UNIQUE;
+ALTER TABLE deposit_addresses ADD COLUMN IF NOT EXISTS derivation_path VARCHAR(100);
+
+-- Addresses generated before derivation have no known key; stop handing them out
+UPDATE deposit_addresses SET status = 'retired', updated_at = NOW()
+WHERE derivation_index IS NULL AND status = 'active';
@@ -0,0 +1,15 @@
+-- Link capital supplies to the ERC-20 Transfer log that funded them
+ALTER TABLE capital_supplies ADD COLUMN IF NOT EXISTS deposit_address_id INTEGER REFERENCES deposit_addresses(id);
+ALTER TABLE capital_supplies ADD COLUMN IF NOT EXISTS log_index INTEGER;
+ALTER TABLE capital_supplies ADD COLUMN IF NOT EXISTS block_number BIGINT;
+ALTER TABLE capital_supplies ADD COLUMN IF NOT EXISTS rejection_reason TEXT;
+
+-- Each Transfer log funds at most one supply
+CREATE UNIQUE INDEX IF NOT EXISTS idx_capital_supplies_tx_log ON capital_supplies(tx_hash, log_index);
+
+-- Last block scanned for deposits that can no longer be reorganised
+CREATE TABLE IF NOT EXISTS evm_scan_cursors (
+    name VARCHAR(100) PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
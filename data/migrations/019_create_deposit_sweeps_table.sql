@@ -0,0 +1,26 @@
+-- Create deposit_sweeps table (unsigned transfers of deposit address balances to the treasury)
+CREATE TABLE IF NOT EXISTS deposit_sweeps (
+    id SERIAL PRIMARY KEY,
+    deposit_address_id INTEGER NOT NULL REFERENCES deposit_addresses(id) ON DELETE CASCADE,
+    token VARCHAR(10) NOT NULL,
+    amount DECIMAL(18, 8) NOT NULL,
+    amount_base_units NUMERIC(78, 0) NOT NULL,
+    treasury_address VARCHAR(255) NOT NULL,
+    unsigned_tx TEXT NOT NULL,
+    gas_top_up_wei NUMERIC(78, 0) NOT NULL DEFAULT 0,
+    from_block BIGINT NOT NULL,
+    status VARCHAR(50) DEFAULT 'awaiting_signature',
+    tx_hash VARCHAR(255),
+    block_number BIGINT,
+    swept_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- At most one sweep per address awaits signature at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_deposit_sweeps_awaiting ON deposit_sweeps(deposit_address_id) WHERE status = 'awaiting_signature';
+CREATE INDEX IF NOT EXISTS idx_deposit_sweeps_status ON deposit_sweeps(status);
+
+-- Record the sweep that emptied each deposit address
+ALTER TABLE deposit_addresses ADD COLUMN IF NOT EXISTS sweep_tx_hash VARCHAR(255);
+ALTER TABLE deposit_addresses ADD COLUMN IF NOT EXISTS swept_at TIMESTAMP WITH TIME ZONE;
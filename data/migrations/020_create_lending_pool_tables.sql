@@ -0,0 +1,41 @@
+-- Create lending_pools table (one share-based pool per capital token)
+CREATE TABLE IF NOT EXISTS lending_pools (
+    token VARCHAR(10) PRIMARY KEY,
+    total_shares NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    total_assets NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO lending_pools (token) VALUES ('AAUD'), ('USDC'), ('USDT') ON CONFLICT (token) DO NOTHING;
+
+-- Create pool_positions table (each lender's shares and net principal in a pool)
+CREATE TABLE IF NOT EXISTS pool_positions (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(10) NOT NULL REFERENCES lending_pools(token),
+    shares NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    principal NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, token)
+);
+
+-- Create pool_ledger table (every change to a pool's assets or shares)
+CREATE TABLE IF NOT EXISTS pool_ledger (
+    id SERIAL PRIMARY KEY,
+    token VARCHAR(10) NOT NULL REFERENCES lending_pools(token),
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    entry_type VARCHAR(20) NOT NULL,
+    capital_supply_id INTEGER UNIQUE REFERENCES capital_supplies(id),
+    assets NUMERIC(38, 18) NOT NULL,
+    shares NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    share_price NUMERIC(38, 18) NOT NULL,
+    interest_aud DECIMAL(18, 2),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pool_ledger_token ON pool_ledger(token);
+CREATE INDEX IF NOT EXISTS idx_pool_ledger_user_id ON pool_ledger(user_id);
+
+-- Interest is added to the pools once per accrual
+ALTER TABLE loan_interest_accruals ADD COLUMN IF NOT EXISTS pool_distributed_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_loan_interest_accruals_undistributed ON loan_interest_accruals(id) WHERE pool_distributed_at IS NULL;
@@ -0,0 +1,24 @@
+-- Create capital_withdrawals table (lender requests to take capital out of a lending pool)
+CREATE TABLE IF NOT EXISTS capital_withdrawals (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(10) NOT NULL REFERENCES lending_pools(token),
+    amount DECIMAL(18, 8) NOT NULL,
+    wallet_address VARCHAR(255) NOT NULL,
+    status VARCHAR(50) DEFAULT 'pending',
+    available_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    shares NUMERIC(38, 18),
+    share_price NUMERIC(38, 18),
+    approved_at TIMESTAMP WITH TIME ZONE,
+    payout_tx_hash VARCHAR(255) UNIQUE,
+    paid_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    paid_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_capital_withdrawals_user_id ON capital_withdrawals(user_id);
+CREATE INDEX IF NOT EXISTS idx_capital_withdrawals_status ON capital_withdrawals(status);
+
+-- Link the pool ledger entry that burned a withdrawal's shares
+ALTER TABLE pool_ledger ADD COLUMN IF NOT EXISTS capital_withdrawal_id INTEGER UNIQUE REFERENCES capital_withdrawals(id);
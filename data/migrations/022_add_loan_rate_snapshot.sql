@@ -0,0 +1,3 @@
+-- Record the pool utilisation the rate model priced each loan at.
+-- The rate itself is snapshotted in annual_interest_rate, so later rate changes don't affect the loan.
+ALTER TABLE loans ADD COLUMN IF NOT EXISTS rate_utilisation DECIMAL(12, 6);
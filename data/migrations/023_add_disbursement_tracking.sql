@@ -0,0 +1,9 @@
+-- Track payout attempts so failed disbursements can be retried
+ALTER TABLE disbursements ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE disbursements ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE disbursements ADD COLUMN IF NOT EXISTS completed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE disbursements ADD COLUMN IF NOT EXISTS created_by INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+-- A loan is paid out at most once; retries reuse its disbursement
+CREATE UNIQUE INDEX IF NOT EXISTS idx_disbursements_loan_id_unique ON disbursements(loan_id);
+CREATE INDEX IF NOT EXISTS idx_disbursements_next_attempt_at ON disbursements(next_attempt_at);
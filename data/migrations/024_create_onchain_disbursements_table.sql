@@ -0,0 +1,22 @@
+-- Create onchain_disbursements table (payouts seen in Disbursement contract events, reconciled against disbursements)
+CREATE TABLE IF NOT EXISTS onchain_disbursements (
+    id SERIAL PRIMARY KEY,
+    contract_disbursement_id VARCHAR(66) NOT NULL,
+    contract_loan_id VARCHAR(66) NOT NULL,
+    loan_id INTEGER REFERENCES loans(id) ON DELETE SET NULL,
+    disbursement_id INTEGER REFERENCES disbursements(id) ON DELETE SET NULL,
+    recipient_address VARCHAR(255) NOT NULL,
+    amount DECIMAL(18, 8) NOT NULL,
+    amount_base_units NUMERIC(78, 0) NOT NULL,
+    tx_hash VARCHAR(255) NOT NULL,
+    log_index INTEGER NOT NULL,
+    block_number BIGINT NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_onchain_disbursements_tx_log ON onchain_disbursements(tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_onchain_disbursements_status ON onchain_disbursements(status);
+CREATE INDEX IF NOT EXISTS idx_onchain_disbursements_loan_id ON onchain_disbursements(loan_id);
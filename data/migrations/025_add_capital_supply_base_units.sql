@@ -0,0 +1,4 @@
+-- Exact token amount of a capital supply in the token's smallest unit, so claims are matched
+-- to on-chain transfers without comparing floats. The capital watcher fills it in for pending
+-- supplies recorded before this column, once their token's decimals are configured.
+ALTER TABLE capital_supplies ADD COLUMN IF NOT EXISTS amount_base_units NUMERIC(78, 0);
@@ -0,0 +1,6 @@
+-- Pools earn interest once borrowers pay it, so distribution is tracked per repayment
+ALTER TABLE loan_repayments ADD COLUMN IF NOT EXISTS pool_distributed_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_loan_repayments_undistributed ON loan_repayments(id) WHERE pool_distributed_at IS NULL;
+
+-- Accrued interest is a receivable and is no longer added to the pools
+ALTER TABLE loan_interest_accruals DROP COLUMN IF EXISTS pool_distributed_at;
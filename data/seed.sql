@@ -20,11 +20,17 @@ INSERT INTO customers (user_id, first_name, last_name, phone) VALUES
 ON CONFLICT (user_id) DO NOTHING;
 
 -- Insert test loans
-INSERT INTO loans (customer_id, amount_aud, status, interest_rate, term_months) VALUES
-    (1, 10000.00, 'approved', 5.5, 12),
-    (1, 5000.00, 'pending', 5.5, 6),
-    (2, 15000.00, 'approved', 6.0, 24),
-    (3, 7500.00, 'disbursed', 5.0, 12);
+-- Rates are ratios, e.g. 0.099 for 9.90% p.a.; the accrual job catches
+-- disbursed loans up from disbursed_at
+INSERT INTO loans (
+    customer_id, amount_aud, collateral_btc, btc_price_at_creation, status,
+    annual_interest_rate, admin_fee_rate, admin_fee_aud, term_months,
+    principal_outstanding_aud, disbursed_at
+) VALUES
+    (1, 10000.00, 0.20000000, 100000.00, 'disbursed', 0.099, 0.02, 200.00, 12, 10000.00, NOW() - INTERVAL '30 days'),
+    (1, 5000.00, 0.10000000, 100000.00, 'pending', 0.099, 0.02, 100.00, 12, 5000.00, NULL),
+    (2, 15000.00, 0.30000000, 100000.00, 'disbursed', 0.099, 0.02, 300.00, 12, 15000.00, NOW() - INTERVAL '10 days'),
+    (3, 7500.00, 0.15000000, 100000.00, 'collateralised', 0.099, 0.02, 150.00, 12, 7500.00, NULL);
 
 -- Insert test disbursements
 INSERT INTO disbursements (loan_id, customer_id, amount_aud, method, status, recipient_address) VALUES
@@ -45,7 +51,7 @@ SELECT 'Customers:' as table_name;
 SELECT id, user_id, first_name, last_name, phone FROM customers;
 
 SELECT 'Loans:' as table_name;
-SELECT id, customer_id, amount_aud, status, interest_rate, term_months FROM loans;
+SELECT id, customer_id, amount_aud, status, annual_interest_rate, term_months FROM loans;
 
 SELECT 'Disbursements:' as table_name;
 SELECT id, loan_id, customer_id, amount_aud, method, status, recipient_address FROM disbursements;
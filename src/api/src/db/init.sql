@@ -3,6 +3,7 @@ CREATE TABLE IF NOT EXISTS users (
     id SERIAL PRIMARY KEY,
     email VARCHAR(255) UNIQUE NOT NULL,
     password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL DEFAULT 'borrower' CHECK (role IN ('borrower', 'lender', 'operator', 'admin')),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
@@ -28,10 +29,169 @@ CREATE TABLE IF NOT EXISTS loans (
     status VARCHAR(50) DEFAULT 'pending',
     deposit_address VARCHAR(100),
     derivation_path VARCHAR(100),
+    current_lvr DECIMAL(12, 6),
+    risk_level VARCHAR(20) DEFAULT 'ok',
+    risk_checked_at TIMESTAMP WITH TIME ZONE,
+    annual_interest_rate DECIMAL(8, 6),
+    rate_utilisation DECIMAL(12, 6),
+    admin_fee_rate DECIMAL(8, 6),
+    admin_fee_aud DECIMAL(18, 2),
+    term_months INTEGER,
+    principal_outstanding_aud DECIMAL(18, 2),
+    accrued_interest_aud DECIMAL(18, 2) DEFAULT 0,
+    interest_accrued_through DATE,
+    disbursed_at TIMESTAMP WITH TIME ZONE,
+    fees_paid_aud DECIMAL(18, 2) DEFAULT 0,
+    interest_paid_aud DECIMAL(18, 2) DEFAULT 0,
+    btc_return_address VARCHAR(100),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Create loan status history table
+CREATE TABLE IF NOT EXISTS loan_status_history (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    from_status VARCHAR(50),
+    to_status VARCHAR(50) NOT NULL,
+    actor_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create loan collateral UTXOs table
+CREATE TABLE IF NOT EXISTS loan_collateral_utxos (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    address VARCHAR(100) NOT NULL,
+    txid VARCHAR(64) NOT NULL,
+    vout INTEGER NOT NULL,
+    amount_sats BIGINT NOT NULL,
+    block_height BIGINT,
+    confirmations BIGINT NOT NULL DEFAULT 0,
+    spent BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(txid, vout)
+);
+
+-- Create loan risk events table
+CREATE TABLE IF NOT EXISTS loan_risk_events (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    from_level VARCHAR(20),
+    to_level VARCHAR(20) NOT NULL,
+    lvr DECIMAL(12, 6) NOT NULL,
+    btc_price DECIMAL(18, 2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create daily interest accruals table
+CREATE TABLE IF NOT EXISTS loan_interest_accruals (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    accrual_date DATE NOT NULL,
+    principal_aud DECIMAL(18, 2) NOT NULL,
+    annual_rate DECIMAL(8, 6) NOT NULL,
+    interest_aud DECIMAL(18, 2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(loan_id, accrual_date)
+);
+
+-- Create loan repayments table
+CREATE TABLE IF NOT EXISTS loan_repayments (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL REFERENCES loans(id) ON DELETE CASCADE,
+    currency VARCHAR(10) NOT NULL,
+    amount DECIMAL(18, 8) NOT NULL,
+    amount_aud DECIMAL(18, 2) NOT NULL,
+    fees_aud DECIMAL(18, 2) NOT NULL DEFAULT 0,
+    interest_aud DECIMAL(18, 2) NOT NULL DEFAULT 0,
+    principal_aud DECIMAL(18, 2) NOT NULL DEFAULT 0,
+    reference VARCHAR(255),
+    tx_hash VARCHAR(255),
+    recorded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    pool_distributed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create collateral releases table
+CREATE TABLE IF NOT EXISTS collateral_releases (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL UNIQUE REFERENCES loans(id) ON DELETE CASCADE,
+    return_address VARCHAR(100),
+    amount_sats BIGINT NOT NULL,
+    status VARCHAR(50) DEFAULT 'awaiting_address',
+    psbt TEXT,
+    fee_rate INTEGER,
+    fee_sats BIGINT,
+    psbt_created_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create loan liquidations table
+CREATE TABLE IF NOT EXISTS loan_liquidations (
+    id SERIAL PRIMARY KEY,
+    loan_id INTEGER NOT NULL UNIQUE REFERENCES loans(id) ON DELETE CASCADE,
+    exchange_address VARCHAR(100) NOT NULL,
+    psbt TEXT NOT NULL,
+    input_sats BIGINT NOT NULL,
+    fee_sats BIGINT NOT NULL,
+    sweep_sats BIGINT NOT NULL,
+    btc_price DECIMAL(18, 2) NOT NULL,
+    lvr DECIMAL(12, 6) NOT NULL,
+    outstanding_aud DECIMAL(18, 2) NOT NULL,
+    expected_proceeds_aud DECIMAL(18, 2) NOT NULL,
+    status VARCHAR(50) DEFAULT 'awaiting_signature',
+    sweep_txid VARCHAR(64),
+    proceeds_aud DECIMAL(18, 2),
+    surplus_aud DECIMAL(18, 2),
+    shortfall_aud DECIMAL(18, 2),
+    initiated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    settled_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    settled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create customer credits table for amounts owed back to borrowers
+CREATE TABLE IF NOT EXISTS customer_credits (
+    id SERIAL PRIMARY KEY,
+    customer_id INTEGER NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    loan_id INTEGER REFERENCES loans(id) ON DELETE SET NULL,
+    amount_aud DECIMAL(18, 2) NOT NULL,
+    reason VARCHAR(100) NOT NULL,
+    status VARCHAR(50) DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create BTC/AUD price history table
+CREATE TABLE IF NOT EXISTS btc_price_history (
+    id BIGSERIAL PRIMARY KEY,
+    price_aud DECIMAL(18, 2) NOT NULL,
+    source VARCHAR(50) NOT NULL,
+    source_count INTEGER,
+    recorded_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source, recorded_at)
+);
+
+-- Create loan quotes table
+CREATE TABLE IF NOT EXISTS loan_quotes (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    btc_price DECIMAL(18, 2) NOT NULL,
+    lvr DECIMAL(12, 6) NOT NULL,
+    max_amount_aud DECIMAL(18, 2) NOT NULL,
+    collateral_btc DECIMAL(18, 8) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    loan_id INTEGER UNIQUE REFERENCES loans(id) ON DELETE SET NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Create disbursements table
 CREATE TABLE IF NOT EXISTS disbursements (
     id SERIAL PRIMARY KEY,
@@ -43,6 +203,10 @@ CREATE TABLE IF NOT EXISTS disbursements (
     recipient_address VARCHAR(255) NOT NULL,
     tx_hash VARCHAR(255),
     error_message TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
@@ -53,43 +217,211 @@ CREATE TABLE IF NOT EXISTS capital_supplies (
     user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
     token VARCHAR(10) NOT NULL,
     amount DECIMAL(18, 8) NOT NULL,
+    amount_base_units NUMERIC(78, 0),
     wallet_address VARCHAR(255) NOT NULL,
     tx_hash VARCHAR(255),
+    log_index INTEGER,
+    block_number BIGINT,
     status VARCHAR(50) DEFAULT 'pending',
+    rejection_reason TEXT,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
 -- Create deposit_addresses table
+-- Addresses are derived at m/44'/60'/0'/0/{derivation_index}; the sequence hands out each index once
+CREATE SEQUENCE IF NOT EXISTS deposit_address_index_seq MINVALUE 0 START WITH 0;
+
 CREATE TABLE IF NOT EXISTS deposit_addresses (
     id SERIAL PRIMARY KEY,
     user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
     token VARCHAR(10) NOT NULL,
     address VARCHAR(255) NOT NULL UNIQUE,
+    derivation_index INTEGER UNIQUE,
+    derivation_path VARCHAR(100),
     status VARCHAR(50) DEFAULT 'active',
     swept BOOLEAN DEFAULT FALSE,
+    sweep_tx_hash VARCHAR(255),
+    swept_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Link capital supplies to the deposit address they were paid to
+ALTER TABLE capital_supplies ADD COLUMN IF NOT EXISTS deposit_address_id INTEGER REFERENCES deposit_addresses(id);
+
+-- Create evm_scan_cursors table (last block scanned for deposits that can no longer be reorganised)
+CREATE TABLE IF NOT EXISTS evm_scan_cursors (
+    name VARCHAR(100) PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create onchain_disbursements table (payouts seen in Disbursement contract events, reconciled against disbursements)
+CREATE TABLE IF NOT EXISTS onchain_disbursements (
+    id SERIAL PRIMARY KEY,
+    contract_disbursement_id VARCHAR(66) NOT NULL,
+    contract_loan_id VARCHAR(66) NOT NULL,
+    loan_id INTEGER REFERENCES loans(id) ON DELETE SET NULL,
+    disbursement_id INTEGER REFERENCES disbursements(id) ON DELETE SET NULL,
+    recipient_address VARCHAR(255) NOT NULL,
+    amount DECIMAL(18, 8) NOT NULL,
+    amount_base_units NUMERIC(78, 0) NOT NULL,
+    tx_hash VARCHAR(255) NOT NULL,
+    log_index INTEGER NOT NULL,
+    block_number BIGINT NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create deposit_sweeps table (unsigned transfers of deposit address balances to the treasury)
+CREATE TABLE IF NOT EXISTS deposit_sweeps (
+    id SERIAL PRIMARY KEY,
+    deposit_address_id INTEGER NOT NULL REFERENCES deposit_addresses(id) ON DELETE CASCADE,
+    token VARCHAR(10) NOT NULL,
+    amount DECIMAL(18, 8) NOT NULL,
+    amount_base_units NUMERIC(78, 0) NOT NULL,
+    treasury_address VARCHAR(255) NOT NULL,
+    unsigned_tx TEXT NOT NULL,
+    gas_top_up_wei NUMERIC(78, 0) NOT NULL DEFAULT 0,
+    from_block BIGINT NOT NULL,
+    status VARCHAR(50) DEFAULT 'awaiting_signature',
+    tx_hash VARCHAR(255),
+    block_number BIGINT,
+    swept_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create lending_pools table (one share-based pool per capital token)
+CREATE TABLE IF NOT EXISTS lending_pools (
+    token VARCHAR(10) PRIMARY KEY,
+    total_shares NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    total_assets NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO lending_pools (token) VALUES ('AAUD'), ('USDC'), ('USDT') ON CONFLICT (token) DO NOTHING;
+
+-- Create pool_positions table (each lender's shares and net principal in a pool)
+CREATE TABLE IF NOT EXISTS pool_positions (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(10) NOT NULL REFERENCES lending_pools(token),
+    shares NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    principal NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, token)
+);
+
+-- Create pool_ledger table (every change to a pool's assets or shares)
+CREATE TABLE IF NOT EXISTS pool_ledger (
+    id SERIAL PRIMARY KEY,
+    token VARCHAR(10) NOT NULL REFERENCES lending_pools(token),
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    entry_type VARCHAR(20) NOT NULL,
+    capital_supply_id INTEGER UNIQUE REFERENCES capital_supplies(id),
+    assets NUMERIC(38, 18) NOT NULL,
+    shares NUMERIC(38, 18) NOT NULL DEFAULT 0,
+    share_price NUMERIC(38, 18) NOT NULL,
+    interest_aud DECIMAL(18, 2),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create capital_withdrawals table (lender requests to take capital out of a lending pool)
+CREATE TABLE IF NOT EXISTS capital_withdrawals (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token VARCHAR(10) NOT NULL REFERENCES lending_pools(token),
+    amount DECIMAL(18, 8) NOT NULL,
+    wallet_address VARCHAR(255) NOT NULL,
+    status VARCHAR(50) DEFAULT 'pending',
+    available_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    shares NUMERIC(38, 18),
+    share_price NUMERIC(38, 18),
+    approved_at TIMESTAMP WITH TIME ZONE,
+    payout_tx_hash VARCHAR(255) UNIQUE,
+    paid_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    paid_at TIMESTAMP WITH TIME ZONE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Link the pool ledger entry that burned a withdrawal's shares
+ALTER TABLE pool_ledger ADD COLUMN IF NOT EXISTS capital_withdrawal_id INTEGER UNIQUE REFERENCES capital_withdrawals(id);
+
 -- Create index on email for faster lookups
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
 
+-- Create unique index so each user has at most one customer profile
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customers_user_id ON customers(user_id);
+
+-- Create index for loan deposit addresses
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loans_deposit_address ON loans(deposit_address);
+
+-- Create index for loan status history
+CREATE INDEX IF NOT EXISTS idx_loan_status_history_loan_id ON loan_status_history(loan_id);
+
+-- Create index for loan collateral UTXOs
+CREATE INDEX IF NOT EXISTS idx_loan_collateral_utxos_loan_id ON loan_collateral_utxos(loan_id);
+
+-- Create indexes for loan risk
+CREATE INDEX IF NOT EXISTS idx_loan_risk_events_loan_id ON loan_risk_events(loan_id);
+CREATE INDEX IF NOT EXISTS idx_loans_risk_level ON loans(risk_level);
+
+-- Create indexes for repayments and collateral releases
+CREATE INDEX IF NOT EXISTS idx_loan_repayments_loan_id ON loan_repayments(loan_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_loan_repayments_tx_hash ON loan_repayments(tx_hash) WHERE tx_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_collateral_releases_status ON collateral_releases(status);
+
+-- Create indexes for liquidations and customer credits
+CREATE INDEX IF NOT EXISTS idx_loan_liquidations_status ON loan_liquidations(status);
+CREATE INDEX IF NOT EXISTS idx_customer_credits_customer_id ON customer_credits(customer_id);
+
+-- Create indexes for price history
+CREATE INDEX IF NOT EXISTS idx_btc_price_history_recorded_at ON btc_price_history(recorded_at);
+
+-- Create indexes for loan quotes
+CREATE INDEX IF NOT EXISTS idx_loan_quotes_user_id ON loan_quotes(user_id);
+
 -- Create indexes for disbursements
 CREATE INDEX IF NOT EXISTS idx_disbursements_loan_id ON disbursements(loan_id);
 CREATE INDEX IF NOT EXISTS idx_disbursements_customer_id ON disbursements(customer_id);
 CREATE INDEX IF NOT EXISTS idx_disbursements_status ON disbursements(status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_disbursements_loan_id_unique ON disbursements(loan_id);
+CREATE INDEX IF NOT EXISTS idx_disbursements_next_attempt_at ON disbursements(next_attempt_at);
+
+-- Create indexes for onchain_disbursements
+CREATE UNIQUE INDEX IF NOT EXISTS idx_onchain_disbursements_tx_log ON onchain_disbursements(tx_hash, log_index);
+CREATE INDEX IF NOT EXISTS idx_onchain_disbursements_status ON onchain_disbursements(status);
+CREATE INDEX IF NOT EXISTS idx_onchain_disbursements_loan_id ON onchain_disbursements(loan_id);
 
 -- Create indexes for capital_supplies
 CREATE INDEX IF NOT EXISTS idx_capital_supplies_user_id ON capital_supplies(user_id);
 CREATE INDEX IF NOT EXISTS idx_capital_supplies_status ON capital_supplies(status);
 CREATE INDEX IF NOT EXISTS idx_capital_supplies_token ON capital_supplies(token);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_capital_supplies_tx_log ON capital_supplies(tx_hash, log_index);
 
 -- Create indexes for deposit_addresses
 CREATE INDEX IF NOT EXISTS idx_deposit_addresses_user_id ON deposit_addresses(user_id);
 CREATE INDEX IF NOT EXISTS idx_deposit_addresses_status ON deposit_addresses(status);
 CREATE INDEX IF NOT EXISTS idx_deposit_addresses_swept ON deposit_addresses(swept);
 
+-- Create indexes for deposit_sweeps
+CREATE UNIQUE INDEX IF NOT EXISTS idx_deposit_sweeps_awaiting ON deposit_sweeps(deposit_address_id) WHERE status = 'awaiting_signature';
+CREATE INDEX IF NOT EXISTS idx_deposit_sweeps_status ON deposit_sweeps(status);
+
+-- Create indexes for pool_ledger
+CREATE INDEX IF NOT EXISTS idx_pool_ledger_token ON pool_ledger(token);
+CREATE INDEX IF NOT EXISTS idx_pool_ledger_user_id ON pool_ledger(user_id);
+CREATE INDEX IF NOT EXISTS idx_loan_repayments_undistributed ON loan_repayments(id) WHERE pool_distributed_at IS NULL;
+
+-- Create indexes for capital_withdrawals
+CREATE INDEX IF NOT EXISTS idx_capital_withdrawals_user_id ON capital_withdrawals(user_id);
+CREATE INDEX IF NOT EXISTS idx_capital_withdrawals_status ON capital_withdrawals(status);
+
 -- Insert a test user (password is 'password123' hashed with bcrypt)
 INSERT INTO users (email, password_hash)
 VALUES ('test@example.com', '$2b$10$K8ik9pYikgXXHy7mQMrRDu2n36Z.S2TwfheTD5QTi1rof91AnHiZK')
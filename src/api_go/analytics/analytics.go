@@ -0,0 +1,298 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+
+	"paperhands/api/interest"
+	"paperhands/api/models"
+	"paperhands/api/risk"
+	"paperhands/api/services"
+)
+
+// MonthFormat labels the points of monthly series
+const MonthFormat = "2006-01"
+
+// Range is the period analytics cover. Loan figures include loans created in the range;
+// monthly series have a point for every month it touches.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// LVRBucket is the number and outstanding debt of loans in an LVR band
+type LVRBucket struct {
+	LVR    string  `json:"lvr"`
+	Count  int     `json:"count"`
+	Amount float64 `json:"amount"`
+}
+
+// CapitalPoint is the capital supplied and lent out at the end of a month, in AUD
+type CapitalPoint struct {
+	Month    string  `json:"month"`
+	Supplied float64 `json:"supplied"`
+	Utilized float64 `json:"utilized"`
+}
+
+// InterestPoint is the loan interest accrued in a month, in AUD
+type InterestPoint struct {
+	Month    string  `json:"month"`
+	Interest float64 `json:"interest"`
+}
+
+// Summary is the headline figures of the lending book. Rates and LVRs are percentages.
+type Summary struct {
+	TotalLoans           int     `json:"totalLoans"`
+	TotalLoanValue       float64 `json:"totalLoanValue"`
+	TotalCapitalSupplied float64 `json:"totalCapitalSupplied"`
+	UtilizationRate      float64 `json:"utilizationRate"`
+	TotalInterestEarned  float64 `json:"totalInterestEarned"`
+	AverageLVR           float64 `json:"averageLVR"`
+}
+
+// lvrBands are the upper bounds of the LVR buckets; loans above the last are underwater
+var lvrBands = []struct {
+	Label string
+	Upper float64
+}{
+	{"0-20%", 0.20},
+	{"20-40%", 0.40},
+	{"40-60%", 0.60},
+	{"60-80%", 0.80},
+	{"80-100%", 1.00},
+	{"100%+", math.Inf(1)},
+}
+
+// loanLVRs returns the live LVR and debt of every loan with collateral at risk created in r
+func loanLVRs(ctx context.Context, db *sql.DB, r Range, btcPrice float64) (lvrs, debts []float64, err error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT
+			COALESCE(principal_outstanding_aud, amount_aud)
+				+ COALESCE(accrued_interest_aud, 0) - COALESCE(interest_paid_aud, 0),
+			collateral_btc
+		FROM loans
+		WHERE status = ANY($1) AND created_at >= $2 AND created_at < $3
+	`, pq.Array(risk.MonitoredStatuses), r.From, r.To)
+	if err != nil {
+		return nil, nil, fmt.Errorf("querying loan LVRs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var debt, collateral float64
+		if err := rows.Scan(&debt, &collateral); err != nil {
+			return nil, nil, err
+		}
+		if collateral <= 0 {
+			continue
+		}
+		lvrs = append(lvrs, risk.LVR(debt, collateral, btcPrice))
+		debts = append(debts, debt)
+	}
+
+	return lvrs, debts, rows.Err()
+}
+
+// LoansByLVR buckets loans with collateral at risk by their LVR at btcPrice
+func LoansByLVR(ctx context.Context, db *sql.DB, r Range, btcPrice float64) ([]LVRBucket, error) {
+	lvrs, debts, err := loanLVRs(ctx, db, r, btcPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := make([]LVRBucket, len(lvrBands))
+	for i, band := range lvrBands {
+		buckets[i].LVR = band.Label
+	}
+
+	for i, lvr := range lvrs {
+		for j, band := range lvrBands {
+			if lvr < band.Upper {
+				buckets[j].Count++
+				buckets[j].Amount += debts[i]
+				break
+			}
+		}
+	}
+
+	for i := range buckets {
+		buckets[i].Amount = interest.RoundCents(buckets[i].Amount)
+	}
+
+	return buckets, nil
+}
+
+// CapitalUtilization returns, for each month in r, the AUD value of confirmed capital supplies
+// less approved withdrawals, and the principal lent out (disbursed less repaid), at the end
+// of the month or at r.To. Supplies are valued at the current token prices.
+func CapitalUtilization(ctx context.Context, db *sql.DB, r Range, price services.PriceFunc) ([]CapitalPoint, error) {
+	rows, err := db.QueryContext(ctx, `
+		WITH months AS (
+			SELECT m AS month, LEAST(m + INTERVAL '1 month', $2) AS month_end
+			FROM generate_series(date_trunc('month', $1::timestamptz), $2::timestamptz, INTERVAL '1 month') m
+		)
+		SELECT m.month, p.token,
+			(SELECT COALESCE(SUM(s.amount), 0) FROM capital_supplies s
+				WHERE s.token = p.token AND s.status = $3 AND s.created_at < m.month_end)
+			- (SELECT COALESCE(SUM(w.amount), 0) FROM capital_withdrawals w
+				WHERE w.token = p.token AND w.status IN ($4, $5) AND w.approved_at < m.month_end)
+		FROM months m CROSS JOIN lending_pools p
+		ORDER BY m.month, p.token
+	`, r.From, r.To, models.CapitalStatusConfirmed, models.WithdrawalStatusReady, models.WithdrawalStatusPaid)
+	if err != nil {
+		return nil, fmt.Errorf("querying supplied capital: %w", err)
+	}
+
+	var points []CapitalPoint
+	prices := map[string]float64{}
+	for rows.Next() {
+		var month time.Time
+		var token string
+		var amount float64
+		if err := rows.Scan(&month, &token, &amount); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		label := month.UTC().Format(MonthFormat)
+		if len(points) == 0 || points[len(points)-1].Month != label {
+			points = append(points, CapitalPoint{Month: label})
+		}
+
+		if amount <= 0 {
+			continue
+		}
+		tokenPrice, ok := prices[token]
+		if !ok {
+			tokenPrice, err = price(token)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("pricing %s: %w", token, err)
+			}
+			prices[token] = tokenPrice
+		}
+		points[len(points)-1].Supplied += amount * tokenPrice
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		WITH months AS (
+			SELECT m AS month, LEAST(m + INTERVAL '1 month', $2) AS month_end
+			FROM generate_series(date_trunc('month', $1::timestamptz), $2::timestamptz, INTERVAL '1 month') m
+		)
+		SELECT
+			(SELECT COALESCE(SUM(l.amount_aud), 0) FROM loans l WHERE l.disbursed_at < m.month_end)
+			- (SELECT COALESCE(SUM(rp.principal_aud), 0) FROM loan_repayments rp WHERE rp.created_at < m.month_end)
+		FROM months m
+		ORDER BY m.month
+	`, r.From, r.To)
+	if err != nil {
+		return nil, fmt.Errorf("querying utilised capital: %w", err)
+	}
+	defer rows.Close()
+
+	for i := 0; rows.Next(); i++ {
+		var utilized float64
+		if err := rows.Scan(&utilized); err != nil {
+			return nil, err
+		}
+		if i < len(points) {
+			points[i].Utilized = interest.RoundCents(math.Max(utilized, 0))
+			points[i].Supplied = interest.RoundCents(points[i].Supplied)
+		}
+	}
+
+	return points, rows.Err()
+}
+
+// InterestEarned returns the loan interest accrued in each month in r
+func InterestEarned(ctx context.Context, db *sql.DB, r Range) ([]InterestPoint, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT m.month, COALESCE(SUM(a.interest_aud), 0)
+		FROM generate_series(date_trunc('month', $1::timestamptz), $2::timestamptz, INTERVAL '1 month') m(month)
+		LEFT JOIN loan_interest_accruals a
+			ON a.accrual_date >= m.month AND a.accrual_date < m.month + INTERVAL '1 month'
+			AND a.accrual_date >= $1::timestamptz::date AND a.accrual_date < $2
+		GROUP BY m.month
+		ORDER BY m.month
+	`, r.From, r.To)
+	if err != nil {
+		return nil, fmt.Errorf("querying interest earned: %w", err)
+	}
+	defer rows.Close()
+
+	points := []InterestPoint{}
+	for rows.Next() {
+		var month time.Time
+		var p InterestPoint
+		if err := rows.Scan(&month, &p.Interest); err != nil {
+			return nil, err
+		}
+		p.Month = month.UTC().Format(MonthFormat)
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+// GetSummary returns the headline figures for r: loans created and their value, capital
+// supplied and utilisation at r.To, interest accrued, and the average live LVR
+func GetSummary(ctx context.Context, db *sql.DB, r Range, btcPrice float64, price services.PriceFunc) (Summary, error) {
+	var s Summary
+
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(amount_aud), 0)
+		FROM loans
+		WHERE status <> $1 AND created_at >= $2 AND created_at < $3
+	`, models.LoanStatusCancelled, r.From, r.To).Scan(&s.TotalLoans, &s.TotalLoanValue)
+	if err != nil {
+		return s, fmt.Errorf("summing loans: %w", err)
+	}
+
+	err = db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(interest_aud), 0)
+		FROM loan_interest_accruals
+		WHERE accrual_date >= $1::timestamptz::date AND accrual_date < $2
+	`, r.From, r.To).Scan(&s.TotalInterestEarned)
+	if err != nil {
+		return s, fmt.Errorf("summing interest: %w", err)
+	}
+
+	// The capital at r.To is the last point of a one-month series ending there
+	capital, err := CapitalUtilization(ctx, db, Range{From: r.To, To: r.To}, price)
+	if err != nil {
+		return s, err
+	}
+	if len(capital) > 0 {
+		last := capital[len(capital)-1]
+		s.TotalCapitalSupplied = last.Supplied
+		if last.Supplied > 0 {
+			s.UtilizationRate = math.Round(last.Utilized/last.Supplied*10000) / 100
+		}
+	}
+
+	lvrs, _, err := loanLVRs(ctx, db, r, btcPrice)
+	if err != nil {
+		return s, err
+	}
+	if len(lvrs) > 0 {
+		var total float64
+		for _, lvr := range lvrs {
+			total += lvr
+		}
+		s.AverageLVR = math.Round(total/float64(len(lvrs))*10000) / 100
+	}
+
+	s.TotalLoanValue = interest.RoundCents(s.TotalLoanValue)
+	s.TotalInterestEarned = interest.RoundCents(s.TotalInterestEarned)
+	return s, nil
+}
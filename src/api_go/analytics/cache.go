@@ -0,0 +1,71 @@
+package analytics
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"paperhands/api/config"
+)
+
+// Cache holds analytics results for TTL so public dashboards don't rerun the aggregations on
+// every request. Concurrent misses for the same key share one load.
+type Cache struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	loads   singleflight.Group
+}
+
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NewCacheFromEnv creates a cache that keeps results for ANALYTICS_CACHE_SECONDS (default 60)
+func NewCacheFromEnv() *Cache {
+	return &Cache{
+		TTL:     time.Duration(config.EnvIntOrZero("ANALYTICS_CACHE_SECONDS", 60)) * time.Second,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+// Get returns the cached value for key, calling load if it is missing or expired.
+// Errors are not cached.
+func (c *Cache) Get(key string, load func() (interface{}, error)) (interface{}, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.value, nil
+	}
+
+	value, err, _ := c.loads.Do(key, func() (interface{}, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.entries[key] = cacheEntry{value: value, expiresAt: time.Now().Add(c.TTL)}
+		c.evictExpired(now)
+		c.mu.Unlock()
+
+		return value, nil
+	})
+	return value, err
+}
+
+// evictExpired drops expired entries so distinct date ranges don't accumulate.
+// The caller holds c.mu.
+func (c *Cache) evictExpired(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
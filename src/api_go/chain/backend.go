@@ -0,0 +1,54 @@
+package chain
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when a transaction or address is unknown to the backend
+var ErrNotFound = errors.New("not found")
+
+// UTXO is an unspent output paying to a watched address
+type UTXO struct {
+	TxID        string
+	Vout        uint32
+	Value       int64 // satoshis
+	Confirmed   bool
+	BlockHeight int64
+}
+
+// Confirmations returns the number of confirmations given the current chain tip
+func (u UTXO) Confirmations(tipHeight int64) int64 {
+	return TxStatus{Confirmed: u.Confirmed, BlockHeight: u.BlockHeight}.Confirmations(tipHeight)
+}
+
+// TxStatus is whether and where a transaction has been mined
+type TxStatus struct {
+	Confirmed   bool
+	BlockHeight int64
+}
+
+// Confirmations returns the number of confirmations given the current chain tip
+func (s TxStatus) Confirmations(tipHeight int64) int64 {
+	if !s.Confirmed || s.BlockHeight <= 0 || tipHeight < s.BlockHeight {
+		return 0
+	}
+	return tipHeight - s.BlockHeight + 1
+}
+
+// Outpoint identifies a transaction output
+type Outpoint struct {
+	TxID string
+	Vout uint32
+}
+
+// Backend is a source of Bitcoin chain data
+type Backend interface {
+	// AddressUTXOs returns the unspent outputs paying to address, including unconfirmed ones
+	AddressUTXOs(ctx context.Context, address string) ([]UTXO, error)
+	// TxStatus returns the status of a transaction, or ErrNotFound if the backend has not
+	// seen it
+	TxStatus(ctx context.Context, txid string) (TxStatus, error)
+	// TipHeight returns the height of the best block
+	TipHeight(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,135 @@
+package chain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEsploraURL is the public mempool.space Esplora API
+const DefaultEsploraURL = "https://mempool.space/api"
+
+// EsploraClient is a Backend for Esplora-compatible HTTP APIs (Blockstream, mempool.space)
+type EsploraClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+type esploraStatus struct {
+	Confirmed   bool  `json:"confirmed"`
+	BlockHeight int64 `json:"block_height"`
+}
+
+type esploraUTXO struct {
+	TxID   string        `json:"txid"`
+	Vout   uint32        `json:"vout"`
+	Value  int64         `json:"value"`
+	Status esploraStatus `json:"status"`
+}
+
+// NewEsploraClient creates a client for the given base URL, e.g. https://mempool.space/api
+func NewEsploraClient(baseURL string) *EsploraClient {
+	return &EsploraClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// NewEsploraClientFromEnv creates a client using CHAIN_API_URL, defaulting to mempool.space
+func NewEsploraClientFromEnv() *EsploraClient {
+	baseURL := os.Getenv("CHAIN_API_URL")
+	if baseURL == "" {
+		baseURL = DefaultEsploraURL
+	}
+	return NewEsploraClient(baseURL)
+}
+
+// AddressUTXOs returns the unspent outputs paying to address
+func (e *EsploraClient) AddressUTXOs(ctx context.Context, address string) ([]UTXO, error) {
+	body, err := e.get(ctx, "/address/"+address+"/utxo")
+	if err != nil {
+		return nil, err
+	}
+
+	var data []esploraUTXO
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("parsing utxos for %s: %w", address, err)
+	}
+
+	utxos := make([]UTXO, 0, len(data))
+	for _, u := range data {
+		utxos = append(utxos, UTXO{
+			TxID:        u.TxID,
+			Vout:        u.Vout,
+			Value:       u.Value,
+			Confirmed:   u.Status.Confirmed,
+			BlockHeight: u.Status.BlockHeight,
+		})
+	}
+
+	return utxos, nil
+}
+
+// TxStatus returns the status of a transaction in the mempool or the chain
+func (e *EsploraClient) TxStatus(ctx context.Context, txid string) (TxStatus, error) {
+	body, err := e.get(ctx, "/tx/"+txid+"/status")
+	if err != nil {
+		return TxStatus{}, err
+	}
+
+	var data esploraStatus
+	if err := json.Unmarshal(body, &data); err != nil {
+		return TxStatus{}, fmt.Errorf("parsing status of %s: %w", txid, err)
+	}
+
+	return TxStatus{Confirmed: data.Confirmed, BlockHeight: data.BlockHeight}, nil
+}
+
+// TipHeight returns the height of the best block
+func (e *EsploraClient) TipHeight(ctx context.Context) (int64, error) {
+	body, err := e.get(ctx, "/blocks/tip/height")
+	if err != nil {
+		return 0, err
+	}
+
+	height, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parsing tip height: %w", err)
+	}
+
+	return height, nil
+}
+
+func (e *EsploraClient) get(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("esplora %s: status %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
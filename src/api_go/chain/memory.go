@@ -0,0 +1,107 @@
+package chain
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBackend is an in-memory Backend for tests and local development
+type MemoryBackend struct {
+	mu     sync.RWMutex
+	tip    int64
+	utxos  map[string][]UTXO
+	txs    map[string]TxStatus
+	errors map[string]error
+}
+
+// NewMemoryBackend creates an empty in-memory chain at the given tip height
+func NewMemoryBackend(tipHeight int64) *MemoryBackend {
+	return &MemoryBackend{
+		tip:    tipHeight,
+		utxos:  make(map[string][]UTXO),
+		txs:    make(map[string]TxStatus),
+		errors: make(map[string]error),
+	}
+}
+
+// AddUTXO adds an unspent output paying to address, and its transaction if it is not known
+func (m *MemoryBackend) AddUTXO(address string, utxo UTXO) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.utxos[address] = append(m.utxos[address], utxo)
+	if _, ok := m.txs[utxo.TxID]; !ok {
+		m.txs[utxo.TxID] = TxStatus{Confirmed: utxo.Confirmed, BlockHeight: utxo.BlockHeight}
+	}
+}
+
+// SetTxStatus adds a transaction or updates its status
+func (m *MemoryBackend) SetTxStatus(txid string, status TxStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.txs[txid] = status
+}
+
+// Spend removes an output from the UTXO set
+func (m *MemoryBackend) Spend(address, txid string, vout uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	utxos := m.utxos[address]
+	for i, u := range utxos {
+		if u.TxID == txid && u.Vout == vout {
+			m.utxos[address] = append(utxos[:i], utxos[i+1:]...)
+			return
+		}
+	}
+}
+
+// SetTipHeight sets the best block height
+func (m *MemoryBackend) SetTipHeight(height int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tip = height
+}
+
+// FailAddress makes lookups for address return err, or clears the failure if err is nil
+func (m *MemoryBackend) FailAddress(address string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.errors, address)
+		return
+	}
+	m.errors[address] = err
+}
+
+// AddressUTXOs returns the unspent outputs paying to address
+func (m *MemoryBackend) AddressUTXOs(ctx context.Context, address string) ([]UTXO, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if err := m.errors[address]; err != nil {
+		return nil, err
+	}
+
+	utxos := make([]UTXO, len(m.utxos[address]))
+	copy(utxos, m.utxos[address])
+	return utxos, nil
+}
+
+// TxStatus returns the status of a transaction, or ErrNotFound if it has not been added
+func (m *MemoryBackend) TxStatus(ctx context.Context, txid string) (TxStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, ok := m.txs[txid]
+	if !ok {
+		return TxStatus{}, ErrNotFound
+	}
+	return status, nil
+}
+
+// TipHeight returns the best block height
+func (m *MemoryBackend) TipHeight(ctx context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tip, nil
+}
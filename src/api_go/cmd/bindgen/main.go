@@ -0,0 +1,525 @@
+// Command bindgen generates Go bindings for a Solidity contract from its ABI, built on the evm
+// package's JSON-RPC client rather than go-ethereum. It supports the types the PaperHands
+// contracts use: address, bool, bytes32 and uint<N>, dynamic arrays of those as function
+// inputs, and static tuples as outputs.
+//
+// Usage:
+//
+//	go run ./cmd/bindgen -abi Disbursement.abi.json -type Disbursement -pkg disbursement -out disbursement.gen.go
+//
+// The ABI may be a bare ABI array or a hardhat artifact with an "abi" field.
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/sha3"
+)
+
+type abiParam struct {
+	Name         string     `json:"name"`
+	Type         string     `json:"type"`
+	InternalType string     `json:"internalType"`
+	Indexed      bool       `json:"indexed"`
+	Components   []abiParam `json:"components"`
+}
+
+type abiEntry struct {
+	Type            string     `json:"type"`
+	Name            string     `json:"name"`
+	Inputs          []abiParam `json:"inputs"`
+	Outputs         []abiParam `json:"outputs"`
+	StateMutability string     `json:"stateMutability"`
+	Anonymous       bool       `json:"anonymous"`
+}
+
+// reservedNames are identifiers used by the generated code that parameters must not shadow
+var reservedNames = map[string]bool{
+	"c": true, "ctx": true, "from": true, "words": true, "err": true, "out": true, "l": true, "i": true, "v": true,
+	"break": true, "case": true, "chan": true, "const": true, "continue": true, "default": true, "defer": true,
+	"else": true, "fallthrough": true, "for": true, "func": true, "go": true, "goto": true, "if": true,
+	"import": true, "interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+}
+
+func main() {
+	abiPath := flag.String("abi", "", "path to the contract ABI or hardhat artifact")
+	typeName := flag.String("type", "", "Go type name of the contract binding")
+	pkg := flag.String("pkg", "", "Go package name")
+	out := flag.String("out", "", "output file (default stdout)")
+	flag.Parse()
+
+	if *abiPath == "" || *typeName == "" || *pkg == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(*abiPath)
+	if err != nil {
+		log.Fatalf("reading ABI: %v", err)
+	}
+
+	entries, err := parseABI(data)
+	if err != nil {
+		log.Fatalf("parsing ABI: %v", err)
+	}
+
+	src, err := generate(filepath.Base(*abiPath), *pkg, *typeName, entries)
+	if err != nil {
+		log.Fatalf("generating bindings: %v", err)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatalf("writing bindings: %v", err)
+	}
+}
+
+func parseABI(data []byte) ([]abiEntry, error) {
+	var entries []abiEntry
+	if err := json.Unmarshal(data, &entries); err == nil {
+		return entries, nil
+	}
+
+	var artifact struct {
+		ABI []abiEntry `json:"abi"`
+	}
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return nil, err
+	}
+	if artifact.ABI == nil {
+		return nil, fmt.Errorf("no ABI found")
+	}
+	return artifact.ABI, nil
+}
+
+type generator struct {
+	b        strings.Builder
+	typeName string
+	usesBig  bool
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.b, format, args...)
+	g.b.WriteByte('\n')
+}
+
+func generate(source, pkg, typeName string, entries []abiEntry) ([]byte, error) {
+	var functions, events []abiEntry
+	for _, e := range entries {
+		switch e.Type {
+		case "function":
+			functions = append(functions, e)
+		case "event":
+			if !e.Anonymous {
+				events = append(events, e)
+			}
+		}
+	}
+
+	g := &generator{typeName: typeName}
+	var body generator
+	body.typeName = typeName
+
+	// Selectors and topics
+	body.p("// Function selectors")
+	body.p("const (")
+	for _, fn := range functions {
+		sig, err := signature(fn)
+		if err != nil {
+			return nil, err
+		}
+		body.p("%sSelector = %q // %s", goName(fn.Name), "0x"+keccakHex(sig)[:8], sig)
+	}
+	body.p(")")
+	body.p("")
+
+	if len(events) > 0 {
+		body.p("// Event signature hashes")
+		body.p("const (")
+		for _, ev := range events {
+			sig, err := signature(ev)
+			if err != nil {
+				return nil, err
+			}
+			body.p("%sTopic = %q // %s", goName(ev.Name), "0x"+keccakHex(sig), sig)
+		}
+		body.p(")")
+		body.p("")
+	}
+
+	// Binding type
+	body.p("// %s is a binding to a deployed %s contract", typeName, typeName)
+	body.p("type %s struct {", typeName)
+	body.p("Address string")
+	body.p("Backend evm.ContractBackend")
+	body.p("}")
+	body.p("")
+	body.p("// New%s binds the %s contract at address", typeName, typeName)
+	body.p("func New%s(address string, backend evm.ContractBackend) *%s {", typeName, typeName)
+	body.p("return &%s{Address: strings.ToLower(address), Backend: backend}", typeName)
+	body.p("}")
+	body.p("")
+
+	for _, fn := range functions {
+		if err := body.function(fn); err != nil {
+			return nil, fmt.Errorf("function %s: %w", fn.Name, err)
+		}
+	}
+
+	for _, ev := range events {
+		if err := body.event(ev); err != nil {
+			return nil, fmt.Errorf("event %s: %w", ev.Name, err)
+		}
+	}
+
+	body.p("// call executes a read-only call and checks it returned at least n words")
+	body.p("func (c *%s) call(ctx context.Context, method, data string, n int) ([]string, error) {", typeName)
+	body.p("result, err := c.Backend.Call(ctx, c.Address, data)")
+	body.p("if err != nil {")
+	body.p("return nil, fmt.Errorf(\"calling %%s: %%w\", method, err)")
+	body.p("}")
+	body.p("words, err := evm.ABIWords(result)")
+	body.p("if err != nil {")
+	body.p("return nil, fmt.Errorf(\"decoding %%s result: %%w\", method, err)")
+	body.p("}")
+	body.p("if len(words) < n {")
+	body.p("return nil, fmt.Errorf(\"%%s returned %%d words, want %%d\", method, len(words), n)")
+	body.p("}")
+	body.p("return words, nil")
+	body.p("}")
+
+	g.p("// Code generated by bindgen from %s. DO NOT EDIT.", source)
+	g.p("")
+	g.p("package %s", pkg)
+	g.p("")
+	g.p("import (")
+	g.p("%q", "context")
+	g.p("%q", "fmt")
+	if body.usesBig {
+		g.p("%q", "math/big")
+	}
+	g.p("%q", "strings")
+	g.p("")
+	g.p("%q", "paperhands/api/evm")
+	g.p(")")
+	g.p("")
+	g.b.WriteString(body.b.String())
+
+	return format.Source([]byte(g.b.String()))
+}
+
+func (g *generator) function(fn abiEntry) error {
+	name := goName(fn.Name)
+	sig, _ := signature(fn)
+
+	params := make([]string, len(fn.Inputs))
+	names := make([]string, len(fn.Inputs))
+	for i, in := range fn.Inputs {
+		typ, err := g.goType(in.Type, true)
+		if err != nil {
+			return err
+		}
+		names[i] = paramName(in.Name, i)
+		params[i] = names[i] + " " + typ
+	}
+
+	// Calldata encoder
+	g.p("// Pack%s encodes %s %s call", name, article(sig), sig)
+	g.p("func Pack%s(%s) string {", name, strings.Join(params, ", "))
+	args := []string{name + "Selector"}
+	for i, in := range fn.Inputs {
+		if elem, ok := strings.CutSuffix(in.Type, "[]"); ok {
+			g.p("%sArgs := make([]evm.ABIArg, len(%s))", names[i], names[i])
+			g.p("for i, v := range %s {", names[i])
+			g.p("%sArgs[i] = %s", names[i], encodeExpr(elem, "v"))
+			g.p("}")
+			args = append(args, fmt.Sprintf("evm.ArrayArg(%sArgs...)", names[i]))
+			continue
+		}
+		args = append(args, encodeExpr(in.Type, names[i]))
+	}
+	g.p("return evm.PackCall(%s)", strings.Join(args, ", "))
+	g.p("}")
+	g.p("")
+
+	if fn.StateMutability != "view" && fn.StateMutability != "pure" {
+		g.p("// %s sends %s %s transaction from from and returns its hash", name, article(sig), sig)
+		g.p("func (c *%s) %s(ctx context.Context, from string%s) (string, error) {", g.typeName, name, prefixed(params))
+		g.p("return c.Backend.SendTransaction(ctx, from, c.Address, Pack%s(%s))", name, strings.Join(names, ", "))
+		g.p("}")
+		g.p("")
+		return nil
+	}
+
+	outputs := fn.Outputs
+	structName := ""
+	if len(outputs) == 1 && outputs[0].Type == "tuple" {
+		structName = tupleName(outputs[0])
+		outputs = outputs[0].Components
+	} else if len(outputs) > 1 {
+		structName = name + "Result"
+	}
+	if len(outputs) == 0 {
+		return fmt.Errorf("view function has no outputs")
+	}
+
+	if structName != "" {
+		g.p("// %s is the result of %s", structName, sig)
+		g.p("type %s struct {", structName)
+		for i, out := range outputs {
+			typ, err := g.goType(out.Type, false)
+			if err != nil {
+				return err
+			}
+			g.p("%s %s", fieldName(out.Name, i), typ)
+		}
+		g.p("}")
+		g.p("")
+	}
+
+	resultType := structName
+	if resultType == "" {
+		typ, err := g.goType(outputs[0].Type, false)
+		if err != nil {
+			return err
+		}
+		resultType = typ
+	}
+
+	g.p("// %s calls %s", name, sig)
+	g.p("func (c *%s) %s(ctx context.Context%s) (out %s, err error) {", g.typeName, name, prefixed(params), resultType)
+	g.p("words, err := c.call(ctx, %q, Pack%s(%s), %d)", fn.Name, name, strings.Join(names, ", "), len(outputs))
+	g.p("if err != nil {")
+	g.p("return out, err")
+	g.p("}")
+	if structName == "" {
+		g.p("return %s, nil", decodeExpr(outputs[0].Type, "words[0]"))
+	} else {
+		g.p("return %s{", structName)
+		for i, out := range outputs {
+			g.p("%s: %s,", fieldName(out.Name, i), decodeExpr(out.Type, fmt.Sprintf("words[%d]", i)))
+		}
+		g.p("}, nil")
+	}
+	g.p("}")
+	g.p("")
+	return nil
+}
+
+func (g *generator) event(ev abiEntry) error {
+	name := goName(ev.Name)
+	sig, _ := signature(ev)
+
+	g.p("// %s is %s %s event", name, article(sig), sig)
+	g.p("type %s struct {", name)
+	for i, in := range ev.Inputs {
+		typ, err := g.goType(in.Type, false)
+		if err != nil {
+			return err
+		}
+		g.p("%s %s", fieldName(in.Name, i), typ)
+	}
+	g.p("Raw evm.Log")
+	g.p("}")
+	g.p("")
+
+	topics := 1
+	dataWords := 0
+	for _, in := range ev.Inputs {
+		if in.Indexed {
+			topics++
+		} else {
+			dataWords++
+		}
+	}
+
+	g.p("// Parse%s decodes %s %s log", name, article(ev.Name), ev.Name)
+	g.p("func Parse%s(l evm.Log) (%s, error) {", name, name)
+	g.p("if len(l.Topics) != %d || l.Topics[0] != %sTopic {", topics, name)
+	g.p("return %s{}, fmt.Errorf(\"log %%s:%%d is not a %s event\", l.TxHash, l.LogIndex)", name, ev.Name)
+	g.p("}")
+	if dataWords > 0 {
+		g.p("words, err := evm.ABIWords(l.Data)")
+		g.p("if err != nil {")
+		g.p("return %s{}, fmt.Errorf(\"log %%s:%%d: %%w\", l.TxHash, l.LogIndex, err)", name)
+		g.p("}")
+		g.p("if len(words) != %d {", dataWords)
+		g.p("return %s{}, fmt.Errorf(\"log %%s:%%d has %%d data words, want %d\", l.TxHash, l.LogIndex, len(words))", name, dataWords)
+		g.p("}")
+	}
+	g.p("return %s{", name)
+	topic, word := 1, 0
+	for i, in := range ev.Inputs {
+		src := fmt.Sprintf("l.Topics[%d]", topic)
+		if in.Indexed {
+			topic++
+		} else {
+			src = fmt.Sprintf("words[%d]", word)
+			word++
+		}
+		g.p("%s: %s,", fieldName(in.Name, i), decodeExpr(in.Type, src))
+	}
+	g.p("Raw: l,")
+	g.p("}, nil")
+	g.p("}")
+	g.p("")
+	return nil
+}
+
+// goType maps an ABI type to its Go type. Arrays are only allowed as function inputs.
+func (g *generator) goType(typ string, allowArray bool) (string, error) {
+	if elem, ok := strings.CutSuffix(typ, "[]"); ok {
+		if !allowArray {
+			return "", fmt.Errorf("unsupported output type %s", typ)
+		}
+		elemType, err := g.goType(elem, false)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elemType, nil
+	}
+
+	switch {
+	case typ == "address":
+		return "string", nil
+	case typ == "bool":
+		return "bool", nil
+	case typ == "bytes32":
+		return "[32]byte", nil
+	case strings.HasPrefix(typ, "uint"):
+		g.usesBig = true
+		return "*big.Int", nil
+	}
+	return "", fmt.Errorf("unsupported type %s", typ)
+}
+
+func encodeExpr(typ, value string) string {
+	switch {
+	case typ == "address":
+		return "evm.AddressArg(" + value + ")"
+	case typ == "bool":
+		return "evm.BoolArg(" + value + ")"
+	case typ == "bytes32":
+		return "evm.Bytes32Arg(" + value + ")"
+	}
+	return "evm.UintArg(" + value + ")"
+}
+
+func decodeExpr(typ, word string) string {
+	switch {
+	case typ == "address":
+		return "evm.WordAddress(" + word + ")"
+	case typ == "bool":
+		return "evm.WordBool(" + word + ")"
+	case typ == "bytes32":
+		return "evm.WordBytes32(" + word + ")"
+	}
+	return "evm.WordUint(" + word + ")"
+}
+
+// signature returns the canonical signature of a function or event, e.g. transfer(address,uint256)
+func signature(e abiEntry) (string, error) {
+	types := make([]string, len(e.Inputs))
+	for i, in := range e.Inputs {
+		if strings.HasPrefix(in.Type, "tuple") {
+			return "", fmt.Errorf("%s: tuple inputs are not supported", e.Name)
+		}
+		types[i] = in.Type
+	}
+	return e.Name + "(" + strings.Join(types, ",") + ")", nil
+}
+
+func keccakHex(s string) string {
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// tupleName returns the struct name of a tuple from its internal type, e.g.
+// "struct Disbursement.DisbursementRecord" is DisbursementRecord
+func tupleName(p abiParam) string {
+	name := strings.TrimPrefix(p.InternalType, "struct ")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return goName(name)
+}
+
+// goName converts a Solidity identifier to an exported Go name, e.g. loanIds is LoanIDs
+func goName(name string) string {
+	words := splitWords(strings.TrimLeft(name, "_"))
+	for i, w := range words {
+		switch strings.ToLower(w) {
+		case "id":
+			words[i] = "ID"
+		case "ids":
+			words[i] = "IDs"
+		default:
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
+
+func fieldName(name string, i int) string {
+	if name == "" {
+		return fmt.Sprintf("Field%d", i)
+	}
+	return goName(name)
+}
+
+func paramName(name string, i int) string {
+	if strings.TrimLeft(name, "_") == "" {
+		return fmt.Sprintf("arg%d", i)
+	}
+	exported := goName(name)
+	words := splitWords(exported)
+	words[0] = strings.ToLower(words[0])
+	param := strings.Join(words, "")
+	if reservedNames[param] {
+		param += "Arg"
+	}
+	return param
+}
+
+// splitWords splits a camelCase identifier into words, keeping initialisms such as ID together
+func splitWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1]) {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+// article returns the indefinite article for a word
+func article(word string) string {
+	if strings.ContainsAny(strings.ToLower(word[:1]), "aeiou") {
+		return "an"
+	}
+	return "a"
+}
+
+func prefixed(params []string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(params, ", ")
+}
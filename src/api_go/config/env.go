@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// EnvInt returns the positive integer in the environment variable name, or fallback if it is
+// unset or invalid
+func EnvInt(name string, fallback int) int {
+	if env := os.Getenv(name); env != "" {
+		if parsed, err := strconv.Atoi(env); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// EnvUint returns the positive integer in the environment variable name, or fallback if it is
+// unset or invalid
+func EnvUint(name string, fallback uint64) uint64 {
+	if env := os.Getenv(name); env != "" {
+		if parsed, err := strconv.ParseUint(env, 10, 64); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// EnvFloat returns the positive number in the environment variable name, or fallback if it is
+// unset or invalid
+func EnvFloat(name string, fallback float64) float64 {
+	if env := os.Getenv(name); env != "" {
+		if parsed, err := strconv.ParseFloat(env, 64); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// EnvIntOrZero is EnvInt for values where zero is meaningful, such as a count that disables
+// a feature
+func EnvIntOrZero(name string, fallback int) int {
+	if env := os.Getenv(name); env != "" {
+		if parsed, err := strconv.Atoi(env); err == nil && parsed >= 0 {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// EnvFloatOrZero is EnvFloat for values that may be zero, such as rates and fees
+func EnvFloatOrZero(name string, fallback float64) float64 {
+	if env := os.Getenv(name); env != "" {
+		if parsed, err := strconv.ParseFloat(env, 64); err == nil && parsed >= 0 {
+			return parsed
+		}
+	}
+	return fallback
+}
+
+// EnvSeconds returns the positive number of seconds in the environment variable name as a
+// duration, or fallback if it is unset or invalid
+func EnvSeconds(name string, fallback time.Duration) time.Duration {
+	if seconds := EnvInt(name, 0); seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return fallback
+}
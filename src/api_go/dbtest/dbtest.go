@@ -0,0 +1,275 @@
+// Package dbtest is a scripted database/sql driver for testing code that runs SQL against
+// config.DB or a *sql.DB without a database. Each statement must match the next expectation,
+// in order; rollbacks are always accepted and need not be scripted.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Any matches any argument value
+var Any = anyArg{}
+
+type anyArg struct{}
+
+type kind string
+
+const (
+	kindBegin  kind = "BEGIN"
+	kindCommit kind = "COMMIT"
+	kindQuery  kind = "query"
+	kindExec   kind = "exec"
+)
+
+// Expectation is a statement the code under test is expected to run
+type Expectation struct {
+	kind     kind
+	fragment string
+	args     []interface{}
+	checkArg bool
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+	err      error
+}
+
+// WithArgs requires the statement's arguments to equal args. Any matches any value.
+func (e *Expectation) WithArgs(args ...interface{}) *Expectation {
+	e.args = args
+	e.checkArg = true
+	return e
+}
+
+// WillReturnRows makes a query return rows with the given columns
+func (e *Expectation) WillReturnRows(columns []string, rows ...[]interface{}) *Expectation {
+	e.columns = columns
+	for _, row := range rows {
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			converted, err := driver.DefaultParameterConverter.ConvertValue(v)
+			if err != nil {
+				panic(fmt.Sprintf("dbtest: unsupported row value %#v: %v", v, err))
+			}
+			values[i] = converted
+		}
+		e.rows = append(e.rows, values)
+	}
+	return e
+}
+
+// WillAffect makes an exec report n affected rows
+func (e *Expectation) WillAffect(n int64) *Expectation {
+	e.affected = n
+	return e
+}
+
+// WillReturnError makes the statement fail with err
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Mock holds the expected statements of a test
+type Mock struct {
+	t        testing.TB
+	mu       sync.Mutex
+	expected []*Expectation
+}
+
+// New returns a database backed by a new Mock. Unmet expectations fail the test when it ends.
+func New(t testing.TB) (*sql.DB, *Mock) {
+	m := &Mock{t: t}
+	db := sql.OpenDB(connector{m})
+	t.Cleanup(func() {
+		db.Close()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for _, e := range m.expected {
+			t.Errorf("dbtest: expected %s %q was not run", e.kind, e.fragment)
+		}
+	})
+	return db, m
+}
+
+// ExpectBegin expects a transaction to start
+func (m *Mock) ExpectBegin() {
+	m.expect(&Expectation{kind: kindBegin})
+}
+
+// ExpectCommit expects the transaction to commit
+func (m *Mock) ExpectCommit() {
+	m.expect(&Expectation{kind: kindCommit})
+}
+
+// ExpectQuery expects a query containing fragment, ignoring differences in whitespace
+func (m *Mock) ExpectQuery(fragment string) *Expectation {
+	return m.expect(&Expectation{kind: kindQuery, fragment: fragment})
+}
+
+// ExpectExec expects a statement containing fragment, ignoring differences in whitespace
+func (m *Mock) ExpectExec(fragment string) *Expectation {
+	return m.expect(&Expectation{kind: kindExec, fragment: fragment, affected: 1})
+}
+
+func (m *Mock) expect(e *Expectation) *Expectation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expected = append(m.expected, e)
+	return e
+}
+
+// next pops the next expectation and checks the statement against it
+func (m *Mock) next(k kind, query string, args []driver.NamedValue) (*Expectation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.expected) == 0 {
+		m.t.Errorf("dbtest: unexpected %s %s", k, squash(query))
+		return nil, fmt.Errorf("dbtest: unexpected %s", k)
+	}
+
+	e := m.expected[0]
+	if e.kind != k || !strings.Contains(squash(query), squash(e.fragment)) {
+		m.t.Errorf("dbtest: got %s %s, want %s %q", k, squash(query), e.kind, e.fragment)
+		return nil, fmt.Errorf("dbtest: unexpected %s", k)
+	}
+	m.expected = m.expected[1:]
+
+	if e.checkArg {
+		if len(args) != len(e.args) {
+			m.t.Errorf("dbtest: %q got %d args, want %d", e.fragment, len(args), len(e.args))
+			return nil, errors.New("dbtest: argument mismatch")
+		}
+		for i, want := range e.args {
+			if !argEqual(want, args[i].Value) {
+				m.t.Errorf("dbtest: %q arg $%d = %#v, want %#v", e.fragment, i+1, args[i].Value, want)
+				return nil, errors.New("dbtest: argument mismatch")
+			}
+		}
+	}
+
+	return e, e.err
+}
+
+func argEqual(want interface{}, got driver.Value) bool {
+	if _, ok := want.(anyArg); ok {
+		return true
+	}
+	converted, err := driver.DefaultParameterConverter.ConvertValue(want)
+	if err == nil {
+		want = converted
+	}
+	if reflect.DeepEqual(want, got) {
+		return true
+	}
+	return fmt.Sprint(want) == fmt.Sprint(got)
+}
+
+func squash(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+type connector struct{ m *Mock }
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return &conn{c.m}, nil }
+func (c connector) Driver() driver.Driver                        { return drv{c.m} }
+
+type drv struct{ m *Mock }
+
+func (d drv) Open(string) (driver.Conn, error) { return &conn{d.m}, nil }
+
+type conn struct{ m *Mock }
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) { return &stmt{c, query}, nil }
+func (c *conn) Close() error                              { return nil }
+func (c *conn) Begin() (driver.Tx, error)                 { return c.BeginTx(context.Background(), driver.TxOptions{}) }
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	if _, err := c.m.next(kindBegin, "", nil); err != nil {
+		return nil, err
+	}
+	return tx{c.m}, nil
+}
+
+// CheckNamedValue passes through values the default converter rejects, e.g. *big.Int
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if converted, err := driver.DefaultParameterConverter.ConvertValue(nv.Value); err == nil {
+		nv.Value = converted
+	}
+	return nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	e, err := c.m.next(kindQuery, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{columns: e.columns, values: e.rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, err := c.m.next(kindExec, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(e.affected), nil
+}
+
+type stmt struct {
+	c     *conn
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return nv
+}
+
+type tx struct{ m *Mock }
+
+func (t tx) Commit() error {
+	_, err := t.m.next(kindCommit, "", nil)
+	return err
+}
+
+func (t tx) Rollback() error { return nil }
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
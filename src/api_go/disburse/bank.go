@@ -0,0 +1,200 @@
+package disburse
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"paperhands/api/models"
+	"paperhands/api/oracle"
+)
+
+// BankRail pays AUD by bank transfer from the Independent Reserve account. The exchange only
+// pays bank accounts registered with it, so a payout's recipient is the GUID of the
+// borrower's registered account.
+type BankRail struct {
+	URL        string
+	APIKey     string
+	APISecret  string
+	HTTPClient *http.Client
+	// UseNPP sends payouts over the New Payments Platform, which settles in minutes
+	UseNPP bool
+
+	mu        sync.Mutex
+	lastNonce int64
+}
+
+type irAccount struct {
+	CurrencyCode     string  `json:"currencyCode"`
+	AvailableBalance float64 `json:"availableBalance"`
+}
+
+type irFiatWithdrawal struct {
+	FiatWithdrawalRequestGUID string `json:"fiatWithdrawalRequestGuid"`
+	Status                    string `json:"status"`
+}
+
+// NewBankRailFromEnv creates a rail using the IR_API_KEY and IR_API_SECRET credentials against
+// IR_API_URL (default the public API). It returns nil if no credentials are configured.
+func NewBankRailFromEnv() *BankRail {
+	key := os.Getenv("IR_API_KEY")
+	secret := os.Getenv("IR_API_SECRET")
+	if key == "" || secret == "" {
+		return nil
+	}
+
+	url := os.Getenv("IR_API_URL")
+	if url == "" {
+		url = oracle.DefaultIndependentReserveURL
+	}
+
+	return &BankRail{
+		URL:        strings.TrimRight(url, "/"),
+		APIKey:     key,
+		APISecret:  secret,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		UseNPP:     true,
+	}
+}
+
+func (r *BankRail) Method() string { return models.DisbursementMethodAPI }
+
+// Disburse requests a fiat withdrawal to the recipient bank account and returns its GUID. The
+// loan ID is passed as the withdrawal comment so payouts can be matched on the exchange.
+func (r *BankRail) Disburse(ctx context.Context, d models.Disbursement) (string, error) {
+	var withdrawal irFiatWithdrawal
+	err := r.privateRequest(ctx, "/Private/WithdrawFiatCurrency", map[string]interface{}{
+		"secondaryCurrencyCode": "Aud",
+		"withdrawalAmount":      json.Number(strconv.FormatFloat(d.AmountAUD, 'f', 2, 64)),
+		"fiatBankAccountGuid":   d.RecipientAddress,
+		"useNpp":                r.UseNPP,
+		"comment":               fmt.Sprintf("PaperHands loan %d", d.LoanID),
+	}, &withdrawal)
+	if err != nil {
+		return "", err
+	}
+
+	if withdrawal.FiatWithdrawalRequestGUID == "" {
+		return "", fmt.Errorf("independent reserve returned no withdrawal ID")
+	}
+	return withdrawal.FiatWithdrawalRequestGUID, nil
+}
+
+// Status maps the exchange's withdrawal status to a disbursement status
+func (r *BankRail) Status(ctx context.Context, d models.Disbursement) (Result, error) {
+	var withdrawal irFiatWithdrawal
+	err := r.privateRequest(ctx, "/Private/GetFiatWithdrawal", map[string]interface{}{
+		"fiatWithdrawalRequestGuid": d.TxHash.String,
+	}, &withdrawal)
+	if err != nil {
+		return Result{}, err
+	}
+
+	switch strings.ToLower(withdrawal.Status) {
+	case "completed":
+		return completed(), nil
+	case "rejected", "cancelled", "failed":
+		return failed(fmt.Sprintf("withdrawal %s %s", d.TxHash.String, strings.ToLower(withdrawal.Status))), nil
+	}
+	return processing(), nil
+}
+
+// Balance returns the available AUD balance of the exchange account
+func (r *BankRail) Balance(ctx context.Context) (float64, error) {
+	var accounts []irAccount
+	if err := r.privateRequest(ctx, "/Private/GetAccounts", nil, &accounts); err != nil {
+		return 0, err
+	}
+
+	for _, account := range accounts {
+		if strings.EqualFold(account.CurrencyCode, "Aud") {
+			return account.AvailableBalance, nil
+		}
+	}
+	return 0, fmt.Errorf("independent reserve account has no AUD balance")
+}
+
+// privateRequest posts params to an authenticated endpoint. Requests are signed with an
+// HMAC-SHA256 of the URL followed by the parameters as key=value pairs sorted by key.
+func (r *BankRail) privateRequest(ctx context.Context, endpoint string, params map[string]interface{}, result interface{}) error {
+	url := r.URL + endpoint
+
+	body := map[string]interface{}{
+		"apiKey": r.APIKey,
+		"nonce":  r.nonce(),
+	}
+	for key, value := range params {
+		body[key] = value
+	}
+
+	keys := make([]string, 0, len(body))
+	for key := range body {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	message := []string{url}
+	for _, key := range keys {
+		message = append(message, fmt.Sprintf("%s=%v", key, body[key]))
+	}
+
+	mac := hmac.New(sha256.New, []byte(r.APISecret))
+	mac.Write([]byte(strings.Join(message, ",")))
+	body["signature"] = hex.EncodeToString(mac.Sum(nil))
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("independent reserve %s: status %d: %s", endpoint, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("parsing independent reserve %s response: %w", endpoint, err)
+	}
+	return nil
+}
+
+// nonce returns a strictly increasing nonce based on the current time in milliseconds
+func (r *BankRail) nonce() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	nonce := time.Now().UnixMilli()
+	if nonce <= r.lastNonce {
+		nonce = r.lastNonce + 1
+	}
+	r.lastNonce = nonce
+	return nonce
+}
@@ -0,0 +1,188 @@
+package disburse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/evm"
+	"paperhands/api/evm/disbursement"
+	"paperhands/api/models"
+)
+
+// ContractRail pays AUD stablecoins to the borrower's wallet through the Disbursement
+// contract. The contract only accepts calls from its owner, whose key is held by the node or
+// an external signer behind it rather than by the server.
+type ContractRail struct {
+	Backend evm.TxSender
+	// Contract is the Disbursement contract address
+	Contract string
+	// Owner is the contract owner the disburse calls are sent from
+	Owner string
+	// Token is the AUD stablecoin the contract pays out
+	Token evm.Token
+	// FromBlock is the block the contract was deployed in; retries look for an earlier payout
+	// from here so a loan is not paid twice
+	FromBlock        uint64
+	MinConfirmations uint64
+	// ReceiptTimeout is how long a sent payout may go without a receipt before it is failed,
+	// e.g. because the transaction was dropped from the mempool
+	ReceiptTimeout time.Duration
+	// BatchBlocks is the number of blocks requested per eth_getLogs call
+	BatchBlocks uint64
+}
+
+// NewContractRailFromEnv creates a rail calling DISBURSEMENT_CONTRACT_ADDRESS from
+// DISBURSEMENT_OWNER_ADDRESS, deployed at DISBURSEMENT_FROM_BLOCK (default 0). Payouts are in
+// AAUD and complete after DISBURSEMENT_MIN_CONFIRMATIONS (default 12), or fail if they have no
+// receipt after DISBURSEMENT_RECEIPT_TIMEOUT_MINUTES (default 30). Logs are fetched
+// EVM_LOG_BATCH_BLOCKS (default 2000) at a time. It returns nil if the contract, owner or AAUD
+// token is not configured.
+func NewContractRailFromEnv(backend evm.TxSender) *ContractRail {
+	contract := strings.ToLower(os.Getenv("DISBURSEMENT_CONTRACT_ADDRESS"))
+	owner := strings.ToLower(os.Getenv("DISBURSEMENT_OWNER_ADDRESS"))
+	if contract == "" || owner == "" {
+		return nil
+	}
+
+	token, ok := aaudToken()
+	if !ok {
+		log.Println("On-chain disbursements disabled: TOKEN_AAUD_ADDRESS not configured")
+		return nil
+	}
+
+	return &ContractRail{
+		Backend:          backend,
+		Contract:         contract,
+		Owner:            owner,
+		Token:            token,
+		FromBlock:        config.EnvUint("DISBURSEMENT_FROM_BLOCK", 0),
+		MinConfirmations: config.EnvUint("DISBURSEMENT_MIN_CONFIRMATIONS", 12),
+		ReceiptTimeout:   time.Duration(config.EnvInt("DISBURSEMENT_RECEIPT_TIMEOUT_MINUTES", 30)) * time.Minute,
+		BatchBlocks:      config.EnvUint("EVM_LOG_BATCH_BLOCKS", 2000),
+	}
+}
+
+func (r *ContractRail) Method() string { return models.DisbursementMethodOnChain }
+
+// Disburse calls disburse(loanId, recipient, amount) on the contract. On a retry, if the
+// contract already emitted a DisbursementCreated event for the loan, e.g. because an earlier
+// attempt was mined after it timed out, that transaction is returned instead of paying again.
+func (r *ContractRail) Disburse(ctx context.Context, d models.Disbursement) (string, error) {
+	if d.Attempts > 1 {
+		existing, err := r.findPayout(ctx, d.LoanID)
+		if err != nil {
+			return "", err
+		}
+		if existing != "" {
+			log.Printf("Disbursement %d of loan %d already paid on chain in %s", d.ID, d.LoanID, existing)
+			return existing, nil
+		}
+	}
+
+	amount := r.Token.BaseUnits(d.AmountAUD)
+	if amount.Sign() <= 0 {
+		return "", fmt.Errorf("invalid disbursement amount %.2f", d.AmountAUD)
+	}
+
+	contract := disbursement.NewDisbursement(r.Contract, r.Backend)
+	txHash, err := contract.Disburse(ctx, r.Owner, disbursement.LoanID(d.LoanID), d.RecipientAddress, amount)
+	if err != nil {
+		return "", fmt.Errorf("sending disburse transaction: %w", err)
+	}
+
+	return txHash, nil
+}
+
+// Status completes a payout once its transaction has MinConfirmations and fails it if the
+// transaction reverted or has had no receipt for ReceiptTimeout since it was sent. A failed
+// payout is safe to retry: Disburse looks for an earlier payout for the loan first.
+func (r *ContractRail) Status(ctx context.Context, d models.Disbursement) (Result, error) {
+	receipt, err := r.Backend.TransactionReceipt(ctx, d.TxHash.String)
+	if errors.Is(err, evm.ErrNotFound) {
+		// The reference is recorded as the payout is sent, so updated_at is the send time
+		if r.ReceiptTimeout > 0 && time.Since(d.UpdatedAt) > r.ReceiptTimeout {
+			return failed(fmt.Sprintf("transaction %s not mined within %s", d.TxHash.String, r.ReceiptTimeout)), nil
+		}
+		return processing(), nil
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("fetching receipt: %w", err)
+	}
+
+	if !receipt.Success {
+		return failed(fmt.Sprintf("transaction %s reverted", receipt.TxHash)), nil
+	}
+
+	latest, err := r.Backend.BlockNumber(ctx)
+	if err != nil {
+		return Result{}, fmt.Errorf("fetching latest block: %w", err)
+	}
+	if evm.Confirmations(receipt.BlockNumber, latest) < r.MinConfirmations {
+		return processing(), nil
+	}
+
+	return completed(), nil
+}
+
+// Balance returns the contract's stablecoin balance
+func (r *ContractRail) Balance(ctx context.Context) (float64, error) {
+	balance, err := r.Backend.TokenBalance(ctx, r.Token.Contract, r.Contract)
+	if err != nil {
+		return 0, err
+	}
+	return r.Token.Amount(balance), nil
+}
+
+// findPayout returns the transaction of the contract's DisbursementCreated event for a loan,
+// or "" if it has not been paid
+func (r *ContractRail) findPayout(ctx context.Context, loanID int) (string, error) {
+	latest, err := r.Backend.BlockNumber(ctx)
+	if err != nil {
+		return "", fmt.Errorf("fetching latest block: %w", err)
+	}
+
+	for from := r.FromBlock; from <= latest; from += r.BatchBlocks {
+		to := from + r.BatchBlocks - 1
+		if to > latest {
+			to = latest
+		}
+
+		logs, err := r.Backend.Logs(ctx, evm.FilterQuery{
+			FromBlock: from,
+			ToBlock:   to,
+			Addresses: []string{r.Contract},
+			Topics: [][]string{
+				{disbursement.DisbursementCreatedTopic},
+				{},
+				{disbursement.LoanIDTopic(loanID)},
+			},
+		})
+		if err != nil {
+			return "", fmt.Errorf("fetching disbursement events: %w", err)
+		}
+
+		for _, l := range logs {
+			if !l.Removed {
+				return l.TxHash, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// aaudToken returns the AUD stablecoin the Disbursement contract pays out, if configured
+func aaudToken() (evm.Token, bool) {
+	for _, t := range evm.TokensFromEnv() {
+		if t.Symbol == "AAUD" {
+			return t, true
+		}
+	}
+	return evm.Token{}, false
+}
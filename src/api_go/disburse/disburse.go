@@ -0,0 +1,41 @@
+package disburse
+
+import (
+	"context"
+
+	"paperhands/api/models"
+)
+
+// Disburser is a payout rail that sends a loan's principal to the borrower
+type Disburser interface {
+	// Method returns the disbursement method the rail handles
+	Method() string
+	// Disburse sends the payout of d and returns the reference to track it by: a transaction
+	// hash or the payment provider's ID. It may be called again for a payout whose previous
+	// attempt failed.
+	Disburse(ctx context.Context, d models.Disbursement) (string, error)
+	// Status reports the state of a payout sent by Disburse
+	Status(ctx context.Context, d models.Disbursement) (Result, error)
+	// Balance returns the AUD available to the rail for payouts
+	Balance(ctx context.Context) (float64, error)
+}
+
+// Result is the state of a sent payout
+type Result struct {
+	// Status is processing, completed or failed
+	Status string
+	// Reason explains why a payout failed
+	Reason string
+}
+
+func processing() Result {
+	return Result{Status: models.DisbursementStatusProcessing}
+}
+
+func completed() Result {
+	return Result{Status: models.DisbursementStatusCompleted}
+}
+
+func failed(reason string) Result {
+	return Result{Status: models.DisbursementStatusFailed, Reason: reason}
+}
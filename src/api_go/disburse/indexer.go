@@ -0,0 +1,340 @@
+package disburse
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/evm"
+	"paperhands/api/evm/disbursement"
+	"paperhands/api/models"
+	"paperhands/api/services"
+)
+
+// indexerCursor names the scan cursor of the disbursement indexer
+const indexerCursor = "disbursement_contract"
+
+// Indexer follows the Disbursement contract's DisbursementCompleted events and reconciles each
+// payout against the disbursements table. A payout whose transaction no disbursement records,
+// e.g. one sent outside the API or a retry that paid a loan twice, is stored as unmatched and
+// logged; unmatched and mismatched payouts are reconciled again on every poll until they match.
+type Indexer struct {
+	DB      *sql.DB
+	Backend evm.Backend
+	// Contract is the Disbursement contract address
+	Contract string
+	// Token is the AUD stablecoin the contract pays out
+	Token            evm.Token
+	Interval         time.Duration
+	MinConfirmations uint64
+	// StartBlock is where indexing starts when there is no cursor, normally the block the
+	// contract was deployed in
+	StartBlock uint64
+	// BatchBlocks is the number of blocks requested per eth_getLogs call
+	BatchBlocks uint64
+}
+
+// NewIndexerFromEnv creates an indexer for DISBURSEMENT_CONTRACT_ADDRESS paying out AAUD,
+// polling every DISBURSEMENT_INDEX_INTERVAL_SECONDS (default 30). Events are indexed from
+// DISBURSEMENT_FROM_BLOCK (default 0) once they have DISBURSEMENT_MIN_CONFIRMATIONS (default
+// 12), EVM_LOG_BATCH_BLOCKS (default 2000) blocks at a time.
+func NewIndexerFromEnv(db *sql.DB, backend evm.Backend) *Indexer {
+	token, _ := aaudToken()
+
+	return &Indexer{
+		DB:               db,
+		Backend:          backend,
+		Contract:         strings.ToLower(os.Getenv("DISBURSEMENT_CONTRACT_ADDRESS")),
+		Token:            token,
+		Interval:         config.EnvSeconds("DISBURSEMENT_INDEX_INTERVAL_SECONDS", 30*time.Second),
+		MinConfirmations: config.EnvUint("DISBURSEMENT_MIN_CONFIRMATIONS", 12),
+		StartBlock:       config.EnvUint("DISBURSEMENT_FROM_BLOCK", 0),
+		BatchBlocks:      config.EnvUint("EVM_LOG_BATCH_BLOCKS", 2000),
+	}
+}
+
+// Run indexes until ctx is cancelled. It returns immediately if the contract or AAUD token is
+// not configured.
+func (i *Indexer) Run(ctx context.Context) {
+	if i.Contract == "" {
+		log.Println("Disbursement indexer disabled: DISBURSEMENT_CONTRACT_ADDRESS not configured")
+		return
+	}
+	if i.Token.Contract == "" {
+		log.Println("Disbursement indexer disabled: TOKEN_AAUD_ADDRESS not configured")
+		return
+	}
+
+	log.Printf("Disbursement indexer started for %s (interval %s, %d confirmations)", i.Contract, i.Interval, i.MinConfirmations)
+
+	ticker := time.NewTicker(i.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := i.Poll(ctx); err != nil {
+			log.Printf("Disbursement indexer poll failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Disbursement indexer stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll reconciles the payouts that did not match last time, then indexes the payouts in
+// blocks that have reached MinConfirmations since the last poll
+func (i *Indexer) Poll(ctx context.Context) error {
+	if err := i.recheck(ctx); err != nil {
+		return err
+	}
+
+	latest, err := i.Backend.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching latest block: %w", err)
+	}
+	// The newest block with MinConfirmations, counting the block a payout is in
+	confirmed := latest
+	if i.MinConfirmations > 1 {
+		if latest < i.MinConfirmations {
+			return nil
+		}
+		confirmed = latest - i.MinConfirmations + 1
+	}
+
+	cursor, err := i.cursor(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Only confirmed blocks are indexed, so stored payouts are never reorganised away
+	for from := cursor + 1; from <= confirmed; from += i.BatchBlocks {
+		to := from + i.BatchBlocks - 1
+		if to > confirmed {
+			to = confirmed
+		}
+
+		logs, err := i.Backend.Logs(ctx, evm.FilterQuery{
+			FromBlock: from,
+			ToBlock:   to,
+			Addresses: []string{i.Contract},
+			Topics:    [][]string{{disbursement.DisbursementCompletedTopic}},
+		})
+		if err != nil {
+			return fmt.Errorf("fetching logs for blocks %d-%d: %w", from, to, err)
+		}
+
+		for _, l := range logs {
+			if err := i.record(ctx, l); err != nil {
+				return fmt.Errorf("recording payout %s:%d: %w", l.TxHash, l.LogIndex, err)
+			}
+		}
+
+		if err := i.setCursor(ctx, to); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// record reconciles and stores the payout of a DisbursementCompleted log
+func (i *Indexer) record(ctx context.Context, l evm.Log) error {
+	ev, err := disbursement.ParseDisbursementCompleted(l)
+	if err != nil {
+		return err
+	}
+
+	o := models.OnChainDisbursement{
+		ContractDisbursementID: "0x" + hex.EncodeToString(ev.DisbursementID[:]),
+		ContractLoanID:         "0x" + hex.EncodeToString(ev.LoanID[:]),
+		RecipientAddress:       ev.Recipient,
+		Amount:                 i.Token.Amount(ev.Amount),
+		AmountBaseUnits:        ev.Amount.String(),
+		TxHash:                 l.TxHash,
+		LogIndex:               int(l.LogIndex),
+		BlockNumber:            int64(l.BlockNumber),
+	}
+	if err := i.reconcile(ctx, &o); err != nil {
+		return err
+	}
+
+	o, created, err := services.RecordOnChainDisbursement(i.DB, o)
+	if err != nil {
+		return err
+	}
+	if created && o.Status != models.OnChainDisbursementMatched {
+		log.Printf("Warning: on-chain payout %s:%d of %.2f %s to %s is %s: %s",
+			o.TxHash, o.LogIndex, o.Amount, i.Token.Symbol, o.RecipientAddress, o.Status, o.Reason.String)
+	}
+	return nil
+}
+
+// recheck reconciles the payouts that are unmatched or mismatched again, e.g. because the
+// processor had not yet recorded the payout's transaction when it was indexed
+func (i *Indexer) recheck(ctx context.Context) error {
+	rows, err := i.DB.QueryContext(ctx,
+		"SELECT "+services.OnChainDisbursementColumns+" FROM onchain_disbursements WHERE status != $1 ORDER BY id",
+		models.OnChainDisbursementMatched,
+	)
+	if err != nil {
+		return fmt.Errorf("querying unmatched payouts: %w", err)
+	}
+	defer rows.Close()
+
+	var payouts []models.OnChainDisbursement
+	for rows.Next() {
+		o, err := services.ScanOnChainDisbursement(rows)
+		if err != nil {
+			return fmt.Errorf("scanning payout: %w", err)
+		}
+		payouts = append(payouts, o)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range payouts {
+		previous := o
+		if err := i.reconcile(ctx, &o); err != nil {
+			log.Printf("Error reconciling on-chain payout %s:%d: %v", o.TxHash, o.LogIndex, err)
+			continue
+		}
+		if o.Status == previous.Status && o.Reason == previous.Reason &&
+			o.LoanID == previous.LoanID && o.DisbursementID == previous.DisbursementID {
+			continue
+		}
+
+		if err := services.UpdateOnChainDisbursementReconciliation(i.DB, o); err != nil {
+			log.Printf("Error updating on-chain payout %s:%d: %v", o.TxHash, o.LogIndex, err)
+			continue
+		}
+		if o.Status == models.OnChainDisbursementMatched {
+			log.Printf("On-chain payout %s:%d now matches disbursement %d", o.TxHash, o.LogIndex, o.DisbursementID.Int64)
+		}
+	}
+
+	return nil
+}
+
+// reconcile sets the loan, disbursement, status and reason of a payout. A payout matches the
+// on_chain disbursement that records its transaction if they agree on the loan, recipient and
+// amount.
+func (i *Indexer) reconcile(ctx context.Context, o *models.OnChainDisbursement) error {
+	o.LoanID = sql.NullInt64{}
+	o.DisbursementID = sql.NullInt64{}
+	o.Reason = sql.NullString{}
+
+	loanID, ok := disbursement.DecodeLoanID(evm.WordBytes32(o.ContractLoanID))
+	if ok {
+		var exists bool
+		if err := i.DB.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM loans WHERE id = $1)", loanID).Scan(&exists); err != nil {
+			return fmt.Errorf("looking up loan %d: %w", loanID, err)
+		}
+		if exists {
+			o.LoanID = sql.NullInt64{Int64: int64(loanID), Valid: true}
+		}
+	}
+
+	amount, ok := new(big.Int).SetString(o.AmountBaseUnits, 10)
+	if !ok {
+		return fmt.Errorf("invalid amount %q", o.AmountBaseUnits)
+	}
+
+	d, err := services.GetDisbursementByTxHash(i.DB, models.DisbursementMethodOnChain, o.TxHash, loanID)
+	switch {
+	case err == nil:
+		o.DisbursementID = sql.NullInt64{Int64: int64(d.ID), Valid: true}
+
+		var problems []string
+		if !o.LoanID.Valid || int(o.LoanID.Int64) != d.LoanID {
+			problems = append(problems, fmt.Sprintf("paid loanId %s but disbursement %d is for loan %d", o.ContractLoanID, d.ID, d.LoanID))
+		}
+		if !strings.EqualFold(o.RecipientAddress, d.RecipientAddress) {
+			problems = append(problems, fmt.Sprintf("paid %s but disbursement %d is to %s", o.RecipientAddress, d.ID, d.RecipientAddress))
+		}
+		if expected := i.Token.BaseUnits(d.AmountAUD); expected.Cmp(amount) != 0 {
+			problems = append(problems, fmt.Sprintf("paid %s base units but disbursement %d is for %s", amount, d.ID, expected))
+		}
+
+		o.Status = models.OnChainDisbursementMatched
+		if len(problems) > 0 {
+			o.Status = models.OnChainDisbursementMismatch
+			o.Reason = sql.NullString{String: strings.Join(problems, "; "), Valid: true}
+		}
+		return nil
+	case !errors.Is(err, services.ErrDisbursementNotFound):
+		return fmt.Errorf("looking up disbursement of %s: %w", o.TxHash, err)
+	}
+
+	o.Status = models.OnChainDisbursementUnmatched
+	reason, err := i.unmatchedReason(o)
+	if err != nil {
+		return err
+	}
+	o.Reason = sql.NullString{String: reason, Valid: true}
+	return nil
+}
+
+// unmatchedReason explains why no disbursement records a payout's transaction
+func (i *Indexer) unmatchedReason(o *models.OnChainDisbursement) (string, error) {
+	if !o.LoanID.Valid {
+		return fmt.Sprintf("loanId %s is not a loan", o.ContractLoanID), nil
+	}
+
+	d, err := services.GetLoanDisbursement(i.DB, int(o.LoanID.Int64))
+	if errors.Is(err, services.ErrDisbursementNotFound) {
+		return fmt.Sprintf("loan %d has no disbursement", o.LoanID.Int64), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("looking up disbursement of loan %d: %w", o.LoanID.Int64, err)
+	}
+
+	o.DisbursementID = sql.NullInt64{Int64: int64(d.ID), Valid: true}
+	switch {
+	case d.Method != models.DisbursementMethodOnChain:
+		return fmt.Sprintf("loan %d was disbursed via %s by disbursement %d", d.LoanID, d.Method, d.ID), nil
+	case d.TxHash.Valid:
+		return fmt.Sprintf("disbursement %d of loan %d was paid in %s", d.ID, d.LoanID, d.TxHash.String), nil
+	}
+	return fmt.Sprintf("disbursement %d of loan %d is %s with no transaction recorded", d.ID, d.LoanID, d.Status), nil
+}
+
+// cursor returns the last block indexed, starting from StartBlock the first time
+func (i *Indexer) cursor(ctx context.Context) (uint64, error) {
+	var block int64
+	err := i.DB.QueryRowContext(ctx, "SELECT block_number FROM evm_scan_cursors WHERE name = $1", indexerCursor).Scan(&block)
+	if err == nil {
+		return uint64(block), nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("reading scan cursor: %w", err)
+	}
+
+	if i.StartBlock == 0 {
+		return 0, nil
+	}
+	return i.StartBlock - 1, nil
+}
+
+func (i *Indexer) setCursor(ctx context.Context, block uint64) error {
+	_, err := i.DB.ExecContext(ctx, `
+		INSERT INTO evm_scan_cursors (name, block_number)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET block_number = EXCLUDED.block_number, updated_at = NOW()
+	`, indexerCursor, int64(block))
+	if err != nil {
+		return fmt.Errorf("saving scan cursor: %w", err)
+	}
+	return nil
+}
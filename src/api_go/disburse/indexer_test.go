@@ -0,0 +1,251 @@
+package disburse
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"paperhands/api/dbtest"
+	"paperhands/api/evm"
+	"paperhands/api/evm/disbursement"
+	"paperhands/api/models"
+)
+
+var (
+	aaud = evm.Token{Symbol: "AAUD", Contract: "0x" + strings.Repeat("aa", 20), Decimals: 6}
+
+	borrower = "0x" + strings.Repeat("11", 20)
+	stranger = "0x" + strings.Repeat("33", 20)
+
+	payoutHash = "0x" + strings.Repeat("d1", 32)
+	otherHash  = "0x" + strings.Repeat("d2", 32)
+
+	disbursementColumns = []string{
+		"id", "loan_id", "customer_id", "amount_aud", "method", "status", "recipient_address", "tx_hash",
+		"error_message", "attempts", "next_attempt_at", "completed_at", "created_by", "created_at", "updated_at",
+	}
+)
+
+// payout is a DisbursementCompleted payout of amount base units of AAUD to recipient for loanID
+func payout(loanID int, recipient, amount string) models.OnChainDisbursement {
+	return models.OnChainDisbursement{
+		ContractDisbursementID: "0x" + strings.Repeat("e1", 32),
+		ContractLoanID:         disbursement.LoanIDTopic(loanID),
+		RecipientAddress:       recipient,
+		AmountBaseUnits:        amount,
+		TxHash:                 payoutHash,
+		LogIndex:               2,
+		BlockNumber:            500,
+	}
+}
+
+// disbursementRow is a disbursements row selected with services.DisbursementColumns
+func disbursementRow(id, loanID int, method, status string, amountAUD float64, txHash interface{}) []interface{} {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	return []interface{}{
+		id, loanID, 42, amountAUD, method, status, borrower, txHash,
+		nil, 1, nil, nil, nil, now, now,
+	}
+}
+
+// expectLoan scripts the lookup of whether loanID is a loan
+func expectLoan(mock *dbtest.Mock, loanID int, exists bool) {
+	mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM loans WHERE id = $1)").
+		WithArgs(loanID).
+		WillReturnRows([]string{"exists"}, []interface{}{exists})
+}
+
+// expectByTxHash scripts the lookup of the disbursement recording the payout's transaction
+func expectByTxHash(mock *dbtest.Mock, loanID int, rows ...[]interface{}) {
+	mock.ExpectQuery("FROM disbursements WHERE method = $1 AND tx_hash = $2").
+		WithArgs(models.DisbursementMethodOnChain, payoutHash, loanID).
+		WillReturnRows(disbursementColumns, rows...)
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name               string
+		payout             models.OnChainDisbursement
+		script             func(mock *dbtest.Mock)
+		wantStatus         string
+		wantLoanID         int64
+		wantDisbursementID int64
+		wantReason         string
+	}{
+		{
+			name:   "matched",
+			payout: payout(7, borrower, "2500000000"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 7, true)
+				expectByTxHash(mock, 7, disbursementRow(3, 7, models.DisbursementMethodOnChain, models.DisbursementStatusProcessing, 2500, payoutHash))
+			},
+			wantStatus:         models.OnChainDisbursementMatched,
+			wantLoanID:         7,
+			wantDisbursementID: 3,
+		},
+		{
+			name:   "recipient differs only in case",
+			payout: payout(7, strings.ToUpper(borrower), "2500000000"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 7, true)
+				expectByTxHash(mock, 7, disbursementRow(3, 7, models.DisbursementMethodOnChain, models.DisbursementStatusCompleted, 2500, payoutHash))
+			},
+			wantStatus:         models.OnChainDisbursementMatched,
+			wantLoanID:         7,
+			wantDisbursementID: 3,
+		},
+		{
+			name:   "mismatched recipient and amount",
+			payout: payout(7, stranger, "2600000000"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 7, true)
+				expectByTxHash(mock, 7, disbursementRow(3, 7, models.DisbursementMethodOnChain, models.DisbursementStatusProcessing, 2500, payoutHash))
+			},
+			wantStatus:         models.OnChainDisbursementMismatch,
+			wantLoanID:         7,
+			wantDisbursementID: 3,
+			wantReason: "paid " + stranger + " but disbursement 3 is to " + borrower +
+				"; paid 2600000000 base units but disbursement 3 is for 2500000000",
+		},
+		{
+			name:   "mismatched short payment",
+			payout: payout(7, borrower, "2499999999"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 7, true)
+				expectByTxHash(mock, 7, disbursementRow(3, 7, models.DisbursementMethodOnChain, models.DisbursementStatusProcessing, 2500, payoutHash))
+			},
+			wantStatus:         models.OnChainDisbursementMismatch,
+			wantLoanID:         7,
+			wantDisbursementID: 3,
+			wantReason:         "paid 2499999999 base units but disbursement 3 is for 2500000000",
+		},
+		{
+			name:   "mismatched loan",
+			payout: payout(8, borrower, "2500000000"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 8, true)
+				expectByTxHash(mock, 8, disbursementRow(3, 7, models.DisbursementMethodOnChain, models.DisbursementStatusProcessing, 2500, payoutHash))
+			},
+			wantStatus:         models.OnChainDisbursementMismatch,
+			wantLoanID:         8,
+			wantDisbursementID: 3,
+			wantReason:         "paid loanId " + disbursement.LoanIDTopic(8) + " but disbursement 3 is for loan 7",
+		},
+		{
+			name:   "unmatched loanId is not a loan",
+			payout: payout(9, borrower, "2500000000"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 9, false)
+				expectByTxHash(mock, 9)
+			},
+			wantStatus: models.OnChainDisbursementUnmatched,
+			wantReason: "loanId " + disbursement.LoanIDTopic(9) + " is not a loan",
+		},
+		{
+			name:   "unmatched loan has no disbursement",
+			payout: payout(7, borrower, "2500000000"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 7, true)
+				expectByTxHash(mock, 7)
+				mock.ExpectQuery("FROM disbursements WHERE loan_id = $1").
+					WithArgs(7).
+					WillReturnRows(disbursementColumns)
+			},
+			wantStatus: models.OnChainDisbursementUnmatched,
+			wantLoanID: 7,
+			wantReason: "loan 7 has no disbursement",
+		},
+		{
+			name:   "unmatched loan paid in another transaction",
+			payout: payout(7, borrower, "2500000000"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 7, true)
+				expectByTxHash(mock, 7)
+				mock.ExpectQuery("FROM disbursements WHERE loan_id = $1").
+					WithArgs(7).
+					WillReturnRows(disbursementColumns, disbursementRow(3, 7, models.DisbursementMethodOnChain, models.DisbursementStatusCompleted, 2500, otherHash))
+			},
+			wantStatus:         models.OnChainDisbursementUnmatched,
+			wantLoanID:         7,
+			wantDisbursementID: 3,
+			wantReason:         "disbursement 3 of loan 7 was paid in " + otherHash,
+		},
+		{
+			name:   "unmatched loan disbursed by bank transfer",
+			payout: payout(7, borrower, "2500000000"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 7, true)
+				expectByTxHash(mock, 7)
+				mock.ExpectQuery("FROM disbursements WHERE loan_id = $1").
+					WithArgs(7).
+					WillReturnRows(disbursementColumns, disbursementRow(3, 7, models.DisbursementMethodAPI, models.DisbursementStatusCompleted, 2500, "ir-123"))
+			},
+			wantStatus:         models.OnChainDisbursementUnmatched,
+			wantLoanID:         7,
+			wantDisbursementID: 3,
+			wantReason:         "loan 7 was disbursed via api by disbursement 3",
+		},
+		{
+			name:   "unmatched payout not yet recorded",
+			payout: payout(7, borrower, "2500000000"),
+			script: func(mock *dbtest.Mock) {
+				expectLoan(mock, 7, true)
+				expectByTxHash(mock, 7)
+				mock.ExpectQuery("FROM disbursements WHERE loan_id = $1").
+					WithArgs(7).
+					WillReturnRows(disbursementColumns, disbursementRow(3, 7, models.DisbursementMethodOnChain, models.DisbursementStatusProcessing, 2500, nil))
+			},
+			wantStatus:         models.OnChainDisbursementUnmatched,
+			wantLoanID:         7,
+			wantDisbursementID: 3,
+			wantReason:         "disbursement 3 of loan 7 is processing with no transaction recorded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			tt.script(mock)
+			i := &Indexer{DB: db, Token: aaud}
+
+			o := tt.payout
+			if err := i.reconcile(context.Background(), &o); err != nil {
+				t.Fatalf("reconcile: %v", err)
+			}
+
+			if o.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", o.Status, tt.wantStatus)
+			}
+			if o.LoanID.Valid != (tt.wantLoanID != 0) || o.LoanID.Int64 != tt.wantLoanID {
+				t.Errorf("loan = %+v, want %d", o.LoanID, tt.wantLoanID)
+			}
+			if o.DisbursementID.Valid != (tt.wantDisbursementID != 0) || o.DisbursementID.Int64 != tt.wantDisbursementID {
+				t.Errorf("disbursement = %+v, want %d", o.DisbursementID, tt.wantDisbursementID)
+			}
+			if o.Reason.Valid != (tt.wantReason != "") || o.Reason.String != tt.wantReason {
+				t.Errorf("reason = %q, want %q", o.Reason.String, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestReconcileResetsEarlierResult(t *testing.T) {
+	// A payout that was unmatched when indexed matches once the processor records its
+	// transaction, and loses the earlier reason
+	db, mock := dbtest.New(t)
+	expectLoan(mock, 7, true)
+	expectByTxHash(mock, 7, disbursementRow(3, 7, models.DisbursementMethodOnChain, models.DisbursementStatusProcessing, 2500, payoutHash))
+	i := &Indexer{DB: db, Token: aaud}
+
+	o := payout(7, borrower, "2500000000")
+	o.Status = models.OnChainDisbursementUnmatched
+	o.Reason.String, o.Reason.Valid = "disbursement 3 of loan 7 is processing with no transaction recorded", true
+
+	if err := i.reconcile(context.Background(), &o); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if o.Status != models.OnChainDisbursementMatched || o.Reason.Valid {
+		t.Errorf("status = %s (%q), want %s with no reason", o.Status, o.Reason.String, models.OnChainDisbursementMatched)
+	}
+}
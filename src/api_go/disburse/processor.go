@@ -0,0 +1,257 @@
+package disburse
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/evm"
+	"paperhands/api/models"
+	"paperhands/api/services"
+)
+
+// sendTimeout bounds a single payout request to a rail
+const sendTimeout = 2 * time.Minute
+
+// Processor is a background job that sends pending disbursements through the rail for their
+// method and follows them until the payout settles, when the loan moves to disbursed. Failed
+// payouts are retried after RetryDelay until MaxAttempts have been made; after that staff
+// must retry them.
+type Processor struct {
+	DB          *sql.DB
+	Rails       map[string]Disburser
+	Interval    time.Duration
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+// NewProcessorFromEnv creates a processor with the rails configured in the environment (see
+// NewContractRailFromEnv and NewBankRailFromEnv). It runs every DISBURSEMENT_INTERVAL_SECONDS
+// (default 30) and makes up to DISBURSEMENT_MAX_ATTEMPTS (default 3) attempts,
+// DISBURSEMENT_RETRY_MINUTES (default 10) apart.
+func NewProcessorFromEnv(db *sql.DB, backend evm.TxSender) *Processor {
+	rails := make(map[string]Disburser)
+	if rail := NewContractRailFromEnv(backend); rail != nil {
+		rails[rail.Method()] = rail
+	}
+	if rail := NewBankRailFromEnv(); rail != nil {
+		rails[rail.Method()] = rail
+	}
+
+	return &Processor{
+		DB:          db,
+		Rails:       rails,
+		Interval:    config.EnvSeconds("DISBURSEMENT_INTERVAL_SECONDS", 30*time.Second),
+		MaxAttempts: config.EnvInt("DISBURSEMENT_MAX_ATTEMPTS", 3),
+		RetryDelay:  time.Duration(config.EnvInt("DISBURSEMENT_RETRY_MINUTES", 10)) * time.Minute,
+	}
+}
+
+// Rail returns the rail for a disbursement method, if one is configured
+func (p *Processor) Rail(method string) (Disburser, bool) {
+	rail, ok := p.Rails[method]
+	return rail, ok
+}
+
+// Run processes disbursements until ctx is cancelled. It returns immediately if no rail is
+// configured.
+func (p *Processor) Run(ctx context.Context) {
+	if len(p.Rails) == 0 {
+		log.Println("Disbursement processor disabled: no payout rail configured")
+		return
+	}
+
+	methods := make([]string, 0, len(p.Rails))
+	for method := range p.Rails {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+
+	log.Printf("Disbursement processor started (interval %s, rails %s, max attempts %d)",
+		p.Interval, strings.Join(methods, ", "), p.MaxAttempts)
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Poll(ctx); err != nil {
+			log.Printf("Disbursement processor poll failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Disbursement processor stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll settles or fails sent payouts, then sends disbursements that are pending or due a retry
+func (p *Processor) Poll(ctx context.Context) error {
+	sent, err := p.disbursements(ctx, "status = $1", models.DisbursementStatusProcessing)
+	if err != nil {
+		return fmt.Errorf("querying processing disbursements: %w", err)
+	}
+	for _, d := range sent {
+		if err := p.check(ctx, d); err != nil {
+			log.Printf("Error checking disbursement %d: %v", d.ID, err)
+		}
+	}
+
+	due, err := p.disbursements(ctx,
+		"status = $1 OR (status = $2 AND next_attempt_at <= NOW())",
+		models.DisbursementStatusPending, models.DisbursementStatusFailed,
+	)
+	if err != nil {
+		return fmt.Errorf("querying due disbursements: %w", err)
+	}
+	for _, d := range due {
+		if err := p.send(ctx, d.ID); err != nil {
+			log.Printf("Error sending disbursement %d: %v", d.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Processor) disbursements(ctx context.Context, where string, args ...interface{}) ([]models.Disbursement, error) {
+	rows, err := p.DB.QueryContext(ctx, "SELECT "+services.DisbursementColumns+" FROM disbursements WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var disbursements []models.Disbursement
+	for rows.Next() {
+		d, err := services.ScanDisbursement(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning disbursement: %w", err)
+		}
+		disbursements = append(disbursements, d)
+	}
+
+	return disbursements, rows.Err()
+}
+
+// send claims a disbursement and sends its payout. The claim is committed first, so the
+// payout is sent at most once per attempt even if several processors run.
+func (p *Processor) send(ctx context.Context, id int) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	d, err := services.ClaimDisbursement(tx, id)
+	if errors.Is(err, services.ErrDisbursementNotDue) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	rail, ok := p.Rail(d.Method)
+	if !ok {
+		return p.fail(d, fmt.Sprintf("no payout rail configured for %s disbursements", d.Method))
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	ref, err := rail.Disburse(sendCtx, d)
+	if err != nil {
+		return p.fail(d, err.Error())
+	}
+
+	if err := services.RecordDisbursementSent(p.DB, d.ID, ref); err != nil {
+		return fmt.Errorf("recording payout reference %s: %w", ref, err)
+	}
+
+	log.Printf("Sent disbursement %d of loan %d: %.2f AUD via %s (%s, attempt %d)",
+		d.ID, d.LoanID, d.AmountAUD, d.Method, ref, d.Attempts)
+	return nil
+}
+
+// check asks the rail how a sent payout is going and completes or fails the disbursement
+func (p *Processor) check(ctx context.Context, d models.Disbursement) error {
+	// A payout claimed but never given a reference was interrupted mid-send. It may have gone
+	// out, so it is not retried automatically.
+	if !d.TxHash.Valid {
+		if time.Since(d.UpdatedAt) < 2*sendTimeout {
+			return nil
+		}
+		log.Printf("Disbursement %d was interrupted while sending; check %s before retrying", d.ID, d.Method)
+		return services.FailDisbursement(p.DB, d.ID, "interrupted before the payout reference was recorded", sql.NullTime{})
+	}
+
+	rail, ok := p.Rail(d.Method)
+	if !ok {
+		return fmt.Errorf("no payout rail configured for %s disbursements", d.Method)
+	}
+
+	result, err := rail.Status(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	switch result.Status {
+	case models.DisbursementStatusCompleted:
+		return p.complete(ctx, d)
+	case models.DisbursementStatusFailed:
+		return p.fail(d, result.Reason)
+	}
+	return nil
+}
+
+func (p *Processor) complete(ctx context.Context, d models.Disbursement) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	d, loanStatus, err := services.CompleteDisbursement(tx, d.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Disbursement %d of loan %d completed (%s)", d.ID, d.LoanID, d.TxHash.String)
+	if loanStatus != models.LoanStatusCollateralised {
+		log.Printf("Warning: loan %d was %s when its disbursement completed; status left unchanged", d.LoanID, loanStatus)
+	}
+	return nil
+}
+
+// fail records a failed attempt and schedules a retry if attempts remain
+func (p *Processor) fail(d models.Disbursement, reason string) error {
+	var retryAt sql.NullTime
+	if d.Attempts < p.MaxAttempts {
+		retryAt = sql.NullTime{Time: time.Now().Add(p.RetryDelay), Valid: true}
+	}
+
+	if err := services.FailDisbursement(p.DB, d.ID, reason, retryAt); err != nil {
+		return fmt.Errorf("recording failure: %w", err)
+	}
+
+	if retryAt.Valid {
+		log.Printf("Disbursement %d attempt %d failed, retrying at %s: %s", d.ID, d.Attempts, retryAt.Time.Format(time.RFC3339), reason)
+	} else {
+		log.Printf("Disbursement %d failed after %d attempts: %s", d.ID, d.Attempts, reason)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package evm
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// wordHexLen is the length of a 32-byte ABI word in hex characters
+const wordHexLen = 64
+
+// ABIArg is an argument encoded for a contract call. Static values are a single word in the
+// head of the calldata; dynamic arrays are an offset in the head and their contents in the tail.
+type ABIArg struct {
+	words   string
+	dynamic bool
+}
+
+// AddressArg encodes an address argument
+func AddressArg(address string) ABIArg {
+	return ABIArg{words: encodeAddress(address)}
+}
+
+// UintArg encodes a uint argument of any size
+func UintArg(value *big.Int) ABIArg {
+	if value == nil {
+		value = new(big.Int)
+	}
+	return ABIArg{words: encodeUint(value)}
+}
+
+// Bytes32Arg encodes a bytes32 argument
+func Bytes32Arg(value [32]byte) ABIArg {
+	return ABIArg{words: hex.EncodeToString(value[:])}
+}
+
+// BoolArg encodes a bool argument
+func BoolArg(value bool) ABIArg {
+	if value {
+		return UintArg(big.NewInt(1))
+	}
+	return UintArg(new(big.Int))
+}
+
+// ArrayArg encodes a dynamic array of static elements, e.g. address[]
+func ArrayArg(elems ...ABIArg) ABIArg {
+	var b strings.Builder
+	b.WriteString(encodeUint(big.NewInt(int64(len(elems)))))
+	for _, elem := range elems {
+		b.WriteString(elem.words)
+	}
+	return ABIArg{words: b.String(), dynamic: true}
+}
+
+// PackCall encodes a call of the function with the given 4-byte selector
+func PackCall(selector string, args ...ABIArg) string {
+	var head, tail strings.Builder
+	headLen := len(args) * wordHexLen / 2
+
+	for _, arg := range args {
+		if !arg.dynamic {
+			head.WriteString(arg.words)
+			continue
+		}
+		offset := headLen + tail.Len()/2
+		head.WriteString(encodeUint(big.NewInt(int64(offset))))
+		tail.WriteString(arg.words)
+	}
+
+	return "0x" + strings.TrimPrefix(selector, "0x") + head.String() + tail.String()
+}
+
+// ABIWords splits ABI-encoded return data or event data into 32-byte words
+func ABIWords(data string) ([]string, error) {
+	hexData := strings.TrimPrefix(data, "0x")
+	if len(hexData)%wordHexLen != 0 {
+		return nil, fmt.Errorf("abi data of %d hex characters is not a whole number of words", len(hexData))
+	}
+	if _, err := hex.DecodeString(hexData); err != nil {
+		return nil, fmt.Errorf("invalid abi data: %w", err)
+	}
+
+	words := make([]string, 0, len(hexData)/wordHexLen)
+	for i := 0; i < len(hexData); i += wordHexLen {
+		words = append(words, strings.ToLower(hexData[i:i+wordHexLen]))
+	}
+	return words, nil
+}
+
+// WordAddress decodes an address word or indexed topic
+func WordAddress(word string) string {
+	return TopicAddress(word)
+}
+
+// WordUint decodes a uint word or indexed topic
+func WordUint(word string) *big.Int {
+	value, _ := new(big.Int).SetString(strings.TrimPrefix(word, "0x"), 16)
+	if value == nil {
+		return new(big.Int)
+	}
+	return value
+}
+
+// WordBytes32 decodes a bytes32 word or indexed topic
+func WordBytes32(word string) [32]byte {
+	var value [32]byte
+	hex.Decode(value[:], []byte(strings.TrimPrefix(word, "0x")))
+	return value
+}
+
+// WordBool decodes a bool word or indexed topic
+func WordBool(word string) bool {
+	return WordUint(word).Sign() != 0
+}
@@ -0,0 +1,110 @@
+package evm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrNotFound is returned when a transaction or receipt is unknown to the node
+var ErrNotFound = errors.New("not found")
+
+// TransferTopic is the ERC-20 Transfer(address,address,uint256) event signature hash
+const TransferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// Log is an event log emitted by a contract. Addresses, topics and hashes are lower-case hex.
+type Log struct {
+	Address     string
+	Topics      []string
+	Data        string
+	BlockNumber uint64
+	TxHash      string
+	LogIndex    uint
+	// Removed is set for logs dropped by a chain reorganisation
+	Removed bool
+}
+
+// Receipt is the outcome of a mined transaction
+type Receipt struct {
+	TxHash      string
+	BlockNumber uint64
+	// Success is false for reverted transactions
+	Success bool
+	Logs    []Log
+}
+
+// FilterQuery selects logs in [FromBlock, ToBlock] emitted by any of Addresses.
+// Topics[i] matches any of the listed values at position i; an empty list matches anything.
+type FilterQuery struct {
+	FromBlock uint64
+	ToBlock   uint64
+	Addresses []string
+	Topics    [][]string
+}
+
+// Backend is a source of EVM chain data
+type Backend interface {
+	// BlockNumber returns the number of the latest block
+	BlockNumber(ctx context.Context) (uint64, error)
+	// Logs returns the logs matching q
+	Logs(ctx context.Context, q FilterQuery) ([]Log, error)
+	// TransactionReceipt returns the receipt of a mined transaction, or ErrNotFound
+	TransactionReceipt(ctx context.Context, txHash string) (*Receipt, error)
+}
+
+// Transfer is a decoded ERC-20 Transfer event
+type Transfer struct {
+	Token       string // contract address
+	From        string
+	To          string
+	Value       *big.Int // token base units
+	TxHash      string
+	LogIndex    uint
+	BlockNumber uint64
+}
+
+// ParseTransfer decodes an ERC-20 Transfer log. from and to are indexed, value is the data.
+func ParseTransfer(l Log) (Transfer, error) {
+	if len(l.Topics) != 3 || l.Topics[0] != TransferTopic {
+		return Transfer{}, fmt.Errorf("log %s:%d is not an ERC-20 transfer", l.TxHash, l.LogIndex)
+	}
+
+	value, ok := new(big.Int).SetString(strings.TrimPrefix(l.Data, "0x"), 16)
+	if !ok {
+		return Transfer{}, fmt.Errorf("log %s:%d has invalid transfer value %q", l.TxHash, l.LogIndex, l.Data)
+	}
+
+	return Transfer{
+		Token:       l.Address,
+		From:        TopicAddress(l.Topics[1]),
+		To:          TopicAddress(l.Topics[2]),
+		Value:       value,
+		TxHash:      l.TxHash,
+		LogIndex:    l.LogIndex,
+		BlockNumber: l.BlockNumber,
+	}, nil
+}
+
+// AddressTopic left-pads an address to the 32-byte topic it is indexed as
+func AddressTopic(address string) string {
+	return "0x" + strings.Repeat("0", 24) + strings.TrimPrefix(strings.ToLower(address), "0x")
+}
+
+// TopicAddress returns the lower-case address held in the last 20 bytes of an indexed topic
+func TopicAddress(topic string) string {
+	hex := strings.TrimPrefix(strings.ToLower(topic), "0x")
+	if len(hex) > 40 {
+		hex = hex[len(hex)-40:]
+	}
+	return "0x" + hex
+}
+
+// Confirmations returns the number of confirmations of a block given the latest block
+func Confirmations(blockNumber, latest uint64) uint64 {
+	if blockNumber == 0 || latest < blockNumber {
+		return 0
+	}
+	return latest - blockNumber + 1
+}
@@ -0,0 +1,480 @@
+// Code generated by bindgen from Disbursement.abi.json. DO NOT EDIT.
+
+package disbursement
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"paperhands/api/evm"
+)
+
+// Function selectors
+const (
+	BatchDisburseSelector        = "0xe59ad56b" // batchDisburse(bytes32[],address[],uint256[])
+	DisburseSelector             = "0x6664ac91" // disburse(bytes32,address,uint256)
+	DisbursementIDsSelector      = "0x7933e46b" // disbursementIds(uint256)
+	DisbursementTokenSelector    = "0x5824535d" // disbursementToken()
+	DisbursementsSelector        = "0x643a5c76" // disbursements(bytes32)
+	GetBalanceSelector           = "0x12065fe0" // getBalance()
+	GetDisbursementSelector      = "0x4190fba9" // getDisbursement(bytes32)
+	GetDisbursementCountSelector = "0xd1a85407" // getDisbursementCount()
+	OwnerSelector                = "0x8da5cb5b" // owner()
+	PauseSelector                = "0x8456cb59" // pause()
+	PausedSelector               = "0x5c975abb" // paused()
+	RenounceOwnershipSelector    = "0x715018a6" // renounceOwnership()
+	SetDisbursementTokenSelector = "0x183cf45c" // setDisbursementToken(address)
+	TransferOwnershipSelector    = "0xf2fde38b" // transferOwnership(address)
+	UnpauseSelector              = "0x3f4ba83a" // unpause()
+	WithdrawTokensSelector       = "0x5e35359e" // withdrawTokens(address,address,uint256)
+)
+
+// Event signature hashes
+const (
+	DisbursementCompletedTopic = "0x78fd8ebd628d5f74005a01ba71e30aa10ed4c1acf2f9deac93bc8a56c44a662a" // DisbursementCompleted(bytes32,bytes32,address,uint256,uint256)
+	DisbursementCreatedTopic   = "0x98670ca1957805d99ed3594c44d92d8add732d5fd91ef850cf7eb543a1b4007a" // DisbursementCreated(bytes32,bytes32,address,uint256)
+	FundsWithdrawnTopic        = "0xa92ff919b850e4909ab2261d907ef955f11bc1716733a6cbece38d163a69af8a" // FundsWithdrawn(address,address,uint256)
+	OwnershipTransferredTopic  = "0x8be0079c531659141344cd1fd0a4f28419497f9722a3daafe3b4186f6b6457e0" // OwnershipTransferred(address,address)
+	PausedTopic                = "0x62e78cea01bee320cd4e420270b5ea74000d11b0c9f74754ebdbfc544b05a258" // Paused(address)
+	TokenUpdatedTopic          = "0x0b1186973f810894b87ab0bfbee422fddcaad21b46dc705a561451bbb6bac117" // TokenUpdated(address,address)
+	UnpausedTopic              = "0x5db9ee0a495bf2e6ff9c91a7834c1ba4fdd244a5e8aa4e537bd38aeae4b073aa" // Unpaused(address)
+)
+
+// Disbursement is a binding to a deployed Disbursement contract
+type Disbursement struct {
+	Address string
+	Backend evm.ContractBackend
+}
+
+// NewDisbursement binds the Disbursement contract at address
+func NewDisbursement(address string, backend evm.ContractBackend) *Disbursement {
+	return &Disbursement{Address: strings.ToLower(address), Backend: backend}
+}
+
+// PackBatchDisburse encodes a batchDisburse(bytes32[],address[],uint256[]) call
+func PackBatchDisburse(loanIDs [][32]byte, recipients []string, amounts []*big.Int) string {
+	loanIDsArgs := make([]evm.ABIArg, len(loanIDs))
+	for i, v := range loanIDs {
+		loanIDsArgs[i] = evm.Bytes32Arg(v)
+	}
+	recipientsArgs := make([]evm.ABIArg, len(recipients))
+	for i, v := range recipients {
+		recipientsArgs[i] = evm.AddressArg(v)
+	}
+	amountsArgs := make([]evm.ABIArg, len(amounts))
+	for i, v := range amounts {
+		amountsArgs[i] = evm.UintArg(v)
+	}
+	return evm.PackCall(BatchDisburseSelector, evm.ArrayArg(loanIDsArgs...), evm.ArrayArg(recipientsArgs...), evm.ArrayArg(amountsArgs...))
+}
+
+// BatchDisburse sends a batchDisburse(bytes32[],address[],uint256[]) transaction from from and returns its hash
+func (c *Disbursement) BatchDisburse(ctx context.Context, from string, loanIDs [][32]byte, recipients []string, amounts []*big.Int) (string, error) {
+	return c.Backend.SendTransaction(ctx, from, c.Address, PackBatchDisburse(loanIDs, recipients, amounts))
+}
+
+// PackDisburse encodes a disburse(bytes32,address,uint256) call
+func PackDisburse(loanID [32]byte, recipient string, amount *big.Int) string {
+	return evm.PackCall(DisburseSelector, evm.Bytes32Arg(loanID), evm.AddressArg(recipient), evm.UintArg(amount))
+}
+
+// Disburse sends a disburse(bytes32,address,uint256) transaction from from and returns its hash
+func (c *Disbursement) Disburse(ctx context.Context, from string, loanID [32]byte, recipient string, amount *big.Int) (string, error) {
+	return c.Backend.SendTransaction(ctx, from, c.Address, PackDisburse(loanID, recipient, amount))
+}
+
+// PackDisbursementIDs encodes a disbursementIds(uint256) call
+func PackDisbursementIDs(arg0 *big.Int) string {
+	return evm.PackCall(DisbursementIDsSelector, evm.UintArg(arg0))
+}
+
+// DisbursementIDs calls disbursementIds(uint256)
+func (c *Disbursement) DisbursementIDs(ctx context.Context, arg0 *big.Int) (out [32]byte, err error) {
+	words, err := c.call(ctx, "disbursementIds", PackDisbursementIDs(arg0), 1)
+	if err != nil {
+		return out, err
+	}
+	return evm.WordBytes32(words[0]), nil
+}
+
+// PackDisbursementToken encodes a disbursementToken() call
+func PackDisbursementToken() string {
+	return evm.PackCall(DisbursementTokenSelector)
+}
+
+// DisbursementToken calls disbursementToken()
+func (c *Disbursement) DisbursementToken(ctx context.Context) (out string, err error) {
+	words, err := c.call(ctx, "disbursementToken", PackDisbursementToken(), 1)
+	if err != nil {
+		return out, err
+	}
+	return evm.WordAddress(words[0]), nil
+}
+
+// PackDisbursements encodes a disbursements(bytes32) call
+func PackDisbursements(arg0 [32]byte) string {
+	return evm.PackCall(DisbursementsSelector, evm.Bytes32Arg(arg0))
+}
+
+// DisbursementsResult is the result of disbursements(bytes32)
+type DisbursementsResult struct {
+	LoanID    [32]byte
+	Recipient string
+	Amount    *big.Int
+	Timestamp *big.Int
+	Completed bool
+}
+
+// Disbursements calls disbursements(bytes32)
+func (c *Disbursement) Disbursements(ctx context.Context, arg0 [32]byte) (out DisbursementsResult, err error) {
+	words, err := c.call(ctx, "disbursements", PackDisbursements(arg0), 5)
+	if err != nil {
+		return out, err
+	}
+	return DisbursementsResult{
+		LoanID:    evm.WordBytes32(words[0]),
+		Recipient: evm.WordAddress(words[1]),
+		Amount:    evm.WordUint(words[2]),
+		Timestamp: evm.WordUint(words[3]),
+		Completed: evm.WordBool(words[4]),
+	}, nil
+}
+
+// PackGetBalance encodes a getBalance() call
+func PackGetBalance() string {
+	return evm.PackCall(GetBalanceSelector)
+}
+
+// GetBalance calls getBalance()
+func (c *Disbursement) GetBalance(ctx context.Context) (out *big.Int, err error) {
+	words, err := c.call(ctx, "getBalance", PackGetBalance(), 1)
+	if err != nil {
+		return out, err
+	}
+	return evm.WordUint(words[0]), nil
+}
+
+// PackGetDisbursement encodes a getDisbursement(bytes32) call
+func PackGetDisbursement(disbursementID [32]byte) string {
+	return evm.PackCall(GetDisbursementSelector, evm.Bytes32Arg(disbursementID))
+}
+
+// DisbursementRecord is the result of getDisbursement(bytes32)
+type DisbursementRecord struct {
+	LoanID    [32]byte
+	Recipient string
+	Amount    *big.Int
+	Timestamp *big.Int
+	Completed bool
+}
+
+// GetDisbursement calls getDisbursement(bytes32)
+func (c *Disbursement) GetDisbursement(ctx context.Context, disbursementID [32]byte) (out DisbursementRecord, err error) {
+	words, err := c.call(ctx, "getDisbursement", PackGetDisbursement(disbursementID), 5)
+	if err != nil {
+		return out, err
+	}
+	return DisbursementRecord{
+		LoanID:    evm.WordBytes32(words[0]),
+		Recipient: evm.WordAddress(words[1]),
+		Amount:    evm.WordUint(words[2]),
+		Timestamp: evm.WordUint(words[3]),
+		Completed: evm.WordBool(words[4]),
+	}, nil
+}
+
+// PackGetDisbursementCount encodes a getDisbursementCount() call
+func PackGetDisbursementCount() string {
+	return evm.PackCall(GetDisbursementCountSelector)
+}
+
+// GetDisbursementCount calls getDisbursementCount()
+func (c *Disbursement) GetDisbursementCount(ctx context.Context) (out *big.Int, err error) {
+	words, err := c.call(ctx, "getDisbursementCount", PackGetDisbursementCount(), 1)
+	if err != nil {
+		return out, err
+	}
+	return evm.WordUint(words[0]), nil
+}
+
+// PackOwner encodes an owner() call
+func PackOwner() string {
+	return evm.PackCall(OwnerSelector)
+}
+
+// Owner calls owner()
+func (c *Disbursement) Owner(ctx context.Context) (out string, err error) {
+	words, err := c.call(ctx, "owner", PackOwner(), 1)
+	if err != nil {
+		return out, err
+	}
+	return evm.WordAddress(words[0]), nil
+}
+
+// PackPause encodes a pause() call
+func PackPause() string {
+	return evm.PackCall(PauseSelector)
+}
+
+// Pause sends a pause() transaction from from and returns its hash
+func (c *Disbursement) Pause(ctx context.Context, from string) (string, error) {
+	return c.Backend.SendTransaction(ctx, from, c.Address, PackPause())
+}
+
+// PackPaused encodes a paused() call
+func PackPaused() string {
+	return evm.PackCall(PausedSelector)
+}
+
+// Paused calls paused()
+func (c *Disbursement) Paused(ctx context.Context) (out bool, err error) {
+	words, err := c.call(ctx, "paused", PackPaused(), 1)
+	if err != nil {
+		return out, err
+	}
+	return evm.WordBool(words[0]), nil
+}
+
+// PackRenounceOwnership encodes a renounceOwnership() call
+func PackRenounceOwnership() string {
+	return evm.PackCall(RenounceOwnershipSelector)
+}
+
+// RenounceOwnership sends a renounceOwnership() transaction from from and returns its hash
+func (c *Disbursement) RenounceOwnership(ctx context.Context, from string) (string, error) {
+	return c.Backend.SendTransaction(ctx, from, c.Address, PackRenounceOwnership())
+}
+
+// PackSetDisbursementToken encodes a setDisbursementToken(address) call
+func PackSetDisbursementToken(newToken string) string {
+	return evm.PackCall(SetDisbursementTokenSelector, evm.AddressArg(newToken))
+}
+
+// SetDisbursementToken sends a setDisbursementToken(address) transaction from from and returns its hash
+func (c *Disbursement) SetDisbursementToken(ctx context.Context, from string, newToken string) (string, error) {
+	return c.Backend.SendTransaction(ctx, from, c.Address, PackSetDisbursementToken(newToken))
+}
+
+// PackTransferOwnership encodes a transferOwnership(address) call
+func PackTransferOwnership(newOwner string) string {
+	return evm.PackCall(TransferOwnershipSelector, evm.AddressArg(newOwner))
+}
+
+// TransferOwnership sends a transferOwnership(address) transaction from from and returns its hash
+func (c *Disbursement) TransferOwnership(ctx context.Context, from string, newOwner string) (string, error) {
+	return c.Backend.SendTransaction(ctx, from, c.Address, PackTransferOwnership(newOwner))
+}
+
+// PackUnpause encodes an unpause() call
+func PackUnpause() string {
+	return evm.PackCall(UnpauseSelector)
+}
+
+// Unpause sends an unpause() transaction from from and returns its hash
+func (c *Disbursement) Unpause(ctx context.Context, from string) (string, error) {
+	return c.Backend.SendTransaction(ctx, from, c.Address, PackUnpause())
+}
+
+// PackWithdrawTokens encodes a withdrawTokens(address,address,uint256) call
+func PackWithdrawTokens(token string, to string, amount *big.Int) string {
+	return evm.PackCall(WithdrawTokensSelector, evm.AddressArg(token), evm.AddressArg(to), evm.UintArg(amount))
+}
+
+// WithdrawTokens sends a withdrawTokens(address,address,uint256) transaction from from and returns its hash
+func (c *Disbursement) WithdrawTokens(ctx context.Context, from string, token string, to string, amount *big.Int) (string, error) {
+	return c.Backend.SendTransaction(ctx, from, c.Address, PackWithdrawTokens(token, to, amount))
+}
+
+// DisbursementCompleted is a DisbursementCompleted(bytes32,bytes32,address,uint256,uint256) event
+type DisbursementCompleted struct {
+	DisbursementID [32]byte
+	LoanID         [32]byte
+	Recipient      string
+	Amount         *big.Int
+	Timestamp      *big.Int
+	Raw            evm.Log
+}
+
+// ParseDisbursementCompleted decodes a DisbursementCompleted log
+func ParseDisbursementCompleted(l evm.Log) (DisbursementCompleted, error) {
+	if len(l.Topics) != 4 || l.Topics[0] != DisbursementCompletedTopic {
+		return DisbursementCompleted{}, fmt.Errorf("log %s:%d is not a DisbursementCompleted event", l.TxHash, l.LogIndex)
+	}
+	words, err := evm.ABIWords(l.Data)
+	if err != nil {
+		return DisbursementCompleted{}, fmt.Errorf("log %s:%d: %w", l.TxHash, l.LogIndex, err)
+	}
+	if len(words) != 2 {
+		return DisbursementCompleted{}, fmt.Errorf("log %s:%d has %d data words, want 2", l.TxHash, l.LogIndex, len(words))
+	}
+	return DisbursementCompleted{
+		DisbursementID: evm.WordBytes32(l.Topics[1]),
+		LoanID:         evm.WordBytes32(l.Topics[2]),
+		Recipient:      evm.WordAddress(l.Topics[3]),
+		Amount:         evm.WordUint(words[0]),
+		Timestamp:      evm.WordUint(words[1]),
+		Raw:            l,
+	}, nil
+}
+
+// DisbursementCreated is a DisbursementCreated(bytes32,bytes32,address,uint256) event
+type DisbursementCreated struct {
+	DisbursementID [32]byte
+	LoanID         [32]byte
+	Recipient      string
+	Amount         *big.Int
+	Raw            evm.Log
+}
+
+// ParseDisbursementCreated decodes a DisbursementCreated log
+func ParseDisbursementCreated(l evm.Log) (DisbursementCreated, error) {
+	if len(l.Topics) != 4 || l.Topics[0] != DisbursementCreatedTopic {
+		return DisbursementCreated{}, fmt.Errorf("log %s:%d is not a DisbursementCreated event", l.TxHash, l.LogIndex)
+	}
+	words, err := evm.ABIWords(l.Data)
+	if err != nil {
+		return DisbursementCreated{}, fmt.Errorf("log %s:%d: %w", l.TxHash, l.LogIndex, err)
+	}
+	if len(words) != 1 {
+		return DisbursementCreated{}, fmt.Errorf("log %s:%d has %d data words, want 1", l.TxHash, l.LogIndex, len(words))
+	}
+	return DisbursementCreated{
+		DisbursementID: evm.WordBytes32(l.Topics[1]),
+		LoanID:         evm.WordBytes32(l.Topics[2]),
+		Recipient:      evm.WordAddress(l.Topics[3]),
+		Amount:         evm.WordUint(words[0]),
+		Raw:            l,
+	}, nil
+}
+
+// FundsWithdrawn is a FundsWithdrawn(address,address,uint256) event
+type FundsWithdrawn struct {
+	Token  string
+	To     string
+	Amount *big.Int
+	Raw    evm.Log
+}
+
+// ParseFundsWithdrawn decodes a FundsWithdrawn log
+func ParseFundsWithdrawn(l evm.Log) (FundsWithdrawn, error) {
+	if len(l.Topics) != 3 || l.Topics[0] != FundsWithdrawnTopic {
+		return FundsWithdrawn{}, fmt.Errorf("log %s:%d is not a FundsWithdrawn event", l.TxHash, l.LogIndex)
+	}
+	words, err := evm.ABIWords(l.Data)
+	if err != nil {
+		return FundsWithdrawn{}, fmt.Errorf("log %s:%d: %w", l.TxHash, l.LogIndex, err)
+	}
+	if len(words) != 1 {
+		return FundsWithdrawn{}, fmt.Errorf("log %s:%d has %d data words, want 1", l.TxHash, l.LogIndex, len(words))
+	}
+	return FundsWithdrawn{
+		Token:  evm.WordAddress(l.Topics[1]),
+		To:     evm.WordAddress(l.Topics[2]),
+		Amount: evm.WordUint(words[0]),
+		Raw:    l,
+	}, nil
+}
+
+// OwnershipTransferred is an OwnershipTransferred(address,address) event
+type OwnershipTransferred struct {
+	PreviousOwner string
+	NewOwner      string
+	Raw           evm.Log
+}
+
+// ParseOwnershipTransferred decodes an OwnershipTransferred log
+func ParseOwnershipTransferred(l evm.Log) (OwnershipTransferred, error) {
+	if len(l.Topics) != 3 || l.Topics[0] != OwnershipTransferredTopic {
+		return OwnershipTransferred{}, fmt.Errorf("log %s:%d is not a OwnershipTransferred event", l.TxHash, l.LogIndex)
+	}
+	return OwnershipTransferred{
+		PreviousOwner: evm.WordAddress(l.Topics[1]),
+		NewOwner:      evm.WordAddress(l.Topics[2]),
+		Raw:           l,
+	}, nil
+}
+
+// Paused is a Paused(address) event
+type Paused struct {
+	Account string
+	Raw     evm.Log
+}
+
+// ParsePaused decodes a Paused log
+func ParsePaused(l evm.Log) (Paused, error) {
+	if len(l.Topics) != 1 || l.Topics[0] != PausedTopic {
+		return Paused{}, fmt.Errorf("log %s:%d is not a Paused event", l.TxHash, l.LogIndex)
+	}
+	words, err := evm.ABIWords(l.Data)
+	if err != nil {
+		return Paused{}, fmt.Errorf("log %s:%d: %w", l.TxHash, l.LogIndex, err)
+	}
+	if len(words) != 1 {
+		return Paused{}, fmt.Errorf("log %s:%d has %d data words, want 1", l.TxHash, l.LogIndex, len(words))
+	}
+	return Paused{
+		Account: evm.WordAddress(words[0]),
+		Raw:     l,
+	}, nil
+}
+
+// TokenUpdated is a TokenUpdated(address,address) event
+type TokenUpdated struct {
+	OldToken string
+	NewToken string
+	Raw      evm.Log
+}
+
+// ParseTokenUpdated decodes a TokenUpdated log
+func ParseTokenUpdated(l evm.Log) (TokenUpdated, error) {
+	if len(l.Topics) != 3 || l.Topics[0] != TokenUpdatedTopic {
+		return TokenUpdated{}, fmt.Errorf("log %s:%d is not a TokenUpdated event", l.TxHash, l.LogIndex)
+	}
+	return TokenUpdated{
+		OldToken: evm.WordAddress(l.Topics[1]),
+		NewToken: evm.WordAddress(l.Topics[2]),
+		Raw:      l,
+	}, nil
+}
+
+// Unpaused is an Unpaused(address) event
+type Unpaused struct {
+	Account string
+	Raw     evm.Log
+}
+
+// ParseUnpaused decodes an Unpaused log
+func ParseUnpaused(l evm.Log) (Unpaused, error) {
+	if len(l.Topics) != 1 || l.Topics[0] != UnpausedTopic {
+		return Unpaused{}, fmt.Errorf("log %s:%d is not a Unpaused event", l.TxHash, l.LogIndex)
+	}
+	words, err := evm.ABIWords(l.Data)
+	if err != nil {
+		return Unpaused{}, fmt.Errorf("log %s:%d: %w", l.TxHash, l.LogIndex, err)
+	}
+	if len(words) != 1 {
+		return Unpaused{}, fmt.Errorf("log %s:%d has %d data words, want 1", l.TxHash, l.LogIndex, len(words))
+	}
+	return Unpaused{
+		Account: evm.WordAddress(words[0]),
+		Raw:     l,
+	}, nil
+}
+
+// call executes a read-only call and checks it returned at least n words
+func (c *Disbursement) call(ctx context.Context, method, data string, n int) ([]string, error) {
+	result, err := c.Backend.Call(ctx, c.Address, data)
+	if err != nil {
+		return nil, fmt.Errorf("calling %s: %w", method, err)
+	}
+	words, err := evm.ABIWords(result)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s result: %w", method, err)
+	}
+	if len(words) < n {
+		return nil, fmt.Errorf("%s returned %d words, want %d", method, len(words), n)
+	}
+	return words, nil
+}
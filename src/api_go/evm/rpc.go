@@ -0,0 +1,298 @@
+package evm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRPCURL is the default JSON-RPC endpoint of a local anvil or hardhat node
+const DefaultRPCURL = "http://localhost:8545"
+
+// RPCClient is a TxBackend for Ethereum JSON-RPC endpoints
+type RPCClient struct {
+	URL        string
+	HTTPClient *http.Client
+
+	nextID atomic.Int64
+}
+
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int64         `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type rpcLog struct {
+	Address     string   `json:"address"`
+	Topics      []string `json:"topics"`
+	Data        string   `json:"data"`
+	BlockNumber string   `json:"blockNumber"`
+	TxHash      string   `json:"transactionHash"`
+	LogIndex    string   `json:"logIndex"`
+	Removed     bool     `json:"removed"`
+}
+
+type rpcReceipt struct {
+	TxHash      string   `json:"transactionHash"`
+	BlockNumber string   `json:"blockNumber"`
+	Status      string   `json:"status"`
+	Logs        []rpcLog `json:"logs"`
+}
+
+// NewRPCClient creates a client for the given endpoint, e.g. http://localhost:8545
+func NewRPCClient(url string) *RPCClient {
+	return &RPCClient{
+		URL:        url,
+		HTTPClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// NewRPCClientFromEnv creates a client using EVM_RPC_URL, defaulting to a local node
+func NewRPCClientFromEnv() *RPCClient {
+	url := os.Getenv("EVM_RPC_URL")
+	if url == "" {
+		url = DefaultRPCURL
+	}
+	return NewRPCClient(url)
+}
+
+// BlockNumber returns the number of the latest block
+func (r *RPCClient) BlockNumber(ctx context.Context) (uint64, error) {
+	var result string
+	if err := r.call(ctx, "eth_blockNumber", &result); err != nil {
+		return 0, err
+	}
+	return parseQuantity(result)
+}
+
+// Logs returns the logs matching q
+func (r *RPCClient) Logs(ctx context.Context, q FilterQuery) ([]Log, error) {
+	filter := map[string]interface{}{
+		"fromBlock": formatQuantity(q.FromBlock),
+		"toBlock":   formatQuantity(q.ToBlock),
+	}
+	if len(q.Addresses) > 0 {
+		filter["address"] = q.Addresses
+	}
+	if len(q.Topics) > 0 {
+		topics := make([]interface{}, len(q.Topics))
+		for i, options := range q.Topics {
+			if len(options) > 0 {
+				topics[i] = options
+			}
+		}
+		filter["topics"] = topics
+	}
+
+	var result []rpcLog
+	if err := r.call(ctx, "eth_getLogs", &result, filter); err != nil {
+		return nil, err
+	}
+
+	logs := make([]Log, 0, len(result))
+	for _, l := range result {
+		parsed, err := l.toLog()
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, parsed)
+	}
+
+	return logs, nil
+}
+
+// TransactionReceipt returns the receipt of a mined transaction, or ErrNotFound
+func (r *RPCClient) TransactionReceipt(ctx context.Context, txHash string) (*Receipt, error) {
+	var result *rpcReceipt
+	if err := r.call(ctx, "eth_getTransactionReceipt", &result, txHash); err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, ErrNotFound
+	}
+
+	blockNumber, err := parseQuantity(result.BlockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("parsing receipt block number: %w", err)
+	}
+
+	receipt := &Receipt{
+		TxHash:      strings.ToLower(result.TxHash),
+		BlockNumber: blockNumber,
+		Success:     result.Status == "0x1",
+	}
+	for _, l := range result.Logs {
+		parsed, err := l.toLog()
+		if err != nil {
+			return nil, err
+		}
+		receipt.Logs = append(receipt.Logs, parsed)
+	}
+
+	return receipt, nil
+}
+
+// ChainID returns the chain ID transactions are signed for
+func (r *RPCClient) ChainID(ctx context.Context) (*big.Int, error) {
+	return r.callBig(ctx, "eth_chainId")
+}
+
+// Balance returns the ether balance of address in wei
+func (r *RPCClient) Balance(ctx context.Context, address string) (*big.Int, error) {
+	return r.callBig(ctx, "eth_getBalance", address, "latest")
+}
+
+// TokenBalance returns the ERC-20 balance of owner in the token's base units
+func (r *RPCClient) TokenBalance(ctx context.Context, contract, owner string) (*big.Int, error) {
+	result, err := r.Call(ctx, contract, BalanceOfCalldata(owner))
+	if err != nil {
+		return nil, err
+	}
+	return ParseUint(result)
+}
+
+// PendingNonce returns the next nonce of address, including pending transactions
+func (r *RPCClient) PendingNonce(ctx context.Context, address string) (uint64, error) {
+	var result string
+	if err := r.call(ctx, "eth_getTransactionCount", &result, address, "pending"); err != nil {
+		return 0, err
+	}
+	return parseQuantity(result)
+}
+
+// GasPrice returns the node's suggested gas price in wei
+func (r *RPCClient) GasPrice(ctx context.Context) (*big.Int, error) {
+	return r.callBig(ctx, "eth_gasPrice")
+}
+
+// Call executes a read-only contract call against the latest block
+func (r *RPCClient) Call(ctx context.Context, to, data string) (string, error) {
+	var result string
+	call := map[string]string{"to": to, "data": data}
+	if err := r.call(ctx, "eth_call", &result, call, "latest"); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// SendTransaction submits a contract call signed by the node's account for from
+func (r *RPCClient) SendTransaction(ctx context.Context, from, to, data string) (string, error) {
+	var result string
+	call := map[string]string{"from": from, "to": to, "data": data}
+	if err := r.call(ctx, "eth_sendTransaction", &result, call); err != nil {
+		return "", err
+	}
+	return strings.ToLower(result), nil
+}
+
+func (l rpcLog) toLog() (Log, error) {
+	blockNumber, err := parseQuantity(l.BlockNumber)
+	if err != nil {
+		return Log{}, fmt.Errorf("parsing log block number: %w", err)
+	}
+	logIndex, err := parseQuantity(l.LogIndex)
+	if err != nil {
+		return Log{}, fmt.Errorf("parsing log index: %w", err)
+	}
+
+	topics := make([]string, len(l.Topics))
+	for i, topic := range l.Topics {
+		topics[i] = strings.ToLower(topic)
+	}
+
+	return Log{
+		Address:     strings.ToLower(l.Address),
+		Topics:      topics,
+		Data:        l.Data,
+		BlockNumber: blockNumber,
+		TxHash:      strings.ToLower(l.TxHash),
+		LogIndex:    uint(logIndex),
+		Removed:     l.Removed,
+	}, nil
+}
+
+func (r *RPCClient) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: r.nextID.Add(1), Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc %s: status %d: %s", method, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var rpcResp rpcResponse
+	if err := json.Unmarshal(respBody, &rpcResp); err != nil {
+		return fmt.Errorf("parsing rpc %s response: %w", method, err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("rpc %s: %s (code %d)", method, rpcResp.Error.Message, rpcResp.Error.Code)
+	}
+
+	if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+		return fmt.Errorf("parsing rpc %s result: %w", method, err)
+	}
+
+	return nil
+}
+
+func (r *RPCClient) callBig(ctx context.Context, method string, params ...interface{}) (*big.Int, error) {
+	var result string
+	if err := r.call(ctx, method, &result, params...); err != nil {
+		return nil, err
+	}
+
+	value, ok := new(big.Int).SetString(strings.TrimPrefix(result, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("rpc %s: invalid quantity %q", method, result)
+	}
+	return value, nil
+}
+
+func parseQuantity(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(s, "0x"), 16, 64)
+}
+
+func formatQuantity(n uint64) string {
+	return "0x" + strconv.FormatUint(n, 16)
+}
@@ -0,0 +1,78 @@
+package evm
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"paperhands/api/config"
+)
+
+// Token is an ERC-20 contract accepted as capital
+type Token struct {
+	Symbol   string
+	Contract string // lower-case contract address
+	Decimals int
+}
+
+// ErrAmountPrecision is returned for amounts that are not a whole number of base units
+var ErrAmountPrecision = errors.New("amount is more precise than the token's decimals")
+
+// TokenSymbols are the tokens capital can be supplied in
+var TokenSymbols = []string{"AAUD", "USDC", "USDT"}
+
+// TokensFromEnv returns the tokens with a contract configured in TOKEN_<SYMBOL>_ADDRESS,
+// with decimals from TOKEN_<SYMBOL>_DECIMALS (default 6). Tokens without a contract are
+// not watched.
+func TokensFromEnv() []Token {
+	var tokens []Token
+	for _, symbol := range TokenSymbols {
+		contract := os.Getenv("TOKEN_" + symbol + "_ADDRESS")
+		if contract == "" {
+			continue
+		}
+
+		tokens = append(tokens, Token{
+			Symbol:   symbol,
+			Contract: strings.ToLower(contract),
+			Decimals: config.EnvIntOrZero("TOKEN_"+symbol+"_DECIMALS", 6),
+		})
+	}
+	return tokens
+}
+
+// Amount converts a value in base units to whole tokens
+func (t Token) Amount(value *big.Int) float64 {
+	amount, _ := new(big.Float).Quo(new(big.Float).SetInt(value), new(big.Float).SetInt(t.unit())).Float64()
+	return amount
+}
+
+// BaseUnits converts an amount of whole tokens to base units, rounding to the nearest unit
+func (t Token) BaseUnits(amount float64) *big.Int {
+	units := new(big.Float).Mul(big.NewFloat(amount), new(big.Float).SetInt(t.unit()))
+	units.Add(units, big.NewFloat(0.5))
+	value, _ := units.Int(nil)
+	return value
+}
+
+// ParseBaseUnits converts a decimal amount of whole tokens, such as a DECIMAL column read
+// as text, to base units exactly. Amounts with more decimal places than the token are
+// rejected rather than rounded.
+func (t Token) ParseBaseUnits(amount string) (*big.Int, error) {
+	value, ok := new(big.Rat).SetString(amount)
+	if !ok {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+
+	value.Mul(value, new(big.Rat).SetInt(t.unit()))
+	if !value.IsInt() {
+		return nil, fmt.Errorf("%w: %s has more than %d decimal places", ErrAmountPrecision, amount, t.Decimals)
+	}
+	return new(big.Int).Set(value.Num()), nil
+}
+
+func (t Token) unit() *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(t.Decimals)), nil)
+}
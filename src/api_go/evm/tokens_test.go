@@ -0,0 +1,47 @@
+package evm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseBaseUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		decimals int
+		amount   string
+		want     string
+		wantErr  error
+	}{
+		{"6 decimals", 6, "1234.567891", "1234567891", nil},
+		{"DECIMAL column padding", 6, "10.00000000", "10000000", nil},
+		// 0.1 and 1e-18 are not representable as float64; parsed as text they are exact
+		{"18 decimals", 18, "0.1", "100000000000000000", nil},
+		{"18 decimals with 8 places", 18, "12345678.87654321", "12345678876543210000000000", nil},
+		{"whole amount", 18, "1000000000", "1000000000000000000000000000", nil},
+		{"more precise than the token", 6, "1.0000001", "", ErrAmountPrecision},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := Token{Symbol: "TEST", Decimals: tt.decimals}
+			got, err := token.ParseBaseUnits(tt.amount)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ParseBaseUnits(%q) error = %v, want %v", tt.amount, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseBaseUnits(%q): %v", tt.amount, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseBaseUnits(%q) = %s, want %s", tt.amount, got, tt.want)
+			}
+		})
+	}
+
+	if _, err := (Token{Decimals: 6}).ParseBaseUnits("ten"); err == nil {
+		t.Error("ParseBaseUnits accepted a non-numeric amount")
+	}
+}
@@ -0,0 +1,134 @@
+package evm
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ERC-20 function selectors
+const (
+	selectorTransfer  = "a9059cbb" // transfer(address,uint256)
+	selectorBalanceOf = "70a08231" // balanceOf(address)
+)
+
+// TxBackend is a Backend that can also provide what is needed to build transactions
+type TxBackend interface {
+	Backend
+	// ChainID returns the chain ID transactions are signed for
+	ChainID(ctx context.Context) (*big.Int, error)
+	// Balance returns the ether balance of address in wei
+	Balance(ctx context.Context, address string) (*big.Int, error)
+	// TokenBalance returns the ERC-20 balance of owner in the token's base units
+	TokenBalance(ctx context.Context, contract, owner string) (*big.Int, error)
+	// PendingNonce returns the next nonce of address, including pending transactions
+	PendingNonce(ctx context.Context, address string) (uint64, error)
+	// GasPrice returns the node's suggested gas price in wei
+	GasPrice(ctx context.Context) (*big.Int, error)
+}
+
+// ContractBackend calls contract functions, either read-only or as transactions sent from
+// accounts managed by the node or an external signer it is connected to, e.g. Clef or an
+// anvil/hardhat dev account
+type ContractBackend interface {
+	// Call executes a read-only call of to with data against the latest block and returns the
+	// hex-encoded result
+	Call(ctx context.Context, to, data string) (string, error)
+	// SendTransaction submits a contract call from from to to and returns its hash. The
+	// signer fills in the nonce, gas and fees.
+	SendTransaction(ctx context.Context, from, to, data string) (string, error)
+}
+
+// TxSender is a TxBackend that can also call contracts
+type TxSender interface {
+	TxBackend
+	ContractBackend
+}
+
+// UnsignedTx is an EIP-1559 transaction left for an offline signer. Quantities are hex
+// encoded as in JSON-RPC, so the JSON can be passed to most signing tools as is.
+type UnsignedTx struct {
+	Type                 string `json:"type"`
+	ChainID              string `json:"chainId"`
+	From                 string `json:"from"`
+	To                   string `json:"to"`
+	Nonce                string `json:"nonce"`
+	Value                string `json:"value"`
+	Data                 string `json:"data"`
+	Gas                  string `json:"gas"`
+	MaxFeePerGas         string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas"`
+	// DerivationPath is the BIP-44 path of the key that signs for From
+	DerivationPath string `json:"derivationPath,omitempty"`
+}
+
+// TransferTx is the parameters of an ERC-20 transfer transaction
+type TransferTx struct {
+	ChainID              *big.Int
+	Token                string
+	From                 string
+	To                   string
+	Value                *big.Int
+	Nonce                uint64
+	Gas                  uint64
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	DerivationPath       string
+}
+
+// Unsigned returns the transaction calling transfer(To, Value) on Token from From
+func (t TransferTx) Unsigned() UnsignedTx {
+	return UnsignedTx{
+		Type:                 "0x2",
+		ChainID:              formatBig(t.ChainID),
+		From:                 t.From,
+		To:                   t.Token,
+		Nonce:                formatQuantity(t.Nonce),
+		Value:                "0x0",
+		Data:                 TransferCalldata(t.To, t.Value),
+		Gas:                  formatQuantity(t.Gas),
+		MaxFeePerGas:         formatBig(t.MaxFeePerGas),
+		MaxPriorityFeePerGas: formatBig(t.MaxPriorityFeePerGas),
+		DerivationPath:       t.DerivationPath,
+	}
+}
+
+// TransferCalldata encodes an ERC-20 transfer(to, value) call
+func TransferCalldata(to string, value *big.Int) string {
+	return "0x" + selectorTransfer + encodeAddress(to) + encodeUint(value)
+}
+
+// BalanceOfCalldata encodes an ERC-20 balanceOf(owner) call
+func BalanceOfCalldata(owner string) string {
+	return "0x" + selectorBalanceOf + encodeAddress(owner)
+}
+
+// ParseUint decodes a uint256 returned by a contract call
+func ParseUint(data string) (*big.Int, error) {
+	hexData := strings.TrimPrefix(data, "0x")
+	if hexData == "" {
+		return new(big.Int), nil
+	}
+	if _, err := hex.DecodeString(hexData); err != nil {
+		return nil, fmt.Errorf("invalid uint256 %q: %w", data, err)
+	}
+	value, _ := new(big.Int).SetString(hexData, 16)
+	return value, nil
+}
+
+func encodeAddress(address string) string {
+	return strings.TrimPrefix(AddressTopic(address), "0x")
+}
+
+func encodeUint(value *big.Int) string {
+	return fmt.Sprintf("%064x", value)
+}
+
+func formatBig(n *big.Int) string {
+	if n == nil {
+		return "0x0"
+	}
+	return "0x" + n.Text(16)
+}
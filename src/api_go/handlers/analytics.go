@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"paperhands/api/analytics"
+	"paperhands/api/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAnalyticsMonths caps the range of analytics requests
+const maxAnalyticsMonths = 60
+
+// analyticsTimeout bounds the queries behind one analytics result
+const analyticsTimeout = 30 * time.Second
+
+// parseAnalyticsRange reads the from and to query params (RFC 3339 or YYYY-MM-DD), defaulting
+// to the last 12 months including the current one. It responds with 400 and returns false if
+// they are invalid.
+func parseAnalyticsRange(c *gin.Context) (analytics.Range, bool) {
+	now := time.Now().UTC()
+	r := analytics.Range{
+		From: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -11, 0),
+		To:   now,
+	}
+
+	if s := c.Query("from"); s != "" {
+		from, err := parseHistoryTime(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: use RFC 3339 or YYYY-MM-DD"})
+			return r, false
+		}
+		r.From = from
+	}
+
+	if s := c.Query("to"); s != "" {
+		to, err := parseHistoryTime(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: use RFC 3339 or YYYY-MM-DD"})
+			return r, false
+		}
+		r.To = to
+	}
+
+	if !r.From.Before(r.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return r, false
+	}
+
+	if r.To.After(r.From.AddDate(0, maxAnalyticsMonths, 0)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Range must not exceed 60 months"})
+		return r, false
+	}
+
+	return r, true
+}
+
+// analyticsHandler serves a cached analytics result for the request's date range.
+// The cache key is the route and raw query, so the default range is cached as one entry.
+func analyticsHandler(cache *analytics.Cache, name string, load func(ctx context.Context, r analytics.Range) (interface{}, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := parseAnalyticsRange(c)
+		if !ok {
+			return
+		}
+
+		result, err := cache.Get(c.FullPath()+"?"+c.Request.URL.RawQuery, func() (interface{}, error) {
+			// The load is shared with concurrent requests, so it isn't tied to this one
+			ctx, cancel := context.WithTimeout(context.Background(), analyticsTimeout)
+			defer cancel()
+			return load(ctx, r)
+		})
+		if err != nil {
+			log.Printf("Error computing %s analytics: %v", name, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to fetch " + name + " data"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// GetLoansLVR returns a handler for loans with collateral at risk bucketed by live LVR
+// Query params: from, to (loan creation dates)
+func GetLoansLVR(cache *analytics.Cache) gin.HandlerFunc {
+	return analyticsHandler(cache, "loans LVR", func(ctx context.Context, r analytics.Range) (interface{}, error) {
+		price, _, err := LatestBTCAUDPrice()
+		if err != nil {
+			return nil, err
+		}
+		return analytics.LoansByLVR(ctx, config.DB, r, price)
+	})
+}
+
+// GetCapitalUtilization returns a handler for monthly capital supplied vs lent out
+// Query params: from, to
+func GetCapitalUtilization(cache *analytics.Cache) gin.HandlerFunc {
+	return analyticsHandler(cache, "capital utilization", func(ctx context.Context, r analytics.Range) (interface{}, error) {
+		return analytics.CapitalUtilization(ctx, config.DB, r, TokenAUDPrice)
+	})
+}
+
+// GetInterestEarned returns a handler for monthly loan interest accrued
+// Query params: from, to
+func GetInterestEarned(cache *analytics.Cache) gin.HandlerFunc {
+	return analyticsHandler(cache, "interest earned", func(ctx context.Context, r analytics.Range) (interface{}, error) {
+		return analytics.InterestEarned(ctx, config.DB, r)
+	})
+}
+
+// GetAnalyticsSummary returns a handler for the headline figures of the lending book
+// Query params: from, to
+func GetAnalyticsSummary(cache *analytics.Cache) gin.HandlerFunc {
+	return analyticsHandler(cache, "summary", func(ctx context.Context, r analytics.Range) (interface{}, error) {
+		price, _, err := LatestBTCAUDPrice()
+		if err != nil {
+			return nil, err
+		}
+		return analytics.GetSummary(ctx, config.DB, r, price, TokenAUDPrice)
+	})
+}
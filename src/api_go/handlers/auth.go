@@ -20,6 +20,7 @@ type LoginRequest struct {
 type SignupRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
+	Role     string `json:"role" binding:"omitempty,oneof=borrower lender"`
 }
 
 type LoginResponse struct {
@@ -45,7 +46,7 @@ func Login(c *gin.Context) {
 	var hashedPassword string
 
 	query := `
-		SELECT id, email, password_hash, created_at, updated_at
+		SELECT id, email, role, password_hash, created_at, updated_at
 		FROM users
 		WHERE email = $1
 	`
@@ -53,6 +54,7 @@ func Login(c *gin.Context) {
 	err := config.DB.QueryRow(query, req.Email).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Role,
 		&hashedPassword,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -81,7 +83,7 @@ func Login(c *gin.Context) {
 	}
 
 	// Generate JWT token
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	token, err := utils.GenerateToken(user.ID, user.Email, user.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to generate authentication token",
@@ -146,17 +148,24 @@ func Signup(c *gin.Context) {
 		return
 	}
 
+	// Self-registered users can only be borrowers or lenders
+	role := req.Role
+	if role == "" {
+		role = models.RoleBorrower
+	}
+
 	// Insert user
 	var user models.User
 	const insertQuery string = `
-		INSERT INTO users (email, password_hash)
-		VALUES ($1, $2)
-		RETURNING id, email, created_at, updated_at
+		INSERT INTO users (email, password_hash, role)
+		VALUES ($1, $2, $3)
+		RETURNING id, email, role, created_at, updated_at
 	`
 
-	err = config.DB.QueryRow(insertQuery, req.Email, string(hashedPassword)).Scan(
+	err = config.DB.QueryRow(insertQuery, req.Email, string(hashedPassword), role).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -169,7 +178,7 @@ func Signup(c *gin.Context) {
 	}
 
 	// Generate JWT token for auto-login after signup
-	token, err := utils.GenerateToken(user.ID, user.Email)
+	token, err := utils.GenerateToken(user.ID, user.Email, user.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to generate authentication token",
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLoanBalance returns the principal, accrued interest, fees and payoff amount of a loan
+// Query params: asOf (YYYY-MM-DD, defaults to today)
+func GetLoanBalance(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	asOf := time.Now()
+	if asOfStr := c.Query("asOf"); asOfStr != "" {
+		asOf, err = time.Parse("2006-01-02", asOfStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid asOf date. Use YYYY-MM-DD"})
+			return
+		}
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	balance, err := services.LoanBalance(config.DB, id, asOf)
+	if errors.Is(err, services.ErrLoanNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error computing balance for loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute loan balance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
@@ -1,23 +1,20 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
-	"os"
 
-	"github.com/btcsuite/btcd/btcec/v2/schnorr"
-	"github.com/btcsuite/btcd/btcutil"
-	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/txscript"
-	"github.com/gin-gonic/gin"
-	"github.com/tyler-smith/go-bip39"
+	"paperhands/api/config"
+	"paperhands/api/services"
+	"paperhands/api/wallet"
 
-	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/gin-gonic/gin"
 )
 
 type BitcoinAddressRequest struct {
-	CustomerID int `json:"customerId" binding:"required"`
-	LoanID     int `json:"loanId" binding:"required"`
+	LoanID int `json:"loanId" binding:"required"`
 }
 
 type BitcoinAddressResponse struct {
@@ -27,146 +24,113 @@ type BitcoinAddressResponse struct {
 	Path       string `json:"path"`
 }
 
-// GenerateBitcoinAddress generates a Taproot (P2TR) address for a customer/loan
-// It supports two modes:
-// 1. XPUB mode (recommended): Uses an extended public key derived at m/86'/0'/0'
-//    This is more secure as the server never has access to private keys
-// 2. SEED mode (fallback): Uses a mnemonic seed phrase to derive keys
-//    Less secure as the server has access to private keys
+// Error definitions
+var (
+	ErrLoanNotOwned     = errors.New("loan does not belong to customer")
+	ErrDerivationFailed = errors.New("failed to derive deposit address")
+)
+
+// GenerateBitcoinAddress returns the Taproot (P2TR) deposit address for a customer/loan
+// The address is derived once and persisted on the loan record, so repeat calls
+// return the same address. Derivation is refused for loans that don't exist or
+// belong to another customer.
 func GenerateBitcoinAddress(c *gin.Context) {
 	var req BitcoinAddressRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "customerId and loanId are required"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "loanId is required"})
 		return
 	}
 
-	var accountKey *hdkeychain.ExtendedKey
-	var err error
-
-	// Try XPUB first (more secure - public keys only)
-	xpub := os.Getenv("XPUB")
-	if xpub != "" {
-		accountKey, err = hdkeychain.NewKeyFromString(xpub)
-		if err != nil {
-			log.Printf("Error parsing XPUB: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid XPUB"})
-			return
-		}
-
-		// Verify it's a public key (not private)
-		if accountKey.IsPrivate() {
-			log.Println("Warning: XPUB contains private key, consider using public key only for security")
-		}
-
-		log.Println("Using XPUB for address generation (public key only mode)")
-	} else {
-		// Fall back to SEED (less secure - has private keys)
-		seed := os.Getenv("SEED")
-		if seed == "" {
-			log.Println("Neither XPUB nor SEED environment variable configured")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "XPUB or SEED not configured"})
-			return
-		}
-
-		log.Println("Using SEED for address generation (private key mode)")
-
-		// Convert mnemonic to seed
-		seedBytes, err := bip39.NewSeedWithErrorChecking(seed, "")
-		if err != nil {
-			log.Printf("Error converting mnemonic to seed: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process seed"})
-			return
-		}
-
-		// Create HD wallet from seed (mainnet)
-		masterKey, err := hdkeychain.NewMaster(seedBytes, &chaincfg.MainNetParams)
-		if err != nil {
-			log.Printf("Error creating master key: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create master key"})
-			return
-		}
-
-		// Derive to account level: m/86'/0'/0'
-		// 86' = purpose (Taproot/BIP86)
-		// 0' = coin type (Bitcoin)
-		// 0' = account
-		hardenedPath := []uint32{
-			86 + hdkeychain.HardenedKeyStart,
-			0 + hdkeychain.HardenedKeyStart,
-			0 + hdkeychain.HardenedKeyStart,
-		}
-
-		accountKey = masterKey
-		for _, index := range hardenedPath {
-			accountKey, err = accountKey.Derive(index)
-			if err != nil {
-				log.Printf("Error deriving hardened key at index %d: %v", index, err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to derive key"})
-				return
-			}
-		}
-	}
-
-	// Derive non-hardened path: {customerId}/{loanId}
-	// This works with both xpub and full keys
-	key := accountKey
-	for _, index := range []uint32{uint32(req.CustomerID), uint32(req.LoanID)} {
-		key, err = key.Derive(index)
-		if err != nil {
-			log.Printf("Error deriving key at index %d: %v", index, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to derive key"})
-			return
-		}
+	customerID, ok := currentCustomerID(c, false)
+	if !ok {
+		return
 	}
 
-	// Get the public key
-	pubKey, err := key.ECPubKey()
+	tx, err := config.DB.Begin()
 	if err != nil {
-		log.Printf("Error getting public key: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get public key"})
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate address"})
 		return
 	}
+	defer tx.Rollback()
 
-	// Create Taproot address (P2TR)
-	// For a simple key-path spend, we use the public key directly as the internal key
-	internalKey := schnorr.SerializePubKey(pubKey)
-
-	// Create the taproot output key (with no script tree, just key path spend)
-	taprootKey := txscript.ComputeTaprootKeyNoScript(pubKey)
-
-	// Create the P2TR address
-	address, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(taprootKey), &chaincfg.MainNetParams)
-	if err != nil {
-		log.Printf("Error creating taproot address: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create address"})
+	address, path, err := assignDepositAddress(tx, customerID, req.LoanID)
+	switch {
+	case errors.Is(err, services.ErrLoanNotFound), errors.Is(err, ErrLoanNotOwned):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+		return
+	case errors.Is(err, wallet.ErrNotConfigured):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "XPUB or SEED not configured"})
+		return
+	case err != nil:
+		log.Printf("Error assigning deposit address for loan %d: %v", req.LoanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate address"})
 		return
 	}
 
-	pathStr := formatDerivationPath(req.CustomerID, req.LoanID)
-
-	log.Printf("Generated Taproot address for customer %d, loan %d: %s (internal key: %x)",
-		req.CustomerID, req.LoanID, address.EncodeAddress(), internalKey)
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing deposit address for loan %d: %v", req.LoanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate address"})
+		return
+	}
 
 	c.JSON(http.StatusOK, BitcoinAddressResponse{
-		Address:    address.EncodeAddress(),
-		CustomerID: req.CustomerID,
+		Address:    address,
+		CustomerID: customerID,
 		LoanID:     req.LoanID,
-		Path:       pathStr,
+		Path:       path,
 	})
 }
 
-func formatDerivationPath(customerID, loanID int) string {
-	return "m/86'/0'/0'/" + itoa(customerID) + "/" + itoa(loanID)
-}
+// assignDepositAddress derives and stores the deposit address for a loan within tx.
+// The loan row is locked so concurrent callers always observe the same address.
+func assignDepositAddress(tx *sql.Tx, customerID, loanID int) (string, string, error) {
+	var ownerID int
+	var depositAddress, derivationPath sql.NullString
+
+	err := tx.QueryRow(`
+		SELECT customer_id, deposit_address, derivation_path
+		FROM loans
+		WHERE id = $1
+		FOR UPDATE
+	`, loanID).Scan(&ownerID, &depositAddress, &derivationPath)
+
+	if err == sql.ErrNoRows {
+		return "", "", services.ErrLoanNotFound
+	}
+	if err != nil {
+		return "", "", err
+	}
 
-func itoa(i int) string {
-	if i == 0 {
-		return "0"
+	if ownerID != customerID {
+		return "", "", ErrLoanNotOwned
 	}
-	result := ""
-	for i > 0 {
-		result = string(rune('0'+i%10)) + result
-		i /= 10
+
+	// Already derived - return the stored address
+	if depositAddress.Valid && derivationPath.Valid {
+		return depositAddress.String, derivationPath.String, nil
+	}
+
+	derived, err := wallet.DeriveLoanAddress(customerID, loanID)
+	if err != nil {
+		if errors.Is(err, wallet.ErrNotConfigured) {
+			return "", "", err
+		}
+		log.Printf("Error deriving address for customer %d, loan %d: %v", customerID, loanID, err)
+		return "", "", ErrDerivationFailed
 	}
-	return result
+
+	_, err = tx.Exec(`
+		UPDATE loans
+		SET deposit_address = $1, derivation_path = $2, updated_at = NOW()
+		WHERE id = $3
+	`, derived.Address, derived.Path, loanID)
+	if err != nil {
+		return "", "", err
+	}
+
+	log.Printf("Generated Taproot address for customer %d, loan %d: %s (internal key: %x)",
+		customerID, loanID, derived.Address, derived.InternalKey)
+
+	return derived.Address, derived.Path, nil
 }
@@ -1,16 +1,23 @@
 package handlers
 
 import (
-	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"paperhands/api/config"
+	"paperhands/api/evm"
+	"paperhands/api/middleware"
 	"paperhands/api/models"
+	"paperhands/api/services"
+	"paperhands/api/wallet"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,16 +25,30 @@ import (
 var validTokens = []string{"AAUD", "USDC", "USDT"}
 
 type CreateCapitalSupplyRequest struct {
-	UserID        int     `json:"userId" binding:"required"`
-	Token         string  `json:"token" binding:"required"`
-	Amount        float64 `json:"amount" binding:"required"`
-	WalletAddress string  `json:"walletAddress" binding:"required"`
-	TxHash        string  `json:"txHash"`
+	Token         string      `json:"token" binding:"required"`
+	Amount        json.Number `json:"amount" binding:"required"`
+	WalletAddress string      `json:"walletAddress" binding:"required"`
+	TxHash        string      `json:"txHash"`
 }
 
 type GenerateDepositAddressRequest struct {
-	UserID int    `json:"userId" binding:"required"`
-	Token  string `json:"token" binding:"required"`
+	Token string `json:"token" binding:"required"`
+}
+
+func isValidTxHash(hash string) bool {
+	if len(hash) != 66 || !strings.HasPrefix(hash, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(hash[2:])
+	return err == nil
+}
+
+func isValidEthAddress(address string) bool {
+	if len(address) != 42 || !strings.HasPrefix(address, "0x") {
+		return false
+	}
+	_, err := hex.DecodeString(address[2:])
+	return err == nil
 }
 
 func isValidToken(token string) bool {
@@ -39,26 +60,29 @@ func isValidToken(token string) bool {
 	return false
 }
 
-func generateEthAddress() string {
-	bytes := make([]byte, 20)
-	rand.Read(bytes)
-	return "0x" + hex.EncodeToString(bytes)
-}
-
-// GetCapitalSupplies returns capital supplies with optional filters
+// GetCapitalSupplies returns the authenticated user's capital supplies with optional filters
+// Staff see all supplies and may filter by userId.
 func GetCapitalSupplies(c *gin.Context) {
-	userIDStr := c.Query("userId")
 	token := c.Query("token")
 	status := c.Query("status")
 
 	query := `
-		SELECT id, user_id, token, amount, wallet_address, tx_hash, status, created_at, updated_at
+		SELECT id, user_id, token, amount, wallet_address, tx_hash, block_number, status, rejection_reason, created_at, updated_at
 		FROM capital_supplies
 		WHERE 1=1
 	`
 	params := []interface{}{}
 	paramCount := 1
 
+	userIDStr := c.Query("userId")
+	if !middleware.IsStaff(c) {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return
+		}
+		userIDStr = strconv.Itoa(userID)
+	}
+
 	if userIDStr != "" {
 		userID, err := strconv.Atoi(userIDStr)
 		if err != nil {
@@ -102,7 +126,9 @@ func GetCapitalSupplies(c *gin.Context) {
 			&supply.Amount,
 			&supply.WalletAddress,
 			&supply.TxHash,
+			&supply.BlockNumber,
 			&supply.Status,
+			&supply.RejectionReason,
 			&supply.CreatedAt,
 			&supply.UpdatedAt,
 		)
@@ -121,11 +147,16 @@ func CreateCapitalSupply(c *gin.Context) {
 	var req CreateCapitalSupplyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "userId, token, amount, and walletAddress are required",
+			"error": "token, amount, and walletAddress are required",
 		})
 		return
 	}
 
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
 	if !isValidToken(req.Token) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("Invalid token. Must be one of: %v", validTokens),
@@ -133,23 +164,67 @@ func CreateCapitalSupply(c *gin.Context) {
 		return
 	}
 
+	// The amount is kept as a decimal so base units are exact even for 18-decimal tokens
+	amount, ok := new(big.Rat).SetString(req.Amount.String())
+	if !ok || amount.Sign() <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
+		return
+	}
+	if !new(big.Rat).Mul(amount, big.NewRat(1e8, 1)).IsInt() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount cannot have more than 8 decimal places"})
+		return
+	}
+	amountText := amount.FloatString(8)
+
+	baseUnits, err := supplyBaseUnits(req.Token, amountText)
+	if errors.Is(err, evm.ErrAmountPrecision) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error converting capital supply amount: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create capital supply"})
+		return
+	}
+
+	// The tx hash is a claim verified by the capital watcher; it can't fund a second supply
 	var txHash sql.NullString
 	if req.TxHash != "" {
-		txHash = sql.NullString{String: req.TxHash, Valid: true}
+		if !isValidTxHash(req.TxHash) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "txHash must be a 0x-prefixed 32-byte hex hash"})
+			return
+		}
+		txHash = sql.NullString{String: strings.ToLower(req.TxHash), Valid: true}
+
+		var claimed bool
+		err := config.DB.QueryRow(
+			"SELECT EXISTS (SELECT 1 FROM capital_supplies WHERE tx_hash = $1 AND status <> $2)",
+			txHash.String, models.CapitalStatusRejected,
+		).Scan(&claimed)
+		if err != nil {
+			log.Printf("Error checking capital supply tx hash: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create capital supply"})
+			return
+		}
+		if claimed {
+			c.JSON(http.StatusConflict, gin.H{"error": "Transaction already recorded as a capital supply"})
+			return
+		}
 	}
 
 	query := `
-		INSERT INTO capital_supplies (user_id, token, amount, wallet_address, tx_hash, status)
-		VALUES ($1, $2, $3, $4, $5, 'pending')
-		RETURNING id, user_id, token, amount, wallet_address, tx_hash, status, created_at, updated_at
+		INSERT INTO capital_supplies (user_id, token, amount, amount_base_units, wallet_address, tx_hash, status)
+		VALUES ($1, $2, $3, $4, $5, $6, 'pending')
+		RETURNING id, user_id, token, amount, wallet_address, tx_hash, block_number, status, rejection_reason, created_at, updated_at
 	`
 
 	var supply models.CapitalSupply
-	err := config.DB.QueryRow(
+	err = config.DB.QueryRow(
 		query,
-		req.UserID,
+		userID,
 		req.Token,
-		req.Amount,
+		amountText,
+		baseUnits,
 		req.WalletAddress,
 		txHash,
 	).Scan(
@@ -159,7 +234,9 @@ func CreateCapitalSupply(c *gin.Context) {
 		&supply.Amount,
 		&supply.WalletAddress,
 		&supply.TxHash,
+		&supply.BlockNumber,
 		&supply.Status,
+		&supply.RejectionReason,
 		&supply.CreatedAt,
 		&supply.UpdatedAt,
 	)
@@ -170,21 +247,137 @@ func CreateCapitalSupply(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Created capital supply %d for user %d: %f %s", supply.ID, req.UserID, req.Amount, req.Token)
+	log.Printf("Created capital supply %d for user %d: %s %s", supply.ID, userID, amountText, req.Token)
 
 	c.JSON(http.StatusCreated, supply.ToResponse())
 }
 
+// supplyBaseUnits converts a supplied decimal amount to the token's base units, or NULL if
+// the token has no contract configured. The capital watcher matches supplies to transfers on
+// this value.
+func supplyBaseUnits(symbol string, amount string) (sql.NullString, error) {
+	for _, token := range evm.TokensFromEnv() {
+		if token.Symbol == symbol {
+			units, err := token.ParseBaseUnits(amount)
+			if err != nil {
+				return sql.NullString{}, err
+			}
+			return sql.NullString{String: units.String(), Valid: true}, nil
+		}
+	}
+	return sql.NullString{}, nil
+}
+
+// ConfirmCapitalSupply marks a pending capital supply as confirmed (staff only)
+// Only supplies the capital watcher has matched to an on-chain Transfer log can be
+// confirmed, so shares are never minted against an unverified claim.
+func ConfirmCapitalSupply(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid capital supply ID"})
+		return
+	}
+
+	var status string
+	var matched bool
+	err = config.DB.QueryRow("SELECT status, log_index IS NOT NULL FROM capital_supplies WHERE id = $1", id).Scan(&status, &matched)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Capital supply not found"})
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error fetching capital supply %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm capital supply"})
+		return
+	}
+
+	if status != models.CapitalStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending capital supplies can be confirmed"})
+		return
+	}
+
+	if !matched {
+		c.JSON(http.StatusConflict, gin.H{"error": "Capital supply has not been matched to an on-chain transfer"})
+		return
+	}
+
+	query := `
+		UPDATE capital_supplies
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2 AND status = $3 AND log_index IS NOT NULL
+		RETURNING id, user_id, token, amount, wallet_address, tx_hash, block_number, status, rejection_reason, created_at, updated_at
+	`
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm capital supply"})
+		return
+	}
+	defer tx.Rollback()
+
+	var supply models.CapitalSupply
+	err = tx.QueryRow(query, models.CapitalStatusConfirmed, id, models.CapitalStatusPending).Scan(
+		&supply.ID,
+		&supply.UserID,
+		&supply.Token,
+		&supply.Amount,
+		&supply.WalletAddress,
+		&supply.TxHash,
+		&supply.BlockNumber,
+		&supply.Status,
+		&supply.RejectionReason,
+		&supply.CreatedAt,
+		&supply.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		// Confirmed or rejected concurrently
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending capital supplies can be confirmed"})
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error confirming capital supply %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm capital supply"})
+		return
+	}
+
+	if _, err := services.MintPoolShares(tx, id); err != nil {
+		log.Printf("Error minting pool shares for capital supply %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm capital supply"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing capital supply confirmation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm capital supply"})
+		return
+	}
+
+	userID, _ := middleware.GetUserIDFromContext(c)
+	log.Printf("Capital supply %d confirmed by user %d", id, userID)
+
+	c.JSON(http.StatusOK, supply.ToResponse())
+}
+
 // GenerateDepositAddress generates or retrieves a deposit address
 func GenerateDepositAddress(c *gin.Context) {
 	var req GenerateDepositAddressRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "userId and token are required",
+			"error": "token is required",
 		})
 		return
 	}
 
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
 	if !isValidToken(req.Token) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": fmt.Sprintf("Invalid token. Must be one of: %v", validTokens),
@@ -198,10 +391,11 @@ func GenerateDepositAddress(c *gin.Context) {
 		SELECT id, address, created_at
 		FROM deposit_addresses
 		WHERE user_id = $1 AND token = $2 AND status = 'active' AND swept = FALSE
+			AND derivation_index IS NOT NULL
 		ORDER BY created_at DESC LIMIT 1
 	`
 
-	err := config.DB.QueryRow(checkQuery, req.UserID, req.Token).Scan(
+	err := config.DB.QueryRow(checkQuery, userID, req.Token).Scan(
 		&existing.ID,
 		&existing.Address,
 		&existing.CreatedAt,
@@ -225,62 +419,48 @@ func GenerateDepositAddress(c *gin.Context) {
 		return
 	}
 
-	// Generate new address
-	depositAddress := generateEthAddress()
-
-	insertQuery := `
-		INSERT INTO deposit_addresses (user_id, token, address, status, swept)
-		VALUES ($1, $2, $3, 'active', FALSE)
-		RETURNING id, user_id, token, address, status, swept, created_at
-	`
-
-	var newAddr models.DepositAddress
-	err = config.DB.QueryRow(insertQuery, req.UserID, req.Token, depositAddress).Scan(
-		&newAddr.ID,
-		&newAddr.UserID,
-		&newAddr.Token,
-		&newAddr.Address,
-		&newAddr.Status,
-		&newAddr.Swept,
-		&newAddr.CreatedAt,
-	)
-
+	// Derive a new address from the next unused index
+	tx, err := config.DB.Begin()
 	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate deposit address"})
+		return
+	}
+	defer tx.Rollback()
+
+	newAddr, err := services.CreateDepositAddress(tx, userID, req.Token)
+	switch {
+	case errors.Is(err, wallet.ErrEthNotConfigured):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ETH_XPUB or SEED not configured"})
+		return
+	case err != nil:
 		log.Printf("Error creating deposit address: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate deposit address"})
 		return
 	}
 
-	log.Printf("Generated deposit address %s for user %d: %s", depositAddress, req.UserID, req.Token)
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing deposit address: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate deposit address"})
+		return
+	}
+
+	log.Printf("Generated deposit address %s (%s) for user %d: %s", newAddr.Address, newAddr.DerivationPath.String, userID, req.Token)
 
-	c.JSON(http.StatusCreated, gin.H{
-		"id":        newAddr.ID,
-		"userId":    newAddr.UserID,
-		"token":     newAddr.Token,
-		"address":   newAddr.Address,
-		"status":    newAddr.Status,
-		"swept":     newAddr.Swept,
-		"createdAt": newAddr.CreatedAt,
-		"isNew":     true,
-	})
+	resp := newAddr.ToResponse()
+	resp["isNew"] = true
+	c.JSON(http.StatusCreated, resp)
 }
 
-// GetDepositAddresses returns deposit addresses for a user
+// GetDepositAddresses returns the authenticated user's deposit addresses
 func GetDepositAddresses(c *gin.Context) {
-	userIDStr := c.Query("userId")
-	if userIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "userId is required"})
-		return
-	}
-
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userId"})
+	userID, ok := currentUserID(c)
+	if !ok {
 		return
 	}
 
 	query := `
-		SELECT id, user_id, token, address, status, swept, created_at, updated_at
+		SELECT id, user_id, token, address, derivation_index, derivation_path, status, swept, created_at, updated_at
 		FROM deposit_addresses
 		WHERE user_id = $1
 		ORDER BY created_at DESC
@@ -302,6 +482,8 @@ func GetDepositAddresses(c *gin.Context) {
 			&addr.UserID,
 			&addr.Token,
 			&addr.Address,
+			&addr.DerivationIndex,
+			&addr.DerivationPath,
 			&addr.Status,
 			&addr.Swept,
 			&addr.CreatedAt,
@@ -311,17 +493,77 @@ func GetDepositAddresses(c *gin.Context) {
 			log.Printf("Error scanning deposit address: %v", err)
 			continue
 		}
-		addresses = append(addresses, map[string]interface{}{
-			"id":        addr.ID,
-			"userId":    addr.UserID,
-			"token":     addr.Token,
-			"address":   addr.Address,
-			"status":    addr.Status,
-			"swept":     addr.Swept,
-			"createdAt": addr.CreatedAt,
-			"updatedAt": addr.UpdatedAt,
-		})
+		addresses = append(addresses, addr.ToResponse())
 	}
 
 	c.JSON(http.StatusOK, addresses)
 }
+
+// VerifyDepositAddress re-derives a deposit address from its stored index and reports
+// whether it matches the stored address. Borrowers may verify their own addresses; staff
+// may verify any.
+func VerifyDepositAddress(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deposit address ID"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var addr models.DepositAddress
+	err = config.DB.QueryRow(`
+		SELECT id, user_id, address, derivation_index, derivation_path
+		FROM deposit_addresses
+		WHERE id = $1
+	`, id).Scan(&addr.ID, &addr.UserID, &addr.Address, &addr.DerivationIndex, &addr.DerivationPath)
+
+	if err == sql.ErrNoRows || (err == nil && addr.UserID != userID && !middleware.IsStaff(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deposit address not found"})
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error fetching deposit address %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify deposit address"})
+		return
+	}
+
+	resp := gin.H{
+		"id":             addr.ID,
+		"address":        addr.Address,
+		"derivationPath": nil,
+		"derivedAddress": nil,
+		"valid":          false,
+	}
+
+	// Addresses generated before HD derivation have no index and no known key
+	if !addr.DerivationIndex.Valid {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	derived, err := wallet.DeriveEthAddress(int(addr.DerivationIndex.Int64))
+	switch {
+	case errors.Is(err, wallet.ErrEthNotConfigured):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "ETH_XPUB or SEED not configured"})
+		return
+	case err != nil:
+		log.Printf("Error deriving deposit address %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify deposit address"})
+		return
+	}
+
+	valid := derived.Address == addr.Address && derived.Path == addr.DerivationPath.String
+	if !valid {
+		log.Printf("Warning: deposit address %d (%s) does not match %s derived at %s", id, addr.Address, derived.Address, derived.Path)
+	}
+
+	resp["derivationPath"] = derived.Path
+	resp["derivedAddress"] = derived.Address
+	resp["valid"] = valid
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"paperhands/api/config"
+	"paperhands/api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLoanCollateral returns the funding UTXOs recorded for a loan's deposit address
+func GetLoanCollateral(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	query := `
+		SELECT id, loan_id, address, txid, vout, amount_sats, block_height, confirmations, spent, created_at, updated_at
+		FROM loan_collateral_utxos
+		WHERE loan_id = $1
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := config.DB.Query(query, id)
+	if err != nil {
+		log.Printf("Error querying collateral utxos: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collateral"})
+		return
+	}
+	defer rows.Close()
+
+	var confirmedSats, pendingSats int64
+	utxos := []map[string]interface{}{}
+	for rows.Next() {
+		var utxo models.CollateralUTXO
+		err := rows.Scan(
+			&utxo.ID,
+			&utxo.LoanID,
+			&utxo.Address,
+			&utxo.TxID,
+			&utxo.Vout,
+			&utxo.AmountSats,
+			&utxo.BlockHeight,
+			&utxo.Confirmations,
+			&utxo.Spent,
+			&utxo.CreatedAt,
+			&utxo.UpdatedAt,
+		)
+		if err != nil {
+			log.Printf("Error scanning collateral utxo: %v", err)
+			continue
+		}
+
+		if !utxo.Spent {
+			if utxo.Confirmations > 0 {
+				confirmedSats += utxo.AmountSats
+			} else {
+				pendingSats += utxo.AmountSats
+			}
+		}
+
+		utxos = append(utxos, utxo.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"loanId":       id,
+		"confirmedBtc": float64(confirmedSats) / 1e8,
+		"pendingBtc":   float64(pendingSats) / 1e8,
+		"utxos":        utxos,
+	})
+}
@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/disburse"
+	"paperhands/api/models"
+	"paperhands/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateDisbursementRequest struct {
+	Method           string `json:"method" binding:"required"`
+	RecipientAddress string `json:"recipientAddress" binding:"required"`
+}
+
+// CreateDisbursement queues the payout of a collateralised loan's principal (staff only). The
+// recipient is the borrower's wallet for on_chain payouts, or their bank account registered with
+// the exchange for api payouts. Requests are idempotent per loan: if the loan already has a
+// disbursement it is returned with 200 instead of creating another.
+func CreateDisbursement(processor *disburse.Processor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+			return
+		}
+
+		var req CreateDisbursementRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "method and recipientAddress are required"})
+			return
+		}
+
+		userID, ok := currentUserID(c)
+		if !ok {
+			return
+		}
+
+		if !models.IsValidDisbursementMethod(req.Method) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid method. Must be one of: %s, %s", models.DisbursementMethodOnChain, models.DisbursementMethodAPI),
+			})
+			return
+		}
+
+		if _, ok := processor.Rail(req.Method); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("No payout rail is configured for %s disbursements", req.Method)})
+			return
+		}
+
+		recipient := strings.TrimSpace(req.RecipientAddress)
+		if req.Method == models.DisbursementMethodOnChain {
+			recipient = strings.ToLower(recipient)
+			if !isValidEthAddress(recipient) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "recipientAddress must be a 0x-prefixed 20-byte hex address"})
+				return
+			}
+		}
+
+		tx, err := config.DB.Begin()
+		if err != nil {
+			log.Printf("Error starting transaction: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create disbursement"})
+			return
+		}
+		defer tx.Rollback()
+
+		d, created, err := services.CreateDisbursement(tx, services.DisbursementInput{
+			LoanID:           id,
+			Method:           req.Method,
+			RecipientAddress: recipient,
+			CreatedBy:        userID,
+		})
+		switch {
+		case errors.Is(err, services.ErrLoanNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+			return
+		case errors.Is(err, services.ErrLoanNotDisbursable):
+			c.JSON(http.StatusConflict, gin.H{"error": "Only collateralised loans can be disbursed"})
+			return
+		case err != nil:
+			log.Printf("Error creating disbursement for loan %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create disbursement"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			log.Printf("Error committing disbursement for loan %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create disbursement"})
+			return
+		}
+
+		if !created {
+			c.JSON(http.StatusOK, d.ToResponse())
+			return
+		}
+
+		log.Printf("Disbursement %d of loan %d queued: %.2f AUD via %s to %s by user %d",
+			d.ID, id, d.AmountAUD, d.Method, d.RecipientAddress, userID)
+		c.JSON(http.StatusCreated, d.ToResponse())
+	}
+}
+
+// GetLoanDisbursement returns the disbursement of a loan
+func GetLoanDisbursement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	d, err := services.GetLoanDisbursement(config.DB, id)
+	if errors.Is(err, services.ErrDisbursementNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan has no disbursement"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching disbursement of loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch disbursement"})
+		return
+	}
+
+	c.JSON(http.StatusOK, d.ToResponse())
+}
+
+// RetryDisbursement sends a loan's failed disbursement again on the processor's next run,
+// including one that has used up its automatic retries (staff only)
+func RetryDisbursement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry disbursement"})
+		return
+	}
+	defer tx.Rollback()
+
+	d, err := services.RetryDisbursement(tx, id)
+	switch {
+	case errors.Is(err, services.ErrDisbursementNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan has no disbursement"})
+		return
+	case errors.Is(err, services.ErrDisbursementNotRetryable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only failed disbursements can be retried"})
+		return
+	case err != nil:
+		log.Printf("Error retrying disbursement of loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry disbursement"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing disbursement retry of loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry disbursement"})
+		return
+	}
+
+	c.JSON(http.StatusOK, d.ToResponse())
+}
+
+// GetDisbursements returns disbursements, newest first (staff only)
+// Query params: status, method
+func GetDisbursements(c *gin.Context) {
+	query := "SELECT " + services.DisbursementColumns + " FROM disbursements WHERE 1=1"
+	params := []interface{}{}
+	paramCount := 1
+
+	if status := c.Query("status"); status != "" {
+		query += fmt.Sprintf(" AND status = $%d", paramCount)
+		params = append(params, status)
+		paramCount++
+	}
+
+	if method := c.Query("method"); method != "" {
+		query += fmt.Sprintf(" AND method = $%d", paramCount)
+		params = append(params, method)
+		paramCount++
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	rows, err := config.DB.Query(query, params...)
+	if err != nil {
+		log.Printf("Error querying disbursements: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch disbursements"})
+		return
+	}
+	defer rows.Close()
+
+	disbursements := []map[string]interface{}{}
+	for rows.Next() {
+		d, err := services.ScanDisbursement(rows)
+		if err != nil {
+			log.Printf("Error scanning disbursement: %v", err)
+			continue
+		}
+		disbursements = append(disbursements, d.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, disbursements)
+}
+
+// GetOnChainDisbursements returns the payouts indexed from the Disbursement contract's events,
+// newest first (staff only). Unmatched payouts have no disbursement recording their transaction.
+// Query params: status, loanId
+func GetOnChainDisbursements(c *gin.Context) {
+	query := "SELECT " + services.OnChainDisbursementColumns + " FROM onchain_disbursements WHERE 1=1"
+	params := []interface{}{}
+	paramCount := 1
+
+	if status := c.Query("status"); status != "" {
+		query += fmt.Sprintf(" AND status = $%d", paramCount)
+		params = append(params, status)
+		paramCount++
+	}
+
+	if loanID := c.Query("loanId"); loanID != "" {
+		id, err := strconv.Atoi(loanID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loanId"})
+			return
+		}
+		query += fmt.Sprintf(" AND loan_id = $%d", paramCount)
+		params = append(params, id)
+		paramCount++
+	}
+
+	query += " ORDER BY block_number DESC, log_index DESC"
+
+	rows, err := config.DB.Query(query, params...)
+	if err != nil {
+		log.Printf("Error querying on-chain disbursements: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch on-chain disbursements"})
+		return
+	}
+	defer rows.Close()
+
+	payouts := []map[string]interface{}{}
+	for rows.Next() {
+		o, err := services.ScanOnChainDisbursement(rows)
+		if err != nil {
+			log.Printf("Error scanning on-chain disbursement: %v", err)
+			continue
+		}
+		payouts = append(payouts, o.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, payouts)
+}
+
+// GetDisbursementBalance returns the AUD a payout rail has available (staff only)
+func GetDisbursementBalance(processor *disburse.Processor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Param("method")
+		rail, ok := processor.Rail(method)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No payout rail is configured for %s disbursements", method)})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+
+		balance, err := rail.Balance(ctx)
+		if err != nil {
+			log.Printf("Error fetching %s disbursement balance: %v", method, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Balance is unavailable"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"method":     method,
+			"balanceAud": balance,
+		})
+	}
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"paperhands/api/chain"
+	"paperhands/api/config"
+	"paperhands/api/middleware"
+	"paperhands/api/models"
+	"paperhands/api/risk"
+	"paperhands/api/services"
+	"paperhands/api/wallet"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StartLiquidationRequest struct {
+	FeeRate int64  `json:"feeRate" binding:"required"` // sat/vB
+	Reason  string `json:"reason"`
+	Force   bool   `json:"force"`
+}
+
+type SettleLiquidationRequest struct {
+	SweepTxID   string   `json:"sweepTxid" binding:"required"`
+	ProceedsAUD *float64 `json:"proceedsAud" binding:"required"`
+}
+
+// exchangeAddress returns the exchange deposit address liquidated collateral is swept to
+func exchangeAddress() (string, error) {
+	address := os.Getenv("LIQUIDATION_EXCHANGE_ADDRESS")
+	if address == "" {
+		return "", errors.New("LIQUIDATION_EXCHANGE_ADDRESS not configured")
+	}
+	if err := wallet.ValidateAddress(address); err != nil {
+		return "", fmt.Errorf("LIQUIDATION_EXCHANGE_ADDRESS: %w", err)
+	}
+	return address, nil
+}
+
+// StartLiquidation returns a handler that liquidates a loan which has breached its
+// liquidation LVR (staff only). The loan is frozen in the liquidating status and an
+// unsigned PSBT sweeping its collateral to LIQUIDATION_EXCHANGE_ADDRESS is returned for
+// offline signing, together with the expected AUD proceeds at the current price.
+// Set force to liquidate a loan below the threshold, e.g. on default.
+func StartLiquidation(backend chain.Backend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+			return
+		}
+
+		var req StartLiquidationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "feeRate is required"})
+			return
+		}
+
+		if req.FeeRate < 1 || req.FeeRate > wallet.MaxFeeRate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "feeRate must be between 1 and 1000 sat/vB"})
+			return
+		}
+
+		destination, err := exchangeAddress()
+		if err != nil {
+			log.Printf("Error reading exchange address: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Exchange deposit address not configured"})
+			return
+		}
+
+		if !authorizeLoan(c, id) {
+			return
+		}
+
+		actorID, ok := currentUserID(c)
+		if !ok {
+			return
+		}
+
+		var status string
+		var depositAddress, derivationPath sql.NullString
+		err = config.DB.QueryRow(
+			"SELECT status, deposit_address, derivation_path FROM loans WHERE id = $1", id,
+		).Scan(&status, &depositAddress, &derivationPath)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+			return
+		}
+
+		if err != nil {
+			log.Printf("Error fetching loan %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start liquidation"})
+			return
+		}
+
+		if status != models.LoanStatusDisbursed && status != models.LoanStatusActive {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Cannot liquidate a %s loan", status)})
+			return
+		}
+
+		if !depositAddress.Valid || !derivationPath.Valid {
+			c.JSON(http.StatusConflict, gin.H{"error": "Loan has no deposit address"})
+			return
+		}
+
+		price, stale, err := LatestBTCAUDPrice()
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "BTC price unavailable"})
+			return
+		}
+
+		if stale && !req.Force {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "BTC price is stale; retry later or set force"})
+			return
+		}
+
+		loanAddress, ok := loanSweepAddress(c, id, derivationPath.String, depositAddress.String)
+		if !ok {
+			return
+		}
+
+		utxos, err := backend.AddressUTXOs(c.Request.Context(), loanAddress.Address)
+		if err != nil {
+			log.Printf("Error fetching UTXOs for %s: %v", loanAddress.Address, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch UTXOs from chain backend"})
+			return
+		}
+
+		sweep, err := wallet.BuildSweepPSBT(loanAddress, utxos, destination, req.FeeRate)
+		switch {
+		case errors.Is(err, wallet.ErrNoInputs):
+			c.JSON(http.StatusConflict, gin.H{"error": "No confirmed collateral UTXOs at the deposit address"})
+			return
+		case errors.Is(err, wallet.ErrDustOutput):
+			c.JSON(http.StatusConflict, gin.H{"error": "Collateral does not cover the fee at this fee rate"})
+			return
+		case errors.Is(err, wallet.ErrNoFingerprint):
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "XPUB_FINGERPRINT not configured"})
+			return
+		case err != nil:
+			log.Printf("Error building sweep PSBT for loan %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start liquidation"})
+			return
+		}
+
+		tx, err := config.DB.Begin()
+		if err != nil {
+			log.Printf("Error starting transaction: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start liquidation"})
+			return
+		}
+		defer tx.Rollback()
+
+		liquidation, err := services.StartLiquidation(tx, id, services.LiquidationInput{
+			ExchangeAddress: destination,
+			PSBT:            sweep.PSBT,
+			InputSats:       sweep.InputSats,
+			FeeSats:         sweep.FeeSats,
+			SweepSats:       sweep.OutputSats,
+			BTCPrice:        price,
+			Thresholds:      risk.ThresholdsFromEnv(),
+			Force:           req.Force,
+			Reason:          req.Reason,
+			InitiatedBy:     actorID,
+		}, time.Now())
+		switch {
+		case errors.Is(err, services.ErrLoanNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+			return
+		case errors.Is(err, services.ErrNotLiquidatable),
+			errors.Is(err, services.ErrLiquidationInProgress),
+			errors.Is(err, services.ErrBelowLiquidationLVR),
+			errors.Is(err, services.ErrInvalidTransition):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Error starting liquidation of loan %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start liquidation"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			log.Printf("Error committing liquidation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start liquidation"})
+			return
+		}
+
+		log.Printf("Loan %d liquidating by user %d: sweeping %d sats to %s, expected proceeds %.2f AUD",
+			id, actorID, sweep.OutputSats, destination, liquidation.ExpectedProceedsAUD)
+
+		c.JSON(http.StatusCreated, liquidation.ToResponse())
+	}
+}
+
+// GetLoanLiquidation returns the liquidation of a loan
+func GetLoanLiquidation(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	liquidation, err := services.ScanLiquidation(config.DB.QueryRow(
+		"SELECT "+services.LiquidationColumns+" FROM loan_liquidations WHERE loan_id = $1", id,
+	))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan has not been liquidated"})
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error fetching liquidation of loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch liquidation"})
+		return
+	}
+
+	resp := liquidation.ToResponse()
+
+	// Only staff need the unsigned sweep transaction
+	if !middleware.IsStaff(c) {
+		delete(resp, "psbt")
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// SettleLiquidation reconciles a liquidation once the collateral watcher has seen the sweep
+// transaction confirm and the BTC has been sold (staff only). sweepTxid must be the txid of
+// the liquidation's PSBT and proceedsAud is the AUD actually received from the exchange.
+func SettleLiquidation(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	var req SettleLiquidationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sweepTxid and proceedsAud are required"})
+		return
+	}
+
+	req.SweepTxID = strings.ToLower(strings.TrimSpace(req.SweepTxID))
+	if raw, err := hex.DecodeString(req.SweepTxID); err != nil || len(raw) != 32 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sweepTxid"})
+		return
+	}
+
+	if *req.ProceedsAUD < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "proceedsAud cannot be negative"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	actorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle liquidation"})
+		return
+	}
+	defer tx.Rollback()
+
+	liquidation, credit, err := services.SettleLiquidation(tx, id, req.SweepTxID, *req.ProceedsAUD, actorID)
+	switch {
+	case errors.Is(err, services.ErrLiquidationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan has not been liquidated"})
+		return
+	case errors.Is(err, services.ErrSweepTxIDMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrLiquidationSettled),
+		errors.Is(err, services.ErrSweepUnconfirmed),
+		errors.Is(err, services.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error settling liquidation of loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle liquidation"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing liquidation settlement: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle liquidation"})
+		return
+	}
+
+	log.Printf("Liquidation of loan %d settled by user %d: proceeds %.2f AUD, surplus %.2f AUD, shortfall %.2f AUD",
+		id, actorID, liquidation.ProceedsAUD.Float64, liquidation.SurplusAUD.Float64, liquidation.ShortfallAUD.Float64)
+
+	resp := gin.H{
+		"liquidation": liquidation.ToResponse(),
+		"credit":      nil,
+	}
+	if credit != nil {
+		resp["credit"] = credit.ToResponse()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetLiquidations returns all liquidations, newest first (staff only)
+// Query params: status
+func GetLiquidations(c *gin.Context) {
+	query := "SELECT " + services.LiquidationColumns + " FROM loan_liquidations"
+	params := []interface{}{}
+
+	if status := c.Query("status"); status != "" {
+		query += " WHERE status = $1"
+		params = append(params, status)
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	rows, err := config.DB.Query(query, params...)
+	if err != nil {
+		log.Printf("Error querying liquidations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch liquidations"})
+		return
+	}
+	defer rows.Close()
+
+	liquidations := []map[string]interface{}{}
+	for rows.Next() {
+		liquidation, err := services.ScanLiquidation(rows)
+		if err != nil {
+			log.Printf("Error scanning liquidation: %v", err)
+			continue
+		}
+		liquidations = append(liquidations, liquidation.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, liquidations)
+}
+
+// GetCredits returns the caller's credits, such as liquidation surpluses owed to them
+// Staff see all credits and may filter by customerId.
+func GetCredits(c *gin.Context) {
+	query := `
+		SELECT id, customer_id, loan_id, amount_aud, reason, status, created_at, updated_at
+		FROM customer_credits
+	`
+	params := []interface{}{}
+
+	customerIDStr := c.Query("customerId")
+	if !middleware.IsStaff(c) {
+		customerID, ok := currentCustomerID(c, false)
+		if !ok {
+			return
+		}
+		customerIDStr = strconv.Itoa(customerID)
+	}
+
+	if customerIDStr != "" {
+		customerID, err := strconv.Atoi(customerIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customerId"})
+			return
+		}
+		query += " WHERE customer_id = $1"
+		params = append(params, customerID)
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	rows, err := config.DB.Query(query, params...)
+	if err != nil {
+		log.Printf("Error querying credits: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch credits"})
+		return
+	}
+	defer rows.Close()
+
+	credits := []map[string]interface{}{}
+	for rows.Next() {
+		var credit models.CustomerCredit
+		err := rows.Scan(
+			&credit.ID,
+			&credit.CustomerID,
+			&credit.LoanID,
+			&credit.AmountAUD,
+			&credit.Reason,
+			&credit.Status,
+			&credit.CreatedAt,
+			&credit.UpdatedAt,
+		)
+		if err != nil {
+			log.Printf("Error scanning credit: %v", err)
+			continue
+		}
+		credits = append(credits, credit.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, credits)
+}
@@ -2,55 +2,116 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"paperhands/api/config"
+	"paperhands/api/interest"
+	"paperhands/api/middleware"
 	"paperhands/api/models"
+	"paperhands/api/rates"
+	"paperhands/api/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 type CreateLoanRequest struct {
-	CustomerID         int     `json:"customerId" binding:"required"`
-	AmountAUD          float64 `json:"amountAud" binding:"required"`
-	CollateralBTC      float64 `json:"collateralBtc" binding:"required"`
-	BTCPriceAtCreation float64 `json:"btcPriceAtCreation" binding:"required"`
+	QuoteID string `json:"quoteId" binding:"required"`
+	// AmountAUD may be lower than the quoted maximum; defaults to the maximum
+	AmountAUD float64 `json:"amountAud"`
 }
 
-// GetLoans returns all loans with optional filters
+// loanColumns is the column list scanned by scanLoan
+const loanColumns = `
+	id,
+	customer_id,
+	amount_aud,
+	collateral_btc,
+	btc_price_at_creation,
+	status,
+	deposit_address,
+	derivation_path,
+	COALESCE(annual_interest_rate, 0),
+	rate_utilisation,
+	COALESCE(admin_fee_rate, 0),
+	COALESCE(admin_fee_aud, 0),
+	COALESCE(term_months, 0),
+	COALESCE(principal_outstanding_aud, amount_aud),
+	COALESCE(accrued_interest_aud, 0),
+	COALESCE(fees_paid_aud, 0),
+	COALESCE(interest_paid_aud, 0),
+	interest_accrued_through,
+	disbursed_at,
+	btc_return_address,
+	created_at,
+	updated_at
+`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLoan scans a row selected with loanColumns into a Loan
+func scanLoan(row rowScanner) (models.Loan, error) {
+	var loan models.Loan
+	err := row.Scan(
+		&loan.ID,
+		&loan.CustomerID,
+		&loan.AmountAUD,
+		&loan.CollateralBTC,
+		&loan.BTCPriceAtCreation,
+		&loan.Status,
+		&loan.DepositAddress,
+		&loan.DerivationPath,
+		&loan.AnnualInterestRate,
+		&loan.RateUtilisation,
+		&loan.AdminFeeRate,
+		&loan.AdminFeeAUD,
+		&loan.TermMonths,
+		&loan.PrincipalOutstandingAUD,
+		&loan.AccruedInterestAUD,
+		&loan.FeesPaidAUD,
+		&loan.InterestPaidAUD,
+		&loan.InterestAccruedThrough,
+		&loan.DisbursedAt,
+		&loan.BTCReturnAddress,
+		&loan.CreatedAt,
+		&loan.UpdatedAt,
+	)
+	return loan, err
+}
+
+// GetLoans returns the authenticated customer's loans with optional filters
+// Staff see all loans and may filter by customerId.
 func GetLoans(c *gin.Context) {
-	customerID := c.Query("customerId")
 	status := c.Query("status")
 
-	query := `
-		SELECT
-			id,
-			customer_id,
-			amount_aud,
-			collateral_btc,
-			btc_price_at_creation,
-			status,
-			deposit_address,
-			derivation_path,
-			created_at,
-			updated_at
-		FROM loans
-		WHERE 1=1
-	`
+	query := "SELECT " + loanColumns + " FROM loans WHERE 1=1"
 	params := []interface{}{}
 	paramCount := 1
 
-	if customerID != "" {
-		query += fmt.Sprintf(" AND customer_id = $%d", paramCount)
-		custID, err := strconv.Atoi(customerID)
+	customerIDStr := c.Query("customerId")
+	if !middleware.IsStaff(c) {
+		customerID, ok := currentCustomerID(c, false)
+		if !ok {
+			return
+		}
+		customerIDStr = strconv.Itoa(customerID)
+	}
+
+	if customerIDStr != "" {
+		customerID, err := strconv.Atoi(customerIDStr)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customerId"})
 			return
 		}
-		params = append(params, custID)
+		query += fmt.Sprintf(" AND customer_id = $%d", paramCount)
+		params = append(params, customerID)
 		paramCount++
 	}
 
@@ -72,19 +133,7 @@ func GetLoans(c *gin.Context) {
 
 	loans := []map[string]interface{}{}
 	for rows.Next() {
-		var loan models.Loan
-		err := rows.Scan(
-			&loan.ID,
-			&loan.CustomerID,
-			&loan.AmountAUD,
-			&loan.CollateralBTC,
-			&loan.BTCPriceAtCreation,
-			&loan.Status,
-			&loan.DepositAddress,
-			&loan.DerivationPath,
-			&loan.CreatedAt,
-			&loan.UpdatedAt,
-		)
+		loan, err := scanLoan(rows)
 		if err != nil {
 			log.Printf("Error scanning loan: %v", err)
 			continue
@@ -104,35 +153,13 @@ func GetLoanByID(c *gin.Context) {
 		return
 	}
 
-	query := `
-		SELECT
-			id,
-			customer_id,
-			amount_aud,
-			collateral_btc,
-			btc_price_at_creation,
-			status,
-			deposit_address,
-			derivation_path,
-			created_at,
-			updated_at
-		FROM loans
-		WHERE id = $1
-	`
+	if !authorizeLoan(c, id) {
+		return
+	}
 
-	var loan models.Loan
-	err = config.DB.QueryRow(query, id).Scan(
-		&loan.ID,
-		&loan.CustomerID,
-		&loan.AmountAUD,
-		&loan.CollateralBTC,
-		&loan.BTCPriceAtCreation,
-		&loan.Status,
-		&loan.DepositAddress,
-		&loan.DerivationPath,
-		&loan.CreatedAt,
-		&loan.UpdatedAt,
-	)
+	query := "SELECT " + loanColumns + " FROM loans WHERE id = $1"
+
+	loan, err := scanLoan(config.DB.QueryRow(query, id))
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
@@ -148,39 +175,85 @@ func GetLoanByID(c *gin.Context) {
 	c.JSON(http.StatusOK, loan.ToResponse())
 }
 
-// CreateLoan creates a new loan
+// CreateLoan creates a new loan from a quote
+// The BTC price and required collateral are taken from the quote, which is single use.
+// The Taproot deposit address is derived and stored in the same transaction,
+// so a loan is never created without its collateral address.
 func CreateLoan(c *gin.Context) {
 	var req CreateLoanRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "customerId, amountAud, collateralBtc, and btcPriceAtCreation are required",
-		})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quoteId is required"})
 		return
 	}
 
-	query := `
-		INSERT INTO loans (customer_id, amount_aud, collateral_btc, btc_price_at_creation, status)
-		VALUES ($1, $2, $3, $4, 'pending')
-		RETURNING id, customer_id, amount_aud, collateral_btc, btc_price_at_creation, status, created_at, updated_at
-	`
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
 
-	var loan models.Loan
-	err := config.DB.QueryRow(
-		query,
-		req.CustomerID,
-		req.AmountAUD,
-		req.CollateralBTC,
-		req.BTCPriceAtCreation,
-	).Scan(
-		&loan.ID,
-		&loan.CustomerID,
-		&loan.AmountAUD,
-		&loan.CollateralBTC,
-		&loan.BTCPriceAtCreation,
-		&loan.Status,
-		&loan.CreatedAt,
-		&loan.UpdatedAt,
-	)
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loan"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The borrower is always the authenticated user
+	customerID, err := ensureCustomerID(tx, userID)
+	if err != nil {
+		log.Printf("Error resolving customer for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loan"})
+		return
+	}
+
+	// Price and collateral come from the quote, never from the client
+	quoted, err := services.RedeemQuote(tx, req.QuoteID, userID, req.AmountAUD, time.Now())
+	switch {
+	case errors.Is(err, services.ErrInvalidQuote), errors.Is(err, services.ErrQuoteNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quote"})
+		return
+	case errors.Is(err, services.ErrQuoteExpired), errors.Is(err, services.ErrQuoteUsed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidLoanAmount), errors.Is(err, services.ErrAmountExceedsQuote):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error redeeming quote for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loan"})
+		return
+	}
+
+	terms := interest.TermsFromEnv()
+
+	// The rate at the current utilisation is fixed for the life of the loan
+	rate, err := rates.Current(tx, TokenAUDPrice, rates.ModelFromEnv())
+	if err != nil {
+		log.Printf("Error pricing loan interest rate: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Interest rate is unavailable"})
+		return
+	}
+
+	var loanID int
+	err = tx.QueryRow(`
+		INSERT INTO loans (
+			customer_id, amount_aud, collateral_btc, btc_price_at_creation, status,
+			annual_interest_rate, rate_utilisation, admin_fee_rate, admin_fee_aud, term_months, principal_outstanding_aud
+		)
+		VALUES ($1, $2, $3, $4, 'pending', $5, $6, $7, $8, $9, $2)
+		RETURNING id
+	`,
+		customerID,
+		quoted.AmountAUD,
+		quoted.CollateralBTC,
+		quoted.Quote.BTCPrice,
+		rate.BorrowAPR,
+		rate.Utilisation,
+		terms.AdminFeeRate,
+		terms.AdminFee(quoted.AmountAUD),
+		terms.TermMonths,
+	).Scan(&loanID)
 
 	if err != nil {
 		log.Printf("Error creating loan: %v", err)
@@ -188,12 +261,46 @@ func CreateLoan(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Created pending loan %d for customer %d", loan.ID, req.CustomerID)
+	if err := services.MarkQuoteUsed(tx, quoted.Quote.ID, loanID); err != nil {
+		log.Printf("Error marking quote %s used for loan %d: %v", quoted.Quote.ID, loanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loan"})
+		return
+	}
+
+	if err := services.RecordLoanStatus(tx, loanID, "", models.LoanStatusPending, userID, "Loan created"); err != nil {
+		log.Printf("Error recording status for loan %d: %v", loanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loan"})
+		return
+	}
+
+	if _, _, err := assignDepositAddress(tx, customerID, loanID); err != nil {
+		log.Printf("Error assigning deposit address for loan %d: %v", loanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate deposit address"})
+		return
+	}
+
+	loan, err := scanLoan(tx.QueryRow("SELECT "+loanColumns+" FROM loans WHERE id = $1", loanID))
+	if err != nil {
+		log.Printf("Error fetching created loan %d: %v", loanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loan"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing loan: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create loan"})
+		return
+	}
+
+	log.Printf("Created pending loan %d for customer %d", loan.ID, customerID)
 
 	c.JSON(http.StatusCreated, loan.ToResponse())
 }
 
-// UpdateLoanStatus updates the status of a loan
+// UpdateLoanStatus moves a loan to a new status
+// Only transitions allowed by the loan lifecycle are accepted; every change is
+// recorded in loan_status_history. Statuses owned by the collateral watcher,
+// disbursements, repayments and liquidations cannot be set here.
 func UpdateLoanStatus(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -204,43 +311,115 @@ func UpdateLoanStatus(c *gin.Context) {
 
 	var req struct {
 		Status string `json:"status" binding:"required"`
+		Reason string `json:"reason"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "status is required"})
 		return
 	}
 
-	query := `
-		UPDATE loans
-		SET status = $1, updated_at = NOW()
-		WHERE id = $2
-		RETURNING id, customer_id, amount_aud, collateral_btc, btc_price_at_creation, status, deposit_address, derivation_path, created_at, updated_at
-	`
+	if models.IsSystemLoanStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Status %s is set by the system and cannot be set directly", req.Status)})
+		return
+	}
 
-	var loan models.Loan
-	err = config.DB.QueryRow(query, req.Status, id).Scan(
-		&loan.ID,
-		&loan.CustomerID,
-		&loan.AmountAUD,
-		&loan.CollateralBTC,
-		&loan.BTCPriceAtCreation,
-		&loan.Status,
-		&loan.DepositAddress,
-		&loan.DerivationPath,
-		&loan.CreatedAt,
-		&loan.UpdatedAt,
-	)
+	if !authorizeLoan(c, id) {
+		return
+	}
 
-	if err == sql.ErrNoRows {
+	actorID, _ := middleware.GetUserIDFromContext(c)
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update loan"})
+		return
+	}
+	defer tx.Rollback()
+
+	from, err := services.TransitionLoanStatus(tx, id, req.Status, actorID, req.Reason)
+	switch {
+	case errors.Is(err, services.ErrLoanNotFound):
 		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
 		return
+	case errors.Is(err, services.ErrInvalidStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid status: %s", req.Status)})
+		return
+	case errors.Is(err, services.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("Cannot transition loan from %s to %s", from, req.Status),
+		})
+		return
+	case err != nil:
+		log.Printf("Error updating loan: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update loan"})
+		return
 	}
 
+	loan, err := scanLoan(tx.QueryRow("SELECT "+loanColumns+" FROM loans WHERE id = $1", id))
 	if err != nil {
-		log.Printf("Error updating loan: %v", err)
+		log.Printf("Error fetching loan %d: %v", id, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update loan"})
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing loan status: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update loan"})
+		return
+	}
+
+	log.Printf("Loan %d transitioned from %s to %s by user %d", id, from, req.Status, actorID)
+
 	c.JSON(http.StatusOK, loan.ToResponse())
 }
+
+// GetLoanHistory returns the status history of a loan, oldest first
+func GetLoanHistory(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	query := `
+		SELECT id, loan_id, from_status, to_status, actor_user_id, reason, created_at
+		FROM loan_status_history
+		WHERE loan_id = $1
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := config.DB.Query(query, id)
+	if err != nil {
+		log.Printf("Error querying loan history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loan history"})
+		return
+	}
+	defer rows.Close()
+
+	history := []map[string]interface{}{}
+	for rows.Next() {
+		var entry models.LoanStatusHistory
+		err := rows.Scan(
+			&entry.ID,
+			&entry.LoanID,
+			&entry.FromStatus,
+			&entry.ToStatus,
+			&entry.ActorUserID,
+			&entry.Reason,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			log.Printf("Error scanning loan history: %v", err)
+			continue
+		}
+		history = append(history, entry.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, history)
+}
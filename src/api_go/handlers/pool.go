@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"paperhands/api/config"
+	"paperhands/api/middleware"
+	"paperhands/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCapitalPositions returns the authenticated lender's pool positions: principal supplied,
+// shares held, their current value and the yield earned. Staff may pass userId to view
+// another lender's positions.
+func GetCapitalPositions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if userIDStr := c.Query("userId"); userIDStr != "" && middleware.IsStaff(c) {
+		parsed, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userId"})
+			return
+		}
+		userID = parsed
+	}
+
+	positions, err := services.GetPoolPositions(config.DB, userID)
+	if err != nil {
+		log.Printf("Error fetching pool positions for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch capital positions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, positions)
+}
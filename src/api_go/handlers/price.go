@@ -1,115 +1,204 @@
 package handlers
 
 import (
-	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"paperhands/api/config"
+	"paperhands/api/oracle"
+	"paperhands/api/pricefeed"
+	"paperhands/api/pricehistory"
 )
 
-type PriceCache struct {
-	Price     float64
-	Timestamp time.Time
-	mu        sync.RWMutex
+type PriceResponse struct {
+	Pair      string                `json:"pair"`
+	Price     float64               `json:"price"`
+	Currency  string                `json:"currency"`
+	UpdatedAt time.Time             `json:"updatedAt"`
+	Cached    bool                  `json:"cached"`
+	Stale     bool                  `json:"stale,omitempty"`
+	Sources   []oracle.SourceResult `json:"sources,omitempty"`
 }
 
-type CoinGeckoResponse struct {
-	Bitcoin struct {
-		AUD float64 `json:"aud"`
-	} `json:"bitcoin"`
-}
+// priceRefresher keeps prices in memory; handlers never fetch prices themselves
+var priceRefresher *pricefeed.Refresher
 
-type PriceResponse struct {
-	Price    float64 `json:"price"`
-	Currency string  `json:"currency"`
-	Cached   bool    `json:"cached"`
-	Stale    bool    `json:"stale,omitempty"`
+// ErrPriceUnavailable is returned when no price has been fetched yet
+var ErrPriceUnavailable = errors.New("price unavailable")
+
+// SetPriceRefresher sets the background refresher prices are read from
+func SetPriceRefresher(r *pricefeed.Refresher) {
+	priceRefresher = r
 }
 
-var (
-	priceCache = &PriceCache{}
-	cacheTTL   = 60 * time.Second // 1 minute cache
-)
+// RecordPriceHistory stores refreshed BTC/AUD prices in the price history.
+// It is the price refresher's OnRefresh hook.
+func RecordPriceHistory(result oracle.Result) {
+	if result.Pair != oracle.BTCAUD {
+		return
+	}
+
+	accepted := acceptedSources(result.Sources)
+	if err := pricehistory.Record(config.DB, result.Price, pricehistory.SourceOracle, accepted, time.Now()); err != nil {
+		log.Printf("Error recording BTC price history: %v", err)
+	}
+}
 
-// GetBTCAUDPrice returns the current BTC/AUD price
-func GetBTCAUDPrice(c *gin.Context) {
-	// Check cache
-	priceCache.mu.RLock()
-	if priceCache.Price > 0 && time.Since(priceCache.Timestamp) < cacheTTL {
-		price := priceCache.Price
-		priceCache.mu.RUnlock()
-		c.JSON(http.StatusOK, PriceResponse{
-			Price:    price,
-			Currency: "AUD",
-			Cached:   true,
-		})
+// GetPrice returns the current price of a pair written as base-quote, e.g. btc-aud or
+// usdc-aud, and the sources it was aggregated from
+func GetPrice(c *gin.Context) {
+	pair, err := oracle.ParsePair(c.Param("pair"))
+	if err != nil {
+		pairs := make([]string, 0, len(oracle.SupportedPairs))
+		for _, supported := range oracle.SupportedPairs {
+			pairs = append(pairs, supported.String())
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unsupported pair", "pairs": pairs})
 		return
 	}
-	priceCache.mu.RUnlock()
 
-	// Fetch from CoinGecko API
-	resp, err := http.Get("https://api.coingecko.com/api/v3/simple/price?ids=bitcoin&vs_currencies=aud")
+	resp, err := LatestPrice(pair)
 	if err != nil {
-		log.Printf("Error fetching BTC price: %v", err)
-		returnCachedOrError(c)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("%s price unavailable", pair)})
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("CoinGecko API error: %d", resp.StatusCode)
-		returnCachedOrError(c)
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetPriceMetrics returns the refresh state of each pair and the latency and errors of
+// each upstream pair and price source
+func GetPriceMetrics(c *gin.Context) {
+	if priceRefresher == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Price refresher not running"})
 		return
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	pairs, sources := priceRefresher.Metrics.Snapshot()
+
+	c.JSON(http.StatusOK, gin.H{
+		"pairs":    priceRefresher.Statuses(),
+		"upstream": pairs,
+		"sources":  sources,
+	})
+}
+
+// LatestPrice returns the last refreshed price of pair from memory, so Cached is always set.
+// Stale is set when the price is older than the pair's max age, e.g. because upstream
+// refreshes are failing.
+func LatestPrice(pair oracle.Pair) (PriceResponse, error) {
+	resp := PriceResponse{Pair: pair.String(), Currency: pair.Quote}
+
+	if priceRefresher == nil {
+		return resp, ErrPriceUnavailable
+	}
+
+	entry, err := priceRefresher.Latest(pair)
 	if err != nil {
-		log.Printf("Error reading response: %v", err)
-		returnCachedOrError(c)
-		return
+		return resp, fmt.Errorf("%w: %v", ErrPriceUnavailable, err)
 	}
 
-	var data CoinGeckoResponse
-	if err := json.Unmarshal(body, &data); err != nil {
-		log.Printf("Error parsing response: %v", err)
-		returnCachedOrError(c)
-		return
+	resp.Price = entry.Price
+	resp.UpdatedAt = entry.UpdatedAt
+	resp.Cached = true
+	resp.Stale = entry.Stale
+	resp.Sources = entry.Sources
+	return resp, nil
+}
+
+// LatestBTCAUDPrice returns the BTC/AUD price as LatestPrice does
+func LatestBTCAUDPrice() (price float64, stale bool, err error) {
+	resp, err := LatestPrice(oracle.BTCAUD)
+	return resp.Price, resp.Stale, err
+}
+
+// GetBTCAUDPriceHistory returns OHLC candles of the stored BTC/AUD price history
+// Query params: from, to (RFC 3339 or YYYY-MM-DD, default the last 24 hours), interval (default 1h)
+func GetBTCAUDPriceHistory(c *gin.Context) {
+	to := time.Now().UTC()
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := parseHistoryTime(toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time. Use RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		to = parsed
 	}
 
-	price := data.Bitcoin.AUD
+	from := to.Add(-24 * time.Hour)
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := parseHistoryTime(fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time. Use RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		from = parsed
+	}
 
-	// Update cache
-	priceCache.mu.Lock()
-	priceCache.Price = price
-	priceCache.Timestamp = time.Now()
-	priceCache.mu.Unlock()
+	interval := c.DefaultQuery("interval", "1h")
 
-	log.Printf("Fetched BTC/AUD price: %.2f", price)
+	candles, err := pricehistory.Candles(config.DB, from, to, interval)
+	switch {
+	case errors.Is(err, pricehistory.ErrInvalidInterval):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interval", "intervals": pricehistory.IntervalNames()})
+		return
+	case errors.Is(err, pricehistory.ErrInvalidRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	case errors.Is(err, pricehistory.ErrTooManyCandles):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Time range too large for interval"})
+		return
+	case err != nil:
+		log.Printf("Error fetching BTC price history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch BTC price history"})
+		return
+	}
 
-	c.JSON(http.StatusOK, PriceResponse{
-		Price:    price,
-		Currency: "AUD",
-		Cached:   false,
+	c.JSON(http.StatusOK, gin.H{
+		"currency": "AUD",
+		"interval": interval,
+		"from":     from,
+		"to":       to,
+		"candles":  candles,
 	})
 }
 
-func returnCachedOrError(c *gin.Context) {
-	priceCache.mu.RLock()
-	defer priceCache.mu.RUnlock()
-
-	if priceCache.Price > 0 {
-		c.JSON(http.StatusOK, PriceResponse{
-			Price:    priceCache.Price,
-			Currency: "AUD",
-			Cached:   true,
-			Stale:    true,
-		})
-		return
+// parseHistoryTime parses an RFC 3339 timestamp or a YYYY-MM-DD date (midnight UTC)
+func parseHistoryTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
 	}
+	return time.Parse("2006-01-02", s)
+}
 
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch BTC price"})
+func acceptedSources(sources []oracle.SourceResult) int {
+	n := 0
+	for _, s := range sources {
+		if s.Status == oracle.StatusAccepted {
+			n++
+		}
+	}
+	return n
+}
+
+// TokenAUDPrice returns the AUD value of one unit of a capital token for internal consumers
+// such as the pool interest distributor. AAUD is pegged 1:1; USDC and USDT use the latest
+// price, including a stale one.
+func TokenAUDPrice(token string) (float64, error) {
+	switch token {
+	case "AAUD":
+		return 1, nil
+	case "USDC":
+		resp, err := LatestPrice(oracle.USDCAUD)
+		return resp.Price, err
+	case "USDT":
+		resp, err := LatestPrice(oracle.USDTAUD)
+		return resp.Price, err
+	}
+	return 0, fmt.Errorf("no AUD price for token %s", token)
 }
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateQuoteRequest struct {
+	AmountAUD float64 `json:"amountAud" binding:"required"`
+	// LVR is the loan-to-value ratio to borrow at, e.g. 0.5; defaults to LOAN_DEFAULT_LVR
+	LVR float64 `json:"lvr"`
+}
+
+// CreateQuote locks the current oracle BTC/AUD price and the collateral required for a loan.
+// The returned quote ID is signed and must be passed to CreateLoan before it expires.
+func CreateQuote(c *gin.Context) {
+	var req CreateQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amountAud is required"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	// Never quote from a stale price
+	price, stale, err := LatestBTCAUDPrice()
+	if err != nil || stale {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "BTC price unavailable, try again shortly"})
+		return
+	}
+
+	terms := services.QuoteTermsFromEnv()
+
+	quote, err := services.CreateQuote(config.DB, userID, req.AmountAUD, req.LVR, price, terms, time.Now())
+	switch {
+	case errors.Is(err, services.ErrInvalidLoanAmount), errors.Is(err, services.ErrInvalidLVR):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error creating quote for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create quote"})
+		return
+	}
+
+	signedID, err := services.SignQuoteID(quote.ID)
+	if err != nil {
+		log.Printf("Error signing quote %s: %v", quote.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create quote"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, quote.ToResponse(signedID))
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"paperhands/api/config"
+	"paperhands/api/rates"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRates returns the current borrower APR and lender APY from the utilisation-based rate model,
+// with the utilisation they were computed at and the model's parameters
+func GetRates(c *gin.Context) {
+	current, err := rates.Current(config.DB, TokenAUDPrice, rates.ModelFromEnv())
+	if err != nil {
+		log.Printf("Error computing rates: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Rates are unavailable"})
+		return
+	}
+
+	c.JSON(http.StatusOK, current)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"paperhands/api/chain"
+	"paperhands/api/config"
+	"paperhands/api/models"
+	"paperhands/api/services"
+	"paperhands/api/wallet"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReleasePSBTRequest struct {
+	FeeRate int64 `json:"feeRate" binding:"required"` // sat/vB
+}
+
+// CreateReleasePSBT returns a handler that builds an unsigned PSBT returning a repaid
+// loan's collateral to the borrower's return address (staff only). The PSBT spends every
+// confirmed UTXO at the loan's deposit address and includes BIP-86 derivation info for
+// the stored derivation path, so it can be signed offline when the server only has an XPUB.
+func CreateReleasePSBT(backend chain.Backend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idStr := c.Param("id")
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+			return
+		}
+
+		var req ReleasePSBTRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "feeRate is required"})
+			return
+		}
+
+		if req.FeeRate < 1 || req.FeeRate > wallet.MaxFeeRate {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "feeRate must be between 1 and 1000 sat/vB"})
+			return
+		}
+
+		if !authorizeLoan(c, id) {
+			return
+		}
+
+		var status string
+		var depositAddress, derivationPath sql.NullString
+		err = config.DB.QueryRow(
+			"SELECT status, deposit_address, derivation_path FROM loans WHERE id = $1", id,
+		).Scan(&status, &depositAddress, &derivationPath)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+			return
+		}
+
+		if err != nil {
+			log.Printf("Error fetching loan %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build release PSBT"})
+			return
+		}
+
+		if status != models.LoanStatusRepaid {
+			c.JSON(http.StatusConflict, gin.H{"error": "Collateral can only be released once the loan is repaid"})
+			return
+		}
+
+		if !depositAddress.Valid || !derivationPath.Valid {
+			c.JSON(http.StatusConflict, gin.H{"error": "Loan has no deposit address"})
+			return
+		}
+
+		release, err := services.FindCollateralRelease(config.DB, id)
+		if err != nil {
+			log.Printf("Error fetching collateral release for loan %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build release PSBT"})
+			return
+		}
+
+		if release == nil || !release.ReturnAddress.Valid {
+			c.JSON(http.StatusConflict, gin.H{"error": "Borrower has not set a BTC return address"})
+			return
+		}
+
+		if release.Status == models.CollateralReleaseReleased {
+			c.JSON(http.StatusConflict, gin.H{"error": "Collateral has already been released"})
+			return
+		}
+
+		loanAddress, ok := loanSweepAddress(c, id, derivationPath.String, depositAddress.String)
+		if !ok {
+			return
+		}
+
+		utxos, err := backend.AddressUTXOs(c.Request.Context(), loanAddress.Address)
+		if err != nil {
+			log.Printf("Error fetching UTXOs for %s: %v", loanAddress.Address, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch UTXOs from chain backend"})
+			return
+		}
+
+		built, err := wallet.BuildSweepPSBT(loanAddress, utxos, release.ReturnAddress.String, req.FeeRate)
+		switch {
+		case errors.Is(err, wallet.ErrNoInputs):
+			c.JSON(http.StatusConflict, gin.H{"error": "No confirmed collateral UTXOs at the deposit address"})
+			return
+		case errors.Is(err, wallet.ErrDustOutput):
+			c.JSON(http.StatusConflict, gin.H{"error": "Collateral does not cover the fee at this fee rate"})
+			return
+		case errors.Is(err, wallet.ErrNoFingerprint):
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "XPUB_FINGERPRINT not configured"})
+			return
+		case err != nil:
+			log.Printf("Error building release PSBT for loan %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build release PSBT"})
+			return
+		}
+
+		tx, err := config.DB.Begin()
+		if err != nil {
+			log.Printf("Error starting transaction: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build release PSBT"})
+			return
+		}
+		defer tx.Rollback()
+
+		release, err = services.RecordReleasePSBT(tx, id, built.PSBT, built.FeeRate, built.FeeSats)
+		if err != nil {
+			log.Printf("Error storing release PSBT for loan %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build release PSBT"})
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			log.Printf("Error committing release PSBT: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build release PSBT"})
+			return
+		}
+
+		log.Printf("Built release PSBT for loan %d: %d inputs, %d sats to %s (fee %d sats)",
+			id, built.InputCount, built.OutputSats, built.Destination, built.FeeSats)
+
+		c.JSON(http.StatusOK, gin.H{
+			"loanId":      id,
+			"psbt":        built.PSBT,
+			"inputCount":  built.InputCount,
+			"inputSats":   built.InputSats,
+			"outputSats":  built.OutputSats,
+			"feeSats":     built.FeeSats,
+			"feeRate":     built.FeeRate,
+			"vsize":       built.VSize,
+			"destination": built.Destination,
+			"release":     release.ToResponse(),
+		})
+	}
+}
+
+// loanSweepAddress re-derives the key of a loan's deposit address so its collateral can be spent.
+// It responds with 500 and returns false if the wallet is not configured or no longer matches.
+func loanSweepAddress(c *gin.Context, loanID int, path, depositAddress string) (*wallet.LoanAddress, bool) {
+	loanAddress, err := wallet.LoanAddressFromPath(path, depositAddress)
+	if errors.Is(err, wallet.ErrNotConfigured) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "XPUB or SEED not configured"})
+		return nil, false
+	}
+
+	if errors.Is(err, wallet.ErrPathMismatch) {
+		log.Printf("Error deriving address for loan %d: %v", loanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Deposit address does not match configured wallet"})
+		return nil, false
+	}
+
+	if err != nil {
+		log.Printf("Error deriving address for loan %d: %v", loanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to derive deposit key"})
+		return nil, false
+	}
+
+	return loanAddress, true
+}
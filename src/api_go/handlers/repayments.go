@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/models"
+	"paperhands/api/services"
+	"paperhands/api/wallet"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateRepaymentRequest struct {
+	Amount    float64 `json:"amount" binding:"required"`
+	Currency  string  `json:"currency"`
+	AmountAUD float64 `json:"amountAud"`
+	Reference string  `json:"reference"`
+	TxHash    string  `json:"txHash"`
+}
+
+type ReturnAddressRequest struct {
+	Address string `json:"address" binding:"required"`
+}
+
+// CreateRepayment records a repayment against a loan (staff only)
+// AUD repayments need a bank reference; stablecoin repayments need a tx hash.
+// USDC and USDT repayments must include the AUD value received in amountAud.
+func CreateRepayment(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	var req CreateRepaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount is required"})
+		return
+	}
+
+	req.Currency = strings.ToUpper(req.Currency)
+	if req.Currency == "" {
+		req.Currency = models.RepaymentCurrencyAUD
+	}
+
+	if !models.IsValidRepaymentCurrency(req.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency. Must be AUD, AAUD, USDC or USDT"})
+		return
+	}
+
+	if req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be positive"})
+		return
+	}
+
+	// AAUD is pegged 1:1 to AUD; other stablecoins are converted by the operator
+	if req.Currency == models.RepaymentCurrencyAUD || req.Currency == models.RepaymentCurrencyAAUD {
+		req.AmountAUD = req.Amount
+	} else if req.AmountAUD <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amountAud is required for " + req.Currency + " repayments"})
+		return
+	}
+
+	// Hashes are stored lower-case so the same transfer cannot be recorded twice in another case
+	req.TxHash = strings.ToLower(strings.TrimSpace(req.TxHash))
+	if models.IsStablecoin(req.Currency) && req.TxHash == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "txHash is required for stablecoin repayments"})
+		return
+	}
+
+	if req.Currency == models.RepaymentCurrencyAUD && req.Reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reference is required for AUD repayments"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	actorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record repayment"})
+		return
+	}
+	defer tx.Rollback()
+
+	repayment, release, err := services.RecordRepayment(tx, id, services.RepaymentInput{
+		Currency:   req.Currency,
+		Amount:     req.Amount,
+		AmountAUD:  req.AmountAUD,
+		Reference:  req.Reference,
+		TxHash:     req.TxHash,
+		RecordedBy: actorID,
+	}, time.Now())
+	switch {
+	case errors.Is(err, services.ErrLoanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+		return
+	case errors.Is(err, services.ErrInvalidAmount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be positive"})
+		return
+	case errors.Is(err, services.ErrLoanNotRepayable), errors.Is(err, services.ErrOverpayment),
+		errors.Is(err, services.ErrDuplicateTxHash):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Error recording repayment for loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record repayment"})
+		return
+	}
+
+	loan, err := scanLoan(tx.QueryRow("SELECT "+loanColumns+" FROM loans WHERE id = $1", id))
+	if err != nil {
+		log.Printf("Error fetching loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record repayment"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing repayment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record repayment"})
+		return
+	}
+
+	log.Printf("Recorded %.2f AUD repayment on loan %d (fees %.2f, interest %.2f, principal %.2f)",
+		repayment.AmountAUD, id, repayment.FeesAUD, repayment.InterestAUD, repayment.PrincipalAUD)
+
+	resp := gin.H{
+		"repayment":         repayment.ToResponse(),
+		"loan":              loan.ToResponse(),
+		"collateralRelease": nil,
+	}
+	if release != nil {
+		resp["collateralRelease"] = release.ToResponse()
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// GetLoanRepayments returns the repayments recorded against a loan, oldest first
+func GetLoanRepayments(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	query := `
+		SELECT id, loan_id, currency, amount, amount_aud, fees_aud, interest_aud, principal_aud,
+			reference, tx_hash, recorded_by, created_at
+		FROM loan_repayments
+		WHERE loan_id = $1
+		ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := config.DB.Query(query, id)
+	if err != nil {
+		log.Printf("Error querying repayments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch repayments"})
+		return
+	}
+	defer rows.Close()
+
+	repayments := []map[string]interface{}{}
+	for rows.Next() {
+		var repayment models.LoanRepayment
+		err := rows.Scan(
+			&repayment.ID,
+			&repayment.LoanID,
+			&repayment.Currency,
+			&repayment.Amount,
+			&repayment.AmountAUD,
+			&repayment.FeesAUD,
+			&repayment.InterestAUD,
+			&repayment.PrincipalAUD,
+			&repayment.Reference,
+			&repayment.TxHash,
+			&repayment.RecordedBy,
+			&repayment.CreatedAt,
+		)
+		if err != nil {
+			log.Printf("Error scanning repayment: %v", err)
+			continue
+		}
+		repayments = append(repayments, repayment.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, repayments)
+}
+
+// GetCollateralRelease returns the collateral release instruction for a repaid loan
+func GetCollateralRelease(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	release, err := services.FindCollateralRelease(config.DB, id)
+	if err != nil {
+		log.Printf("Error fetching collateral release for loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch collateral release"})
+		return
+	}
+
+	if release == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No collateral release for this loan"})
+		return
+	}
+
+	c.JSON(http.StatusOK, release.ToResponse())
+}
+
+// UpdateReturnAddress sets the BTC address collateral is returned to once the loan is repaid
+func UpdateReturnAddress(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	var req ReturnAddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "address is required"})
+		return
+	}
+
+	req.Address = strings.TrimSpace(req.Address)
+	if err := wallet.ValidateAddress(req.Address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Bitcoin address"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update return address"})
+		return
+	}
+	defer tx.Rollback()
+
+	release, err := services.SetReturnAddress(tx, id, req.Address)
+	switch {
+	case errors.Is(err, services.ErrLoanNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+		return
+	case errors.Is(err, services.ErrReleaseLocked):
+		c.JSON(http.StatusConflict, gin.H{"error": "The collateral release has already been built; contact support to change the return address"})
+		return
+	case err != nil:
+		log.Printf("Error updating return address for loan %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update return address"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing return address: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update return address"})
+		return
+	}
+
+	resp := gin.H{
+		"loanId":            id,
+		"btcReturnAddress":  req.Address,
+		"collateralRelease": nil,
+	}
+	if release != nil {
+		resp["collateralRelease"] = release.ToResponse()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"paperhands/api/config"
+	"paperhands/api/models"
+	"paperhands/api/risk"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLoanRisk returns the live LVR and risk level of a loan with its recent risk events
+func GetLoanRisk(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid loan ID"})
+		return
+	}
+
+	if !authorizeLoan(c, id) {
+		return
+	}
+
+	loan, err := scanLoan(config.DB.QueryRow("SELECT "+loanColumns+" FROM loans WHERE id = $1", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error fetching loan: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loan"})
+		return
+	}
+
+	price, stale, err := LatestBTCAUDPrice()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "BTC price unavailable"})
+		return
+	}
+
+	thresholds := risk.ThresholdsFromEnv()
+	debt := loan.PrincipalOutstandingAUD + loan.AccruedInterestAUD - loan.InterestPaidAUD
+	assessment := thresholds.Assess(debt, loan.CollateralBTC, price)
+
+	monitored := false
+	for _, status := range risk.MonitoredStatuses {
+		if loan.Status == status {
+			monitored = true
+		}
+	}
+
+	query := `
+		SELECT id, loan_id, from_level, to_level, lvr, btc_price, created_at
+		FROM loan_risk_events
+		WHERE loan_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 50
+	`
+
+	rows, err := config.DB.Query(query, id)
+	if err != nil {
+		log.Printf("Error querying risk events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch risk events"})
+		return
+	}
+	defer rows.Close()
+
+	events := []map[string]interface{}{}
+	for rows.Next() {
+		var event models.LoanRiskEvent
+		err := rows.Scan(
+			&event.ID,
+			&event.LoanID,
+			&event.FromLevel,
+			&event.ToLevel,
+			&event.LVR,
+			&event.BTCPrice,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			log.Printf("Error scanning risk event: %v", err)
+			continue
+		}
+		events = append(events, event.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"loanId":     id,
+		"status":     loan.Status,
+		"monitored":  monitored,
+		"assessment": assessment,
+		"thresholds": thresholds,
+		"priceStale": stale,
+		"events":     events,
+	})
+}
+
+// GetRiskSummary returns portfolio-wide LVR and the number of loans at each risk level (staff only)
+func GetRiskSummary(c *gin.Context) {
+	price, stale, err := LatestBTCAUDPrice()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "BTC price unavailable"})
+		return
+	}
+
+	loans, err := risk.MonitoredLoans(c.Request.Context(), config.DB)
+	if err != nil {
+		log.Printf("Error fetching monitored loans: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loans"})
+		return
+	}
+
+	thresholds := risk.ThresholdsFromEnv()
+
+	levels := map[string]int{
+		risk.LevelOK:          0,
+		risk.LevelWarning:     0,
+		risk.LevelMarginCall:  0,
+		risk.LevelLiquidation: 0,
+	}
+	atRisk := []gin.H{}
+	var totalDebt, totalCollateralBTC float64
+
+	for _, loan := range loans {
+		if loan.CollateralBTC <= 0 {
+			continue
+		}
+
+		assessment := thresholds.Assess(loan.DebtAUD, loan.CollateralBTC, price)
+		levels[assessment.Level]++
+		totalDebt += loan.DebtAUD
+		totalCollateralBTC += loan.CollateralBTC
+
+		if assessment.Level == risk.LevelMarginCall || assessment.Level == risk.LevelLiquidation {
+			atRisk = append(atRisk, gin.H{
+				"loanId":     loan.ID,
+				"customerId": loan.CustomerID,
+				"status":     loan.Status,
+				"lvr":        assessment.LVR,
+				"level":      assessment.Level,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"btcPrice":           price,
+		"priceStale":         stale,
+		"thresholds":         thresholds,
+		"loanCount":          len(loans),
+		"levels":             levels,
+		"totalDebtAud":       totalDebt,
+		"totalCollateralBtc": totalCollateralBTC,
+		"totalCollateralAud": totalCollateralBTC * price,
+		"portfolioLvr":       risk.LVR(totalDebt, totalCollateralBTC, price),
+		"atRisk":             atRisk,
+	})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"paperhands/api/config"
+	"paperhands/api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// currentUserID returns the authenticated user's ID from the JWT.
+// It responds with 401 and returns false if the context has no user.
+func currentUserID(c *gin.Context) (int, bool) {
+	userID, ok := middleware.GetUserIDFromContext(c)
+	if !ok || userID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return 0, false
+	}
+	return userID, true
+}
+
+// findCustomerID returns the customer profile ID for a user, or 0 if the user has none
+func findCustomerID(q querier, userID int) (int, error) {
+	var customerID int
+	err := q.QueryRow("SELECT id FROM customers WHERE user_id = $1", userID).Scan(&customerID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return customerID, err
+}
+
+// ensureCustomerID returns the customer profile ID for a user, creating an empty profile if needed
+func ensureCustomerID(q querier, userID int) (int, error) {
+	customerID, err := findCustomerID(q, userID)
+	if err != nil || customerID != 0 {
+		return customerID, err
+	}
+
+	err = q.QueryRow(`
+		INSERT INTO customers (user_id)
+		VALUES ($1)
+		ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING id
+	`, userID).Scan(&customerID)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("Created customer profile %d for user %d", customerID, userID)
+	return customerID, nil
+}
+
+// currentCustomerID resolves the authenticated user's customer profile ID.
+// It writes an error response and returns false on failure.
+func currentCustomerID(c *gin.Context, create bool) (int, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return 0, false
+	}
+
+	var customerID int
+	var err error
+	if create {
+		customerID, err = ensureCustomerID(config.DB, userID)
+	} else {
+		customerID, err = findCustomerID(config.DB, userID)
+	}
+	if err != nil {
+		log.Printf("Error resolving customer for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve customer"})
+		return 0, false
+	}
+
+	return customerID, true
+}
+
+// authorizeLoan checks the authenticated user owns a loan, or is staff.
+// It responds with 404 for loans that don't exist or belong to someone else,
+// so loan IDs of other customers are not disclosed.
+func authorizeLoan(c *gin.Context, loanID int) bool {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return false
+	}
+
+	if middleware.IsStaff(c) {
+		return true
+	}
+
+	var owned bool
+	err := config.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM loans l
+			JOIN customers cu ON cu.id = l.customer_id
+			WHERE l.id = $1 AND cu.user_id = $2
+		)
+	`, loanID, userID).Scan(&owned)
+	if err != nil {
+		log.Printf("Error checking ownership of loan %d: %v", loanID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loan"})
+		return false
+	}
+
+	if !owned {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan not found"})
+		return false
+	}
+
+	return true
+}
+
+// authorizeUser checks the authenticated user is the user identified by id,
+// or holds one of the given roles
+func authorizeUser(c *gin.Context, id int, roles ...string) bool {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return false
+	}
+
+	if userID == id {
+		return true
+	}
+
+	role, _ := middleware.GetUserRoleFromContext(c)
+	for _, allowed := range roles {
+		if role == allowed {
+			return true
+		}
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own account"})
+	return false
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/middleware"
+	"paperhands/api/stream"
+	"paperhands/api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamHeartbeat is how often idle streams send a heartbeat event:
+// STREAM_HEARTBEAT_SECONDS, default 15
+func streamHeartbeat() time.Duration {
+	return config.EnvSeconds("STREAM_HEARTBEAT_SECONDS", 15*time.Second)
+}
+
+// streamTokenTTL is how long a stream token can be used to connect:
+// STREAM_TOKEN_TTL_SECONDS, default 60
+func streamTokenTTL() time.Duration {
+	return config.EnvSeconds("STREAM_TOKEN_TTL_SECONDS", 60*time.Second)
+}
+
+// CreateStreamToken issues a short-lived token for connecting to an event stream with
+// EventSource, which cannot send the Authorization header
+func CreateStreamToken(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	email, _ := middleware.GetUserEmailFromContext(c)
+	role, _ := middleware.GetUserRoleFromContext(c)
+
+	token, expiresAt, err := utils.GenerateStreamToken(userID, email, role, streamTokenTTL())
+	if err != nil {
+		log.Printf("Error generating stream token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate stream token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":     token,
+		"expiresAt": expiresAt.UTC(),
+	})
+}
+
+// StreamPrice streams BTC/AUD price ticks as server-sent events, starting with the latest price
+func StreamPrice(hub *stream.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sub := hub.Subscribe(func(e stream.Event) bool { return e.Name == stream.EventPrice })
+		defer hub.Unsubscribe(sub)
+
+		var snapshot []stream.Event
+		if tick, ok := hub.LastPrice(); ok {
+			snapshot = append(snapshot, stream.Event{Name: stream.EventPrice, Data: tick})
+		}
+
+		serveEvents(c, sub, snapshot)
+	}
+}
+
+// StreamLoans streams status and LVR changes of the caller's loans as server-sent events,
+// starting with the current state of each loan. Staff receive every loan.
+func StreamLoans(hub *stream.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		staff := middleware.IsStaff(c)
+
+		var customerID int
+		if !staff {
+			var ok bool
+			if customerID, ok = currentCustomerID(c, false); !ok {
+				return
+			}
+		}
+
+		// Borrowers only receive their own loans' events; those without a customer profile
+		// have no loans, so only get heartbeats
+		var sub *stream.Subscriber
+		if staff {
+			sub = hub.Subscribe(func(e stream.Event) bool { return e.Name == stream.EventLoan })
+		} else {
+			sub = hub.SubscribeCustomer(customerID)
+		}
+		defer hub.Unsubscribe(sub)
+
+		var snapshot []stream.Event
+		if staff || customerID != 0 {
+			for _, update := range hub.Loans(customerID) {
+				snapshot = append(snapshot, stream.Event{Name: stream.EventLoan, Data: update})
+			}
+		}
+
+		serveEvents(c, sub, snapshot)
+	}
+}
+
+// serveEvents writes snapshot and then every event the subscriber receives until the
+// client disconnects or the hub closes, sending heartbeats while idle
+func serveEvents(c *gin.Context, sub *stream.Subscriber, snapshot []stream.Event) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Stop nginx buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, event := range snapshot {
+		c.SSEvent(event.Name, event.Data)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			c.SSEvent(event.Name, event.Data)
+		case now := <-heartbeat.C:
+			c.SSEvent(stream.EventHeartbeat, gin.H{"time": now.UTC()})
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"paperhands/api/config"
+	"paperhands/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSweeps returns deposit sweeps, newest first, with their unsigned transfers (staff only)
+// Query params: status
+func GetSweeps(c *gin.Context) {
+	query := "SELECT " + services.SweepColumns + " FROM " + services.SweepTables
+	params := []interface{}{}
+
+	if status := c.Query("status"); status != "" {
+		query += " WHERE s.status = $1"
+		params = append(params, status)
+	}
+
+	query += " ORDER BY s.created_at DESC"
+
+	rows, err := config.DB.Query(query, params...)
+	if err != nil {
+		log.Printf("Error querying sweeps: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sweeps"})
+		return
+	}
+	defer rows.Close()
+
+	sweeps := []map[string]interface{}{}
+	for rows.Next() {
+		sweep, err := services.ScanSweep(rows)
+		if err != nil {
+			log.Printf("Error scanning sweep: %v", err)
+			continue
+		}
+		sweeps = append(sweeps, sweep.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, sweeps)
+}
+
+// CancelSweep discards a sweep awaiting signature so the sweeper rebuilds it (staff only)
+func CancelSweep(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sweep ID"})
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel sweep"})
+		return
+	}
+	defer tx.Rollback()
+
+	sweep, err := services.CancelSweep(tx, id)
+	switch {
+	case errors.Is(err, services.ErrSweepNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sweep not found"})
+		return
+	case errors.Is(err, services.ErrSweepNotCancellable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only sweeps awaiting signature can be cancelled"})
+		return
+	case err != nil:
+		log.Printf("Error cancelling sweep %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel sweep"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing sweep %d cancellation: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel sweep"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sweep.ToResponse())
+}
@@ -14,6 +14,7 @@ import (
 type CreateUserRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=8"`
+	Role     string `json:"role" binding:"omitempty,oneof=borrower lender operator admin"`
 }
 
 type UpdateUserRequest struct {
@@ -21,10 +22,14 @@ type UpdateUserRequest struct {
 	Password string `json:"password" binding:"omitempty,min=8"`
 }
 
-// GetAllUsers retrieves all users
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=borrower lender operator admin"`
+}
+
+// GetAllUsers retrieves all users (staff only)
 func GetAllUsers(c *gin.Context) {
 	query := `
-		SELECT id, email, created_at, updated_at
+		SELECT id, email, role, created_at, updated_at
 		FROM users
 		ORDER BY created_at DESC
 	`
@@ -41,7 +46,7 @@ func GetAllUsers(c *gin.Context) {
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Email, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		if err := rows.Scan(&user.ID, &user.Email, &user.Role, &user.CreatedAt, &user.UpdatedAt); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to scan user data",
 			})
@@ -74,9 +79,13 @@ func GetUserByID(c *gin.Context) {
 		return
 	}
 
+	if !authorizeUser(c, id, models.RoleOperator, models.RoleAdmin) {
+		return
+	}
+
 	var user models.User
 	query := `
-		SELECT id, email, created_at, updated_at
+		SELECT id, email, role, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -84,6 +93,7 @@ func GetUserByID(c *gin.Context) {
 	err = config.DB.QueryRow(query, id).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -143,17 +153,23 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	role := req.Role
+	if role == "" {
+		role = models.RoleBorrower
+	}
+
 	// Insert user
 	var user models.User
 	insertQuery := `
-		INSERT INTO users (email, password_hash)
-		VALUES ($1, $2)
-		RETURNING id, email, created_at, updated_at
+		INSERT INTO users (email, password_hash, role)
+		VALUES ($1, $2, $3)
+		RETURNING id, email, role, created_at, updated_at
 	`
 
-	err = config.DB.QueryRow(insertQuery, req.Email, string(hashedPassword)).Scan(
+	err = config.DB.QueryRow(insertQuery, req.Email, string(hashedPassword), role).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -182,6 +198,10 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if !authorizeUser(c, id, models.RoleAdmin) {
+		return
+	}
+
 	var req UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -247,12 +267,13 @@ func UpdateUser(c *gin.Context) {
 	for i := 1; i < len(updates); i++ {
 		updateQuery += ", " + updates[i]
 	}
-	updateQuery += ", updated_at = CURRENT_TIMESTAMP WHERE id = $" + strconv.Itoa(argCount) + " RETURNING id, email, created_at, updated_at"
+	updateQuery += ", updated_at = CURRENT_TIMESTAMP WHERE id = $" + strconv.Itoa(argCount) + " RETURNING id, email, role, created_at, updated_at"
 
 	var user models.User
 	err = config.DB.QueryRow(updateQuery, args...).Scan(
 		&user.ID,
 		&user.Email,
+		&user.Role,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -269,3 +290,59 @@ func UpdateUser(c *gin.Context) {
 		"user":    user,
 	})
 }
+
+// UpdateUserRole changes a user's role (admin only)
+// The new role applies to the user's next request, including with tokens already issued.
+func UpdateUserRole(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user ID",
+		})
+		return
+	}
+
+	var req UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "role must be one of: borrower, lender, operator, admin",
+		})
+		return
+	}
+
+	query := `
+		UPDATE users
+		SET role = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+		RETURNING id, email, role, created_at, updated_at
+	`
+
+	var user models.User
+	err = config.DB.QueryRow(query, req.Role, id).Scan(
+		&user.ID,
+		&user.Email,
+		&user.Role,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to update user role",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User role updated successfully",
+		"user":    user,
+	})
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/middleware"
+	"paperhands/api/models"
+	"paperhands/api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateWithdrawalRequest struct {
+	Token         string  `json:"token" binding:"required"`
+	Amount        float64 `json:"amount" binding:"required"`
+	WalletAddress string  `json:"walletAddress" binding:"required"`
+}
+
+type PayWithdrawalRequest struct {
+	TxHash string `json:"txHash" binding:"required"`
+}
+
+// CreateWithdrawal requests a withdrawal from the caller's pool position. The withdrawal can be
+// approved after the notice period; it is queued straight away if the pool lacks the unlent
+// liquidity to pay it without exceeding the maximum utilisation.
+func CreateWithdrawal(c *gin.Context) {
+	var req CreateWithdrawalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token, amount, and walletAddress are required"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	if !isValidToken(req.Token) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid token. Must be one of: %v", validTokens),
+		})
+		return
+	}
+
+	if req.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		return
+	}
+
+	if !isValidEthAddress(req.WalletAddress) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "walletAddress must be a 0x-prefixed 20-byte hex address"})
+		return
+	}
+
+	terms := services.WithdrawalTermsFromEnv()
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create withdrawal"})
+		return
+	}
+	defer tx.Rollback()
+
+	liquidity, err := services.PoolLiquidity(tx, TokenAUDPrice, terms.MaxUtilisation)
+	if err != nil {
+		log.Printf("Error checking pool liquidity: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Pool liquidity is unavailable"})
+		return
+	}
+
+	var pool models.PoolLiquidity
+	for _, l := range liquidity {
+		if l.Token == req.Token {
+			pool = l
+		}
+	}
+
+	status := models.WithdrawalStatusPending
+	if req.Amount > pool.Available {
+		status = models.WithdrawalStatusQueued
+	}
+
+	withdrawal, err := services.CreateWithdrawal(tx, services.WithdrawalInput{
+		UserID:        userID,
+		Token:         req.Token,
+		Amount:        req.Amount,
+		WalletAddress: strings.ToLower(req.WalletAddress),
+		Status:        status,
+		AvailableAt:   time.Now().Add(terms.NoticePeriod),
+	})
+	if errors.Is(err, services.ErrInsufficientPosition) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Amount exceeds the withdrawable value of your position"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating withdrawal: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create withdrawal"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing withdrawal: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create withdrawal"})
+		return
+	}
+
+	log.Printf("Created withdrawal %d for user %d: %f %s (%s)", withdrawal.ID, userID, req.Amount, req.Token, status)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"withdrawal": withdrawal.ToResponse(),
+		"liquidity":  pool,
+	})
+}
+
+// GetWithdrawals returns the authenticated user's withdrawals, newest first.
+// Staff see all withdrawals and may filter by userId.
+// Query params: token, status
+func GetWithdrawals(c *gin.Context) {
+	query := "SELECT " + services.WithdrawalColumns + " FROM capital_withdrawals WHERE 1=1"
+	params := []interface{}{}
+	paramCount := 1
+
+	userIDStr := c.Query("userId")
+	if !middleware.IsStaff(c) {
+		userID, ok := currentUserID(c)
+		if !ok {
+			return
+		}
+		userIDStr = strconv.Itoa(userID)
+	}
+
+	if userIDStr != "" {
+		userID, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userId"})
+			return
+		}
+		query += fmt.Sprintf(" AND user_id = $%d", paramCount)
+		params = append(params, userID)
+		paramCount++
+	}
+
+	if token := c.Query("token"); token != "" {
+		query += fmt.Sprintf(" AND token = $%d", paramCount)
+		params = append(params, token)
+		paramCount++
+	}
+
+	if status := c.Query("status"); status != "" {
+		query += fmt.Sprintf(" AND status = $%d", paramCount)
+		params = append(params, status)
+	}
+
+	query += " ORDER BY created_at DESC"
+
+	rows, err := config.DB.Query(query, params...)
+	if err != nil {
+		log.Printf("Error querying withdrawals: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch withdrawals"})
+		return
+	}
+	defer rows.Close()
+
+	withdrawals := []map[string]interface{}{}
+	for rows.Next() {
+		withdrawal, err := services.ScanWithdrawal(rows)
+		if err != nil {
+			log.Printf("Error scanning withdrawal: %v", err)
+			continue
+		}
+		withdrawals = append(withdrawals, withdrawal.ToResponse())
+	}
+
+	c.JSON(http.StatusOK, withdrawals)
+}
+
+// PayWithdrawal records the transaction that paid out a ready withdrawal (staff only)
+func PayWithdrawal(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid withdrawal ID"})
+		return
+	}
+
+	var req PayWithdrawalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "txHash is required"})
+		return
+	}
+
+	if !isValidTxHash(req.TxHash) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "txHash must be a 0x-prefixed 32-byte hex hash"})
+		return
+	}
+
+	staffID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record withdrawal payout"})
+		return
+	}
+	defer tx.Rollback()
+
+	withdrawal, err := services.PayWithdrawal(tx, id, strings.ToLower(req.TxHash), staffID)
+	switch {
+	case errors.Is(err, services.ErrWithdrawalNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal not found"})
+		return
+	case errors.Is(err, services.ErrWithdrawalNotReady):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only ready withdrawals can be paid out"})
+		return
+	case errors.Is(err, services.ErrPayoutAlreadyRecorded):
+		c.JSON(http.StatusConflict, gin.H{"error": "Transaction already recorded as a withdrawal payout"})
+		return
+	case err != nil:
+		log.Printf("Error recording payout of withdrawal %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record withdrawal payout"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing payout of withdrawal %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record withdrawal payout"})
+		return
+	}
+
+	log.Printf("Withdrawal %d paid out in %s by user %d", id, withdrawal.PayoutTxHash.String, staffID)
+
+	c.JSON(http.StatusOK, withdrawal.ToResponse())
+}
+
+// CancelWithdrawal cancels a pending or queued withdrawal (owner or staff)
+func CancelWithdrawal(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid withdrawal ID"})
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		log.Printf("Error starting transaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel withdrawal"})
+		return
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	err = tx.QueryRow("SELECT user_id FROM capital_withdrawals WHERE id = $1", id).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID && !middleware.IsStaff(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching withdrawal %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel withdrawal"})
+		return
+	}
+
+	withdrawal, err := services.CancelWithdrawal(tx, id)
+	switch {
+	case errors.Is(err, services.ErrWithdrawalNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Withdrawal not found"})
+		return
+	case errors.Is(err, services.ErrWithdrawalNotCancellable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending or queued withdrawals can be cancelled"})
+		return
+	case err != nil:
+		log.Printf("Error cancelling withdrawal %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel withdrawal"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error committing withdrawal %d cancellation: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel withdrawal"})
+		return
+	}
+
+	c.JSON(http.StatusOK, withdrawal.ToResponse())
+}
@@ -0,0 +1,178 @@
+package interest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"paperhands/api/config"
+	"paperhands/api/models"
+)
+
+// AccruingStatuses are the loan statuses that earn interest
+var AccruingStatuses = []string{
+	models.LoanStatusDisbursed,
+	models.LoanStatusActive,
+}
+
+// Accruer is a background job that accrues daily interest on every interest-bearing loan
+type Accruer struct {
+	DB       *sql.DB
+	Interval time.Duration
+}
+
+// NewAccruerFromEnv creates an accruer that runs every INTEREST_ACCRUAL_INTERVAL_MINUTES (default 60).
+// Each run accrues every loan through the end of the previous day, so runs are idempotent.
+func NewAccruerFromEnv(db *sql.DB) *Accruer {
+	return &Accruer{
+		DB:       db,
+		Interval: time.Duration(config.EnvInt("INTEREST_ACCRUAL_INTERVAL_MINUTES", 60)) * time.Minute,
+	}
+}
+
+// Run accrues interest until ctx is cancelled
+func (a *Accruer) Run(ctx context.Context) {
+	log.Printf("Interest accrual job started (interval %s, %s)", a.Interval, DayCountConvention)
+
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.AccrueAll(ctx, time.Now()); err != nil {
+			log.Printf("Interest accrual failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Interest accrual job stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AccrueAll accrues every interest-bearing loan for each day before asOf
+func (a *Accruer) AccrueAll(ctx context.Context, asOf time.Time) error {
+	rows, err := a.DB.QueryContext(ctx, "SELECT id FROM loans WHERE status = ANY($1) ORDER BY id", pq.Array(AccruingStatuses))
+	if err != nil {
+		return fmt.Errorf("querying accruing loans: %w", err)
+	}
+
+	var loanIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		loanIDs = append(loanIDs, id)
+	}
+	rows.Close()
+
+	for _, loanID := range loanIDs {
+		tx, err := a.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		accrued, err := AccrueLoan(tx, loanID, asOf)
+		if err != nil {
+			tx.Rollback()
+			log.Printf("Error accruing interest on loan %d: %v", loanID, err)
+			continue
+		}
+
+		if err := tx.Commit(); err != nil {
+			log.Printf("Error committing interest on loan %d: %v", loanID, err)
+			continue
+		}
+
+		if accrued > 0 {
+			log.Printf("Accrued %.2f AUD interest on loan %d", accrued, loanID)
+		}
+	}
+
+	return nil
+}
+
+// AccrueLoan records one accrual row per day in [next unaccrued day, asOf) for a loan
+// and adds the total to accrued_interest_aud. It locks the loan row and returns the
+// interest accrued by this call.
+func AccrueLoan(tx *sql.Tx, loanID int, asOf time.Time) (float64, error) {
+	var status string
+	var principal, rate float64
+	var disbursedAt sql.NullTime
+	var accruedThrough sql.NullTime
+
+	err := tx.QueryRow(`
+		SELECT status, COALESCE(principal_outstanding_aud, amount_aud), COALESCE(annual_interest_rate, 0),
+			disbursed_at, interest_accrued_through
+		FROM loans
+		WHERE id = $1
+		FOR UPDATE
+	`, loanID).Scan(&status, &principal, &rate, &disbursedAt, &accruedThrough)
+	if err != nil {
+		return 0, err
+	}
+
+	if !IsAccruing(status) || !disbursedAt.Valid {
+		return 0, nil
+	}
+
+	start := Date(disbursedAt.Time)
+	if accruedThrough.Valid {
+		start = Date(accruedThrough.Time).AddDate(0, 0, 1)
+	}
+	end := Date(asOf)
+
+	if !start.Before(end) {
+		return 0, nil
+	}
+
+	daily := DailyInterest(principal, rate)
+	var total float64
+
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		result, err := tx.Exec(`
+			INSERT INTO loan_interest_accruals (loan_id, accrual_date, principal_aud, annual_rate, interest_aud)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (loan_id, accrual_date) DO NOTHING
+		`, loanID, day, principal, rate, daily)
+		if err != nil {
+			return 0, fmt.Errorf("recording accrual for %s: %w", day.Format("2006-01-02"), err)
+		}
+
+		if inserted, _ := result.RowsAffected(); inserted > 0 {
+			total += daily
+		}
+	}
+
+	total = RoundCents(total)
+
+	_, err = tx.Exec(`
+		UPDATE loans
+		SET accrued_interest_aud = COALESCE(accrued_interest_aud, 0) + $1,
+			interest_accrued_through = $2,
+			updated_at = NOW()
+		WHERE id = $3
+	`, total, end.AddDate(0, 0, -1), loanID)
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
+
+// IsAccruing reports whether loans in status earn interest
+func IsAccruing(status string) bool {
+	for _, s := range AccruingStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
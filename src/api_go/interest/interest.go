@@ -0,0 +1,73 @@
+package interest
+
+import (
+	"math"
+	"time"
+
+	"paperhands/api/config"
+)
+
+// DayCountConvention describes how interest is accrued
+// Interest accrues daily on outstanding principal using Actual/365 Fixed:
+// each calendar day the principal is outstanding earns principal * rate / 365,
+// rounded to the cent, starting on the disbursement date.
+const DayCountConvention = "ACT/365F"
+
+// DaysInYear is the fixed day-count denominator
+const DaysInYear = 365
+
+// Terms are the fee and term applied to a new loan. The interest rate comes from the
+// utilisation-based rate model in the rates package.
+type Terms struct {
+	AdminFeeRate   float64 `json:"adminFeeRate"`
+	MinAdminFeeAUD float64 `json:"minAdminFeeAud"`
+	TermMonths     int     `json:"termMonths"`
+}
+
+// TermsFromEnv reads LOAN_ADMIN_FEE_RATE, LOAN_MIN_ADMIN_FEE_AUD and LOAN_TERM_MONTHS,
+// defaulting to the advertised 2% admin fee (min $25) over 12 months
+func TermsFromEnv() Terms {
+	return Terms{
+		AdminFeeRate:   config.EnvFloatOrZero("LOAN_ADMIN_FEE_RATE", 0.02),
+		MinAdminFeeAUD: config.EnvFloatOrZero("LOAN_MIN_ADMIN_FEE_AUD", 25),
+		TermMonths:     config.EnvInt("LOAN_TERM_MONTHS", 12),
+	}
+}
+
+// AdminFee returns the one-off administration fee for a principal amount
+func (t Terms) AdminFee(principal float64) float64 {
+	return math.Max(RoundCents(principal*t.AdminFeeRate), t.MinAdminFeeAUD)
+}
+
+// DailyInterest returns one day's interest on principal at annualRate, rounded to the cent
+func DailyInterest(principal, annualRate float64) float64 {
+	if principal <= 0 || annualRate <= 0 {
+		return 0
+	}
+	return RoundCents(principal * annualRate / DaysInYear)
+}
+
+// Accrue returns the interest accrued on a constant principal for every day in [from, to)
+func Accrue(principal, annualRate float64, from, to time.Time) float64 {
+	days := Days(from, to)
+	if days <= 0 {
+		return 0
+	}
+	return RoundCents(DailyInterest(principal, annualRate) * float64(days))
+}
+
+// Days returns the number of calendar days between two dates, ignoring time of day
+func Days(from, to time.Time) int {
+	return int(Date(to).Sub(Date(from)).Hours() / 24)
+}
+
+// Date truncates t to midnight UTC
+func Date(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// RoundCents rounds an AUD amount to the nearest cent
+func RoundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
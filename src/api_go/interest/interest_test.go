@@ -0,0 +1,70 @@
+package interest
+
+import (
+	"testing"
+	"time"
+)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestAccrue(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal float64
+		rate      float64
+		from, to  time.Time
+		want      float64
+	}{
+		// 10000 * 0.0365 / 365 is exactly 1.00 a day
+		{"one day", 10000, 0.0365, date(2025, 3, 1), date(2025, 3, 2), 1},
+		{"30 days", 10000, 0.0365, date(2025, 3, 1), date(2025, 3, 31), 30},
+		// Each day is rounded to the cent before multiplying: 10000 * 0.099 / 365 = 2.7123...
+		{"daily rounding", 10000, 0.099, date(2025, 3, 1), date(2025, 3, 11), 27.10},
+		{"same day", 10000, 0.099, date(2025, 3, 1), date(2025, 3, 1), 0},
+		{"reversed range", 10000, 0.099, date(2025, 3, 2), date(2025, 3, 1), 0},
+		{"zero principal", 0, 0.099, date(2025, 3, 1), date(2025, 3, 31), 0},
+		{"zero rate", 10000, 0, date(2025, 3, 1), date(2025, 3, 31), 0},
+		// Times of day are ignored: 23:59 to 00:01 the next day is one day, 00:01 to 23:59 is none
+		{"partial days spanning midnight", 10000, 0.0365,
+			time.Date(2025, 3, 1, 23, 59, 0, 0, time.UTC), time.Date(2025, 3, 2, 0, 1, 0, 0, time.UTC), 1},
+		{"partial day within a day", 10000, 0.0365,
+			time.Date(2025, 3, 1, 0, 1, 0, 0, time.UTC), time.Date(2025, 3, 1, 23, 59, 0, 0, time.UTC), 0},
+		// Days are counted in UTC: 09:00 in Sydney on 2 March is still 1 March
+		{"non-UTC times", 10000, 0.0365,
+			time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 2, 9, 0, 0, 0, time.FixedZone("AEDT", 11*60*60)), 0},
+		// ACT/365F divides by 365 even in a leap year, so the extra day earns a 366th day's interest
+		{"non-leap year", 10000, 0.0365, date(2025, 1, 1), date(2026, 1, 1), 365},
+		{"leap year", 10000, 0.0365, date(2024, 1, 1), date(2025, 1, 1), 366},
+		{"across 29 February", 10000, 0.0365, date(2024, 2, 28), date(2024, 3, 1), 2},
+		{"across 28 February", 10000, 0.0365, date(2025, 2, 28), date(2025, 3, 1), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Accrue(tt.principal, tt.rate, tt.from, tt.to); got != tt.want {
+				t.Errorf("Accrue(%v, %v, %s, %s) = %v, want %v", tt.principal, tt.rate, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDailyInterest(t *testing.T) {
+	tests := []struct {
+		principal, rate float64
+		want            float64
+	}{
+		{10000, 0.0365, 1},
+		{10000, 0.099, 2.71},
+		{12345.67, 0.099, 3.35},
+		{-100, 0.099, 0},
+		{10000, -0.01, 0},
+	}
+
+	for _, tt := range tests {
+		if got := DailyInterest(tt.principal, tt.rate); got != tt.want {
+			t.Errorf("DailyInterest(%v, %v) = %v, want %v", tt.principal, tt.rate, got, tt.want)
+		}
+	}
+}
@@ -1,15 +1,30 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"paperhands/api/analytics"
+	"paperhands/api/chain"
 	"paperhands/api/config"
+	"paperhands/api/disburse"
+	"paperhands/api/evm"
 	"paperhands/api/handlers"
+	"paperhands/api/interest"
 	"paperhands/api/middleware"
+	"paperhands/api/models"
+	"paperhands/api/oracle"
+	"paperhands/api/pool"
+	"paperhands/api/pricefeed"
+	"paperhands/api/pricehistory"
+	"paperhands/api/risk"
+	"paperhands/api/stream"
+	"paperhands/api/sweep"
+	"paperhands/api/watcher"
 )
 
 func main() {
@@ -22,6 +37,35 @@ func main() {
 	config.InitDB()
 	defer config.CloseDB()
 
+	// Start background workers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainBackend := chain.NewEsploraClientFromEnv()
+
+	// The backfill starts first so it measures the history gap before the refresher records
+	// its first price. Prices are refreshed in the background; handlers only read them from memory.
+	go pricehistory.NewBackfillerFromEnv(config.DB).Run(ctx)
+	priceRefresher := pricefeed.NewRefresherFromEnv(oracle.NewFromEnv())
+	priceRefresher.OnRefresh = handlers.RecordPriceHistory
+	handlers.SetPriceRefresher(priceRefresher)
+	go priceRefresher.Run(ctx)
+
+	go watcher.NewCollateralWatcherFromEnv(config.DB, chainBackend).Run(ctx)
+	evmBackend := evm.NewRPCClientFromEnv()
+	go watcher.NewCapitalWatcherFromEnv(config.DB, evmBackend).Run(ctx)
+	go sweep.NewSweeperFromEnv(config.DB, evmBackend).Run(ctx)
+	go risk.NewEngineFromEnv(config.DB, handlers.LatestBTCAUDPrice).Run(ctx)
+	go interest.NewAccruerFromEnv(config.DB).Run(ctx)
+	go pool.NewDistributorFromEnv(config.DB, handlers.TokenAUDPrice).Run(ctx)
+	go pool.NewWithdrawalQueueFromEnv(config.DB, handlers.TokenAUDPrice).Run(ctx)
+	disburser := disburse.NewProcessorFromEnv(config.DB, evmBackend)
+	go disburser.Run(ctx)
+	go disburse.NewIndexerFromEnv(config.DB, evmBackend).Run(ctx)
+
+	streamHub := stream.NewHub()
+	go stream.NewFeedFromEnv(config.DB, streamHub, handlers.LatestBTCAUDPrice).Run(ctx)
+
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
@@ -54,14 +98,26 @@ func main() {
 		auth.POST("/logout", handlers.Logout)
 	}
 
+	// Role groups for staff-only routes
+	staff := middleware.RequireRole(models.RoleOperator, models.RoleAdmin)
+	admin := middleware.RequireRole(models.RoleAdmin)
+
 	// Users routes (protected by JWT authentication)
 	users := r.Group("/users")
 	users.Use(middleware.AuthRequired())
 	{
-		users.GET("", handlers.GetAllUsers)
+		users.GET("", staff, handlers.GetAllUsers)
 		users.GET("/:id", handlers.GetUserByID)
-		users.POST("", handlers.CreateUser)
+		users.POST("", admin, handlers.CreateUser)
 		users.PUT("/:id", handlers.UpdateUser)
+		users.PUT("/:id/role", admin, handlers.UpdateUserRole)
+	}
+
+	// Quote routes (protected by JWT authentication)
+	quotes := r.Group("/quotes")
+	quotes.Use(middleware.AuthRequired())
+	{
+		quotes.POST("", handlers.CreateQuote)
 	}
 
 	// Loans routes (protected by JWT authentication)
@@ -71,13 +127,81 @@ func main() {
 		loans.GET("", handlers.GetLoans)
 		loans.GET("/:id", handlers.GetLoanByID)
 		loans.POST("", handlers.CreateLoan)
-		loans.PUT("/:id", handlers.UpdateLoanStatus)
+		loans.PUT("/:id", staff, handlers.UpdateLoanStatus)
+		loans.GET("/:id/history", handlers.GetLoanHistory)
+		loans.GET("/:id/collateral", handlers.GetLoanCollateral)
+		loans.GET("/:id/risk", handlers.GetLoanRisk)
+		loans.GET("/:id/balance", handlers.GetLoanBalance)
+		loans.GET("/:id/repayments", handlers.GetLoanRepayments)
+		loans.POST("/:id/repayments", staff, handlers.CreateRepayment)
+		loans.GET("/:id/release", handlers.GetCollateralRelease)
+		loans.PUT("/:id/return-address", handlers.UpdateReturnAddress)
+		loans.POST("/:id/release-psbt", staff, handlers.CreateReleasePSBT(chainBackend))
+		loans.GET("/:id/liquidation", handlers.GetLoanLiquidation)
+		loans.POST("/:id/liquidation", staff, handlers.StartLiquidation(chainBackend))
+		loans.POST("/:id/liquidation/settle", staff, handlers.SettleLiquidation)
+		loans.GET("/:id/disbursement", handlers.GetLoanDisbursement)
+		loans.POST("/:id/disbursement", staff, handlers.CreateDisbursement(disburser))
+		loans.POST("/:id/disbursement/retry", staff, handlers.RetryDisbursement)
+	}
+
+	// Disbursement routes (staff only)
+	disbursements := r.Group("/disbursements")
+	disbursements.Use(middleware.AuthRequired(), staff)
+	{
+		disbursements.GET("", handlers.GetDisbursements)
+		disbursements.GET("/onchain", handlers.GetOnChainDisbursements)
+		disbursements.GET("/balance/:method", handlers.GetDisbursementBalance(disburser))
+	}
+
+	// Risk routes (staff only)
+	riskRoutes := r.Group("/risk")
+	riskRoutes.Use(middleware.AuthRequired(), staff)
+	{
+		riskRoutes.GET("/summary", handlers.GetRiskSummary)
+	}
+
+	// Liquidation routes (staff only)
+	liquidations := r.Group("/liquidations")
+	liquidations.Use(middleware.AuthRequired(), staff)
+	{
+		liquidations.GET("", handlers.GetLiquidations)
+	}
+
+	// Credit routes (protected by JWT authentication)
+	credits := r.Group("/credits")
+	credits.Use(middleware.AuthRequired())
+	{
+		credits.GET("", handlers.GetCredits)
 	}
 
 	// Price routes (public - no auth required)
 	price := r.Group("/price")
 	{
-		price.GET("/btc-aud", handlers.GetBTCAUDPrice)
+		price.GET("/btc-aud/history", handlers.GetBTCAUDPriceHistory)
+		price.GET("/metrics", middleware.AuthRequired(), staff, handlers.GetPriceMetrics)
+		price.GET("/:pair", handlers.GetPrice)
+	}
+
+	// Analytics routes (public - no auth required)
+	analyticsCache := analytics.NewCacheFromEnv()
+	analyticsRoutes := r.Group("/analytics")
+	{
+		analyticsRoutes.GET("/loans-lvr", handlers.GetLoansLVR(analyticsCache))
+		analyticsRoutes.GET("/capital-utilization", handlers.GetCapitalUtilization(analyticsCache))
+		analyticsRoutes.GET("/interest-earned", handlers.GetInterestEarned(analyticsCache))
+		analyticsRoutes.GET("/summary", handlers.GetAnalyticsSummary(analyticsCache))
+	}
+
+	// Interest rate routes (public - no auth required)
+	r.GET("/rates", handlers.GetRates)
+
+	// Server-sent event streams
+	streams := r.Group("/stream")
+	{
+		streams.GET("/price", handlers.StreamPrice(streamHub))
+		streams.POST("/token", middleware.AuthRequired(), handlers.CreateStreamToken)
+		streams.GET("/loans", middleware.StreamAuthRequired(), handlers.StreamLoans(streamHub))
 	}
 
 	// Capital routes (protected by JWT authentication)
@@ -86,8 +210,17 @@ func main() {
 	{
 		capital.GET("", handlers.GetCapitalSupplies)
 		capital.POST("", handlers.CreateCapitalSupply)
+		capital.PUT("/:id/confirm", staff, handlers.ConfirmCapitalSupply)
+		capital.GET("/positions", handlers.GetCapitalPositions)
+		capital.GET("/withdrawals", handlers.GetWithdrawals)
+		capital.POST("/withdrawals", handlers.CreateWithdrawal)
+		capital.POST("/withdrawals/:id/payout", staff, handlers.PayWithdrawal)
+		capital.POST("/withdrawals/:id/cancel", handlers.CancelWithdrawal)
 		capital.POST("/deposit-address", handlers.GenerateDepositAddress)
 		capital.GET("/deposit-addresses", handlers.GetDepositAddresses)
+		capital.GET("/deposit-addresses/:id/verify", handlers.VerifyDepositAddress)
+		capital.GET("/sweeps", staff, handlers.GetSweeps)
+		capital.POST("/sweeps/:id/cancel", staff, handlers.CancelSweep)
 	}
 
 	// Bitcoin routes (protected by JWT authentication)
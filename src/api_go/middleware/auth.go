@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"database/sql"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"paperhands/api/config"
+	"paperhands/api/models"
 	"paperhands/api/utils"
 )
 
@@ -12,6 +16,7 @@ import (
 const (
 	ContextUserID    = "userID"
 	ContextUserEmail = "userEmail"
+	ContextUserRole  = "userRole"
 )
 
 // AuthRequired is middleware that validates JWT tokens
@@ -35,34 +40,77 @@ func AuthRequired() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-
-		// Validate token
-		claims, err := utils.ValidateToken(tokenString)
-		if err != nil {
-			switch err {
-			case utils.ErrExpiredToken:
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"error": "Token has expired",
-				})
-			case utils.ErrMissingSecret:
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-					"error": "Server configuration error",
-				})
-			default:
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"error": "Invalid token",
-				})
+		authenticate(c, parts[1])
+	}
+}
+
+// StreamAuthRequired is AuthRequired for server-sent event streams. Browsers' EventSource
+// cannot set headers, so a short-lived stream token from POST /stream/token may be passed
+// in the stream_token query parameter instead. Login tokens are never accepted there.
+func StreamAuthRequired() gin.HandlerFunc {
+	auth := AuthRequired()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			if token := c.Query("stream_token"); token != "" {
+				authenticateWith(c, token, utils.ValidateStreamToken)
+				return
 			}
-			return
 		}
+		auth(c)
+	}
+}
 
-		// Store user info in context for use in handlers
-		c.Set(ContextUserID, claims.UserID)
-		c.Set(ContextUserEmail, claims.Email)
+// authenticate validates tokenString and stores the user in the context
+func authenticate(c *gin.Context, tokenString string) {
+	authenticateWith(c, tokenString, utils.ValidateToken)
+}
 
-		c.Next()
+// authenticateWith validates tokenString with validate and stores the user in the context
+func authenticateWith(c *gin.Context, tokenString string, validate func(string) (*utils.JWTClaims, error)) {
+	// Validate token
+	claims, err := validate(tokenString)
+	if err != nil {
+		switch err {
+		case utils.ErrExpiredToken:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Token has expired",
+			})
+		case utils.ErrMissingSecret:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error": "Server configuration error",
+			})
+		default:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Invalid token",
+			})
+		}
+		return
 	}
+
+	// The role is read from the database rather than the token, so a role change or
+	// deleted user takes effect immediately instead of when the token expires
+	var role string
+	err = config.DB.QueryRow("SELECT role FROM users WHERE id = $1", claims.UserID).Scan(&role)
+	if err == sql.ErrNoRows {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Invalid token",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching role of user %d: %v", claims.UserID, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to authenticate",
+		})
+		return
+	}
+
+	// Store user info in context for use in handlers
+	c.Set(ContextUserID, claims.UserID)
+	c.Set(ContextUserEmail, claims.Email)
+	c.Set(ContextUserRole, role)
+
+	c.Next()
 }
 
 // GetUserIDFromContext extracts user ID from Gin context
@@ -84,3 +132,44 @@ func GetUserEmailFromContext(c *gin.Context) (string, bool) {
 	emailStr, ok := email.(string)
 	return emailStr, ok
 }
+
+// GetUserRoleFromContext extracts user role from Gin context
+func GetUserRoleFromContext(c *gin.Context) (string, bool) {
+	role, exists := c.Get(ContextUserRole)
+	if !exists {
+		return "", false
+	}
+	roleStr, ok := role.(string)
+	return roleStr, ok
+}
+
+// RequireRole is middleware that only allows users with one of the given roles.
+// It must be used after AuthRequired.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, ok := GetUserRoleFromContext(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Authentication required",
+			})
+			return
+		}
+
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "Insufficient permissions",
+		})
+	}
+}
+
+// IsStaff reports whether the authenticated user is an operator or admin
+func IsStaff(c *gin.Context) bool {
+	role, _ := GetUserRoleFromContext(c)
+	return models.IsStaffRole(role)
+}
@@ -5,16 +5,27 @@ import (
 	"time"
 )
 
+// Capital supply statuses
+const (
+	CapitalStatusPending   = "pending"
+	CapitalStatusConfirmed = "confirmed"
+	// CapitalStatusRejected marks supplies whose transaction is missing, failed or does not
+	// match an on-chain transfer to the user's deposit address
+	CapitalStatusRejected = "rejected"
+)
+
 type CapitalSupply struct {
-	ID            int            `json:"id"`
-	UserID        int            `json:"userId"`
-	Token         string         `json:"token"`
-	Amount        float64        `json:"amount"`
-	WalletAddress string         `json:"walletAddress"`
-	TxHash        sql.NullString `json:"-"`
-	Status        string         `json:"status"`
-	CreatedAt     time.Time      `json:"createdAt"`
-	UpdatedAt     time.Time      `json:"updatedAt"`
+	ID              int            `json:"id"`
+	UserID          int            `json:"userId"`
+	Token           string         `json:"token"`
+	Amount          float64        `json:"amount"`
+	WalletAddress   string         `json:"walletAddress"`
+	TxHash          sql.NullString `json:"-"`
+	BlockNumber     sql.NullInt64  `json:"-"`
+	Status          string         `json:"status"`
+	RejectionReason sql.NullString `json:"-"`
+	CreatedAt       time.Time      `json:"createdAt"`
+	UpdatedAt       time.Time      `json:"updatedAt"`
 }
 
 func (c CapitalSupply) ToResponse() map[string]interface{} {
@@ -35,16 +46,56 @@ func (c CapitalSupply) ToResponse() map[string]interface{} {
 		resp["txHash"] = nil
 	}
 
+	if c.BlockNumber.Valid {
+		resp["blockNumber"] = c.BlockNumber.Int64
+	} else {
+		resp["blockNumber"] = nil
+	}
+
+	if c.RejectionReason.Valid {
+		resp["rejectionReason"] = c.RejectionReason.String
+	}
+
 	return resp
 }
 
+// Deposit address statuses
+const (
+	DepositAddressStatusActive = "active"
+	// DepositAddressStatusRetired marks random addresses generated before HD derivation
+	DepositAddressStatusRetired = "retired"
+)
+
 type DepositAddress struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"userId"`
-	Token     string    `json:"token"`
-	Address   string    `json:"address"`
-	Status    string    `json:"status"`
-	Swept     bool      `json:"swept"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID              int            `json:"id"`
+	UserID          int            `json:"userId"`
+	Token           string         `json:"token"`
+	Address         string         `json:"address"`
+	DerivationIndex sql.NullInt64  `json:"-"`
+	DerivationPath  sql.NullString `json:"-"`
+	Status          string         `json:"status"`
+	Swept           bool           `json:"swept"`
+	CreatedAt       time.Time      `json:"createdAt"`
+	UpdatedAt       time.Time      `json:"updatedAt"`
+}
+
+func (d DepositAddress) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":        d.ID,
+		"userId":    d.UserID,
+		"token":     d.Token,
+		"address":   d.Address,
+		"status":    d.Status,
+		"swept":     d.Swept,
+		"createdAt": d.CreatedAt,
+		"updatedAt": d.UpdatedAt,
+	}
+
+	if d.DerivationPath.Valid {
+		resp["derivationPath"] = d.DerivationPath.String
+	} else {
+		resp["derivationPath"] = nil
+	}
+
+	return resp
 }
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Disbursement methods, matching the disbursement_method type
+const (
+	// DisbursementMethodOnChain pays AUD stablecoins through the Disbursement contract
+	DisbursementMethodOnChain = "on_chain"
+	// DisbursementMethodAPI pays a bank transfer through the exchange API
+	DisbursementMethodAPI = "api"
+)
+
+// Disbursement statuses, matching the disbursement_status type
+const (
+	// DisbursementStatusPending disbursements are waiting to be sent
+	DisbursementStatusPending = "pending"
+	// DisbursementStatusProcessing disbursements have been sent and are waiting to settle
+	DisbursementStatusProcessing = "processing"
+	DisbursementStatusCompleted  = "completed"
+	// DisbursementStatusFailed disbursements are retried at NextAttemptAt, if set
+	DisbursementStatusFailed = "failed"
+)
+
+// IsValidDisbursementMethod reports whether method is a known disbursement method
+func IsValidDisbursementMethod(method string) bool {
+	return method == DisbursementMethodOnChain || method == DisbursementMethodAPI
+}
+
+// Disbursement is the payout of a loan's principal to the borrower
+type Disbursement struct {
+	ID               int     `json:"id"`
+	LoanID           int     `json:"loanId"`
+	CustomerID       int     `json:"customerId"`
+	AmountAUD        float64 `json:"amountAud"`
+	Method           string  `json:"method"`
+	Status           string  `json:"status"`
+	RecipientAddress string  `json:"recipientAddress"`
+	// TxHash is the transaction hash of on-chain payouts, or the exchange's withdrawal ID of
+	// bank transfers
+	TxHash        sql.NullString `json:"-"`
+	ErrorMessage  sql.NullString `json:"-"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt sql.NullTime   `json:"-"`
+	CompletedAt   sql.NullTime   `json:"-"`
+	CreatedBy     sql.NullInt64  `json:"-"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+}
+
+func (d Disbursement) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":               d.ID,
+		"loanId":           d.LoanID,
+		"customerId":       d.CustomerID,
+		"amountAud":        d.AmountAUD,
+		"method":           d.Method,
+		"status":           d.Status,
+		"recipientAddress": d.RecipientAddress,
+		"txHash":           nil,
+		"errorMessage":     nil,
+		"attempts":         d.Attempts,
+		"nextAttemptAt":    nil,
+		"completedAt":      nil,
+		"createdBy":        nil,
+		"createdAt":        d.CreatedAt,
+		"updatedAt":        d.UpdatedAt,
+	}
+
+	if d.TxHash.Valid {
+		resp["txHash"] = d.TxHash.String
+	}
+	if d.ErrorMessage.Valid {
+		resp["errorMessage"] = d.ErrorMessage.String
+	}
+	if d.NextAttemptAt.Valid {
+		resp["nextAttemptAt"] = d.NextAttemptAt.Time
+	}
+	if d.CompletedAt.Valid {
+		resp["completedAt"] = d.CompletedAt.Time
+	}
+	if d.CreatedBy.Valid {
+		resp["createdBy"] = d.CreatedBy.Int64
+	}
+
+	return resp
+}
+
+// On-chain disbursement reconciliation statuses
+const (
+	// OnChainDisbursementMatched payouts are the transaction of an on_chain disbursement
+	OnChainDisbursementMatched = "matched"
+	// OnChainDisbursementMismatch payouts belong to a disbursement but disagree with it on the
+	// loan, recipient or amount
+	OnChainDisbursementMismatch = "mismatch"
+	// OnChainDisbursementUnmatched payouts have no disbursement recording their transaction
+	OnChainDisbursementUnmatched = "unmatched"
+)
+
+// OnChainDisbursement is a payout seen in the Disbursement contract's events and the
+// disbursement it was reconciled against
+type OnChainDisbursement struct {
+	ID int `json:"id"`
+	// ContractDisbursementID and ContractLoanID are the contract's bytes32 disbursementId and
+	// loanId as hex
+	ContractDisbursementID string         `json:"contractDisbursementId"`
+	ContractLoanID         string         `json:"contractLoanId"`
+	LoanID                 sql.NullInt64  `json:"-"`
+	DisbursementID         sql.NullInt64  `json:"-"`
+	RecipientAddress       string         `json:"recipientAddress"`
+	Amount                 float64        `json:"amount"`
+	AmountBaseUnits        string         `json:"amountBaseUnits"`
+	TxHash                 string         `json:"txHash"`
+	LogIndex               int            `json:"logIndex"`
+	BlockNumber            int64          `json:"blockNumber"`
+	Status                 string         `json:"status"`
+	Reason                 sql.NullString `json:"-"`
+	CreatedAt              time.Time      `json:"createdAt"`
+	UpdatedAt              time.Time      `json:"updatedAt"`
+}
+
+func (o OnChainDisbursement) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":                     o.ID,
+		"contractDisbursementId": o.ContractDisbursementID,
+		"contractLoanId":         o.ContractLoanID,
+		"loanId":                 nil,
+		"disbursementId":         nil,
+		"recipientAddress":       o.RecipientAddress,
+		"amount":                 o.Amount,
+		"amountBaseUnits":        o.AmountBaseUnits,
+		"txHash":                 o.TxHash,
+		"logIndex":               o.LogIndex,
+		"blockNumber":            o.BlockNumber,
+		"status":                 o.Status,
+		"reason":                 nil,
+		"createdAt":              o.CreatedAt,
+		"updatedAt":              o.UpdatedAt,
+	}
+
+	if o.LoanID.Valid {
+		resp["loanId"] = o.LoanID.Int64
+	}
+	if o.DisbursementID.Valid {
+		resp["disbursementId"] = o.DisbursementID.Int64
+	}
+	if o.Reason.Valid {
+		resp["reason"] = o.Reason.String
+	}
+
+	return resp
+}
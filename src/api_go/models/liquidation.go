@@ -0,0 +1,134 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Liquidation statuses
+const (
+	LiquidationStatusAwaitingSignature = "awaiting_signature"
+	LiquidationStatusSwept             = "swept"
+	LiquidationStatusSettled           = "settled"
+)
+
+type LoanLiquidation struct {
+	ID                  int             `json:"id"`
+	LoanID              int             `json:"loanId"`
+	ExchangeAddress     string          `json:"exchangeAddress"`
+	PSBT                string          `json:"psbt"`
+	InputSats           int64           `json:"inputSats"`
+	FeeSats             int64           `json:"feeSats"`
+	SweepSats           int64           `json:"sweepSats"`
+	BTCPrice            float64         `json:"btcPrice"`
+	LVR                 float64         `json:"lvr"`
+	OutstandingAUD      float64         `json:"outstandingAud"`
+	ExpectedProceedsAUD float64         `json:"expectedProceedsAud"`
+	Status              string          `json:"status"`
+	SweepTxID           sql.NullString  `json:"-"`
+	ProceedsAUD         sql.NullFloat64 `json:"-"`
+	SurplusAUD          sql.NullFloat64 `json:"-"`
+	ShortfallAUD        sql.NullFloat64 `json:"-"`
+	InitiatedBy         sql.NullInt64   `json:"-"`
+	SettledBy           sql.NullInt64   `json:"-"`
+	SettledAt           sql.NullTime    `json:"-"`
+	CreatedAt           time.Time       `json:"createdAt"`
+	UpdatedAt           time.Time       `json:"updatedAt"`
+}
+
+func (l LoanLiquidation) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":                  l.ID,
+		"loanId":              l.LoanID,
+		"exchangeAddress":     l.ExchangeAddress,
+		"psbt":                l.PSBT,
+		"inputSats":           l.InputSats,
+		"feeSats":             l.FeeSats,
+		"sweepSats":           l.SweepSats,
+		"sweepBtc":            float64(l.SweepSats) / 1e8,
+		"btcPrice":            l.BTCPrice,
+		"lvr":                 l.LVR,
+		"outstandingAud":      l.OutstandingAUD,
+		"expectedProceedsAud": l.ExpectedProceedsAUD,
+		"status":              l.Status,
+		"sweepTxid":           nil,
+		"proceedsAud":         nil,
+		"surplusAud":          nil,
+		"shortfallAud":        nil,
+		"initiatedBy":         nil,
+		"settledBy":           nil,
+		"settledAt":           nil,
+		"createdAt":           l.CreatedAt,
+		"updatedAt":           l.UpdatedAt,
+	}
+
+	if l.SweepTxID.Valid {
+		resp["sweepTxid"] = l.SweepTxID.String
+	}
+
+	if l.ProceedsAUD.Valid {
+		resp["proceedsAud"] = l.ProceedsAUD.Float64
+	}
+
+	if l.SurplusAUD.Valid {
+		resp["surplusAud"] = l.SurplusAUD.Float64
+	}
+
+	if l.ShortfallAUD.Valid {
+		resp["shortfallAud"] = l.ShortfallAUD.Float64
+	}
+
+	if l.InitiatedBy.Valid {
+		resp["initiatedBy"] = l.InitiatedBy.Int64
+	}
+
+	if l.SettledBy.Valid {
+		resp["settledBy"] = l.SettledBy.Int64
+	}
+
+	if l.SettledAt.Valid {
+		resp["settledAt"] = l.SettledAt.Time
+	}
+
+	return resp
+}
+
+// Customer credit statuses
+const (
+	CreditStatusPending = "pending"
+	CreditStatusPaid    = "paid"
+)
+
+// CreditReasonLiquidationSurplus is the reason for crediting liquidation proceeds above the balance owed
+const CreditReasonLiquidationSurplus = "liquidation_surplus"
+
+// CustomerCredit is money owed back to a borrower, e.g. liquidation surplus
+type CustomerCredit struct {
+	ID         int           `json:"id"`
+	CustomerID int           `json:"customerId"`
+	LoanID     sql.NullInt64 `json:"-"`
+	AmountAUD  float64       `json:"amountAud"`
+	Reason     string        `json:"reason"`
+	Status     string        `json:"status"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	UpdatedAt  time.Time     `json:"updatedAt"`
+}
+
+func (c CustomerCredit) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":         c.ID,
+		"customerId": c.CustomerID,
+		"loanId":     nil,
+		"amountAud":  c.AmountAUD,
+		"reason":     c.Reason,
+		"status":     c.Status,
+		"createdAt":  c.CreatedAt,
+		"updatedAt":  c.UpdatedAt,
+	}
+
+	if c.LoanID.Valid {
+		resp["loanId"] = c.LoanID.Int64
+	}
+
+	return resp
+}
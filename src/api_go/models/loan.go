@@ -2,33 +2,54 @@ package models
 
 import (
 	"database/sql"
+	"sort"
 	"time"
 )
 
 type Loan struct {
-	ID                 int            `json:"id"`
-	CustomerID         int            `json:"customerId"`
-	AmountAUD          float64        `json:"amountAud"`
-	CollateralBTC      float64        `json:"collateralBtc"`
-	BTCPriceAtCreation float64        `json:"btcPriceAtCreation"`
-	Status             string         `json:"status"`
-	DepositAddress     sql.NullString `json:"-"`
-	DerivationPath     sql.NullString `json:"-"`
-	CreatedAt          time.Time      `json:"createdAt"`
-	UpdatedAt          time.Time      `json:"updatedAt"`
+	ID                      int             `json:"id"`
+	CustomerID              int             `json:"customerId"`
+	AmountAUD               float64         `json:"amountAud"`
+	CollateralBTC           float64         `json:"collateralBtc"`
+	BTCPriceAtCreation      float64         `json:"btcPriceAtCreation"`
+	Status                  string          `json:"status"`
+	DepositAddress          sql.NullString  `json:"-"`
+	DerivationPath          sql.NullString  `json:"-"`
+	AnnualInterestRate      float64         `json:"annualInterestRate"`
+	RateUtilisation         sql.NullFloat64 `json:"-"`
+	AdminFeeRate            float64         `json:"adminFeeRate"`
+	AdminFeeAUD             float64         `json:"adminFeeAud"`
+	TermMonths              int             `json:"termMonths"`
+	PrincipalOutstandingAUD float64         `json:"principalOutstandingAud"`
+	AccruedInterestAUD      float64         `json:"accruedInterestAud"`
+	FeesPaidAUD             float64         `json:"feesPaidAud"`
+	InterestPaidAUD         float64         `json:"interestPaidAud"`
+	InterestAccruedThrough  sql.NullTime    `json:"-"`
+	DisbursedAt             sql.NullTime    `json:"-"`
+	BTCReturnAddress        sql.NullString  `json:"-"`
+	CreatedAt               time.Time       `json:"createdAt"`
+	UpdatedAt               time.Time       `json:"updatedAt"`
 }
 
 // MarshalJSON custom marshaler to handle nullable fields
 func (l Loan) ToResponse() map[string]interface{} {
 	resp := map[string]interface{}{
-		"id":                 l.ID,
-		"customerId":         l.CustomerID,
-		"amountAud":          l.AmountAUD,
-		"collateralBtc":      l.CollateralBTC,
-		"btcPriceAtCreation": l.BTCPriceAtCreation,
-		"status":             l.Status,
-		"createdAt":          l.CreatedAt,
-		"updatedAt":          l.UpdatedAt,
+		"id":                      l.ID,
+		"customerId":              l.CustomerID,
+		"amountAud":               l.AmountAUD,
+		"collateralBtc":           l.CollateralBTC,
+		"btcPriceAtCreation":      l.BTCPriceAtCreation,
+		"status":                  l.Status,
+		"annualInterestRate":      l.AnnualInterestRate,
+		"adminFeeRate":            l.AdminFeeRate,
+		"adminFeeAud":             l.AdminFeeAUD,
+		"termMonths":              l.TermMonths,
+		"principalOutstandingAud": l.PrincipalOutstandingAUD,
+		"accruedInterestAud":      l.AccruedInterestAUD,
+		"feesPaidAud":             l.FeesPaidAUD,
+		"interestPaidAud":         l.InterestPaidAUD,
+		"createdAt":               l.CreatedAt,
+		"updatedAt":               l.UpdatedAt,
 	}
 
 	if l.DepositAddress.Valid {
@@ -43,5 +64,204 @@ func (l Loan) ToResponse() map[string]interface{} {
 		resp["derivationPath"] = nil
 	}
 
+	if l.BTCReturnAddress.Valid {
+		resp["btcReturnAddress"] = l.BTCReturnAddress.String
+	} else {
+		resp["btcReturnAddress"] = nil
+	}
+
+	if l.InterestAccruedThrough.Valid {
+		resp["interestAccruedThrough"] = l.InterestAccruedThrough.Time.Format("2006-01-02")
+	} else {
+		resp["interestAccruedThrough"] = nil
+	}
+
+	if l.RateUtilisation.Valid {
+		resp["rateUtilisation"] = l.RateUtilisation.Float64
+	} else {
+		resp["rateUtilisation"] = nil
+	}
+
+	if l.DisbursedAt.Valid {
+		resp["disbursedAt"] = l.DisbursedAt.Time
+		resp["maturityDate"] = l.DisbursedAt.Time.AddDate(0, l.TermMonths, 0).Format("2006-01-02")
+	} else {
+		resp["disbursedAt"] = nil
+		resp["maturityDate"] = nil
+	}
+
+	return resp
+}
+
+// Loan lifecycle statuses
+const (
+	LoanStatusPending            = "pending"
+	LoanStatusAwaitingCollateral = "awaiting_collateral"
+	LoanStatusCollateralised     = "collateralised"
+	LoanStatusDisbursed          = "disbursed"
+	LoanStatusActive             = "active"
+	LoanStatusRepaid             = "repaid"
+	LoanStatusLiquidating        = "liquidating"
+	LoanStatusLiquidated         = "liquidated"
+	LoanStatusDefaulted          = "defaulted"
+	LoanStatusCancelled          = "cancelled"
+)
+
+// loanTransitions lists the statuses each status may move to
+var loanTransitions = map[string][]string{
+	LoanStatusPending:            {LoanStatusAwaitingCollateral, LoanStatusCancelled},
+	LoanStatusAwaitingCollateral: {LoanStatusCollateralised, LoanStatusCancelled},
+	LoanStatusCollateralised:     {LoanStatusDisbursed, LoanStatusCancelled},
+	LoanStatusDisbursed:          {LoanStatusActive, LoanStatusLiquidating, LoanStatusDefaulted},
+	LoanStatusActive:             {LoanStatusRepaid, LoanStatusLiquidating, LoanStatusDefaulted},
+	LoanStatusLiquidating:        {LoanStatusLiquidated},
+	LoanStatusRepaid:             {},
+	LoanStatusLiquidated:         {},
+	LoanStatusDefaulted:          {},
+	LoanStatusCancelled:          {},
+}
+
+// systemLoanStatuses are only entered through the workflow that owns them: the collateral
+// watcher, disbursements, repayments and liquidations
+var systemLoanStatuses = map[string]bool{
+	LoanStatusCollateralised: true,
+	LoanStatusDisbursed:      true,
+	LoanStatusActive:         true,
+	LoanStatusRepaid:         true,
+	LoanStatusLiquidating:    true,
+	LoanStatusLiquidated:     true,
+}
+
+// IsSystemLoanStatus reports whether status can only be set by the system, not by staff directly
+func IsSystemLoanStatus(status string) bool {
+	return systemLoanStatuses[status]
+}
+
+// IsValidLoanStatus reports whether status is a known loan status
+func IsValidLoanStatus(status string) bool {
+	_, ok := loanTransitions[status]
+	return ok
+}
+
+// CanTransitionLoan reports whether a loan may move from one status to another
+func CanTransitionLoan(from, to string) bool {
+	for _, next := range loanTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// FinalLoanStatuses returns the statuses a loan cannot move on from
+func FinalLoanStatuses() []string {
+	var final []string
+	for status, next := range loanTransitions {
+		if len(next) == 0 {
+			final = append(final, status)
+		}
+	}
+	sort.Strings(final)
+	return final
+}
+
+type LoanStatusHistory struct {
+	ID          int            `json:"id"`
+	LoanID      int            `json:"loanId"`
+	FromStatus  sql.NullString `json:"-"`
+	ToStatus    string         `json:"toStatus"`
+	ActorUserID sql.NullInt64  `json:"-"`
+	Reason      sql.NullString `json:"-"`
+	CreatedAt   time.Time      `json:"createdAt"`
+}
+
+func (h LoanStatusHistory) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":         h.ID,
+		"loanId":     h.LoanID,
+		"fromStatus": nil,
+		"toStatus":   h.ToStatus,
+		"actorId":    nil,
+		"reason":     nil,
+		"createdAt":  h.CreatedAt,
+	}
+
+	if h.FromStatus.Valid {
+		resp["fromStatus"] = h.FromStatus.String
+	}
+
+	if h.ActorUserID.Valid {
+		resp["actorId"] = h.ActorUserID.Int64
+	}
+
+	if h.Reason.Valid {
+		resp["reason"] = h.Reason.String
+	}
+
+	return resp
+}
+
+type CollateralUTXO struct {
+	ID            int           `json:"id"`
+	LoanID        int           `json:"loanId"`
+	Address       string        `json:"address"`
+	TxID          string        `json:"txid"`
+	Vout          int           `json:"vout"`
+	AmountSats    int64         `json:"amountSats"`
+	BlockHeight   sql.NullInt64 `json:"-"`
+	Confirmations int64         `json:"confirmations"`
+	Spent         bool          `json:"spent"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	UpdatedAt     time.Time     `json:"updatedAt"`
+}
+
+func (u CollateralUTXO) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":            u.ID,
+		"loanId":        u.LoanID,
+		"address":       u.Address,
+		"txid":          u.TxID,
+		"vout":          u.Vout,
+		"amountSats":    u.AmountSats,
+		"amountBtc":     float64(u.AmountSats) / 1e8,
+		"blockHeight":   nil,
+		"confirmations": u.Confirmations,
+		"spent":         u.Spent,
+		"createdAt":     u.CreatedAt,
+		"updatedAt":     u.UpdatedAt,
+	}
+
+	if u.BlockHeight.Valid {
+		resp["blockHeight"] = u.BlockHeight.Int64
+	}
+
+	return resp
+}
+
+type LoanRiskEvent struct {
+	ID        int            `json:"id"`
+	LoanID    int            `json:"loanId"`
+	FromLevel sql.NullString `json:"-"`
+	ToLevel   string         `json:"toLevel"`
+	LVR       float64        `json:"lvr"`
+	BTCPrice  float64        `json:"btcPrice"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+func (e LoanRiskEvent) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":        e.ID,
+		"loanId":    e.LoanID,
+		"fromLevel": nil,
+		"toLevel":   e.ToLevel,
+		"lvr":       e.LVR,
+		"btcPrice":  e.BTCPrice,
+		"createdAt": e.CreatedAt,
+	}
+
+	if e.FromLevel.Valid {
+		resp["fromLevel"] = e.FromLevel.String
+	}
+
 	return resp
 }
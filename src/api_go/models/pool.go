@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Pool ledger entry types
+const (
+	PoolEntryDeposit    = "deposit"
+	PoolEntryInterest   = "interest"
+	PoolEntryWithdrawal = "withdrawal"
+)
+
+// PoolPosition is a lender's holding in a lending pool. Principal is the amount supplied;
+// Value is what the shares are worth now, so Yield is the interest earned on the principal.
+type PoolPosition struct {
+	UserID     int       `json:"userId"`
+	Token      string    `json:"token"`
+	Principal  float64   `json:"principal"`
+	Shares     float64   `json:"shares"`
+	SharePrice float64   `json:"sharePrice"`
+	Value      float64   `json:"value"`
+	Yield      float64   `json:"yield"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// PoolLiquidity is how much of a lending pool is lent out and how much can be withdrawn.
+// Lent is the pool's share of outstanding loan principal, in the pool's token.
+type PoolLiquidity struct {
+	Token       string  `json:"token"`
+	TotalAssets float64 `json:"totalAssets"`
+	Lent        float64 `json:"lent"`
+	Available   float64 `json:"available"`
+	Utilisation float64 `json:"utilisation"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoanQuote locks the BTC/AUD price and collateral requirement for a new loan
+type LoanQuote struct {
+	ID            string        `json:"id"`
+	UserID        int           `json:"userId"`
+	BTCPrice      float64       `json:"btcPrice"`
+	LVR           float64       `json:"lvr"`
+	MaxAmountAUD  float64       `json:"maxAmountAud"`
+	CollateralBTC float64       `json:"collateralBtc"`
+	ExpiresAt     time.Time     `json:"expiresAt"`
+	LoanID        sql.NullInt64 `json:"-"`
+	UsedAt        sql.NullTime  `json:"-"`
+	CreatedAt     time.Time     `json:"createdAt"`
+}
+
+// Expired reports whether the quote can no longer be used at now
+func (q LoanQuote) Expired(now time.Time) bool {
+	return !now.Before(q.ExpiresAt)
+}
+
+// ToResponse returns the quote with its signed ID, which is what clients pass to CreateLoan
+func (q LoanQuote) ToResponse(signedID string) map[string]interface{} {
+	resp := map[string]interface{}{
+		"quoteId":       signedID,
+		"btcPrice":      q.BTCPrice,
+		"lvr":           q.LVR,
+		"maxAmountAud":  q.MaxAmountAUD,
+		"collateralBtc": q.CollateralBTC,
+		"expiresAt":     q.ExpiresAt,
+		"createdAt":     q.CreatedAt,
+		"loanId":        nil,
+		"usedAt":        nil,
+	}
+
+	if q.LoanID.Valid {
+		resp["loanId"] = q.LoanID.Int64
+	}
+
+	if q.UsedAt.Valid {
+		resp["usedAt"] = q.UsedAt.Time
+	}
+
+	return resp
+}
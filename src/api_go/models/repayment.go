@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Repayment currencies
+const (
+	RepaymentCurrencyAUD  = "AUD"
+	RepaymentCurrencyAAUD = "AAUD"
+	RepaymentCurrencyUSDC = "USDC"
+	RepaymentCurrencyUSDT = "USDT"
+)
+
+// IsValidRepaymentCurrency reports whether currency is accepted for repayments
+func IsValidRepaymentCurrency(currency string) bool {
+	switch currency {
+	case RepaymentCurrencyAUD, RepaymentCurrencyAAUD, RepaymentCurrencyUSDC, RepaymentCurrencyUSDT:
+		return true
+	}
+	return false
+}
+
+// IsStablecoin reports whether a repayment currency is settled on-chain
+func IsStablecoin(currency string) bool {
+	return currency != RepaymentCurrencyAUD && IsValidRepaymentCurrency(currency)
+}
+
+type LoanRepayment struct {
+	ID           int            `json:"id"`
+	LoanID       int            `json:"loanId"`
+	Currency     string         `json:"currency"`
+	Amount       float64        `json:"amount"`
+	AmountAUD    float64        `json:"amountAud"`
+	FeesAUD      float64        `json:"feesAud"`
+	InterestAUD  float64        `json:"interestAud"`
+	PrincipalAUD float64        `json:"principalAud"`
+	Reference    sql.NullString `json:"-"`
+	TxHash       sql.NullString `json:"-"`
+	RecordedBy   sql.NullInt64  `json:"-"`
+	CreatedAt    time.Time      `json:"createdAt"`
+}
+
+func (r LoanRepayment) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":           r.ID,
+		"loanId":       r.LoanID,
+		"currency":     r.Currency,
+		"amount":       r.Amount,
+		"amountAud":    r.AmountAUD,
+		"feesAud":      r.FeesAUD,
+		"interestAud":  r.InterestAUD,
+		"principalAud": r.PrincipalAUD,
+		"reference":    nil,
+		"txHash":       nil,
+		"recordedBy":   nil,
+		"createdAt":    r.CreatedAt,
+	}
+
+	if r.Reference.Valid {
+		resp["reference"] = r.Reference.String
+	}
+
+	if r.TxHash.Valid {
+		resp["txHash"] = r.TxHash.String
+	}
+
+	if r.RecordedBy.Valid {
+		resp["recordedBy"] = r.RecordedBy.Int64
+	}
+
+	return resp
+}
+
+// Collateral release statuses
+const (
+	CollateralReleaseAwaitingAddress   = "awaiting_address"
+	CollateralReleasePending           = "pending"
+	CollateralReleaseAwaitingSignature = "awaiting_signature"
+	CollateralReleaseReleased          = "released"
+)
+
+type CollateralRelease struct {
+	ID            int            `json:"id"`
+	LoanID        int            `json:"loanId"`
+	ReturnAddress sql.NullString `json:"-"`
+	AmountSats    int64          `json:"amountSats"`
+	Status        string         `json:"status"`
+	PSBT          sql.NullString `json:"-"`
+	FeeRate       sql.NullInt64  `json:"-"`
+	FeeSats       sql.NullInt64  `json:"-"`
+	PSBTCreatedAt sql.NullTime   `json:"-"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	UpdatedAt     time.Time      `json:"updatedAt"`
+}
+
+func (r CollateralRelease) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":            r.ID,
+		"loanId":        r.LoanID,
+		"returnAddress": nil,
+		"amountSats":    r.AmountSats,
+		"amountBtc":     float64(r.AmountSats) / 1e8,
+		"status":        r.Status,
+		"psbt":          nil,
+		"feeRate":       nil,
+		"feeSats":       nil,
+		"psbtCreatedAt": nil,
+		"createdAt":     r.CreatedAt,
+		"updatedAt":     r.UpdatedAt,
+	}
+
+	if r.ReturnAddress.Valid {
+		resp["returnAddress"] = r.ReturnAddress.String
+	}
+
+	if r.PSBT.Valid {
+		resp["psbt"] = r.PSBT.String
+	}
+
+	if r.FeeRate.Valid {
+		resp["feeRate"] = r.FeeRate.Int64
+	}
+
+	if r.FeeSats.Valid {
+		resp["feeSats"] = r.FeeSats.Int64
+	}
+
+	if r.PSBTCreatedAt.Valid {
+		resp["psbtCreatedAt"] = r.PSBTCreatedAt.Time
+	}
+
+	return resp
+}
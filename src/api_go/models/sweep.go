@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Deposit sweep statuses
+const (
+	SweepStatusAwaitingSignature = "awaiting_signature"
+	SweepStatusSwept             = "swept"
+	SweepStatusCancelled         = "cancelled"
+)
+
+// DepositSweep is the transfer of a deposit address's token balance to the treasury
+type DepositSweep struct {
+	ID               int            `json:"id"`
+	DepositAddressID int            `json:"depositAddressId"`
+	Address          string         `json:"address"`
+	UserID           int            `json:"userId"`
+	Token            string         `json:"token"`
+	Amount           float64        `json:"amount"`
+	AmountBaseUnits  string         `json:"amountBaseUnits"`
+	TreasuryAddress  string         `json:"treasuryAddress"`
+	UnsignedTx       string         `json:"-"`
+	GasTopUpWei      string         `json:"gasTopUpWei"`
+	FromBlock        int64          `json:"fromBlock"`
+	Status           string         `json:"status"`
+	TxHash           sql.NullString `json:"-"`
+	BlockNumber      sql.NullInt64  `json:"-"`
+	SweptAt          sql.NullTime   `json:"-"`
+	CreatedAt        time.Time      `json:"createdAt"`
+	UpdatedAt        time.Time      `json:"updatedAt"`
+}
+
+func (s DepositSweep) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":               s.ID,
+		"depositAddressId": s.DepositAddressID,
+		"address":          s.Address,
+		"userId":           s.UserID,
+		"token":            s.Token,
+		"amount":           s.Amount,
+		"amountBaseUnits":  s.AmountBaseUnits,
+		"treasuryAddress":  s.TreasuryAddress,
+		"unsignedTx":       json.RawMessage(s.UnsignedTx),
+		"gasTopUpWei":      s.GasTopUpWei,
+		"fromBlock":        s.FromBlock,
+		"status":           s.Status,
+		"txHash":           nil,
+		"blockNumber":      nil,
+		"sweptAt":          nil,
+		"createdAt":        s.CreatedAt,
+		"updatedAt":        s.UpdatedAt,
+	}
+
+	if s.TxHash.Valid {
+		resp["txHash"] = s.TxHash.String
+	}
+	if s.BlockNumber.Valid {
+		resp["blockNumber"] = s.BlockNumber.Int64
+	}
+	if s.SweptAt.Valid {
+		resp["sweptAt"] = s.SweptAt.Time
+	}
+
+	return resp
+}
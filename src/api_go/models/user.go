@@ -2,9 +2,32 @@ package models
 
 import "time"
 
+// User roles
+const (
+	RoleBorrower = "borrower"
+	RoleLender   = "lender"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
 type User struct {
 	ID        int       `json:"id"`
 	Email     string    `json:"email"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// IsValidRole reports whether role is a known user role
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleBorrower, RoleLender, RoleOperator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// IsStaffRole reports whether role belongs to PaperHands staff
+func IsStaffRole(role string) bool {
+	return role == RoleOperator || role == RoleAdmin
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Capital withdrawal statuses
+const (
+	// WithdrawalStatusPending withdrawals are serving their notice period
+	WithdrawalStatusPending = "pending"
+	// WithdrawalStatusQueued withdrawals are waiting for the pool to have enough unlent liquidity
+	WithdrawalStatusQueued = "queued"
+	// WithdrawalStatusReady withdrawals have burned their shares and are waiting to be paid out
+	WithdrawalStatusReady     = "ready"
+	WithdrawalStatusPaid      = "paid"
+	WithdrawalStatusCancelled = "cancelled"
+)
+
+// CapitalWithdrawal is a lender's request to take capital out of a lending pool
+type CapitalWithdrawal struct {
+	ID            int             `json:"id"`
+	UserID        int             `json:"userId"`
+	Token         string          `json:"token"`
+	Amount        float64         `json:"amount"`
+	WalletAddress string          `json:"walletAddress"`
+	Status        string          `json:"status"`
+	AvailableAt   time.Time       `json:"availableAt"`
+	Shares        sql.NullFloat64 `json:"-"`
+	SharePrice    sql.NullFloat64 `json:"-"`
+	ApprovedAt    sql.NullTime    `json:"-"`
+	PayoutTxHash  sql.NullString  `json:"-"`
+	PaidAt        sql.NullTime    `json:"-"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	UpdatedAt     time.Time       `json:"updatedAt"`
+}
+
+func (w CapitalWithdrawal) ToResponse() map[string]interface{} {
+	resp := map[string]interface{}{
+		"id":            w.ID,
+		"userId":        w.UserID,
+		"token":         w.Token,
+		"amount":        w.Amount,
+		"walletAddress": w.WalletAddress,
+		"status":        w.Status,
+		"availableAt":   w.AvailableAt,
+		"shares":        nil,
+		"sharePrice":    nil,
+		"approvedAt":    nil,
+		"payoutTxHash":  nil,
+		"paidAt":        nil,
+		"createdAt":     w.CreatedAt,
+		"updatedAt":     w.UpdatedAt,
+	}
+
+	if w.Shares.Valid {
+		resp["shares"] = w.Shares.Float64
+	}
+	if w.SharePrice.Valid {
+		resp["sharePrice"] = w.SharePrice.Float64
+	}
+	if w.ApprovedAt.Valid {
+		resp["approvedAt"] = w.ApprovedAt.Time
+	}
+	if w.PayoutTxHash.Valid {
+		resp["payoutTxHash"] = w.PayoutTxHash.String
+	}
+	if w.PaidAt.Valid {
+		resp["paidAt"] = w.PaidAt.Time
+	}
+
+	return resp
+}
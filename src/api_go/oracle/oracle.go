@@ -0,0 +1,273 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"paperhands/api/config"
+)
+
+// Error definitions
+var (
+	ErrUnsupportedPair     = errors.New("pair not supported by source")
+	ErrInsufficientSources = errors.New("not enough price sources agree")
+	ErrInvalidPrice        = errors.New("source returned an invalid price")
+	ErrUnknownSource       = errors.New("unknown price source")
+)
+
+// Pair is a currency pair, e.g. BTC/AUD
+type Pair struct {
+	Base  string `json:"base"`
+	Quote string `json:"quote"`
+}
+
+// BTCAUD is the pair loans are priced in
+var BTCAUD = Pair{Base: "BTC", Quote: "AUD"}
+
+func (p Pair) String() string {
+	return p.Base + "/" + p.Quote
+}
+
+// Quote is a price observed at a single source
+type Quote struct {
+	Source    string    `json:"source"`
+	Pair      Pair      `json:"pair"`
+	Price     float64   `json:"price"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PriceSource is an upstream that can quote currency pairs
+type PriceSource interface {
+	// Name identifies the source in responses and configuration
+	Name() string
+	// Quote returns the latest price for pair, or ErrUnsupportedPair
+	Quote(ctx context.Context, pair Pair) (Quote, error)
+}
+
+// Source statuses reported in a Result
+const (
+	StatusAccepted = "accepted"
+	StatusOutlier  = "outlier"
+	StatusStale    = "stale"
+	StatusError    = "error"
+)
+
+// SourceResult is how one source contributed to an aggregated price
+type SourceResult struct {
+	Source string `json:"source"`
+	// Pair is the leg a source quoted when the result is a cross rate
+	Pair      string     `json:"pair,omitempty"`
+	Status    string     `json:"status"`
+	Price     float64    `json:"price,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	// Latency is how long the source took to respond
+	Latency time.Duration `json:"-"`
+}
+
+// Result is an aggregated price and the sources behind it
+type Result struct {
+	Pair      Pair           `json:"pair"`
+	Price     float64        `json:"price"`
+	Timestamp time.Time      `json:"timestamp"`
+	Sources   []SourceResult `json:"sources"`
+}
+
+// Oracle aggregates quotes from several sources into a single price.
+// Quotes older than the source's max age are ignored, the median of the
+// rest is taken, and quotes deviating from it by more than MaxDeviation
+// are rejected before the final median is computed.
+type Oracle struct {
+	Sources []PriceSource
+	// MaxAge is the default staleness limit; SourceMaxAge overrides it per source
+	MaxAge       time.Duration
+	SourceMaxAge map[string]time.Duration
+	// MaxDeviation is the fraction a quote may differ from the median, e.g. 0.02 for 2%
+	MaxDeviation float64
+	// MinSources is the number of accepted quotes required for a price
+	MinSources int
+	Timeout    time.Duration
+}
+
+// DefaultSources is the order sources are queried in when ORACLE_SOURCES is unset
+var DefaultSources = []string{"coingecko", "independentreserve", "kraken", "coinspot", "binance"}
+
+// NewFromEnv creates an oracle configured by:
+//   - ORACLE_SOURCES: comma separated source names (default all)
+//   - ORACLE_<SOURCE>_URL: base URL override for a source, e.g. a local stub
+//   - ORACLE_MAX_AGE_SECONDS (default 120) and ORACLE_<SOURCE>_MAX_AGE_SECONDS
+//   - ORACLE_MAX_DEVIATION (default 0.02)
+//   - ORACLE_MIN_SOURCES (default 2)
+//   - ORACLE_TIMEOUT_SECONDS (default 5)
+func NewFromEnv() *Oracle {
+	names := DefaultSources
+	if env := os.Getenv("ORACLE_SOURCES"); env != "" {
+		names = strings.Split(env, ",")
+	}
+
+	o := &Oracle{
+		MaxAge:       time.Duration(config.EnvInt("ORACLE_MAX_AGE_SECONDS", 120)) * time.Second,
+		SourceMaxAge: map[string]time.Duration{},
+		MaxDeviation: config.EnvFloat("ORACLE_MAX_DEVIATION", 0.02),
+		MinSources:   config.EnvInt("ORACLE_MIN_SOURCES", 2),
+		Timeout:      time.Duration(config.EnvInt("ORACLE_TIMEOUT_SECONDS", 5)) * time.Second,
+	}
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		envName := "ORACLE_" + strings.ToUpper(name)
+		source, err := NewSource(name, os.Getenv(envName+"_URL"))
+		if err != nil {
+			log.Printf("Skipping price source %q: %v", name, err)
+			continue
+		}
+		o.Sources = append(o.Sources, source)
+
+		if maxAge := config.EnvInt(envName+"_MAX_AGE_SECONDS", 0); maxAge > 0 {
+			o.SourceMaxAge[name] = time.Duration(maxAge) * time.Second
+		}
+	}
+
+	if o.MinSources > len(o.Sources) {
+		log.Printf("ORACLE_MIN_SOURCES %d exceeds the %d configured sources", o.MinSources, len(o.Sources))
+	}
+
+	return o
+}
+
+// maxAge returns the staleness limit for a source
+func (o *Oracle) maxAge(source string) time.Duration {
+	if age, ok := o.SourceMaxAge[source]; ok {
+		return age
+	}
+	return o.MaxAge
+}
+
+// Price queries every source concurrently and aggregates the quotes for pair
+func (o *Oracle) Price(ctx context.Context, pair Pair) (Result, error) {
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	quotes := make([]Quote, len(o.Sources))
+	errs := make([]error, len(o.Sources))
+	latencies := make(map[string]time.Duration, len(o.Sources))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, source := range o.Sources {
+		wg.Add(1)
+		go func(i int, source PriceSource) {
+			defer wg.Done()
+			start := time.Now()
+			quotes[i], errs[i] = source.Quote(ctx, pair)
+
+			mu.Lock()
+			latencies[source.Name()] = time.Since(start)
+			mu.Unlock()
+		}(i, source)
+	}
+	wg.Wait()
+
+	result, err := o.Aggregate(pair, quotes, errs, time.Now())
+	for i := range result.Sources {
+		result.Sources[i].Latency = latencies[result.Sources[i].Source]
+	}
+
+	return result, err
+}
+
+// Aggregate combines quotes (and the errors of sources that failed, by index) into a price
+// as of now. Sources that don't support the pair are left out of the result.
+func (o *Oracle) Aggregate(pair Pair, quotes []Quote, errs []error, now time.Time) (Result, error) {
+	result := Result{Pair: pair}
+
+	var fresh []int
+	for i, source := range o.Sources {
+		if errors.Is(errs[i], ErrUnsupportedPair) {
+			continue
+		}
+
+		sr := SourceResult{Source: source.Name()}
+		switch {
+		case errs[i] != nil:
+			sr.Status = StatusError
+			sr.Error = errs[i].Error()
+		case now.Sub(quotes[i].Timestamp) > o.maxAge(source.Name()):
+			sr.Status = StatusStale
+			sr.Price = quotes[i].Price
+			sr.Timestamp = &quotes[i].Timestamp
+		default:
+			sr.Status = StatusAccepted
+			sr.Price = quotes[i].Price
+			sr.Timestamp = &quotes[i].Timestamp
+			fresh = append(fresh, len(result.Sources))
+		}
+		result.Sources = append(result.Sources, sr)
+	}
+
+	if len(result.Sources) == 0 {
+		return result, fmt.Errorf("%w: %s", ErrUnsupportedPair, pair)
+	}
+
+	prices := make([]float64, 0, len(fresh))
+	for _, i := range fresh {
+		prices = append(prices, result.Sources[i].Price)
+	}
+
+	if len(prices) == 0 {
+		return result, fmt.Errorf("%w: 0 of %d sources usable for %s", ErrInsufficientSources, len(result.Sources), pair)
+	}
+
+	// Reject quotes too far from the median of the fresh quotes
+	mid := Median(prices)
+	var accepted []float64
+	var newest time.Time
+	for _, i := range fresh {
+		sr := &result.Sources[i]
+		if o.MaxDeviation > 0 && math.Abs(sr.Price-mid)/mid > o.MaxDeviation {
+			sr.Status = StatusOutlier
+			continue
+		}
+		accepted = append(accepted, sr.Price)
+		if sr.Timestamp.After(newest) {
+			newest = *sr.Timestamp
+		}
+	}
+
+	if len(accepted) < max(o.MinSources, 1) {
+		return result, fmt.Errorf("%w: %d of %d sources accepted for %s, need %d",
+			ErrInsufficientSources, len(accepted), len(result.Sources), pair, o.MinSources)
+	}
+
+	result.Price = Median(accepted)
+	result.Timestamp = newest
+
+	return result, nil
+}
+
+// Median returns the median of prices, which must not be empty
+func Median(prices []float64) float64 {
+	sorted := append([]float64(nil), prices...)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,200 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// namedSource is a source that is only used for its name
+type namedSource string
+
+func (s namedSource) Name() string { return string(s) }
+
+func (s namedSource) Quote(context.Context, Pair) (Quote, error) {
+	return Quote{}, errors.New("not queried")
+}
+
+func newTestOracle(names ...string) *Oracle {
+	o := &Oracle{
+		MaxAge:       2 * time.Minute,
+		SourceMaxAge: map[string]time.Duration{},
+		MaxDeviation: 0.02,
+		MinSources:   2,
+	}
+	for _, name := range names {
+		o.Sources = append(o.Sources, namedSource(name))
+	}
+	return o
+}
+
+func TestAggregate(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fresh := now.Add(-30 * time.Second)
+	stale := now.Add(-5 * time.Minute)
+
+	tests := []struct {
+		name       string
+		minSources int
+		quotes     []Quote
+		errs       []error
+		wantPrice  float64
+		wantErr    error
+		wantStatus []string
+		wantNewest time.Time
+		sourceAge  map[string]time.Duration
+	}{
+		{
+			name: "odd count median",
+			quotes: []Quote{
+				{Price: 100_000, Timestamp: fresh},
+				{Price: 101_000, Timestamp: now},
+				{Price: 100_500, Timestamp: fresh},
+			},
+			wantPrice:  100_500,
+			wantStatus: []string{StatusAccepted, StatusAccepted, StatusAccepted},
+			wantNewest: now,
+		},
+		{
+			name: "even count median",
+			quotes: []Quote{
+				{Price: 100_000, Timestamp: fresh},
+				{Price: 101_000, Timestamp: fresh},
+				{Price: 100_400, Timestamp: fresh},
+				{Price: 100_800, Timestamp: fresh},
+			},
+			wantPrice:  100_600,
+			wantStatus: []string{StatusAccepted, StatusAccepted, StatusAccepted, StatusAccepted},
+			wantNewest: fresh,
+		},
+		{
+			name: "stale quote",
+			quotes: []Quote{
+				{Price: 100_000, Timestamp: fresh},
+				{Price: 90_000, Timestamp: stale},
+				{Price: 100_200, Timestamp: fresh},
+			},
+			wantPrice:  100_100,
+			wantStatus: []string{StatusAccepted, StatusStale, StatusAccepted},
+			wantNewest: fresh,
+		},
+		{
+			name: "per-source max age",
+			quotes: []Quote{
+				{Price: 100_000, Timestamp: fresh},
+				{Price: 100_100, Timestamp: stale},
+				{Price: 100_200, Timestamp: fresh},
+			},
+			sourceAge:  map[string]time.Duration{"b": 10 * time.Minute},
+			wantPrice:  100_100,
+			wantStatus: []string{StatusAccepted, StatusAccepted, StatusAccepted},
+			wantNewest: fresh,
+		},
+		{
+			name: "outlier",
+			quotes: []Quote{
+				{Price: 100_000, Timestamp: fresh},
+				{Price: 100_200, Timestamp: fresh},
+				{Price: 120_000, Timestamp: now},
+			},
+			wantPrice:  100_100,
+			wantStatus: []string{StatusAccepted, StatusAccepted, StatusOutlier},
+			wantNewest: fresh,
+		},
+		{
+			name: "too few sources",
+			quotes: []Quote{
+				{Price: 100_000, Timestamp: fresh},
+				{Price: 100_200, Timestamp: stale},
+				{},
+			},
+			errs:       []error{nil, nil, errors.New("timeout")},
+			wantErr:    ErrInsufficientSources,
+			wantStatus: []string{StatusAccepted, StatusStale, StatusError},
+		},
+		{
+			name:       "min sources of one",
+			minSources: 1,
+			quotes: []Quote{
+				{Price: 100_000, Timestamp: fresh},
+				{},
+				{},
+			},
+			errs:       []error{nil, errors.New("timeout"), ErrUnsupportedPair},
+			wantPrice:  100_000,
+			wantStatus: []string{StatusAccepted, StatusError},
+			wantNewest: fresh,
+		},
+		{
+			name:       "no source supports the pair",
+			quotes:     []Quote{{}, {}},
+			errs:       []error{ErrUnsupportedPair, ErrUnsupportedPair},
+			wantErr:    ErrUnsupportedPair,
+			wantStatus: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := []string{"a", "b", "c", "d"}[:len(tt.quotes)]
+			o := newTestOracle(names...)
+			if tt.minSources > 0 {
+				o.MinSources = tt.minSources
+			}
+			for name, age := range tt.sourceAge {
+				o.SourceMaxAge[name] = age
+			}
+
+			errs := tt.errs
+			if errs == nil {
+				errs = make([]error, len(tt.quotes))
+			}
+
+			result, err := o.Aggregate(BTCAUD, tt.quotes, errs, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Aggregate error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Aggregate: %v", err)
+			}
+
+			if len(result.Sources) != len(tt.wantStatus) {
+				t.Fatalf("got %d sources, want %d", len(result.Sources), len(tt.wantStatus))
+			}
+			for i, want := range tt.wantStatus {
+				if got := result.Sources[i].Status; got != want {
+					t.Errorf("source %s status = %s, want %s", result.Sources[i].Source, got, want)
+				}
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+			if result.Price != tt.wantPrice {
+				t.Errorf("price = %v, want %v", result.Price, tt.wantPrice)
+			}
+			if !result.Timestamp.Equal(tt.wantNewest) {
+				t.Errorf("timestamp = %v, want %v", result.Timestamp, tt.wantNewest)
+			}
+		})
+	}
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		prices []float64
+		want   float64
+	}{
+		{[]float64{3}, 3},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	}
+
+	for _, tt := range tests {
+		if got := Median(tt.prices); got != tt.want {
+			t.Errorf("Median(%v) = %v, want %v", tt.prices, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package oracle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Supported pairs
+var (
+	BTCUSD  = Pair{Base: "BTC", Quote: "USD"}
+	USDCAUD = Pair{Base: "USDC", Quote: "AUD"}
+	USDTAUD = Pair{Base: "USDT", Quote: "AUD"}
+	AUDUSD  = Pair{Base: "AUD", Quote: "USD"}
+)
+
+// SupportedPairs are the pairs the oracle can price, directly or as a cross rate
+var SupportedPairs = []Pair{BTCAUD, BTCUSD, USDCAUD, USDTAUD, AUDUSD}
+
+// crossRate derives a pair no source quotes directly as Numerator / Denominator,
+// e.g. AUD/USD = (BTC/USD) / (BTC/AUD)
+type crossRate struct {
+	Numerator   Pair
+	Denominator Pair
+}
+
+var crossRates = map[Pair]crossRate{
+	AUDUSD: {Numerator: BTCUSD, Denominator: BTCAUD},
+}
+
+// ParsePair parses a supported pair written as base-quote, e.g. "btc-aud"
+func ParsePair(s string) (Pair, error) {
+	base, quote, ok := strings.Cut(strings.ToUpper(s), "-")
+	if !ok {
+		return Pair{}, fmt.Errorf("%w: %s", ErrUnsupportedPair, s)
+	}
+
+	pair := Pair{Base: base, Quote: quote}
+	for _, supported := range SupportedPairs {
+		if pair == supported {
+			return pair, nil
+		}
+	}
+
+	return Pair{}, fmt.Errorf("%w: %s", ErrUnsupportedPair, pair)
+}
+
+// CrossLegs returns the pairs a cross rate is derived from as numerator / denominator,
+// or false if pair is quoted directly
+func CrossLegs(pair Pair) (numerator, denominator Pair, ok bool) {
+	cross, ok := crossRates[pair]
+	return cross.Numerator, cross.Denominator, ok
+}
+
+// DeriveCross combines the numerator and denominator legs of a cross rate into a price
+// for pair. The sources of each leg are reported against the leg they quoted.
+func DeriveCross(pair Pair, num, den Result) Result {
+	result := Result{Pair: pair}
+	for _, leg := range []Result{num, den} {
+		for _, sr := range leg.Sources {
+			sr.Pair = leg.Pair.String()
+			result.Sources = append(result.Sources, sr)
+		}
+	}
+
+	if num.Price > 0 && den.Price > 0 {
+		result.Price = num.Price / den.Price
+	}
+
+	result.Timestamp = num.Timestamp
+	if den.Timestamp.Before(result.Timestamp) {
+		result.Timestamp = den.Timestamp
+	}
+
+	return result
+}
+
+// PairPrice prices pair, aggregating source quotes directly or deriving it from a cross rate
+func (o *Oracle) PairPrice(ctx context.Context, pair Pair) (Result, error) {
+	numPair, denPair, ok := CrossLegs(pair)
+	if !ok {
+		return o.Price(ctx, pair)
+	}
+
+	var num, den Result
+	var numErr, denErr error
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		num, numErr = o.Price(ctx, numPair)
+	}()
+	go func() {
+		defer wg.Done()
+		den, denErr = o.Price(ctx, denPair)
+	}()
+	wg.Wait()
+
+	result := DeriveCross(pair, num, den)
+
+	if numErr != nil {
+		return result, fmt.Errorf("deriving %s from %s: %w", pair, numPair, numErr)
+	}
+	if denErr != nil {
+		return result, fmt.Errorf("deriving %s from %s: %w", pair, denPair, denErr)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,305 @@
+package oracle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default base URLs of the supported sources
+const (
+	DefaultCoinGeckoURL          = "https://api.coingecko.com"
+	DefaultIndependentReserveURL = "https://api.independentreserve.com"
+	DefaultKrakenURL             = "https://api.kraken.com"
+	DefaultCoinSpotURL           = "https://www.coinspot.com.au"
+	DefaultBinanceURL            = "https://api.binance.com"
+)
+
+// NewSource creates a source by name. An empty baseURL uses the source's public API.
+func NewSource(name, baseURL string) (PriceSource, error) {
+	switch name {
+	case "coingecko":
+		return &CoinGecko{httpSource: newHTTPSource(baseURL, DefaultCoinGeckoURL)}, nil
+	case "independentreserve":
+		return &IndependentReserve{httpSource: newHTTPSource(baseURL, DefaultIndependentReserveURL)}, nil
+	case "kraken":
+		return &Kraken{httpSource: newHTTPSource(baseURL, DefaultKrakenURL)}, nil
+	case "coinspot":
+		return &CoinSpot{httpSource: newHTTPSource(baseURL, DefaultCoinSpotURL)}, nil
+	case "binance":
+		return &Binance{httpSource: newHTTPSource(baseURL, DefaultBinanceURL)}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownSource, name)
+}
+
+// httpSource holds the HTTP plumbing shared by the exchange adapters
+type httpSource struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+func newHTTPSource(baseURL, fallback string) httpSource {
+	if baseURL == "" {
+		baseURL = fallback
+	}
+	return httpSource{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// getJSON fetches path (with query) and decodes the JSON response into v
+func (h httpSource) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	target := h.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d from %s", resp.StatusCode, path)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+
+	return nil
+}
+
+// newQuote validates a price and builds a quote, using now when the source has no timestamp
+func newQuote(source string, pair Pair, price float64, timestamp time.Time) (Quote, error) {
+	if price <= 0 || price != price {
+		return Quote{}, fmt.Errorf("%w: %f", ErrInvalidPrice, price)
+	}
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	return Quote{Source: source, Pair: pair, Price: price, Timestamp: timestamp}, nil
+}
+
+// parsePrice parses a price returned as a JSON string
+func parsePrice(s string) (float64, error) {
+	price, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidPrice, s)
+	}
+	return price, nil
+}
+
+// CoinGecko quotes prices from the CoinGecko simple price API
+type CoinGecko struct {
+	httpSource
+}
+
+var coinGeckoIDs = map[string]string{
+	"BTC":  "bitcoin",
+	"USDC": "usd-coin",
+	"USDT": "tether",
+}
+
+func (s *CoinGecko) Name() string { return "coingecko" }
+
+func (s *CoinGecko) Quote(ctx context.Context, pair Pair) (Quote, error) {
+	id, ok := coinGeckoIDs[pair.Base]
+	if !ok || (pair.Quote != "AUD" && pair.Quote != "USD") {
+		return Quote{}, ErrUnsupportedPair
+	}
+	vs := strings.ToLower(pair.Quote)
+
+	var data map[string]map[string]float64
+	err := s.getJSON(ctx, "/api/v3/simple/price", url.Values{
+		"ids":                     {id},
+		"vs_currencies":           {vs},
+		"include_last_updated_at": {"true"},
+	}, &data)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	var timestamp time.Time
+	if updated := data[id]["last_updated_at"]; updated > 0 {
+		timestamp = time.Unix(int64(updated), 0)
+	}
+
+	return newQuote(s.Name(), pair, data[id][vs], timestamp)
+}
+
+// IndependentReserve quotes the last traded price on Independent Reserve
+type IndependentReserve struct {
+	httpSource
+}
+
+var independentReserveCodes = map[string]string{
+	"BTC":  "Xbt",
+	"USDC": "Usdc",
+	"USDT": "Usdt",
+	"AUD":  "Aud",
+	"USD":  "Usd",
+}
+
+func (s *IndependentReserve) Name() string { return "independentreserve" }
+
+func (s *IndependentReserve) Quote(ctx context.Context, pair Pair) (Quote, error) {
+	primary, ok := independentReserveCodes[pair.Base]
+	secondary, ok2 := independentReserveCodes[pair.Quote]
+	if !ok || !ok2 || (pair.Quote != "AUD" && pair.Quote != "USD") {
+		return Quote{}, ErrUnsupportedPair
+	}
+
+	var data struct {
+		LastPrice           float64   `json:"LastPrice"`
+		CreatedTimestampUtc time.Time `json:"CreatedTimestampUtc"`
+	}
+	err := s.getJSON(ctx, "/Public/GetMarketSummary", url.Values{
+		"primaryCurrencyCode":   {primary},
+		"secondaryCurrencyCode": {secondary},
+	}, &data)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return newQuote(s.Name(), pair, data.LastPrice, data.CreatedTimestampUtc)
+}
+
+// Kraken quotes the last traded price on Kraken
+type Kraken struct {
+	httpSource
+}
+
+var krakenPairs = map[Pair]string{
+	{Base: "BTC", Quote: "AUD"}:  "XBTAUD",
+	{Base: "BTC", Quote: "USD"}:  "XBTUSD",
+	{Base: "USDT", Quote: "AUD"}: "USDTAUD",
+	{Base: "USDC", Quote: "AUD"}: "USDCAUD",
+	{Base: "USDT", Quote: "USD"}: "USDTUSD",
+	{Base: "USDC", Quote: "USD"}: "USDCUSD",
+}
+
+func (s *Kraken) Name() string { return "kraken" }
+
+func (s *Kraken) Quote(ctx context.Context, pair Pair) (Quote, error) {
+	symbol, ok := krakenPairs[pair]
+	if !ok {
+		return Quote{}, ErrUnsupportedPair
+	}
+
+	var data struct {
+		Error  []string `json:"error"`
+		Result map[string]struct {
+			// C is the last trade as [price, lot volume]
+			C []string `json:"c"`
+		} `json:"result"`
+	}
+	if err := s.getJSON(ctx, "/0/public/Ticker", url.Values{"pair": {symbol}}, &data); err != nil {
+		return Quote{}, err
+	}
+
+	if len(data.Error) > 0 {
+		return Quote{}, fmt.Errorf("kraken: %s", strings.Join(data.Error, "; "))
+	}
+
+	// Kraken may key the result by its internal pair name (e.g. XXBTZAUD), so take the only entry
+	for _, ticker := range data.Result {
+		if len(ticker.C) == 0 {
+			break
+		}
+		price, err := parsePrice(ticker.C[0])
+		if err != nil {
+			return Quote{}, err
+		}
+		return newQuote(s.Name(), pair, price, time.Time{})
+	}
+
+	return Quote{}, fmt.Errorf("%w: no ticker for %s", ErrInvalidPrice, symbol)
+}
+
+// CoinSpot quotes the last traded AUD price on CoinSpot
+type CoinSpot struct {
+	httpSource
+}
+
+func (s *CoinSpot) Name() string { return "coinspot" }
+
+func (s *CoinSpot) Quote(ctx context.Context, pair Pair) (Quote, error) {
+	if pair.Quote != "AUD" || (pair.Base != "BTC" && pair.Base != "USDT" && pair.Base != "USDC") {
+		return Quote{}, ErrUnsupportedPair
+	}
+
+	var data struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Prices  struct {
+			Last string `json:"last"`
+		} `json:"prices"`
+	}
+	if err := s.getJSON(ctx, "/pubapi/v2/latest/"+pair.Base, nil, &data); err != nil {
+		return Quote{}, err
+	}
+
+	if data.Status != "ok" {
+		return Quote{}, fmt.Errorf("coinspot: %s %s", data.Status, data.Message)
+	}
+
+	price, err := parsePrice(data.Prices.Last)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return newQuote(s.Name(), pair, price, time.Time{})
+}
+
+// Binance quotes the last traded price on Binance
+type Binance struct {
+	httpSource
+}
+
+var binanceSymbols = map[Pair]string{
+	{Base: "BTC", Quote: "AUD"}: "BTCAUD",
+}
+
+func (s *Binance) Name() string { return "binance" }
+
+func (s *Binance) Quote(ctx context.Context, pair Pair) (Quote, error) {
+	symbol, ok := binanceSymbols[pair]
+	if !ok {
+		return Quote{}, ErrUnsupportedPair
+	}
+
+	var data struct {
+		Symbol string `json:"symbol"`
+		Price  string `json:"price"`
+	}
+	if err := s.getJSON(ctx, "/api/v3/ticker/price", url.Values{"symbol": {symbol}}, &data); err != nil {
+		return Quote{}, err
+	}
+
+	price, err := parsePrice(data.Price)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return newQuote(s.Name(), pair, price, time.Time{})
+}
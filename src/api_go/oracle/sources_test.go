@@ -0,0 +1,198 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stubSource serves body for requests to path with the given query, and 404 otherwise
+func stubSource(t *testing.T, name, path string, query map[string]string, body string) PriceSource {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("%s: requested %s, want %s", name, r.URL.Path, path)
+			http.NotFound(w, r)
+			return
+		}
+		for key, want := range query {
+			if got := r.URL.Query().Get(key); got != want {
+				t.Errorf("%s: query %s = %q, want %q", name, key, got, want)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	source, err := NewSource(name, server.URL)
+	if err != nil {
+		t.Fatalf("NewSource(%s): %v", name, err)
+	}
+	return source
+}
+
+func TestSources(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		query         map[string]string
+		body          string
+		pair          Pair
+		wantPrice     float64
+		wantTimestamp time.Time
+	}{
+		{
+			name:          "coingecko",
+			path:          "/api/v3/simple/price",
+			query:         map[string]string{"ids": "bitcoin", "vs_currencies": "aud", "include_last_updated_at": "true"},
+			body:          `{"bitcoin":{"aud":101234.5,"last_updated_at":1700000000}}`,
+			pair:          BTCAUD,
+			wantPrice:     101234.5,
+			wantTimestamp: time.Unix(1700000000, 0),
+		},
+		{
+			name:          "independentreserve",
+			path:          "/Public/GetMarketSummary",
+			query:         map[string]string{"primaryCurrencyCode": "Xbt", "secondaryCurrencyCode": "Aud"},
+			body:          `{"LastPrice":101300.25,"CreatedTimestampUtc":"2023-11-14T22:13:20Z"}`,
+			pair:          BTCAUD,
+			wantPrice:     101300.25,
+			wantTimestamp: time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC),
+		},
+		{
+			name:      "kraken",
+			path:      "/0/public/Ticker",
+			query:     map[string]string{"pair": "XBTAUD"},
+			body:      `{"error":[],"result":{"XXBTZAUD":{"c":["101250.10000","0.0100"]}}}`,
+			pair:      BTCAUD,
+			wantPrice: 101250.1,
+		},
+		{
+			name:      "coinspot",
+			path:      "/pubapi/v2/latest/BTC",
+			body:      `{"status":"ok","prices":{"bid":"101100","ask":"101400","last":"101275.00"}}`,
+			pair:      BTCAUD,
+			wantPrice: 101275,
+		},
+		{
+			name:      "binance",
+			path:      "/api/v3/ticker/price",
+			query:     map[string]string{"symbol": "BTCAUD"},
+			body:      `{"symbol":"BTCAUD","price":"101290.01000000"}`,
+			pair:      BTCAUD,
+			wantPrice: 101290.01,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := stubSource(t, tt.name, tt.path, tt.query, tt.body)
+
+			before := time.Now()
+			quote, err := source.Quote(context.Background(), tt.pair)
+			if err != nil {
+				t.Fatalf("Quote: %v", err)
+			}
+
+			if quote.Source != tt.name || quote.Pair != tt.pair {
+				t.Errorf("quote is for %s %s, want %s %s", quote.Source, quote.Pair, tt.name, tt.pair)
+			}
+			if quote.Price != tt.wantPrice {
+				t.Errorf("price = %v, want %v", quote.Price, tt.wantPrice)
+			}
+
+			// Sources without a timestamp are quoted as of the request
+			if tt.wantTimestamp.IsZero() {
+				if quote.Timestamp.Before(before) {
+					t.Errorf("timestamp = %v, want at least %v", quote.Timestamp, before)
+				}
+			} else if !quote.Timestamp.Equal(tt.wantTimestamp) {
+				t.Errorf("timestamp = %v, want %v", quote.Timestamp, tt.wantTimestamp)
+			}
+		})
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		wantErr error
+	}{
+		{
+			name: "kraken",
+			path: "/0/public/Ticker",
+			body: `{"error":["EQuery:Unknown asset pair"],"result":{}}`,
+		},
+		{
+			name: "coinspot",
+			path: "/pubapi/v2/latest/BTC",
+			body: `{"status":"error","message":"invalid coin type"}`,
+		},
+		{
+			name:    "binance",
+			path:    "/api/v3/ticker/price",
+			body:    `{"symbol":"BTCAUD","price":"not a number"}`,
+			wantErr: ErrInvalidPrice,
+		},
+		{
+			name:    "coingecko",
+			path:    "/api/v3/simple/price",
+			body:    `{"bitcoin":{}}`,
+			wantErr: ErrInvalidPrice,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := stubSource(t, tt.name, tt.path, nil, tt.body)
+
+			_, err := source.Quote(context.Background(), BTCAUD)
+			if err == nil {
+				t.Fatal("Quote succeeded, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Quote error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSourceUnsupportedPair(t *testing.T) {
+	// No request is made for a pair the source does not list
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+	}))
+	defer server.Close()
+
+	source, err := NewSource("binance", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := source.Quote(context.Background(), USDTAUD); !errors.Is(err, ErrUnsupportedPair) {
+		t.Errorf("Quote error = %v, want %v", err, ErrUnsupportedPair)
+	}
+}
+
+func TestSourceHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"rate limited"}`, http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	source, err := NewSource("independentreserve", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := source.Quote(context.Background(), BTCAUD); err == nil {
+		t.Fatal("Quote succeeded, want an error")
+	}
+}
@@ -0,0 +1,276 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"paperhands/api/config"
+	"paperhands/api/interest"
+	"paperhands/api/models"
+	"paperhands/api/services"
+)
+
+// Distributor is a background job that adds the interest borrowers have paid to the lending
+// pools, raising their share prices. Accrued but unpaid interest is a receivable and is not
+// counted in the share price. Interest is recorded in AUD and split across the pools
+// in proportion to the AUD value of their assets, then converted to each pool's token.
+// It also mints shares for confirmed supplies that have none, e.g. those confirmed before
+// the pools existed.
+type Distributor struct {
+	DB       *sql.DB
+	Price    services.PriceFunc
+	Interval time.Duration
+}
+
+type poolBalance struct {
+	Token       string
+	TotalShares float64
+	TotalAssets float64
+	Price       float64
+}
+
+// NewDistributorFromEnv creates a distributor that runs every POOL_DISTRIBUTION_INTERVAL_MINUTES (default 60)
+func NewDistributorFromEnv(db *sql.DB, price services.PriceFunc) *Distributor {
+	return &Distributor{
+		DB:       db,
+		Price:    price,
+		Interval: time.Duration(config.EnvInt("POOL_DISTRIBUTION_INTERVAL_MINUTES", 60)) * time.Minute,
+	}
+}
+
+// Run distributes interest until ctx is cancelled
+func (d *Distributor) Run(ctx context.Context) {
+	log.Printf("Pool interest distributor started (interval %s)", d.Interval)
+
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.Poll(ctx); err != nil {
+			log.Printf("Pool interest distribution failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Pool interest distributor stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll mints any missing shares, then distributes the interest paid since the last run.
+// Shares are minted first so new lenders buy in before the interest raises the share price.
+func (d *Distributor) Poll(ctx context.Context) error {
+	if err := d.MintConfirmed(ctx); err != nil {
+		return err
+	}
+	return d.Distribute(ctx)
+}
+
+// MintConfirmed mints pool shares for every confirmed capital supply without them
+func (d *Distributor) MintConfirmed(ctx context.Context) error {
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT c.id
+		FROM capital_supplies c
+		WHERE c.status = $1
+			AND NOT EXISTS (SELECT 1 FROM pool_ledger l WHERE l.capital_supply_id = c.id)
+		ORDER BY c.id
+	`, models.CapitalStatusConfirmed)
+	if err != nil {
+		return fmt.Errorf("querying unminted capital supplies: %w", err)
+	}
+
+	var supplyIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		supplyIDs = append(supplyIDs, id)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range supplyIDs {
+		if err := d.mint(ctx, id); err != nil {
+			log.Printf("Error minting pool shares for capital supply %d: %v", id, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Distributor) mint(ctx context.Context, supplyID int) error {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	minted, err := services.MintPoolShares(tx, supplyID)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if minted {
+		log.Printf("Minted pool shares for capital supply %d", supplyID)
+	}
+	return nil
+}
+
+// Distribute adds the interest portion of every undistributed repayment to the pools in one
+// transaction. If a pool's token cannot be priced nothing is distributed and the repayments
+// are retried on the next run. Interest paid while no pool has shares is marked distributed
+// without being added, so the first lender cannot claim it.
+func (d *Distributor) Distribute(ctx context.Context) error {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, interest_aud
+		FROM loan_repayments
+		WHERE pool_distributed_at IS NULL AND interest_aud > 0
+		ORDER BY id
+		FOR UPDATE
+	`)
+	if err != nil {
+		return fmt.Errorf("querying undistributed interest: %w", err)
+	}
+
+	var repaymentIDs []int64
+	var interestAUD float64
+	for rows.Next() {
+		var id int64
+		var amount float64
+		if err := rows.Scan(&id, &amount); err != nil {
+			rows.Close()
+			return err
+		}
+		repaymentIDs = append(repaymentIDs, id)
+		interestAUD += amount
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(repaymentIDs) == 0 {
+		return nil
+	}
+
+	pools, err := d.lockPools(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	var totalValue float64
+	for _, p := range pools {
+		totalValue += p.TotalAssets * p.Price
+	}
+
+	interestAUD = interest.RoundCents(interestAUD)
+	remaining := interestAUD
+	for i, p := range pools {
+		if totalValue <= 0 {
+			break
+		}
+
+		share := interest.RoundCents(interestAUD * p.TotalAssets * p.Price / totalValue)
+		if i == len(pools)-1 {
+			// The last pool takes the rounding remainder so the shares sum to the interest
+			share = interest.RoundCents(remaining)
+		}
+		remaining -= share
+		if share <= 0 {
+			continue
+		}
+
+		assets := share / p.Price
+		sharePrice := (p.TotalAssets + assets) / p.TotalShares
+
+		_, err := tx.ExecContext(ctx,
+			"UPDATE lending_pools SET total_assets = total_assets + $1, updated_at = NOW() WHERE token = $2",
+			assets, p.Token,
+		)
+		if err != nil {
+			return fmt.Errorf("adding interest to %s pool: %w", p.Token, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO pool_ledger (token, entry_type, assets, shares, share_price, interest_aud)
+			VALUES ($1, $2, $3, 0, $4, $5)
+		`, p.Token, models.PoolEntryInterest, assets, sharePrice, share)
+		if err != nil {
+			return fmt.Errorf("recording %s pool interest: %w", p.Token, err)
+		}
+
+		log.Printf("Distributed %.2f AUD of interest to the %s pool (%g %s, share price %g)", share, p.Token, assets, p.Token, sharePrice)
+	}
+
+	if totalValue <= 0 {
+		log.Printf("No pool has shares; %.2f AUD of interest left undistributed", interestAUD)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE loan_repayments SET pool_distributed_at = NOW() WHERE id = ANY($1)",
+		pq.Array(repaymentIDs),
+	)
+	if err != nil {
+		return fmt.Errorf("marking interest distributed: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// lockPools locks the pools with shares and prices their tokens in AUD
+func (d *Distributor) lockPools(ctx context.Context, tx *sql.Tx) ([]poolBalance, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT token, total_shares, total_assets
+		FROM lending_pools
+		WHERE total_shares > 0
+		ORDER BY token
+		FOR UPDATE
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("querying lending pools: %w", err)
+	}
+	defer rows.Close()
+
+	var pools []poolBalance
+	for rows.Next() {
+		var p poolBalance
+		if err := rows.Scan(&p.Token, &p.TotalShares, &p.TotalAssets); err != nil {
+			return nil, err
+		}
+
+		p.Price, err = d.Price(p.Token)
+		if err != nil {
+			return nil, fmt.Errorf("pricing %s: %w", p.Token, err)
+		}
+		if p.Price <= 0 {
+			return nil, fmt.Errorf("pricing %s: invalid price %g", p.Token, p.Price)
+		}
+
+		pools = append(pools, p)
+	}
+
+	return pools, rows.Err()
+}
@@ -0,0 +1,46 @@
+package pool
+
+import (
+	"context"
+	"testing"
+
+	"paperhands/api/dbtest"
+	"paperhands/api/models"
+)
+
+func TestDistributePaidInterest(t *testing.T) {
+	db, mock := dbtest.New(t)
+	mock.ExpectBegin()
+	// Only interest borrowers have paid is distributed, not interest accrued on their loans
+	mock.ExpectQuery("FROM loan_repayments WHERE pool_distributed_at IS NULL AND interest_aud > 0").
+		WillReturnRows([]string{"id", "interest_aud"}, []interface{}{3, 60.0}, []interface{}{4, 40.0})
+	mock.ExpectQuery("FROM lending_pools WHERE total_shares > 0").
+		WillReturnRows([]string{"token", "total_shares", "total_assets"},
+			[]interface{}{"AAUD", 1000.0, 1000.0},
+			[]interface{}{"USDC", 1000.0, 1000.0},
+		)
+	// AAUD is at par and USDC at 0.5 AUD, so AAUD holds two thirds of the value
+	mock.ExpectExec("UPDATE lending_pools SET total_assets = total_assets + $1").WithArgs(66.67, "AAUD")
+	mock.ExpectExec("INSERT INTO pool_ledger").WithArgs("AAUD", models.PoolEntryInterest, 66.67, 1.06667, 66.67)
+	mock.ExpectExec("UPDATE lending_pools SET total_assets = total_assets + $1").WithArgs(66.66, "USDC")
+	mock.ExpectExec("INSERT INTO pool_ledger").WithArgs("USDC", models.PoolEntryInterest, 66.66, dbtest.Any, 33.33)
+	mock.ExpectExec("UPDATE loan_repayments SET pool_distributed_at = NOW()")
+	mock.ExpectCommit()
+
+	prices := map[string]float64{"AAUD": 1, "USDC": 0.5}
+	d := &Distributor{DB: db, Price: func(token string) (float64, error) { return prices[token], nil }}
+	if err := d.Distribute(context.Background()); err != nil {
+		t.Fatalf("Distribute: %v", err)
+	}
+}
+
+func TestDistributeNothingPaid(t *testing.T) {
+	db, mock := dbtest.New(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM loan_repayments").WillReturnRows([]string{"id", "interest_aud"})
+
+	d := &Distributor{DB: db, Price: func(string) (float64, error) { return 1, nil }}
+	if err := d.Distribute(context.Background()); err != nil {
+		t.Fatalf("Distribute: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package pool
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/models"
+	"paperhands/api/services"
+)
+
+// WithdrawalQueue is a background job that approves lender withdrawals once their notice
+// period has ended, oldest first. A withdrawal the pool lacks the liquidity for is queued, and
+// blocks later withdrawals of the same token, until loans are repaid or new capital arrives.
+// Approved withdrawals burn their shares and wait for staff to record the payout.
+type WithdrawalQueue struct {
+	DB       *sql.DB
+	Price    services.PriceFunc
+	Terms    services.WithdrawalTerms
+	Interval time.Duration
+}
+
+// NewWithdrawalQueueFromEnv creates a queue that runs every CAPITAL_WITHDRAWAL_INTERVAL_SECONDS
+// (default 60) with the terms from services.WithdrawalTermsFromEnv
+func NewWithdrawalQueueFromEnv(db *sql.DB, price services.PriceFunc) *WithdrawalQueue {
+	return &WithdrawalQueue{
+		DB:       db,
+		Price:    price,
+		Terms:    services.WithdrawalTermsFromEnv(),
+		Interval: config.EnvSeconds("CAPITAL_WITHDRAWAL_INTERVAL_SECONDS", 60*time.Second),
+	}
+}
+
+// Run processes withdrawals until ctx is cancelled
+func (q *WithdrawalQueue) Run(ctx context.Context) {
+	log.Printf("Withdrawal queue started (interval %s, notice %s, max utilisation %g)",
+		q.Interval, q.Terms.NoticePeriod, q.Terms.MaxUtilisation)
+
+	ticker := time.NewTicker(q.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := q.Poll(ctx); err != nil {
+			log.Printf("Withdrawal queue poll failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Withdrawal queue stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll approves every withdrawal past its notice period that the pools can pay
+func (q *WithdrawalQueue) Poll(ctx context.Context) error {
+	rows, err := q.DB.QueryContext(ctx,
+		"SELECT "+services.WithdrawalColumns+" FROM capital_withdrawals WHERE status IN ($1, $2) AND available_at <= NOW() ORDER BY id",
+		models.WithdrawalStatusPending, models.WithdrawalStatusQueued,
+	)
+	if err != nil {
+		return fmt.Errorf("querying open withdrawals: %w", err)
+	}
+
+	var withdrawals []models.CapitalWithdrawal
+	for rows.Next() {
+		w, err := services.ScanWithdrawal(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning withdrawal: %w", err)
+		}
+		withdrawals = append(withdrawals, w)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	blocked := map[string]bool{}
+	for _, w := range withdrawals {
+		approved, err := q.process(ctx, w, blocked[w.Token])
+		if err != nil {
+			log.Printf("Error processing withdrawal %d: %v", w.ID, err)
+		}
+		if !approved {
+			blocked[w.Token] = true
+		}
+	}
+
+	return nil
+}
+
+// process approves a withdrawal if the pool has the liquidity, or else queues it.
+// It reports whether the withdrawal no longer holds up later ones.
+func (q *WithdrawalQueue) process(ctx context.Context, w models.CapitalWithdrawal, blocked bool) (bool, error) {
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	available := 0.0
+	if !blocked {
+		liquidity, err := services.PoolLiquidity(tx, q.Price, q.Terms.MaxUtilisation)
+		if err != nil {
+			return false, err
+		}
+		for _, l := range liquidity {
+			if l.Token == w.Token {
+				available = l.Available
+			}
+		}
+	}
+
+	if blocked || w.Amount > available {
+		if w.Status == models.WithdrawalStatusPending {
+			if err := services.QueueWithdrawal(tx, w.ID); err != nil {
+				return false, err
+			}
+			log.Printf("Queued withdrawal %d of %g %s for liquidity", w.ID, w.Amount, w.Token)
+		}
+		return false, tx.Commit()
+	}
+
+	approved, err := services.ApproveWithdrawal(tx, w.ID)
+	if errors.Is(err, services.ErrInsufficientPosition) {
+		// The position no longer covers the withdrawal; cancel it rather than hold up the queue
+		if _, err := services.CancelWithdrawal(tx, w.ID); err != nil {
+			return false, err
+		}
+		log.Printf("Cancelled withdrawal %d: %v", w.ID, services.ErrInsufficientPosition)
+		return true, tx.Commit()
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	log.Printf("Approved withdrawal %d of %g %s for user %d (%g shares at %g)",
+		approved.ID, approved.Amount, approved.Token, approved.UserID, approved.Shares.Float64, approved.SharePrice.Float64)
+	return true, nil
+}
@@ -0,0 +1,38 @@
+package pool
+
+import (
+	"context"
+	"testing"
+
+	"paperhands/api/dbtest"
+	"paperhands/api/models"
+	"paperhands/api/services"
+)
+
+func TestProcessQueuesWithoutLiquidity(t *testing.T) {
+	db, mock := dbtest.New(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM loans WHERE status = ANY($1)").
+		WillReturnRows([]string{"sum"}, []interface{}{450.0})
+	mock.ExpectQuery("FROM lending_pools ORDER BY token").
+		WillReturnRows([]string{"token", "total_shares", "total_assets"}, []interface{}{"AAUD", 1000.0, 1000.0})
+	// Only 100 can be withdrawn, so no shares are burned and the withdrawal waits in the queue
+	mock.ExpectExec("UPDATE capital_withdrawals SET status = $1").
+		WithArgs(models.WithdrawalStatusQueued, 5, models.WithdrawalStatusPending)
+	mock.ExpectCommit()
+
+	q := &WithdrawalQueue{
+		DB:    db,
+		Price: func(string) (float64, error) { return 1, nil },
+		Terms: services.WithdrawalTerms{MaxUtilisation: 0.5},
+	}
+	w := models.CapitalWithdrawal{ID: 5, UserID: 42, Token: "AAUD", Amount: 100.01, Status: models.WithdrawalStatusPending}
+
+	approved, err := q.process(context.Background(), w, false)
+	if err != nil {
+		t.Fatalf("process: %v", err)
+	}
+	if approved {
+		t.Error("process approved a withdrawal the pool cannot pay")
+	}
+}
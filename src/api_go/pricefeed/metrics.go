@@ -0,0 +1,106 @@
+package pricefeed
+
+import (
+	"sync"
+	"time"
+
+	"paperhands/api/oracle"
+)
+
+// UpstreamMetrics counts the requests to one pair or price source and how long they took
+type UpstreamMetrics struct {
+	Requests          int64      `json:"requests"`
+	Errors            int64      `json:"errors"`
+	ConsecutiveErrors int64      `json:"consecutiveErrors"`
+	LastLatencyMs     float64    `json:"lastLatencyMs"`
+	AvgLatencyMs      float64    `json:"avgLatencyMs"`
+	MaxLatencyMs      float64    `json:"maxLatencyMs"`
+	LastError         string     `json:"lastError,omitempty"`
+	LastSuccessAt     *time.Time `json:"lastSuccessAt,omitempty"`
+	LastErrorAt       *time.Time `json:"lastErrorAt,omitempty"`
+
+	totalLatency time.Duration
+}
+
+func (m *UpstreamMetrics) observe(latency time.Duration, err string, at time.Time) {
+	m.Requests++
+	m.totalLatency += latency
+
+	ms := float64(latency) / float64(time.Millisecond)
+	m.LastLatencyMs = ms
+	m.AvgLatencyMs = float64(m.totalLatency) / float64(time.Millisecond) / float64(m.Requests)
+	if ms > m.MaxLatencyMs {
+		m.MaxLatencyMs = ms
+	}
+
+	if err != "" {
+		m.Errors++
+		m.ConsecutiveErrors++
+		m.LastError = err
+		m.LastErrorAt = &at
+		return
+	}
+
+	m.ConsecutiveErrors = 0
+	m.LastSuccessAt = &at
+}
+
+// Metrics tracks upstream latency and errors per pair (one oracle aggregation) and
+// per price source
+type Metrics struct {
+	mu      sync.Mutex
+	pairs   map[string]*UpstreamMetrics
+	sources map[string]*UpstreamMetrics
+}
+
+func newMetrics() *Metrics {
+	return &Metrics{
+		pairs:   map[string]*UpstreamMetrics{},
+		sources: map[string]*UpstreamMetrics{},
+	}
+}
+
+// observe records one oracle aggregation for pair and the response of each source in it
+func (m *Metrics) observe(pair oracle.Pair, result oracle.Result, latency time.Duration, err error, at time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pm, ok := m.pairs[pair.String()]
+	if !ok {
+		pm = &UpstreamMetrics{}
+		m.pairs[pair.String()] = pm
+	}
+
+	var errMsg string
+	if err != nil {
+		errMsg = err.Error()
+	}
+	pm.observe(latency, errMsg, at)
+
+	for _, sr := range result.Sources {
+		sm, ok := m.sources[sr.Source]
+		if !ok {
+			sm = &UpstreamMetrics{}
+			m.sources[sr.Source] = sm
+		}
+		sm.observe(sr.Latency, sr.Error, at)
+	}
+}
+
+// Snapshot returns a copy of the pair and source metrics, keyed by pair and source name
+func (m *Metrics) Snapshot() (pairs, sources map[string]UpstreamMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pairs = make(map[string]UpstreamMetrics, len(m.pairs))
+	for name, pm := range m.pairs {
+		pairs[name] = *pm
+	}
+
+	sources = make(map[string]UpstreamMetrics, len(m.sources))
+	for name, sm := range m.sources {
+		sources[name] = *sm
+	}
+
+	return pairs, sources
+}
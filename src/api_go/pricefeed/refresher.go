@@ -0,0 +1,289 @@
+package pricefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"paperhands/api/config"
+	"paperhands/api/oracle"
+)
+
+// ErrNoPrice is returned for a pair that has not been fetched successfully yet
+var ErrNoPrice = errors.New("price not fetched yet")
+
+// Entry is the latest price of a pair held in memory
+type Entry struct {
+	Pair      oracle.Pair
+	Price     float64
+	Sources   []oracle.SourceResult
+	UpdatedAt time.Time
+	// Stale is set when the price is older than the pair's max age
+	Stale bool
+}
+
+// Schedule is how often a pair is refreshed and when its price counts as stale
+type Schedule struct {
+	Interval time.Duration
+	MaxAge   time.Duration
+}
+
+// Status is the refresh state of a pair, reported with the metrics
+type Status struct {
+	Pair          string     `json:"pair"`
+	Price         float64    `json:"price,omitempty"`
+	UpdatedAt     *time.Time `json:"updatedAt,omitempty"`
+	AgeSeconds    float64    `json:"ageSeconds,omitempty"`
+	Stale         bool       `json:"stale"`
+	Failures      int        `json:"failures"`
+	NextRefreshAt time.Time  `json:"nextRefreshAt"`
+}
+
+// Refresher keeps the price of every pair in memory by refreshing it from the oracle in
+// the background, so requests never wait on upstream APIs. Failed refreshes are retried
+// with jittered exponential backoff, and concurrent fetches of the same pair (e.g. BTC/AUD
+// on its own and as a leg of AUD/USD) share one upstream call.
+type Refresher struct {
+	Oracle     *oracle.Oracle
+	Pairs      []oracle.Pair
+	Schedules  map[oracle.Pair]Schedule
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// OnRefresh is called with every successfully refreshed price
+	OnRefresh func(oracle.Result)
+	Metrics   *Metrics
+
+	group   singleflight.Group
+	mu      sync.RWMutex
+	entries map[oracle.Pair]Entry
+	status  map[oracle.Pair]*Status
+}
+
+// NewRefresherFromEnv creates a refresher for every supported pair. Each pair is refreshed
+// every PRICE_<BASE><QUOTE>_REFRESH_SECONDS (default 30 for BTC pairs, 300 for fiat and
+// stablecoin pairs) and is stale once older than PRICE_<BASE><QUOTE>_MAX_AGE_SECONDS
+// (default four refresh intervals). Failures back off from PRICE_REFRESH_MIN_BACKOFF_SECONDS
+// (default 5) up to PRICE_REFRESH_MAX_BACKOFF_SECONDS (default 300).
+func NewRefresherFromEnv(o *oracle.Oracle) *Refresher {
+	r := &Refresher{
+		Oracle:     o,
+		Pairs:      oracle.SupportedPairs,
+		Schedules:  map[oracle.Pair]Schedule{},
+		MinBackoff: config.EnvSeconds("PRICE_REFRESH_MIN_BACKOFF_SECONDS", 5*time.Second),
+		MaxBackoff: config.EnvSeconds("PRICE_REFRESH_MAX_BACKOFF_SECONDS", 5*time.Minute),
+		Metrics:    newMetrics(),
+	}
+
+	for _, pair := range r.Pairs {
+		interval := 5 * time.Minute
+		if pair.Base == "BTC" {
+			interval = 30 * time.Second
+		}
+
+		prefix := "PRICE_" + pair.Base + pair.Quote
+		interval = config.EnvSeconds(prefix+"_REFRESH_SECONDS", interval)
+		r.Schedules[pair] = Schedule{
+			Interval: interval,
+			MaxAge:   config.EnvSeconds(prefix+"_MAX_AGE_SECONDS", 4*interval),
+		}
+	}
+
+	return r
+}
+
+// Run refreshes every pair on its schedule until ctx is cancelled
+func (r *Refresher) Run(ctx context.Context) {
+	log.Printf("Price refresher started for %d pairs", len(r.Pairs))
+
+	var wg sync.WaitGroup
+	for _, pair := range r.Pairs {
+		wg.Add(1)
+		go func(pair oracle.Pair) {
+			defer wg.Done()
+			r.run(ctx, pair)
+		}(pair)
+	}
+	wg.Wait()
+
+	log.Println("Price refresher stopped")
+}
+
+// run refreshes one pair until ctx is cancelled
+func (r *Refresher) run(ctx context.Context, pair oracle.Pair) {
+	failures := 0
+
+	for {
+		var wait time.Duration
+		if _, err := r.Refresh(ctx, pair); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			failures++
+			wait = r.backoff(failures)
+			log.Printf("Error refreshing %s price (attempt %d, retrying in %s): %v", pair, failures, wait.Round(time.Millisecond), err)
+		} else {
+			failures = 0
+			wait = r.schedule(pair).Interval
+		}
+
+		r.setStatus(pair, failures, time.Now().Add(wait))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before retry n: MinBackoff doubled for each consecutive
+// failure, capped at MaxBackoff, and jittered over its upper half so that pairs
+// failing together don't retry in lockstep
+func (r *Refresher) backoff(failures int) time.Duration {
+	d := r.MinBackoff
+	for i := 1; i < failures && d < r.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func (r *Refresher) schedule(pair oracle.Pair) Schedule {
+	if s, ok := r.Schedules[pair]; ok {
+		return s
+	}
+	return Schedule{Interval: time.Minute, MaxAge: 4 * time.Minute}
+}
+
+// Refresh fetches pair from the oracle and stores it. Cross rates are derived from their
+// legs, each fetched once however many callers want it at the same time.
+func (r *Refresher) Refresh(ctx context.Context, pair oracle.Pair) (oracle.Result, error) {
+	var result oracle.Result
+	var err error
+
+	if numPair, denPair, ok := oracle.CrossLegs(pair); ok {
+		var num, den oracle.Result
+		var numErr, denErr error
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			num, numErr = r.fetch(ctx, numPair)
+		}()
+		go func() {
+			defer wg.Done()
+			den, denErr = r.fetch(ctx, denPair)
+		}()
+		wg.Wait()
+
+		result = oracle.DeriveCross(pair, num, den)
+		switch {
+		case numErr != nil:
+			err = fmt.Errorf("deriving %s from %s: %w", pair, numPair, numErr)
+		case denErr != nil:
+			err = fmt.Errorf("deriving %s from %s: %w", pair, denPair, denErr)
+		}
+	} else {
+		result, err = r.fetch(ctx, pair)
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	r.mu.Lock()
+	if r.entries == nil {
+		r.entries = map[oracle.Pair]Entry{}
+	}
+	r.entries[pair] = Entry{
+		Pair:      pair,
+		Price:     result.Price,
+		Sources:   result.Sources,
+		UpdatedAt: time.Now(),
+	}
+	r.mu.Unlock()
+
+	if r.OnRefresh != nil {
+		r.OnRefresh(result)
+	}
+
+	return result, nil
+}
+
+// fetch aggregates a directly quoted pair, sharing the upstream call with concurrent callers
+func (r *Refresher) fetch(ctx context.Context, pair oracle.Pair) (oracle.Result, error) {
+	v, err, _ := r.group.Do(pair.String(), func() (interface{}, error) {
+		start := time.Now()
+		result, err := r.Oracle.Price(ctx, pair)
+		if r.Metrics != nil {
+			r.Metrics.observe(pair, result, time.Since(start), err, time.Now())
+		}
+		return result, err
+	})
+	return v.(oracle.Result), err
+}
+
+func (r *Refresher) setStatus(pair oracle.Pair, failures int, next time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.status == nil {
+		r.status = map[oracle.Pair]*Status{}
+	}
+	r.status[pair] = &Status{Pair: pair.String(), Failures: failures, NextRefreshAt: next}
+}
+
+// Latest returns the last price fetched for pair with its stale flag set by age.
+// It never calls upstream.
+func (r *Refresher) Latest(pair oracle.Pair) (Entry, error) {
+	r.mu.RLock()
+	entry, ok := r.entries[pair]
+	r.mu.RUnlock()
+
+	if !ok {
+		return Entry{Pair: pair}, fmt.Errorf("%w: %s", ErrNoPrice, pair)
+	}
+
+	entry.Stale = time.Since(entry.UpdatedAt) > r.schedule(pair).MaxAge
+	return entry, nil
+}
+
+// Statuses returns the refresh state of every pair
+func (r *Refresher) Statuses() []Status {
+	statuses := make([]Status, 0, len(r.Pairs))
+	for _, pair := range r.Pairs {
+		r.mu.RLock()
+		status := Status{Pair: pair.String()}
+		if s, ok := r.status[pair]; ok {
+			status = *s
+		}
+		r.mu.RUnlock()
+
+		// A pair with no price yet is as unusable as a stale one
+		status.Stale = true
+
+		if entry, err := r.Latest(pair); err == nil {
+			updatedAt := entry.UpdatedAt
+			status.Price = entry.Price
+			status.UpdatedAt = &updatedAt
+			status.AgeSeconds = time.Since(updatedAt).Seconds()
+			status.Stale = entry.Stale
+		}
+
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
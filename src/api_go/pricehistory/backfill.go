@@ -0,0 +1,170 @@
+package pricehistory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/oracle"
+)
+
+// backfillChunk is the widest range requested from CoinGecko at once; ranges up to
+// 90 days are returned at hourly granularity
+const backfillChunk = 90 * 24 * time.Hour
+
+// minBackfillGap is the smallest gap worth backfilling; shorter gaps are left to the oracle
+const minBackfillGap = time.Hour
+
+// Backfiller fills gaps in the price history from CoinGecko's historical market data
+type Backfiller struct {
+	DB         *sql.DB
+	BaseURL    string
+	HTTPClient *http.Client
+	// Days is how far back to backfill when the history is empty
+	Days int
+}
+
+// NewBackfillerFromEnv creates a backfiller that covers the last PRICE_HISTORY_BACKFILL_DAYS
+// (default 90). CoinGecko is reached at ORACLE_COINGECKO_URL, like the oracle's CoinGecko source.
+func NewBackfillerFromEnv(db *sql.DB) *Backfiller {
+	baseURL := os.Getenv("ORACLE_COINGECKO_URL")
+	if baseURL == "" {
+		baseURL = oracle.DefaultCoinGeckoURL
+	}
+
+	return &Backfiller{
+		DB:         db,
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Days:       config.EnvIntOrZero("PRICE_HISTORY_BACKFILL_DAYS", 90),
+	}
+}
+
+// Run backfills from the latest stored price (or Days ago if there is none) up to now.
+// It is meant to run once at startup.
+func (b *Backfiller) Run(ctx context.Context) {
+	inserted, err := b.Backfill(ctx, time.Now())
+	if err != nil {
+		log.Printf("Price history backfill failed: %v", err)
+		return
+	}
+
+	if inserted > 0 {
+		log.Printf("Backfilled %d BTC/AUD prices", inserted)
+	}
+}
+
+// Backfill stores historical prices between the latest stored price and now,
+// returning the number of prices inserted
+func (b *Backfiller) Backfill(ctx context.Context, now time.Time) (int, error) {
+	if b.Days == 0 {
+		return 0, nil
+	}
+
+	from := now.Add(-time.Duration(b.Days) * 24 * time.Hour)
+
+	// Prices the refresher records after now must not hide the gap before it
+	latest, err := Latest(b.DB, now)
+	if err != nil {
+		return 0, fmt.Errorf("finding latest price: %w", err)
+	}
+	if latest.After(from) {
+		from = latest
+	}
+
+	if now.Sub(from) < minBackfillGap {
+		return 0, nil
+	}
+
+	inserted := 0
+	for start := from; start.Before(now); start = start.Add(backfillChunk) {
+		end := start.Add(backfillChunk)
+		if end.After(now) {
+			end = now
+		}
+
+		points, err := b.fetchRange(ctx, start, end)
+		if err != nil {
+			return inserted, err
+		}
+
+		for _, point := range points {
+			if !point.Time.After(from) {
+				continue
+			}
+			if err := Record(b.DB, point.Price, SourceCoinGecko, 0, point.Time); err != nil {
+				return inserted, fmt.Errorf("storing price: %w", err)
+			}
+			inserted++
+		}
+	}
+
+	return inserted, nil
+}
+
+type pricePoint struct {
+	Time  time.Time
+	Price float64
+}
+
+// fetchRange returns CoinGecko's BTC/AUD prices between from and to
+func (b *Backfiller) fetchRange(ctx context.Context, from, to time.Time) ([]pricePoint, error) {
+	query := url.Values{
+		"vs_currency": {"aud"},
+		"from":        {strconv.FormatInt(from.Unix(), 10)},
+		"to":          {strconv.FormatInt(to.Unix(), 10)},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		b.BaseURL+"/api/v3/coins/bitcoin/market_chart/range?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := b.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CoinGecko API error: %d", resp.StatusCode)
+	}
+
+	var data struct {
+		// Prices are [unix milliseconds, price] pairs
+		Prices [][2]float64 `json:"prices"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("parsing response: %w", err)
+	}
+
+	points := make([]pricePoint, 0, len(data.Prices))
+	for _, p := range data.Prices {
+		if p[1] <= 0 {
+			continue
+		}
+		points = append(points, pricePoint{
+			Time:  time.UnixMilli(int64(p[0])).UTC(),
+			Price: p[1],
+		})
+	}
+
+	return points, nil
+}
@@ -0,0 +1,128 @@
+package pricehistory
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Error definitions
+var (
+	ErrInvalidInterval = errors.New("invalid candle interval")
+	ErrInvalidRange    = errors.New("invalid time range")
+	ErrTooManyCandles  = errors.New("time range has too many candles for interval")
+)
+
+// Sources stored in btc_price_history
+const (
+	SourceOracle    = "oracle"
+	SourceCoinGecko = "coingecko"
+)
+
+// MaxCandles caps the candles returned by a single query
+const MaxCandles = 1000
+
+// Intervals are the supported candle widths
+var Intervals = map[string]time.Duration{
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"4h":  4 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+// IntervalNames returns the supported intervals from narrowest to widest
+func IntervalNames() []string {
+	names := make([]string, 0, len(Intervals))
+	for name := range Intervals {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return Intervals[names[i]] < Intervals[names[j]] })
+	return names
+}
+
+// Candle is the open, high, low and close price over one interval
+type Candle struct {
+	Time    time.Time `json:"time"`
+	Open    float64   `json:"open"`
+	High    float64   `json:"high"`
+	Low     float64   `json:"low"`
+	Close   float64   `json:"close"`
+	Samples int       `json:"samples"`
+}
+
+// Record stores a price observed at recordedAt. Recording the same source and time twice is a no-op.
+func Record(db *sql.DB, priceAUD float64, source string, sourceCount int, recordedAt time.Time) error {
+	var count sql.NullInt64
+	if sourceCount > 0 {
+		count = sql.NullInt64{Int64: int64(sourceCount), Valid: true}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO btc_price_history (price_aud, source, source_count, recorded_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (source, recorded_at) DO NOTHING
+	`, priceAUD, source, count, recordedAt)
+	return err
+}
+
+// Latest returns the time of the most recent price stored before the given time, or the
+// zero time if there is none
+func Latest(db *sql.DB, before time.Time) (time.Time, error) {
+	var latest sql.NullTime
+	if err := db.QueryRow("SELECT MAX(recorded_at) FROM btc_price_history WHERE recorded_at < $1", before).Scan(&latest); err != nil {
+		return time.Time{}, err
+	}
+	return latest.Time, nil
+}
+
+// Candles aggregates the stored prices in [from, to) into OHLC candles of the given interval.
+// Candles are aligned to the Unix epoch and intervals without prices are omitted.
+func Candles(db *sql.DB, from, to time.Time, interval string) ([]Candle, error) {
+	width, ok := Intervals[interval]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidInterval, interval)
+	}
+
+	if !from.Before(to) {
+		return nil, ErrInvalidRange
+	}
+
+	if to.Sub(from)/width > MaxCandles {
+		return nil, fmt.Errorf("%w: more than %d", ErrTooManyCandles, MaxCandles)
+	}
+
+	seconds := int64(width / time.Second)
+
+	rows, err := db.Query(`
+		SELECT
+			to_timestamp(floor(extract(epoch FROM recorded_at) / $3::bigint) * $3::bigint) AS bucket,
+			(array_agg(price_aud ORDER BY recorded_at ASC))[1] AS open,
+			MAX(price_aud) AS high,
+			MIN(price_aud) AS low,
+			(array_agg(price_aud ORDER BY recorded_at DESC))[1] AS close,
+			COUNT(*) AS samples
+		FROM btc_price_history
+		WHERE recorded_at >= $1 AND recorded_at < $2
+		GROUP BY bucket
+		ORDER BY bucket
+	`, from, to, seconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	candles := []Candle{}
+	for rows.Next() {
+		var candle Candle
+		if err := rows.Scan(&candle.Time, &candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Samples); err != nil {
+			return nil, err
+		}
+		candle.Time = candle.Time.UTC()
+		candles = append(candles, candle)
+	}
+
+	return candles, rows.Err()
+}
@@ -0,0 +1,71 @@
+package rates
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"paperhands/api/interest"
+	"paperhands/api/models"
+	"paperhands/api/services"
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Current returns the model's rates at the live utilisation: outstanding principal of
+// interest-bearing loans over the AUD value of confirmed capital supplies, less the
+// capital lenders have withdrawn
+func Current(q querier, price services.PriceFunc, m Model) (Rates, error) {
+	var borrowed float64
+	err := q.QueryRow(
+		"SELECT COALESCE(SUM(COALESCE(principal_outstanding_aud, amount_aud)), 0) FROM loans WHERE status = ANY($1)",
+		pq.Array(interest.AccruingStatuses),
+	).Scan(&borrowed)
+	if err != nil {
+		return Rates{}, fmt.Errorf("summing outstanding principal: %w", err)
+	}
+
+	rows, err := q.Query(`
+		SELECT token, SUM(amount)
+		FROM (
+			SELECT token, amount FROM capital_supplies WHERE status = $1
+			UNION ALL
+			SELECT token, -amount FROM capital_withdrawals WHERE status IN ($2, $3)
+		) capital
+		GROUP BY token
+		ORDER BY token
+	`, models.CapitalStatusConfirmed, models.WithdrawalStatusReady, models.WithdrawalStatusPaid)
+	if err != nil {
+		return Rates{}, fmt.Errorf("summing supplied capital: %w", err)
+	}
+	defer rows.Close()
+
+	var supplied float64
+	for rows.Next() {
+		var token string
+		var amount float64
+		if err := rows.Scan(&token, &amount); err != nil {
+			return Rates{}, err
+		}
+		if amount <= 0 {
+			continue
+		}
+
+		tokenPrice, err := price(token)
+		if err != nil {
+			return Rates{}, fmt.Errorf("pricing %s: %w", token, err)
+		}
+		supplied += amount * tokenPrice
+	}
+
+	if err := rows.Err(); err != nil {
+		return Rates{}, err
+	}
+
+	return m.At(borrowed, supplied), nil
+}
@@ -0,0 +1,97 @@
+package rates
+
+import (
+	"math"
+
+	"paperhands/api/config"
+	"paperhands/api/interest"
+)
+
+// Model is a kinked utilisation curve. The borrower rate rises from BaseRate by Slope over
+// the utilisation range up to Kink, then by the steeper JumpSlope above it, so rates climb
+// quickly once the pools run short of unlent capital.
+type Model struct {
+	BaseRate  float64 `json:"baseRate"`
+	Slope     float64 `json:"slope"`
+	Kink      float64 `json:"kink"`
+	JumpSlope float64 `json:"jumpSlope"`
+}
+
+// Rates are the rates of a model at a utilisation. APRs are simple annual rates; the lender
+// APY compounds the lender APR daily, as interest is accrued and added to the pools daily.
+type Rates struct {
+	Utilisation float64 `json:"utilisation"`
+	BorrowedAUD float64 `json:"borrowedAud"`
+	SuppliedAUD float64 `json:"suppliedAud"`
+	BorrowAPR   float64 `json:"borrowApr"`
+	LenderAPR   float64 `json:"lenderApr"`
+	LenderAPY   float64 `json:"lenderApy"`
+	Model       Model   `json:"model"`
+}
+
+// ModelFromEnv reads RATE_BASE, RATE_SLOPE, RATE_KINK and RATE_JUMP_SLOPE. The defaults rise
+// from 4% p.a. by 5.9% to the advertised 9.90% at 80% utilisation, and by 30% more above it.
+func ModelFromEnv() Model {
+	return Model{
+		BaseRate:  config.EnvFloatOrZero("RATE_BASE", 0.04),
+		Slope:     config.EnvFloatOrZero("RATE_SLOPE", 0.059),
+		Kink:      math.Min(config.EnvFloatOrZero("RATE_KINK", 0.80), 1),
+		JumpSlope: config.EnvFloatOrZero("RATE_JUMP_SLOPE", 0.30),
+	}
+}
+
+// Utilisation returns the share of supplied capital that is borrowed, between 0 and 1.
+// Borrowing with nothing supplied counts as fully utilised.
+func Utilisation(borrowed, supplied float64) float64 {
+	if borrowed <= 0 {
+		return 0
+	}
+	if supplied <= 0 {
+		return 1
+	}
+	return math.Min(borrowed/supplied, 1)
+}
+
+// BorrowRate returns the borrower APR at utilisation u
+func (m Model) BorrowRate(u float64) float64 {
+	if u <= m.Kink {
+		if m.Kink == 0 {
+			return m.BaseRate
+		}
+		return m.BaseRate + m.Slope*u/m.Kink
+	}
+	excess := (u - m.Kink) / (1 - m.Kink)
+	return m.BaseRate + m.Slope + m.JumpSlope*excess
+}
+
+// LenderRate returns the lender APR at utilisation u: borrower interest is earned on the
+// borrowed share of the pools and shared across all of their capital
+func (m Model) LenderRate(u float64) float64 {
+	return m.BorrowRate(u) * u
+}
+
+// At returns the model's rates for the given borrowed and supplied capital in AUD
+func (m Model) At(borrowedAUD, suppliedAUD float64) Rates {
+	u := Utilisation(borrowedAUD, suppliedAUD)
+	lenderAPR := m.LenderRate(u)
+
+	return Rates{
+		Utilisation: round(u),
+		BorrowedAUD: interest.RoundCents(borrowedAUD),
+		SuppliedAUD: interest.RoundCents(suppliedAUD),
+		BorrowAPR:   round(m.BorrowRate(u)),
+		LenderAPR:   round(lenderAPR),
+		LenderAPY:   round(APY(lenderAPR)),
+		Model:       m,
+	}
+}
+
+// APY compounds a simple annual rate daily
+func APY(apr float64) float64 {
+	return math.Pow(1+apr/interest.DaysInYear, interest.DaysInYear) - 1
+}
+
+// round rounds a rate to the 6 decimal places rates are stored with
+func round(rate float64) float64 {
+	return math.Round(rate*1e6) / 1e6
+}
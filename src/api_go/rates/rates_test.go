@@ -0,0 +1,86 @@
+package rates
+
+import (
+	"math"
+	"testing"
+)
+
+// defaultModel is the model with the ModelFromEnv defaults
+var defaultModel = Model{BaseRate: 0.04, Slope: 0.059, Kink: 0.80, JumpSlope: 0.30}
+
+func TestBorrowRate(t *testing.T) {
+	tests := []struct {
+		name  string
+		model Model
+		u     float64
+		want  float64
+	}{
+		{"0% utilisation", defaultModel, 0, 0.04},
+		{"below the kink", defaultModel, 0.40, 0.0695},
+		{"at the kink", defaultModel, 0.80, 0.099},
+		{"above the kink", defaultModel, 0.90, 0.249},
+		{"100% utilisation", defaultModel, 1, 0.399},
+		{"kink at 0", Model{BaseRate: 0.04, Slope: 0.059, Kink: 0, JumpSlope: 0.30}, 0, 0.04},
+		{"above a kink at 0", Model{BaseRate: 0.04, Slope: 0.059, Kink: 0, JumpSlope: 0.30}, 0.5, 0.249},
+		{"kink at 100%", Model{BaseRate: 0.04, Slope: 0.059, Kink: 1, JumpSlope: 0.30}, 1, 0.099},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.model.BorrowRate(tt.u); math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("BorrowRate(%v) = %v, want %v", tt.u, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBorrowRateIsContinuousAtTheKink(t *testing.T) {
+	below := defaultModel.BorrowRate(defaultModel.Kink - 1e-9)
+	above := defaultModel.BorrowRate(defaultModel.Kink + 1e-9)
+	if math.Abs(above-below) > 1e-6 {
+		t.Errorf("rate jumps from %v to %v at the kink", below, above)
+	}
+}
+
+func TestUtilisation(t *testing.T) {
+	tests := []struct {
+		borrowed, supplied float64
+		want               float64
+	}{
+		{0, 0, 0},
+		{0, 1000, 0},
+		{250, 1000, 0.25},
+		{1000, 1000, 1},
+		{1500, 1000, 1},
+		{100, 0, 1},
+	}
+
+	for _, tt := range tests {
+		if got := Utilisation(tt.borrowed, tt.supplied); got != tt.want {
+			t.Errorf("Utilisation(%v, %v) = %v, want %v", tt.borrowed, tt.supplied, got, tt.want)
+		}
+	}
+}
+
+func TestAt(t *testing.T) {
+	r := defaultModel.At(80_000, 100_000)
+
+	if r.Utilisation != 0.8 {
+		t.Errorf("utilisation = %v, want 0.8", r.Utilisation)
+	}
+	if r.BorrowAPR != 0.099 {
+		t.Errorf("borrow APR = %v, want 0.099", r.BorrowAPR)
+	}
+	// Lenders earn the borrower rate on the borrowed 80% of the pools
+	if r.LenderAPR != 0.0792 {
+		t.Errorf("lender APR = %v, want 0.0792", r.LenderAPR)
+	}
+	if r.LenderAPY <= r.LenderAPR {
+		t.Errorf("lender APY %v does not compound lender APR %v", r.LenderAPY, r.LenderAPR)
+	}
+
+	idle := defaultModel.At(0, 100_000)
+	if idle.BorrowAPR != 0.04 || idle.LenderAPR != 0 || idle.LenderAPY != 0 {
+		t.Errorf("idle pools: borrow %v, lender %v/%v; want 0.04, 0/0", idle.BorrowAPR, idle.LenderAPR, idle.LenderAPY)
+	}
+}
@@ -0,0 +1,166 @@
+package risk
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"paperhands/api/config"
+)
+
+// PriceFunc returns the current BTC/AUD price and whether it is stale
+type PriceFunc func() (price float64, stale bool, err error)
+
+// Engine periodically recomputes the LVR of every monitored loan and
+// records a risk event whenever a loan changes risk level.
+type Engine struct {
+	DB         *sql.DB
+	Price      PriceFunc
+	Thresholds Thresholds
+	Interval   time.Duration
+}
+
+// MonitoredLoan is the data needed to assess a loan
+type MonitoredLoan struct {
+	ID            int
+	CustomerID    int
+	Status        string
+	DebtAUD       float64
+	CollateralBTC float64
+	RiskLevel     string
+}
+
+// NewEngineFromEnv creates an engine checking every RISK_CHECK_INTERVAL_SECONDS (default 60)
+func NewEngineFromEnv(db *sql.DB, price PriceFunc) *Engine {
+	return &Engine{
+		DB:         db,
+		Price:      price,
+		Thresholds: ThresholdsFromEnv(),
+		Interval:   config.EnvSeconds("RISK_CHECK_INTERVAL_SECONDS", 60*time.Second),
+	}
+}
+
+// Run evaluates loans until ctx is cancelled
+func (e *Engine) Run(ctx context.Context) {
+	log.Printf("Risk engine started (interval %s, thresholds %+v)", e.Interval, e.Thresholds)
+
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.Evaluate(ctx); err != nil {
+			log.Printf("Risk evaluation failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Risk engine stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate assesses every monitored loan once at the current price. The cycle is skipped
+// while the price is stale, so loans are never escalated or cleared on an old price.
+func (e *Engine) Evaluate(ctx context.Context) error {
+	price, stale, err := e.Price()
+	if err != nil {
+		return fmt.Errorf("fetching BTC price: %w", err)
+	}
+	if stale {
+		log.Printf("Skipping risk evaluation: BTC price %.2f AUD is stale", price)
+		return nil
+	}
+
+	loans, err := MonitoredLoans(ctx, e.DB)
+	if err != nil {
+		return err
+	}
+
+	for _, loan := range loans {
+		if loan.CollateralBTC <= 0 {
+			continue
+		}
+
+		assessment := e.Thresholds.Assess(loan.DebtAUD, loan.CollateralBTC, price)
+		if err := e.record(ctx, loan, assessment); err != nil {
+			log.Printf("Error recording risk for loan %d: %v", loan.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// record stores the latest LVR on the loan and inserts a risk event when the level changes
+func (e *Engine) record(ctx context.Context, loan MonitoredLoan, a Assessment) error {
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE loans
+		SET current_lvr = $1, risk_level = $2, risk_checked_at = NOW()
+		WHERE id = $3
+	`, a.LVR, a.Level, loan.ID)
+	if err != nil {
+		return err
+	}
+
+	if a.Level != loan.RiskLevel {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO loan_risk_events (loan_id, from_level, to_level, lvr, btc_price)
+			VALUES ($1, $2, $3, $4, $5)
+		`, loan.ID, loan.RiskLevel, a.Level, a.LVR, a.BTCPrice)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("Loan %d risk level changed from %s to %s (LVR %.2f%% at BTC %.2f)",
+			loan.ID, loan.RiskLevel, a.Level, a.LVR*100, a.BTCPrice)
+	}
+
+	return tx.Commit()
+}
+
+// MonitoredLoans returns every loan whose collateral is at risk
+func MonitoredLoans(ctx context.Context, db *sql.DB) ([]MonitoredLoan, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, customer_id, status,
+			COALESCE(principal_outstanding_aud, amount_aud)
+				+ COALESCE(accrued_interest_aud, 0) - COALESCE(interest_paid_aud, 0),
+			collateral_btc, COALESCE(risk_level, 'ok')
+		FROM loans
+		WHERE status = ANY($1)
+		ORDER BY id
+	`, pq.Array(MonitoredStatuses))
+	if err != nil {
+		return nil, fmt.Errorf("querying monitored loans: %w", err)
+	}
+	defer rows.Close()
+
+	var loans []MonitoredLoan
+	for rows.Next() {
+		var loan MonitoredLoan
+		err := rows.Scan(
+			&loan.ID,
+			&loan.CustomerID,
+			&loan.Status,
+			&loan.DebtAUD,
+			&loan.CollateralBTC,
+			&loan.RiskLevel,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scanning monitored loan: %w", err)
+		}
+		loans = append(loans, loan)
+	}
+
+	return loans, rows.Err()
+}
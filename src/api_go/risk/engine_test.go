@@ -0,0 +1,30 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"paperhands/api/dbtest"
+)
+
+func TestEvaluateSkipsStalePrice(t *testing.T) {
+	// No statements are expected: a stale price skips the cycle before loans are read
+	db, _ := dbtest.New(t)
+	e := &Engine{DB: db, Thresholds: Thresholds{Warning: 0.7, MarginCall: 0.8, Liquidation: 0.9}}
+	e.Price = func() (float64, bool, error) { return 50_000, true, nil }
+
+	if err := e.Evaluate(context.Background()); err != nil {
+		t.Fatalf("Evaluate: %v", err)
+	}
+}
+
+func TestEvaluatePriceUnavailable(t *testing.T) {
+	db, _ := dbtest.New(t)
+	e := &Engine{DB: db}
+	e.Price = func() (float64, bool, error) { return 0, false, errors.New("no price") }
+
+	if err := e.Evaluate(context.Background()); err == nil {
+		t.Fatal("Evaluate succeeded without a price")
+	}
+}
@@ -0,0 +1,96 @@
+package risk
+
+import (
+	"math"
+
+	"paperhands/api/config"
+	"paperhands/api/models"
+)
+
+// Risk levels, in increasing order of severity
+const (
+	LevelOK          = "ok"
+	LevelWarning     = "warning"
+	LevelMarginCall  = "margin_call"
+	LevelLiquidation = "liquidation"
+)
+
+// MonitoredStatuses are the loan statuses with collateral at risk
+var MonitoredStatuses = []string{
+	models.LoanStatusCollateralised,
+	models.LoanStatusDisbursed,
+	models.LoanStatusActive,
+}
+
+// Thresholds are the loan-to-value ratios at which each risk level starts
+type Thresholds struct {
+	Warning     float64 `json:"warning"`
+	MarginCall  float64 `json:"marginCall"`
+	Liquidation float64 `json:"liquidation"`
+}
+
+// Assessment is the risk of a single loan at a given BTC price
+type Assessment struct {
+	LVR             float64 `json:"lvr"`
+	Level           string  `json:"level"`
+	DebtAUD         float64 `json:"debtAud"`
+	CollateralBTC   float64 `json:"collateralBtc"`
+	CollateralValue float64 `json:"collateralValueAud"`
+	BTCPrice        float64 `json:"btcPrice"`
+	// LiquidationPrice is the BTC price at which the loan reaches the liquidation LVR
+	LiquidationPrice float64 `json:"liquidationPrice"`
+}
+
+// ThresholdsFromEnv reads RISK_WARNING_LVR, RISK_MARGIN_CALL_LVR and RISK_LIQUIDATION_LVR,
+// defaulting to 70%, 80% and 90%
+func ThresholdsFromEnv() Thresholds {
+	return Thresholds{
+		Warning:     config.EnvFloat("RISK_WARNING_LVR", 0.70),
+		MarginCall:  config.EnvFloat("RISK_MARGIN_CALL_LVR", 0.80),
+		Liquidation: config.EnvFloat("RISK_LIQUIDATION_LVR", 0.90),
+	}
+}
+
+// Classify returns the risk level for a loan-to-value ratio
+func (t Thresholds) Classify(lvr float64) string {
+	switch {
+	case lvr >= t.Liquidation:
+		return LevelLiquidation
+	case lvr >= t.MarginCall:
+		return LevelMarginCall
+	case lvr >= t.Warning:
+		return LevelWarning
+	default:
+		return LevelOK
+	}
+}
+
+// LVR returns the loan-to-value ratio of debt against BTC collateral.
+// It returns 0 when the collateral has no value; callers skip such loans.
+func LVR(debtAUD, collateralBTC, btcPrice float64) float64 {
+	value := collateralBTC * btcPrice
+	if value <= 0 {
+		return 0
+	}
+	return math.Round(debtAUD/value*1e6) / 1e6
+}
+
+// Assess computes the LVR and risk level of a loan at btcPrice
+func (t Thresholds) Assess(debtAUD, collateralBTC, btcPrice float64) Assessment {
+	lvr := LVR(debtAUD, collateralBTC, btcPrice)
+
+	var liquidationPrice float64
+	if collateralBTC > 0 && t.Liquidation > 0 {
+		liquidationPrice = debtAUD / (collateralBTC * t.Liquidation)
+	}
+
+	return Assessment{
+		LVR:              lvr,
+		Level:            t.Classify(lvr),
+		DebtAUD:          debtAUD,
+		CollateralBTC:    collateralBTC,
+		CollateralValue:  collateralBTC * btcPrice,
+		BTCPrice:         btcPrice,
+		LiquidationPrice: liquidationPrice,
+	}
+}
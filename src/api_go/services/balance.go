@@ -0,0 +1,88 @@
+package services
+
+import (
+	"database/sql"
+	"math"
+	"time"
+
+	"paperhands/api/interest"
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Balance is the amount owed on a loan as of a date
+type Balance struct {
+	LoanID             int     `json:"loanId"`
+	AsOf               string  `json:"asOf"`
+	DayCount           string  `json:"dayCountConvention"`
+	AnnualRate         float64 `json:"annualRate"`
+	PrincipalAUD       float64 `json:"principalAud"`
+	AccruedInterestAUD float64 `json:"accruedInterestAud"`
+	FeesAUD            float64 `json:"feesAud"`
+	PayoffAUD          float64 `json:"payoffAud"`
+	InterestDays       int     `json:"interestDays"`
+}
+
+// LoanBalance computes the principal, interest and fees owed on a loan as of a date.
+// Interest is the sum of recorded daily accruals before asOf, plus interest projected
+// at the current principal for days not yet accrued by the accrual job, less interest paid.
+func LoanBalance(q querier, loanID int, asOf time.Time) (Balance, error) {
+	var status string
+	var principal, rate, fees, feesPaid, interestPaid float64
+	var disbursedAt, accruedThrough sql.NullTime
+
+	err := q.QueryRow(`
+		SELECT status, COALESCE(principal_outstanding_aud, amount_aud), COALESCE(annual_interest_rate, 0),
+			COALESCE(admin_fee_aud, 0), COALESCE(fees_paid_aud, 0), COALESCE(interest_paid_aud, 0),
+			disbursed_at, interest_accrued_through
+		FROM loans
+		WHERE id = $1
+	`, loanID).Scan(&status, &principal, &rate, &fees, &feesPaid, &interestPaid, &disbursedAt, &accruedThrough)
+	if err == sql.ErrNoRows {
+		return Balance{}, ErrLoanNotFound
+	}
+	if err != nil {
+		return Balance{}, err
+	}
+
+	asOfDate := interest.Date(asOf)
+	balance := Balance{
+		LoanID:       loanID,
+		AsOf:         asOfDate.Format("2006-01-02"),
+		DayCount:     interest.DayCountConvention,
+		AnnualRate:   rate,
+		PrincipalAUD: principal,
+		FeesAUD:      interest.RoundCents(math.Max(fees-feesPaid, 0)),
+	}
+
+	if disbursedAt.Valid {
+		var accrued float64
+		err := q.QueryRow(`
+			SELECT COALESCE(SUM(interest_aud), 0)
+			FROM loan_interest_accruals
+			WHERE loan_id = $1 AND accrual_date < $2
+		`, loanID, asOfDate).Scan(&accrued)
+		if err != nil {
+			return Balance{}, err
+		}
+
+		// Project interest for days the accrual job hasn't reached yet
+		if interest.IsAccruing(status) {
+			projectFrom := interest.Date(disbursedAt.Time)
+			if accruedThrough.Valid {
+				projectFrom = interest.Date(accruedThrough.Time).AddDate(0, 0, 1)
+			}
+			accrued += interest.Accrue(principal, rate, projectFrom, asOfDate)
+		}
+
+		balance.AccruedInterestAUD = interest.RoundCents(math.Max(accrued-interestPaid, 0))
+		balance.InterestDays = max(interest.Days(disbursedAt.Time, asOfDate), 0)
+	}
+
+	balance.PayoffAUD = interest.RoundCents(balance.PrincipalAUD + balance.AccruedInterestAUD + balance.FeesAUD)
+
+	return balance, nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"paperhands/api/chain"
+)
+
+// RecordCollateralUTXOs upserts the funding outputs seen at a loan's deposit address.
+// Outputs previously recorded but no longer unspent are marked as spent.
+func RecordCollateralUTXOs(tx *sql.Tx, loanID int, address string, utxos []chain.UTXO, tipHeight int64) error {
+	seen := make(map[string]bool, len(utxos))
+
+	for _, utxo := range utxos {
+		var blockHeight sql.NullInt64
+		if utxo.Confirmed {
+			blockHeight = sql.NullInt64{Int64: utxo.BlockHeight, Valid: true}
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO loan_collateral_utxos (loan_id, address, txid, vout, amount_sats, block_height, confirmations)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (txid, vout) DO UPDATE
+			SET block_height = EXCLUDED.block_height,
+				confirmations = EXCLUDED.confirmations,
+				spent = FALSE,
+				updated_at = NOW()
+		`, loanID, address, utxo.TxID, utxo.Vout, utxo.Value, blockHeight, utxo.Confirmations(tipHeight))
+		if err != nil {
+			return fmt.Errorf("recording utxo %s:%d: %w", utxo.TxID, utxo.Vout, err)
+		}
+
+		seen[fmt.Sprintf("%s:%d", utxo.TxID, utxo.Vout)] = true
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, txid, vout
+		FROM loan_collateral_utxos
+		WHERE loan_id = $1 AND spent = FALSE
+	`, loanID)
+	if err != nil {
+		return err
+	}
+
+	var spentIDs []int
+	for rows.Next() {
+		var id int
+		var txid string
+		var vout uint32
+		if err := rows.Scan(&id, &txid, &vout); err != nil {
+			rows.Close()
+			return err
+		}
+		if !seen[fmt.Sprintf("%s:%d", txid, vout)] {
+			spentIDs = append(spentIDs, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range spentIDs {
+		if _, err := tx.Exec("UPDATE loan_collateral_utxos SET spent = TRUE, updated_at = NOW() WHERE id = $1", id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+
+	"paperhands/api/models"
+	"paperhands/api/wallet"
+)
+
+// CreateDepositAddress derives a stablecoin deposit address at the next derivation index and
+// stores it within tx. Indexes come from a sequence, so each is used at most once; an index
+// whose insert is rolled back is skipped rather than reused.
+func CreateDepositAddress(tx *sql.Tx, userID int, token string) (models.DepositAddress, error) {
+	var addr models.DepositAddress
+
+	var index int
+	if err := tx.QueryRow("SELECT nextval('deposit_address_index_seq')").Scan(&index); err != nil {
+		return addr, fmt.Errorf("allocating derivation index: %w", err)
+	}
+
+	derived, err := wallet.DeriveEthAddress(index)
+	if err != nil {
+		return addr, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO deposit_addresses (user_id, token, address, derivation_index, derivation_path, status, swept)
+		VALUES ($1, $2, $3, $4, $5, $6, FALSE)
+		RETURNING id, user_id, token, address, derivation_index, derivation_path, status, swept, created_at, updated_at
+	`, userID, token, derived.Address, derived.Index, derived.Path, models.DepositAddressStatusActive).Scan(
+		&addr.ID,
+		&addr.UserID,
+		&addr.Token,
+		&addr.Address,
+		&addr.DerivationIndex,
+		&addr.DerivationPath,
+		&addr.Status,
+		&addr.Swept,
+		&addr.CreatedAt,
+		&addr.UpdatedAt,
+	)
+	if err != nil {
+		return addr, fmt.Errorf("storing deposit address: %w", err)
+	}
+
+	return addr, nil
+}
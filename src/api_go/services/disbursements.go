@@ -0,0 +1,231 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"paperhands/api/models"
+)
+
+// Error definitions
+var (
+	ErrDisbursementNotFound     = errors.New("disbursement not found")
+	ErrLoanNotDisbursable       = errors.New("only collateralised loans can be disbursed")
+	ErrDisbursementNotDue       = errors.New("disbursement is not due to be sent")
+	ErrDisbursementNotRetryable = errors.New("only failed disbursements can be retried")
+)
+
+// DisbursementColumns is the column list scanned by ScanDisbursement
+const DisbursementColumns = `
+	id, loan_id, customer_id, amount_aud, method, status, recipient_address, tx_hash,
+	error_message, attempts, next_attempt_at, completed_at, created_by, created_at, updated_at
+`
+
+// ScanDisbursement scans a row selected with DisbursementColumns
+func ScanDisbursement(row rowScanner) (models.Disbursement, error) {
+	var d models.Disbursement
+	err := row.Scan(
+		&d.ID,
+		&d.LoanID,
+		&d.CustomerID,
+		&d.AmountAUD,
+		&d.Method,
+		&d.Status,
+		&d.RecipientAddress,
+		&d.TxHash,
+		&d.ErrorMessage,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.CompletedAt,
+		&d.CreatedBy,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+	return d, err
+}
+
+// DisbursementInput is a payout of a loan requested by staff
+type DisbursementInput struct {
+	LoanID           int
+	Method           string
+	RecipientAddress string
+	CreatedBy        int
+}
+
+// CreateDisbursement stores a pending payout of a collateralised loan's principal. Requests are
+// idempotent per loan: if the loan already has a disbursement it is returned unchanged and
+// created is false.
+func CreateDisbursement(tx *sql.Tx, in DisbursementInput) (d models.Disbursement, created bool, err error) {
+	var status string
+	var customerID int
+	var amount float64
+	err = tx.QueryRow(
+		"SELECT status, customer_id, amount_aud FROM loans WHERE id = $1 FOR UPDATE", in.LoanID,
+	).Scan(&status, &customerID, &amount)
+	if err == sql.ErrNoRows {
+		return d, false, ErrLoanNotFound
+	}
+	if err != nil {
+		return d, false, err
+	}
+
+	d, err = GetLoanDisbursement(tx, in.LoanID)
+	if err == nil {
+		return d, false, nil
+	}
+	if err != ErrDisbursementNotFound {
+		return d, false, err
+	}
+
+	if status != models.LoanStatusCollateralised {
+		return d, false, ErrLoanNotDisbursable
+	}
+
+	var createdBy sql.NullInt64
+	if in.CreatedBy != 0 {
+		createdBy = sql.NullInt64{Int64: int64(in.CreatedBy), Valid: true}
+	}
+
+	d, err = ScanDisbursement(tx.QueryRow(`
+		INSERT INTO disbursements (loan_id, customer_id, amount_aud, method, status, recipient_address, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+DisbursementColumns,
+		in.LoanID, customerID, amount, in.Method, models.DisbursementStatusPending, in.RecipientAddress, createdBy,
+	))
+	if err != nil {
+		return d, false, fmt.Errorf("storing disbursement: %w", err)
+	}
+
+	return d, true, nil
+}
+
+// GetLoanDisbursement returns the disbursement of a loan
+func GetLoanDisbursement(q querier, loanID int) (models.Disbursement, error) {
+	d, err := ScanDisbursement(q.QueryRow("SELECT "+DisbursementColumns+" FROM disbursements WHERE loan_id = $1", loanID))
+	if err == sql.ErrNoRows {
+		return d, ErrDisbursementNotFound
+	}
+	return d, err
+}
+
+// ClaimDisbursement marks a pending disbursement, or a failed one whose retry is due, as
+// processing and counts the attempt. It must be committed before the payout is sent so a
+// concurrent run cannot send it twice.
+func ClaimDisbursement(tx *sql.Tx, id int) (models.Disbursement, error) {
+	d, err := lockDisbursement(tx, id)
+	if err != nil {
+		return d, err
+	}
+
+	due := d.Status == models.DisbursementStatusPending ||
+		(d.Status == models.DisbursementStatusFailed && d.NextAttemptAt.Valid && !d.NextAttemptAt.Time.After(time.Now()))
+	if !due {
+		return d, ErrDisbursementNotDue
+	}
+
+	return ScanDisbursement(tx.QueryRow(`
+		UPDATE disbursements
+		SET status = $1, attempts = attempts + 1, error_message = NULL, next_attempt_at = NULL, updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+DisbursementColumns,
+		models.DisbursementStatusProcessing, id,
+	))
+}
+
+// RecordDisbursementSent stores the reference a rail returned for a processing disbursement
+func RecordDisbursementSent(db *sql.DB, id int, txHash string) error {
+	_, err := db.Exec(
+		"UPDATE disbursements SET tx_hash = $1, updated_at = NOW() WHERE id = $2 AND status = $3",
+		txHash, id, models.DisbursementStatusProcessing,
+	)
+	return err
+}
+
+// FailDisbursement marks a processing disbursement failed. It is retried at retryAt, or only
+// when staff retry it if retryAt is not set. The reference of the failed attempt is cleared so
+// the next attempt sends a new payout.
+func FailDisbursement(db *sql.DB, id int, reason string, retryAt sql.NullTime) error {
+	_, err := db.Exec(`
+		UPDATE disbursements
+		SET status = $1, error_message = $2, next_attempt_at = $3, tx_hash = NULL, updated_at = NOW()
+		WHERE id = $4 AND status = $5
+	`, models.DisbursementStatusFailed, reason, retryAt, id, models.DisbursementStatusProcessing)
+	return err
+}
+
+// CompleteDisbursement marks a processing disbursement completed and moves its loan to
+// disbursed, which starts interest accruing. It returns the loan's status beforehand; a loan
+// that is no longer collateralised is left as it is, since the payout has gone out regardless.
+func CompleteDisbursement(tx *sql.Tx, id int) (models.Disbursement, string, error) {
+	d, err := lockDisbursement(tx, id)
+	if err != nil {
+		return d, "", err
+	}
+	if d.Status != models.DisbursementStatusProcessing {
+		return d, "", fmt.Errorf("disbursement %d is %s, not processing", id, d.Status)
+	}
+
+	var loanStatus string
+	if err := tx.QueryRow("SELECT status FROM loans WHERE id = $1", d.LoanID).Scan(&loanStatus); err != nil {
+		return d, "", fmt.Errorf("fetching loan status: %w", err)
+	}
+
+	d, err = ScanDisbursement(tx.QueryRow(`
+		UPDATE disbursements
+		SET status = $1, error_message = NULL, completed_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+DisbursementColumns,
+		models.DisbursementStatusCompleted, id,
+	))
+	if err != nil {
+		return d, loanStatus, fmt.Errorf("completing disbursement: %w", err)
+	}
+
+	if loanStatus != models.LoanStatusCollateralised {
+		return d, loanStatus, nil
+	}
+
+	reason := fmt.Sprintf("Disbursed via %s (%s)", d.Method, d.TxHash.String)
+	if _, err := TransitionLoanStatus(tx, d.LoanID, models.LoanStatusDisbursed, 0, reason); err != nil {
+		return d, loanStatus, err
+	}
+
+	return d, loanStatus, nil
+}
+
+// RetryDisbursement puts a loan's failed disbursement back in the queue to be sent straight away
+func RetryDisbursement(tx *sql.Tx, loanID int) (models.Disbursement, error) {
+	d, err := ScanDisbursement(tx.QueryRow(
+		"SELECT "+DisbursementColumns+" FROM disbursements WHERE loan_id = $1 FOR UPDATE", loanID,
+	))
+	if err == sql.ErrNoRows {
+		return d, ErrDisbursementNotFound
+	}
+	if err != nil {
+		return d, err
+	}
+
+	if d.Status != models.DisbursementStatusFailed {
+		return d, ErrDisbursementNotRetryable
+	}
+
+	return ScanDisbursement(tx.QueryRow(`
+		UPDATE disbursements
+		SET status = $1, next_attempt_at = NULL, updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+DisbursementColumns,
+		models.DisbursementStatusPending, d.ID,
+	))
+}
+
+func lockDisbursement(tx *sql.Tx, id int) (models.Disbursement, error) {
+	d, err := ScanDisbursement(tx.QueryRow(
+		"SELECT "+DisbursementColumns+" FROM disbursements WHERE id = $1 FOR UPDATE", id,
+	))
+	if err == sql.ErrNoRows {
+		return d, ErrDisbursementNotFound
+	}
+	return d, err
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"paperhands/api/chain"
+	"paperhands/api/interest"
+	"paperhands/api/models"
+	"paperhands/api/risk"
+	"paperhands/api/wallet"
+)
+
+// Error definitions
+var (
+	ErrNotLiquidatable       = errors.New("loan is not in a liquidatable status")
+	ErrBelowLiquidationLVR   = errors.New("loan has not breached its liquidation LVR")
+	ErrLiquidationNotFound   = errors.New("liquidation not found")
+	ErrLiquidationSettled    = errors.New("liquidation already settled")
+	ErrLiquidationInProgress = errors.New("loan is already being liquidated")
+	ErrInvalidProceeds       = errors.New("invalid liquidation proceeds")
+	ErrSweepUnconfirmed      = errors.New("liquidation sweep has not confirmed")
+	ErrSweepTxIDMismatch     = errors.New("txid does not match the liquidation sweep")
+)
+
+// LiquidationColumns is the column list scanned by ScanLiquidation
+const LiquidationColumns = `
+	id, loan_id, exchange_address, psbt, input_sats, fee_sats, sweep_sats, btc_price, lvr,
+	outstanding_aud, expected_proceeds_aud, status, sweep_txid, proceeds_aud, surplus_aud,
+	shortfall_aud, initiated_by, settled_by, settled_at, created_at, updated_at
+`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// ScanLiquidation scans a row selected with LiquidationColumns
+func ScanLiquidation(row rowScanner) (models.LoanLiquidation, error) {
+	var l models.LoanLiquidation
+	err := row.Scan(
+		&l.ID,
+		&l.LoanID,
+		&l.ExchangeAddress,
+		&l.PSBT,
+		&l.InputSats,
+		&l.FeeSats,
+		&l.SweepSats,
+		&l.BTCPrice,
+		&l.LVR,
+		&l.OutstandingAUD,
+		&l.ExpectedProceedsAUD,
+		&l.Status,
+		&l.SweepTxID,
+		&l.ProceedsAUD,
+		&l.SurplusAUD,
+		&l.ShortfallAUD,
+		&l.InitiatedBy,
+		&l.SettledBy,
+		&l.SettledAt,
+		&l.CreatedAt,
+		&l.UpdatedAt,
+	)
+	return l, err
+}
+
+// LiquidationInput is a sweep of a loan's collateral to the exchange
+type LiquidationInput struct {
+	ExchangeAddress string
+	PSBT            string
+	InputSats       int64
+	FeeSats         int64
+	SweepSats       int64
+	BTCPrice        float64
+	Thresholds      risk.Thresholds
+	// Force skips the liquidation LVR check
+	Force       bool
+	Reason      string
+	InitiatedBy int
+}
+
+// StartLiquidation freezes a loan by moving it to liquidating and records the sweep of its
+// collateral to the exchange. Interest is accrued up to asOf first; liquidating loans stop
+// accruing and no longer accept repayments. Expected proceeds are valued at in.BTCPrice.
+func StartLiquidation(tx *sql.Tx, loanID int, in LiquidationInput, asOf time.Time) (models.LoanLiquidation, error) {
+	var liquidation models.LoanLiquidation
+
+	if _, err := interest.AccrueLoan(tx, loanID, asOf); err != nil {
+		if err == sql.ErrNoRows {
+			return liquidation, ErrLoanNotFound
+		}
+		return liquidation, fmt.Errorf("accruing interest: %w", err)
+	}
+
+	debt, err := lockLoanDebt(tx, loanID)
+	if err != nil {
+		return liquidation, err
+	}
+
+	if debt.Status == models.LoanStatusLiquidating {
+		return liquidation, ErrLiquidationInProgress
+	}
+
+	if debt.Status != models.LoanStatusDisbursed && debt.Status != models.LoanStatusActive {
+		return liquidation, fmt.Errorf("%w: %s", ErrNotLiquidatable, debt.Status)
+	}
+
+	var collateralBTC float64
+	if err := tx.QueryRow("SELECT collateral_btc FROM loans WHERE id = $1", loanID).Scan(&collateralBTC); err != nil {
+		return liquidation, err
+	}
+
+	// LVR is measured the same way as the risk engine: principal plus unpaid interest
+	lvr := risk.LVR(debt.PrincipalAUD+debt.InterestAUD, collateralBTC, in.BTCPrice)
+	if !in.Force && in.Thresholds.Classify(lvr) != risk.LevelLiquidation {
+		return liquidation, fmt.Errorf("%w: LVR %.2f%% is below %.2f%%",
+			ErrBelowLiquidationLVR, lvr*100, in.Thresholds.Liquidation*100)
+	}
+
+	reason := in.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("Liquidation at LVR %.2f%% (BTC %.2f AUD)", lvr*100, in.BTCPrice)
+	}
+
+	if _, err := TransitionLoanStatus(tx, loanID, models.LoanStatusLiquidating, in.InitiatedBy, reason); err != nil {
+		return liquidation, err
+	}
+
+	var initiatedBy sql.NullInt64
+	if in.InitiatedBy != 0 {
+		initiatedBy = sql.NullInt64{Int64: int64(in.InitiatedBy), Valid: true}
+	}
+
+	expected := interest.RoundCents(float64(in.SweepSats) / 1e8 * in.BTCPrice)
+
+	liquidation, err = ScanLiquidation(tx.QueryRow(`
+		INSERT INTO loan_liquidations (loan_id, exchange_address, psbt, input_sats, fee_sats, sweep_sats,
+			btc_price, lvr, outstanding_aud, expected_proceeds_aud, status, initiated_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING `+LiquidationColumns,
+		loanID, in.ExchangeAddress, in.PSBT, in.InputSats, in.FeeSats, in.SweepSats, in.BTCPrice, lvr,
+		debt.Outstanding(), expected, models.LiquidationStatusAwaitingSignature, initiatedBy,
+	))
+	if err != nil {
+		return liquidation, fmt.Errorf("recording liquidation: %w", err)
+	}
+
+	return liquidation, nil
+}
+
+// MarkLiquidationSwept records the confirmed sweep of a liquidation built from encodedPSBT
+// and marks the collateral UTXOs it spent. It reports false without changes if the
+// liquidation is no longer awaiting signature on that PSBT.
+func MarkLiquidationSwept(tx *sql.Tx, loanID int, encodedPSBT, sweepTxID string, inputs []chain.Outpoint) (bool, error) {
+	result, err := tx.Exec(`
+		UPDATE loan_liquidations
+		SET status = $1, sweep_txid = $2, updated_at = NOW()
+		WHERE loan_id = $3 AND status = $4 AND psbt = $5
+	`, models.LiquidationStatusSwept, sweepTxID, loanID, models.LiquidationStatusAwaitingSignature, encodedPSBT)
+	if err != nil {
+		return false, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	for _, input := range inputs {
+		_, err := tx.Exec(`
+			UPDATE loan_collateral_utxos
+			SET spent = TRUE, updated_at = NOW()
+			WHERE loan_id = $1 AND txid = $2 AND vout = $3
+		`, loanID, input.TxID, input.Vout)
+		if err != nil {
+			return false, fmt.Errorf("marking utxo %s:%d spent: %w", input.TxID, input.Vout, err)
+		}
+	}
+
+	return true, nil
+}
+
+// SettleLiquidation reconciles the AUD proceeds of a confirmed sweep against the loan's
+// outstanding balance. The sweep must have been recorded as confirmed by the collateral
+// watcher and sweepTxID must be the txid of the liquidation's PSBT. Proceeds are applied to fees, interest and principal as a repayment;
+// any surplus is credited to the borrower and any shortfall is recorded on the liquidation.
+// The loan moves to liquidated.
+func SettleLiquidation(tx *sql.Tx, loanID int, sweepTxID string, proceedsAUD float64, actorID int) (models.LoanLiquidation, *models.CustomerCredit, error) {
+	liquidation, err := ScanLiquidation(tx.QueryRow(
+		"SELECT "+LiquidationColumns+" FROM loan_liquidations WHERE loan_id = $1 FOR UPDATE", loanID,
+	))
+	if err == sql.ErrNoRows {
+		return liquidation, nil, ErrLiquidationNotFound
+	}
+	if err != nil {
+		return liquidation, nil, err
+	}
+
+	if liquidation.Status == models.LiquidationStatusSettled {
+		return liquidation, nil, ErrLiquidationSettled
+	}
+
+	sweep, err := wallet.DecodeSweepPSBT(liquidation.PSBT)
+	if err != nil {
+		return liquidation, nil, err
+	}
+	if sweepTxID != sweep.TxID {
+		return liquidation, nil, fmt.Errorf("%w: expected %s", ErrSweepTxIDMismatch, sweep.TxID)
+	}
+
+	if liquidation.Status != models.LiquidationStatusSwept {
+		return liquidation, nil, ErrSweepUnconfirmed
+	}
+
+	proceeds := interest.RoundCents(proceedsAUD)
+	if proceeds < 0 {
+		return liquidation, nil, ErrInvalidProceeds
+	}
+
+	debt, err := lockLoanDebt(tx, loanID)
+	if err != nil {
+		return liquidation, nil, err
+	}
+
+	outstanding := debt.Outstanding()
+	applied := math.Min(proceeds, outstanding)
+
+	if applied > 0 {
+		alloc := Allocate(applied, debt.FeesAUD, debt.InterestAUD, debt.PrincipalAUD)
+		_, err := applyRepayment(tx, loanID, RepaymentInput{
+			Currency:   models.RepaymentCurrencyAUD,
+			Amount:     applied,
+			AmountAUD:  applied,
+			Reference:  fmt.Sprintf("Liquidation %d", liquidation.ID),
+			TxHash:     sweepTxID,
+			RecordedBy: actorID,
+		}, alloc)
+		if err != nil {
+			return liquidation, nil, err
+		}
+	}
+
+	surplus := interest.RoundCents(proceeds - applied)
+	shortfall := interest.RoundCents(outstanding - applied)
+
+	var credit *models.CustomerCredit
+	if surplus > 0 {
+		credit = &models.CustomerCredit{}
+		err := tx.QueryRow(`
+			INSERT INTO customer_credits (customer_id, loan_id, amount_aud, reason, status)
+			SELECT customer_id, id, $1, $2, $3 FROM loans WHERE id = $4
+			RETURNING id, customer_id, loan_id, amount_aud, reason, status, created_at, updated_at
+		`, surplus, models.CreditReasonLiquidationSurplus, models.CreditStatusPending, loanID).Scan(
+			&credit.ID,
+			&credit.CustomerID,
+			&credit.LoanID,
+			&credit.AmountAUD,
+			&credit.Reason,
+			&credit.Status,
+			&credit.CreatedAt,
+			&credit.UpdatedAt,
+		)
+		if err != nil {
+			return liquidation, nil, fmt.Errorf("crediting surplus: %w", err)
+		}
+	}
+
+	var settledBy sql.NullInt64
+	if actorID != 0 {
+		settledBy = sql.NullInt64{Int64: int64(actorID), Valid: true}
+	}
+
+	liquidation, err = ScanLiquidation(tx.QueryRow(`
+		UPDATE loan_liquidations
+		SET status = $1, proceeds_aud = $2, surplus_aud = $3, shortfall_aud = $4,
+			settled_by = $5, settled_at = NOW(), updated_at = NOW()
+		WHERE id = $6
+		RETURNING `+LiquidationColumns,
+		models.LiquidationStatusSettled, proceeds, surplus, shortfall, settledBy, liquidation.ID,
+	))
+	if err != nil {
+		return liquidation, nil, err
+	}
+
+	reason := fmt.Sprintf("Liquidation settled: %.2f AUD proceeds, %.2f AUD surplus, %.2f AUD shortfall", proceeds, surplus, shortfall)
+	if _, err := TransitionLoanStatus(tx, loanID, models.LoanStatusLiquidated, actorID, reason); err != nil {
+		return liquidation, nil, err
+	}
+
+	return liquidation, credit, nil
+}
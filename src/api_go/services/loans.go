@@ -0,0 +1,78 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"paperhands/api/models"
+)
+
+// Error definitions
+var (
+	ErrLoanNotFound      = errors.New("loan not found")
+	ErrInvalidStatus     = errors.New("invalid loan status")
+	ErrInvalidTransition = errors.New("invalid loan status transition")
+)
+
+// TransitionLoanStatus moves a loan to a new status within tx and records the change
+// in loan_status_history. actorID is the user making the change, or 0 for the system.
+// It returns the status the loan was in before the transition.
+func TransitionLoanStatus(tx *sql.Tx, loanID int, to string, actorID int, reason string) (string, error) {
+	if !models.IsValidLoanStatus(to) {
+		return "", ErrInvalidStatus
+	}
+
+	var from string
+	err := tx.QueryRow("SELECT status FROM loans WHERE id = $1 FOR UPDATE", loanID).Scan(&from)
+	if err == sql.ErrNoRows {
+		return "", ErrLoanNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !models.CanTransitionLoan(from, to) {
+		return from, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+
+	if _, err := tx.Exec("UPDATE loans SET status = $1, updated_at = NOW() WHERE id = $2", to, loanID); err != nil {
+		return from, err
+	}
+
+	// Interest starts accruing from the disbursement date
+	if to == models.LoanStatusDisbursed {
+		if _, err := tx.Exec("UPDATE loans SET disbursed_at = NOW() WHERE id = $1", loanID); err != nil {
+			return from, err
+		}
+	}
+
+	if err := RecordLoanStatus(tx, loanID, from, to, actorID, reason); err != nil {
+		return from, err
+	}
+
+	return from, nil
+}
+
+// RecordLoanStatus inserts a loan_status_history row. An empty from status
+// records the initial status of a new loan.
+func RecordLoanStatus(tx *sql.Tx, loanID int, from, to string, actorID int, reason string) error {
+	var fromStatus, reasonText sql.NullString
+	var actor sql.NullInt64
+
+	if from != "" {
+		fromStatus = sql.NullString{String: from, Valid: true}
+	}
+	if reason != "" {
+		reasonText = sql.NullString{String: reason, Valid: true}
+	}
+	if actorID != 0 {
+		actor = sql.NullInt64{Int64: int64(actorID), Valid: true}
+	}
+
+	_, err := tx.Exec(`
+		INSERT INTO loan_status_history (loan_id, from_status, to_status, actor_user_id, reason)
+		VALUES ($1, $2, $3, $4, $5)
+	`, loanID, fromStatus, to, actor, reasonText)
+	return err
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"database/sql"
+
+	"paperhands/api/models"
+)
+
+// OnChainDisbursementColumns is the column list scanned by ScanOnChainDisbursement
+const OnChainDisbursementColumns = `
+	id, contract_disbursement_id, contract_loan_id, loan_id, disbursement_id, recipient_address,
+	amount, amount_base_units, tx_hash, log_index, block_number, status, reason, created_at, updated_at
+`
+
+// ScanOnChainDisbursement scans a row selected with OnChainDisbursementColumns
+func ScanOnChainDisbursement(row rowScanner) (models.OnChainDisbursement, error) {
+	var o models.OnChainDisbursement
+	err := row.Scan(
+		&o.ID,
+		&o.ContractDisbursementID,
+		&o.ContractLoanID,
+		&o.LoanID,
+		&o.DisbursementID,
+		&o.RecipientAddress,
+		&o.Amount,
+		&o.AmountBaseUnits,
+		&o.TxHash,
+		&o.LogIndex,
+		&o.BlockNumber,
+		&o.Status,
+		&o.Reason,
+		&o.CreatedAt,
+		&o.UpdatedAt,
+	)
+	return o, err
+}
+
+// GetDisbursementByTxHash returns the disbursement of a method whose payout reference is txHash.
+// A transaction can pay several loans, so the disbursement of loanID is preferred.
+func GetDisbursementByTxHash(q querier, method, txHash string, loanID int) (models.Disbursement, error) {
+	d, err := ScanDisbursement(q.QueryRow(
+		"SELECT "+DisbursementColumns+" FROM disbursements WHERE method = $1 AND tx_hash = $2 ORDER BY loan_id = $3 DESC, id LIMIT 1",
+		method, txHash, loanID,
+	))
+	if err == sql.ErrNoRows {
+		return d, ErrDisbursementNotFound
+	}
+	return d, err
+}
+
+// RecordOnChainDisbursement stores a reconciled contract payout. Payouts are unique by log, so
+// recording one again returns created false and leaves the stored row unchanged.
+func RecordOnChainDisbursement(db *sql.DB, o models.OnChainDisbursement) (models.OnChainDisbursement, bool, error) {
+	stored, err := ScanOnChainDisbursement(db.QueryRow(`
+		INSERT INTO onchain_disbursements (
+			contract_disbursement_id, contract_loan_id, loan_id, disbursement_id, recipient_address,
+			amount, amount_base_units, tx_hash, log_index, block_number, status, reason
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (tx_hash, log_index) DO NOTHING
+		RETURNING `+OnChainDisbursementColumns,
+		o.ContractDisbursementID, o.ContractLoanID, o.LoanID, o.DisbursementID, o.RecipientAddress,
+		o.Amount, o.AmountBaseUnits, o.TxHash, o.LogIndex, o.BlockNumber, o.Status, o.Reason,
+	))
+	if err == sql.ErrNoRows {
+		return o, false, nil
+	}
+	if err != nil {
+		return o, false, err
+	}
+	return stored, true, nil
+}
+
+// UpdateOnChainDisbursementReconciliation stores the outcome of reconciling a contract payout again
+func UpdateOnChainDisbursementReconciliation(db *sql.DB, o models.OnChainDisbursement) error {
+	_, err := db.Exec(`
+		UPDATE onchain_disbursements
+		SET loan_id = $1, disbursement_id = $2, status = $3, reason = $4, updated_at = NOW()
+		WHERE id = $5
+	`, o.LoanID, o.DisbursementID, o.Status, o.Reason, o.ID)
+	return err
+}
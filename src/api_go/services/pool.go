@@ -0,0 +1,379 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/lib/pq"
+
+	"paperhands/api/interest"
+	"paperhands/api/models"
+)
+
+// Error definitions
+var (
+	ErrSupplyNotConfirmed   = errors.New("capital supply is not confirmed")
+	ErrPoolNotFound         = errors.New("lending pool not found")
+	ErrInsufficientPosition = errors.New("withdrawal exceeds the value of the pool position")
+	ErrPoolInsolvent        = errors.New("lending pool has shares but no assets")
+)
+
+// rowsQuerier is satisfied by both *sql.DB and *sql.Tx
+type rowsQuerier interface {
+	querier
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// PriceFunc returns the AUD value of one unit of a capital token
+type PriceFunc func(token string) (float64, error)
+
+// sharePriceSQL is the value of one share of pool p, 1 before the pool has any shares
+const sharePriceSQL = `CASE WHEN p.total_shares > 0 THEN p.total_assets / p.total_shares ELSE 1 END`
+
+// shareDecimals is the scale pool shares and assets are stored at, NUMERIC(38, 18)
+const shareDecimals = 18
+
+// parseDecimal parses a NUMERIC column read as text
+func parseDecimal(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	return r, nil
+}
+
+// roundDecimal rounds r to places decimal places, down or up
+func roundDecimal(r *big.Rat, places int, up bool) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(places)), nil)
+	n := new(big.Int).Mul(r.Num(), scale)
+	// DivMod floors, the denominator of a Rat is always positive
+	q, m := new(big.Int).DivMod(n, r.Denom(), new(big.Int))
+	if up && m.Sign() != 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	return new(big.Rat).SetFrac(q, scale)
+}
+
+// depositShares returns the shares minted for depositing amount into a pool holding
+// totalAssets over totalShares. The first deposit mints one share per unit; later deposits
+// round down so the pool never mints more shares than the assets paid for.
+func depositShares(amount, totalAssets, totalShares *big.Rat) (*big.Rat, error) {
+	if totalShares.Sign() == 0 {
+		return roundDecimal(amount, shareDecimals, false), nil
+	}
+	if totalAssets.Sign() <= 0 {
+		return nil, ErrPoolInsolvent
+	}
+	shares := new(big.Rat).Mul(amount, totalShares)
+	shares.Quo(shares, totalAssets)
+	return roundDecimal(shares, shareDecimals, false), nil
+}
+
+// sharePrice returns the value of one share, 1 before the pool has any shares
+func sharePrice(totalAssets, totalShares *big.Rat) float64 {
+	if totalShares.Sign() == 0 {
+		return 1
+	}
+	price, _ := new(big.Rat).Quo(totalAssets, totalShares).Float64()
+	return price
+}
+
+// lockPool locks a lending pool and returns its total assets and shares
+func lockPool(tx *sql.Tx, token string) (totalAssets, totalShares *big.Rat, err error) {
+	var assetsText, sharesText string
+	err = tx.QueryRow(
+		"SELECT total_assets::text, total_shares::text FROM lending_pools WHERE token = $1 FOR UPDATE", token,
+	).Scan(&assetsText, &sharesText)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrPoolNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if totalAssets, err = parseDecimal(assetsText); err != nil {
+		return nil, nil, err
+	}
+	if totalShares, err = parseDecimal(sharesText); err != nil {
+		return nil, nil, err
+	}
+	return totalAssets, totalShares, nil
+}
+
+// MintPoolShares mints pool shares to the lender of a confirmed capital supply at the pool's
+// current share price and adds the supply to their principal. Each supply mints once; it
+// returns false if the supply had already minted its shares.
+func MintPoolShares(tx *sql.Tx, supplyID int) (bool, error) {
+	var userID int
+	var token, amountText, status string
+	err := tx.QueryRow(
+		"SELECT user_id, token, amount::text, status FROM capital_supplies WHERE id = $1", supplyID,
+	).Scan(&userID, &token, &amountText, &status)
+	if err != nil {
+		return false, fmt.Errorf("fetching capital supply: %w", err)
+	}
+
+	if status != models.CapitalStatusConfirmed {
+		return false, ErrSupplyNotConfirmed
+	}
+
+	amount, err := parseDecimal(amountText)
+	if err != nil {
+		return false, err
+	}
+
+	// Lock the pool so concurrent mints and interest see a consistent share price
+	totalAssets, totalShares, err := lockPool(tx, token)
+	if err != nil {
+		return false, err
+	}
+
+	minted, err := depositShares(amount, totalAssets, totalShares)
+	if err != nil {
+		return false, err
+	}
+	shares := minted.FloatString(shareDecimals)
+
+	result, err := tx.Exec(`
+		INSERT INTO pool_ledger (token, user_id, entry_type, capital_supply_id, assets, shares, share_price)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (capital_supply_id) DO NOTHING
+	`, token, userID, models.PoolEntryDeposit, supplyID, amountText, shares, sharePrice(totalAssets, totalShares))
+	if err != nil {
+		return false, fmt.Errorf("recording pool deposit: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+		UPDATE lending_pools
+		SET total_shares = total_shares + $1, total_assets = total_assets + $2, updated_at = NOW()
+		WHERE token = $3
+	`, shares, amountText, token)
+	if err != nil {
+		return false, fmt.Errorf("updating lending pool: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO pool_positions (user_id, token, shares, principal)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, token) DO UPDATE
+		SET shares = pool_positions.shares + EXCLUDED.shares,
+			principal = pool_positions.principal + EXCLUDED.principal,
+			updated_at = NOW()
+	`, userID, token, shares, amountText)
+	if err != nil {
+		return false, fmt.Errorf("updating pool position: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetPoolPositions returns a lender's pool positions valued at the current share prices
+func GetPoolPositions(db *sql.DB, userID int) ([]models.PoolPosition, error) {
+	rows, err := db.Query(`
+		SELECT pp.user_id, pp.token, pp.principal, pp.shares, `+sharePriceSQL+`,
+			pp.shares * `+sharePriceSQL+`, pp.created_at, pp.updated_at
+		FROM pool_positions pp
+		JOIN lending_pools p ON p.token = pp.token
+		WHERE pp.user_id = $1
+		ORDER BY pp.token
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	positions := []models.PoolPosition{}
+	for rows.Next() {
+		var pos models.PoolPosition
+		err := rows.Scan(
+			&pos.UserID,
+			&pos.Token,
+			&pos.Principal,
+			&pos.Shares,
+			&pos.SharePrice,
+			&pos.Value,
+			&pos.CreatedAt,
+			&pos.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		pos.Yield = pos.Value - pos.Principal
+		positions = append(positions, pos)
+	}
+
+	return positions, rows.Err()
+}
+
+// withdrawalShares returns the shares burned to withdraw amount from a pool holding
+// totalAssets over totalShares, rounded up so the pool never pays out more than the shares
+// were worth
+func withdrawalShares(amount, totalAssets, totalShares *big.Rat) (*big.Rat, error) {
+	if totalShares.Sign() == 0 || totalAssets.Sign() <= 0 {
+		return nil, ErrInsufficientPosition
+	}
+	shares := new(big.Rat).Mul(amount, totalShares)
+	shares.Quo(shares, totalAssets)
+	return roundDecimal(shares, shareDecimals, true), nil
+}
+
+// withdrawalDecimals is the scale of capital_withdrawals.amount, DECIMAL(18, 8)
+const withdrawalDecimals = 8
+
+// withdrawalTolerance is how far a withdrawal of a whole position may exceed its value: the
+// amount is stored at 8 decimal places, so rounding can leave it one unit over
+var withdrawalTolerance = big.NewRat(1, 100000000)
+
+// BurnPoolShares burns the lender's shares worth amount at the pool's current share price to
+// pay a withdrawal, reducing their principal in proportion to the shares burned. Shares are
+// rounded up; a withdrawal of the whole position burns every share and pays its value rounded
+// down, which may be a unit under amount. It returns the assets to pay out.
+func BurnPoolShares(tx *sql.Tx, withdrawalID, userID int, token string, amount float64) (assets, shares string, price float64, err error) {
+	totalAssets, totalShares, err := lockPool(tx, token)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	var heldText, principalText string
+	err = tx.QueryRow(
+		"SELECT shares::text, principal::text FROM pool_positions WHERE user_id = $1 AND token = $2 FOR UPDATE", userID, token,
+	).Scan(&heldText, &principalText)
+	if err == sql.ErrNoRows {
+		return "", "", 0, ErrInsufficientPosition
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	held, err := parseDecimal(heldText)
+	if err != nil {
+		return "", "", 0, err
+	}
+	principal, err := parseDecimal(principalText)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	paid, _ := new(big.Rat).SetString(strconv.FormatFloat(amount, 'f', withdrawalDecimals, 64))
+	burned, err := withdrawalShares(paid, totalAssets, totalShares)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	if burned.Cmp(held) > 0 {
+		value := new(big.Rat).Mul(held, totalAssets)
+		value = roundDecimal(value.Quo(value, totalShares), withdrawalDecimals, false)
+		if new(big.Rat).Sub(paid, value).Cmp(withdrawalTolerance) > 0 {
+			return "", "", 0, ErrInsufficientPosition
+		}
+		burned, paid = held, value
+	}
+
+	// The principal leaves with the shares; the whole position takes all of it
+	basis := principal
+	if burned.Cmp(held) != 0 {
+		basis = new(big.Rat).Mul(principal, burned)
+		basis = roundDecimal(basis.Quo(basis, held), shareDecimals, false)
+	}
+
+	assets = paid.FloatString(withdrawalDecimals)
+	shares = burned.FloatString(shareDecimals)
+	price = sharePrice(totalAssets, totalShares)
+
+	_, err = tx.Exec(`
+		INSERT INTO pool_ledger (token, user_id, entry_type, capital_withdrawal_id, assets, shares, share_price)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, token, userID, models.PoolEntryWithdrawal, withdrawalID, "-"+assets, "-"+shares, price)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("recording pool withdrawal: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE lending_pools
+		SET total_shares = GREATEST(total_shares - $1, 0), total_assets = GREATEST(total_assets - $2, 0), updated_at = NOW()
+		WHERE token = $3
+	`, shares, assets, token)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("updating lending pool: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE pool_positions
+		SET shares = shares - $1, principal = principal - $2, updated_at = NOW()
+		WHERE user_id = $3 AND token = $4
+	`, shares, basis.FloatString(shareDecimals), userID, token)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("updating pool position: %w", err)
+	}
+
+	return assets, shares, price, nil
+}
+
+// PoolLiquidity returns how much of each lending pool is lent out and how much can be
+// withdrawn while keeping its utilisation at or below maxUtilisation. Loans are in AUD and
+// not drawn from a particular pool, so outstanding principal is allocated across the pools
+// by the AUD value of their assets, as interest is.
+func PoolLiquidity(q rowsQuerier, price PriceFunc, maxUtilisation float64) ([]models.PoolLiquidity, error) {
+	var outstandingAUD float64
+	err := q.QueryRow(
+		"SELECT COALESCE(SUM(COALESCE(principal_outstanding_aud, amount_aud)), 0) FROM loans WHERE status = ANY($1)",
+		pq.Array(interest.AccruingStatuses),
+	).Scan(&outstandingAUD)
+	if err != nil {
+		return nil, fmt.Errorf("summing outstanding principal: %w", err)
+	}
+
+	rows, err := q.Query("SELECT token, total_shares, total_assets FROM lending_pools ORDER BY token")
+	if err != nil {
+		return nil, fmt.Errorf("querying lending pools: %w", err)
+	}
+
+	var pools []models.PoolLiquidity
+	var prices []float64
+	var totalValue float64
+	for rows.Next() {
+		var p models.PoolLiquidity
+		var shares float64
+		if err := rows.Scan(&p.Token, &shares, &p.TotalAssets); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		// Empty pools hold none of the loans and need no price
+		tokenPrice := 0.0
+		if shares > 0 && p.TotalAssets > 0 {
+			tokenPrice, err = price(p.Token)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("pricing %s: %w", p.Token, err)
+			}
+			totalValue += p.TotalAssets * tokenPrice
+		}
+
+		pools = append(pools, p)
+		prices = append(prices, tokenPrice)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range pools {
+		p := &pools[i]
+		if prices[i] > 0 && totalValue > 0 {
+			p.Lent = outstandingAUD * p.TotalAssets / totalValue
+			p.Utilisation = p.Lent / p.TotalAssets
+		}
+		p.Available = math.Max(p.TotalAssets-p.Lent/maxUtilisation, 0)
+	}
+
+	return pools, nil
+}
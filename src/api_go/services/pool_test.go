@@ -0,0 +1,189 @@
+package services
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"paperhands/api/dbtest"
+	"paperhands/api/models"
+)
+
+func rat(t *testing.T, s string) *big.Rat {
+	t.Helper()
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		t.Fatalf("invalid decimal %q", s)
+	}
+	return r
+}
+
+func TestDepositShares(t *testing.T) {
+	tests := []struct {
+		name                        string
+		amount, totalAssets, shares string
+		want                        string
+		wantErr                     error
+	}{
+		{"first deposit mints one share per unit", "100.5", "0", "0", "100.500000000000000000", nil},
+		{"first deposit after the pool emptied", "7", "0.000000000000000001", "0", "7.000000000000000000", nil},
+		{"at par", "10", "100", "100", "10.000000000000000000", nil},
+		// 1 / 1.1 = 0.9090909090909090909..., so the last place rounds in the pool's favour
+		{"rounds down", "1", "11", "10", "0.909090909090909090", nil},
+		{"dust mints nothing", "0.000000000000000001", "3", "1", "0.000000000000000000", nil},
+		{"shares without assets", "10", "0", "5", "", ErrPoolInsolvent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := depositShares(rat(t, tt.amount), rat(t, tt.totalAssets), rat(t, tt.shares))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("depositShares error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.FloatString(shareDecimals) != tt.want {
+				t.Errorf("depositShares(%s, %s, %s) = %s, want %s", tt.amount, tt.totalAssets, tt.shares, got.FloatString(shareDecimals), tt.want)
+			}
+		})
+	}
+}
+
+func TestWithdrawalShares(t *testing.T) {
+	tests := []struct {
+		name                        string
+		amount, totalAssets, shares string
+		want                        string
+		wantErr                     error
+	}{
+		{"at par", "10", "100", "100", "10.000000000000000000", nil},
+		{"exact", "11", "11", "10", "10.000000000000000000", nil},
+		// Withdrawals round the other way to deposits, so a deposit and withdrawal of the same
+		// amount never leaves the lender with shares they did not pay for
+		{"rounds up", "1", "11", "10", "0.909090909090909091", nil},
+		{"dust burns a share unit", "0.00000001", "3", "1", "0.000000003333333334", nil},
+		{"empty pool", "1", "0", "0", "", ErrInsufficientPosition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withdrawalShares(rat(t, tt.amount), rat(t, tt.totalAssets), rat(t, tt.shares))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("withdrawalShares error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got.FloatString(shareDecimals) != tt.want {
+				t.Errorf("withdrawalShares(%s, %s, %s) = %s, want %s", tt.amount, tt.totalAssets, tt.shares, got.FloatString(shareDecimals), tt.want)
+			}
+		})
+	}
+}
+
+func TestBurnPoolShares(t *testing.T) {
+	tests := []struct {
+		name                   string
+		pool, position         []interface{}
+		amount                 float64
+		wantAssets, wantShares string
+		wantPrice              float64
+		wantPrincipal          string
+		wantErr                error
+	}{
+		{
+			name:          "part of the position",
+			pool:          []interface{}{"11", "10"},
+			position:      []interface{}{"10", "10"},
+			amount:        1,
+			wantAssets:    "1.00000000",
+			wantShares:    "0.909090909090909091",
+			wantPrice:     1.1,
+			wantPrincipal: "0.909090909090909091",
+		},
+		{
+			// The position is worth 10.000000001; the requested amount was rounded up when stored
+			name:          "whole position rounded over its value",
+			pool:          []interface{}{"10.000000001", "3"},
+			position:      []interface{}{"3", "9"},
+			amount:        10.00000001,
+			wantAssets:    "10.00000000",
+			wantShares:    "3.000000000000000000",
+			wantPrice:     10.000000001 / 3,
+			wantPrincipal: "9.000000000000000000",
+		},
+		{
+			name:     "more than the position is worth",
+			pool:     []interface{}{"10.000000001", "3"},
+			position: []interface{}{"3", "9"},
+			amount:   10.00000002,
+			wantErr:  ErrInsufficientPosition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM lending_pools WHERE token = $1 FOR UPDATE").
+				WithArgs("USDC").
+				WillReturnRows([]string{"total_assets", "total_shares"}, tt.pool)
+			mock.ExpectQuery("FROM pool_positions WHERE user_id = $1 AND token = $2 FOR UPDATE").
+				WithArgs(42, "USDC").
+				WillReturnRows([]string{"shares", "principal"}, tt.position)
+			if tt.wantErr == nil {
+				mock.ExpectExec("INSERT INTO pool_ledger").
+					WithArgs("USDC", 42, models.PoolEntryWithdrawal, 7, "-"+tt.wantAssets, "-"+tt.wantShares, tt.wantPrice)
+				mock.ExpectExec("UPDATE lending_pools").WithArgs(tt.wantShares, tt.wantAssets, "USDC")
+				mock.ExpectExec("UPDATE pool_positions").WithArgs(tt.wantShares, tt.wantPrincipal, 42, "USDC")
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			assets, shares, _, err := BurnPoolShares(tx, 7, 42, "USDC", tt.amount)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("BurnPoolShares error = %v, want %v", err, tt.wantErr)
+			}
+			if assets != tt.wantAssets || shares != tt.wantShares {
+				t.Errorf("BurnPoolShares = %s assets, %s shares, want %s, %s", assets, shares, tt.wantAssets, tt.wantShares)
+			}
+		})
+	}
+}
+
+func TestPoolLiquidity(t *testing.T) {
+	db, mock := dbtest.New(t)
+	mock.ExpectQuery("FROM loans WHERE status = ANY($1)").
+		WillReturnRows([]string{"sum"}, []interface{}{450.0})
+	mock.ExpectQuery("FROM lending_pools ORDER BY token").
+		WillReturnRows([]string{"token", "total_shares", "total_assets"},
+			[]interface{}{"AAUD", 1000.0, 1000.0},
+			[]interface{}{"USDC", 0.0, 0.0},
+		)
+
+	// Empty pools are not priced
+	price := func(token string) (float64, error) {
+		if token != "AAUD" {
+			t.Errorf("priced %s", token)
+		}
+		return 1, nil
+	}
+
+	pools, err := PoolLiquidity(db, price, 0.5)
+	if err != nil {
+		t.Fatalf("PoolLiquidity: %v", err)
+	}
+
+	// 450 lent out of 1000 at 50% utilisation leaves 1000 - 450/0.5 = 100 to withdraw
+	want := []models.PoolLiquidity{
+		{Token: "AAUD", TotalAssets: 1000, Lent: 450, Available: 100, Utilisation: 0.45},
+		{Token: "USDC"},
+	}
+	if len(pools) != len(want) {
+		t.Fatalf("PoolLiquidity returned %d pools, want %d", len(pools), len(want))
+	}
+	for i := range want {
+		if pools[i] != want[i] {
+			t.Errorf("pool %d = %+v, want %+v", i, pools[i], want[i])
+		}
+	}
+}
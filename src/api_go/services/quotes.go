@@ -0,0 +1,211 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/interest"
+	"paperhands/api/models"
+)
+
+// Error definitions
+var (
+	ErrQuoteNotFound      = errors.New("quote not found")
+	ErrQuoteExpired       = errors.New("quote has expired")
+	ErrQuoteUsed          = errors.New("quote has already been used")
+	ErrInvalidQuote       = errors.New("invalid quote ID")
+	ErrInvalidLVR         = errors.New("invalid loan-to-value ratio")
+	ErrInvalidLoanAmount  = errors.New("loan amount must be positive")
+	ErrAmountExceedsQuote = errors.New("amount exceeds quoted maximum")
+	ErrMissingQuoteSecret = errors.New("quote signing secret not configured")
+)
+
+// QuoteTerms control the quotes offered to borrowers
+type QuoteTerms struct {
+	TTL time.Duration
+	// DefaultLVR is used when a quote request doesn't specify an LVR
+	DefaultLVR float64
+	// MaxLVR is the highest LVR a loan may start at
+	MaxLVR float64
+}
+
+// QuoteTermsFromEnv reads QUOTE_TTL_SECONDS (default 60), LOAN_DEFAULT_LVR (default 50%)
+// and LOAN_MAX_INITIAL_LVR (default 80%)
+func QuoteTermsFromEnv() QuoteTerms {
+	return QuoteTerms{
+		TTL:        config.EnvSeconds("QUOTE_TTL_SECONDS", 60*time.Second),
+		DefaultLVR: config.EnvFloat("LOAN_DEFAULT_LVR", 0.50),
+		MaxLVR:     config.EnvFloat("LOAN_MAX_INITIAL_LVR", 0.80),
+	}
+}
+
+// quoteColumns is the column list scanned by scanQuote
+const quoteColumns = `
+	id, user_id, btc_price, lvr, max_amount_aud, collateral_btc, expires_at, loan_id, used_at, created_at
+`
+
+func scanQuote(row rowScanner) (models.LoanQuote, error) {
+	var q models.LoanQuote
+	err := row.Scan(
+		&q.ID,
+		&q.UserID,
+		&q.BTCPrice,
+		&q.LVR,
+		&q.MaxAmountAUD,
+		&q.CollateralBTC,
+		&q.ExpiresAt,
+		&q.LoanID,
+		&q.UsedAt,
+		&q.CreatedAt,
+	)
+	return q, err
+}
+
+// quoteSecret is QUOTE_SIGNING_SECRET, falling back to JWT_SECRET
+func quoteSecret() ([]byte, error) {
+	secret := os.Getenv("QUOTE_SIGNING_SECRET")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return nil, ErrMissingQuoteSecret
+	}
+	return []byte(secret), nil
+}
+
+// SignQuoteID returns the quote ID clients hold: the stored ID and its HMAC-SHA256
+func SignQuoteID(id string) (string, error) {
+	secret, err := quoteSecret()
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("loan_quote:" + id))
+	return id + "." + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifyQuoteID checks the signature of a signed quote ID and returns the stored ID
+func VerifyQuoteID(signed string) (string, error) {
+	id, _, ok := strings.Cut(signed, ".")
+	if !ok || id == "" {
+		return "", ErrInvalidQuote
+	}
+
+	expected, err := SignQuoteID(id)
+	if err != nil {
+		return "", err
+	}
+
+	if !hmac.Equal([]byte(expected), []byte(signed)) {
+		return "", ErrInvalidQuote
+	}
+
+	return id, nil
+}
+
+// CollateralForAmount returns the BTC needed to borrow amountAUD at lvr and btcPrice,
+// rounded up to the satoshi
+func CollateralForAmount(amountAUD, lvr, btcPrice float64) float64 {
+	sats := math.Ceil(amountAUD / (lvr * btcPrice) * 1e8)
+	return sats / 1e8
+}
+
+// CreateQuote locks btcPrice for a loan of up to amountAUD at lvr for terms.TTL
+func CreateQuote(db *sql.DB, userID int, amountAUD, lvr, btcPrice float64, terms QuoteTerms, now time.Time) (models.LoanQuote, error) {
+	if amountAUD <= 0 || math.IsNaN(amountAUD) || math.IsInf(amountAUD, 0) {
+		return models.LoanQuote{}, ErrInvalidLoanAmount
+	}
+
+	if lvr == 0 {
+		lvr = terms.DefaultLVR
+	}
+	if lvr <= 0 || lvr > terms.MaxLVR || math.IsNaN(lvr) {
+		return models.LoanQuote{}, fmt.Errorf("%w: must be above 0 and at most %.2f", ErrInvalidLVR, terms.MaxLVR)
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return models.LoanQuote{}, fmt.Errorf("generating quote ID: %w", err)
+	}
+
+	amount := interest.RoundCents(amountAUD)
+	price := interest.RoundCents(btcPrice)
+
+	return scanQuote(db.QueryRow(`
+		INSERT INTO loan_quotes (id, user_id, btc_price, lvr, max_amount_aud, collateral_btc, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+quoteColumns,
+		hex.EncodeToString(raw), userID, price, lvr, amount,
+		CollateralForAmount(amount, lvr, price), now.Add(terms.TTL),
+	))
+}
+
+// QuotedLoan is the amount and collateral of a loan created from a quote
+type QuotedLoan struct {
+	Quote         models.LoanQuote
+	AmountAUD     float64
+	CollateralBTC float64
+}
+
+// RedeemQuote locks a user's quote for a new loan of amountAUD (the quoted maximum if 0)
+// and returns the collateral required for that amount at the quoted price and LVR. Quotes
+// of other users are reported as not found. The caller must record the loan with
+// MarkQuoteUsed in the same tx.
+func RedeemQuote(tx *sql.Tx, signedID string, userID int, amountAUD float64, now time.Time) (QuotedLoan, error) {
+	var loan QuotedLoan
+
+	id, err := VerifyQuoteID(signedID)
+	if err != nil {
+		return loan, err
+	}
+
+	quote, err := scanQuote(tx.QueryRow("SELECT "+quoteColumns+" FROM loan_quotes WHERE id = $1 FOR UPDATE", id))
+	if err == sql.ErrNoRows || (err == nil && quote.UserID != userID) {
+		return loan, ErrQuoteNotFound
+	}
+	if err != nil {
+		return loan, err
+	}
+
+	if quote.UsedAt.Valid {
+		return loan, ErrQuoteUsed
+	}
+
+	if quote.Expired(now) {
+		return loan, ErrQuoteExpired
+	}
+
+	amount := quote.MaxAmountAUD
+	if amountAUD != 0 {
+		amount = interest.RoundCents(amountAUD)
+	}
+	if amount <= 0 || math.IsNaN(amount) {
+		return loan, ErrInvalidLoanAmount
+	}
+	if amount > quote.MaxAmountAUD {
+		return loan, fmt.Errorf("%w: %.2f > %.2f", ErrAmountExceedsQuote, amount, quote.MaxAmountAUD)
+	}
+
+	return QuotedLoan{
+		Quote:         quote,
+		AmountAUD:     amount,
+		CollateralBTC: CollateralForAmount(amount, quote.LVR, quote.BTCPrice),
+	}, nil
+}
+
+// MarkQuoteUsed records the loan a quote was redeemed for
+func MarkQuoteUsed(tx *sql.Tx, quoteID string, loanID int) error {
+	_, err := tx.Exec("UPDATE loan_quotes SET loan_id = $1, used_at = NOW() WHERE id = $2", loanID, quoteID)
+	return err
+}
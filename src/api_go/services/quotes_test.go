@@ -0,0 +1,164 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"paperhands/api/dbtest"
+)
+
+func TestSignQuoteID(t *testing.T) {
+	t.Setenv("QUOTE_SIGNING_SECRET", "quote-secret")
+	const id = "0123456789abcdef0123456789abcdef"
+
+	signed, err := SignQuoteID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signed, id+".") {
+		t.Fatalf("signed ID %s does not start with the stored ID", signed)
+	}
+
+	got, err := VerifyQuoteID(signed)
+	if err != nil || got != id {
+		t.Fatalf("VerifyQuoteID(%s) = %q, %v; want %q", signed, got, err, id)
+	}
+
+	mac := signed[len(id)+1:]
+	flipped := "0"
+	if mac[0] == '0' {
+		flipped = "1"
+	}
+
+	tampered := []struct {
+		name   string
+		signed string
+	}{
+		{"another ID with the same MAC", "fedcba9876543210fedcba9876543210." + mac},
+		{"altered MAC", id + "." + flipped + mac[1:]},
+		{"truncated MAC", id + "." + mac[:len(mac)-2]},
+		{"upper-case MAC", id + "." + strings.ToUpper(mac)},
+		{"unsigned ID", id},
+		{"empty ID", "." + mac},
+		{"empty", ""},
+	}
+
+	for _, tt := range tampered {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := VerifyQuoteID(tt.signed); !errors.Is(err, ErrInvalidQuote) {
+				t.Errorf("VerifyQuoteID(%q) error = %v, want %v", tt.signed, err, ErrInvalidQuote)
+			}
+		})
+	}
+
+	// A quote signed with another secret is rejected
+	t.Setenv("QUOTE_SIGNING_SECRET", "rotated-secret")
+	if _, err := VerifyQuoteID(signed); !errors.Is(err, ErrInvalidQuote) {
+		t.Errorf("VerifyQuoteID with a rotated secret error = %v, want %v", err, ErrInvalidQuote)
+	}
+}
+
+func TestQuoteSecretFallback(t *testing.T) {
+	t.Setenv("QUOTE_SIGNING_SECRET", "")
+	t.Setenv("JWT_SECRET", "")
+	if _, err := SignQuoteID("abc"); !errors.Is(err, ErrMissingQuoteSecret) {
+		t.Errorf("SignQuoteID without secrets error = %v, want %v", err, ErrMissingQuoteSecret)
+	}
+
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	fromJWT, err := SignQuoteID("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("QUOTE_SIGNING_SECRET", "quote-secret")
+	fromQuote, err := SignQuoteID("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromJWT == fromQuote {
+		t.Error("QUOTE_SIGNING_SECRET does not take precedence over JWT_SECRET")
+	}
+}
+
+func TestRedeemQuote(t *testing.T) {
+	t.Setenv("QUOTE_SIGNING_SECRET", "quote-secret")
+	const id = "0123456789abcdef0123456789abcdef"
+	signed, err := SignQuoteID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	columns := []string{"id", "user_id", "btc_price", "lvr", "max_amount_aud", "collateral_btc", "expires_at", "loan_id", "used_at", "created_at"}
+	quote := func(userID int, usedAt interface{}) []interface{} {
+		return []interface{}{id, userID, 100_000.0, 0.5, 10_000.0, 0.2, expiresAt, nil, usedAt, expiresAt.Add(-time.Minute)}
+	}
+
+	tests := []struct {
+		name    string
+		row     []interface{}
+		now     time.Time
+		amount  float64
+		want    float64
+		wantErr error
+	}{
+		{"just before expiry", quote(7, nil), expiresAt.Add(-time.Nanosecond), 0, 0.2, nil},
+		{"part of the quoted amount", quote(7, nil), expiresAt.Add(-time.Second), 5_000, 0.1, nil},
+		{"at expiry", quote(7, nil), expiresAt, 0, 0, ErrQuoteExpired},
+		{"after expiry", quote(7, nil), expiresAt.Add(time.Hour), 0, 0, ErrQuoteExpired},
+		{"already used", quote(7, expiresAt.Add(-time.Second)), expiresAt.Add(-time.Second), 0, 0, ErrQuoteUsed},
+		{"another user's quote", quote(8, nil), expiresAt.Add(-time.Second), 0, 0, ErrQuoteNotFound},
+		{"above the quoted amount", quote(7, nil), expiresAt.Add(-time.Second), 10_000.01, 0, ErrAmountExceedsQuote},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery("FROM loan_quotes WHERE id = $1 FOR UPDATE").
+				WithArgs(id).
+				WillReturnRows(columns, tt.row)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			got, err := RedeemQuote(tx, signed, 7, tt.amount, tt.now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("RedeemQuote error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RedeemQuote: %v", err)
+			}
+			if got.CollateralBTC != tt.want {
+				t.Errorf("collateral = %v, want %v", got.CollateralBTC, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedeemTamperedQuote(t *testing.T) {
+	t.Setenv("QUOTE_SIGNING_SECRET", "quote-secret")
+
+	// No statements are expected: a forged quote ID is rejected before the database is read
+	db, mock := dbtest.New(t)
+	mock.ExpectBegin()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	forged := "0123456789abcdef0123456789abcdef." + strings.Repeat("0", 64)
+	if _, err := RedeemQuote(tx, forged, 7, 0, time.Now()); !errors.Is(err, ErrInvalidQuote) {
+		t.Errorf("RedeemQuote(forged) error = %v, want %v", err, ErrInvalidQuote)
+	}
+}
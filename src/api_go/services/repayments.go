@@ -0,0 +1,364 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"paperhands/api/chain"
+	"paperhands/api/interest"
+	"paperhands/api/models"
+
+	"github.com/lib/pq"
+)
+
+// Error definitions
+var (
+	ErrLoanNotRepayable = errors.New("loan is not in a repayable status")
+	ErrInvalidAmount    = errors.New("repayment amount must be positive")
+	ErrOverpayment      = errors.New("repayment exceeds outstanding balance")
+	ErrDuplicateTxHash  = errors.New("a repayment with this tx hash has already been recorded")
+	ErrReleaseLocked    = errors.New("collateral release transaction has already been built")
+)
+
+// RepaymentInput is a repayment received against a loan
+type RepaymentInput struct {
+	Currency   string
+	Amount     float64
+	AmountAUD  float64
+	Reference  string
+	TxHash     string
+	RecordedBy int
+}
+
+// Allocation is how a repayment is split across what is owed
+type Allocation struct {
+	FeesAUD      float64 `json:"feesAud"`
+	InterestAUD  float64 `json:"interestAud"`
+	PrincipalAUD float64 `json:"principalAud"`
+}
+
+// Allocate splits amount across outstanding fees, then interest, then principal
+func Allocate(amount, fees, accruedInterest, principal float64) Allocation {
+	var alloc Allocation
+	remaining := interest.RoundCents(amount)
+
+	alloc.FeesAUD = interest.RoundCents(math.Min(remaining, fees))
+	remaining = interest.RoundCents(remaining - alloc.FeesAUD)
+
+	alloc.InterestAUD = interest.RoundCents(math.Min(remaining, accruedInterest))
+	remaining = interest.RoundCents(remaining - alloc.InterestAUD)
+
+	alloc.PrincipalAUD = interest.RoundCents(math.Min(remaining, principal))
+
+	return alloc
+}
+
+// loanDebt is what a borrower owes on a loan, read with the loan row locked
+type loanDebt struct {
+	Status        string
+	PrincipalAUD  float64
+	FeesAUD       float64
+	InterestAUD   float64
+	ReturnAddress sql.NullString
+}
+
+// Outstanding returns the total owed
+func (d loanDebt) Outstanding() float64 {
+	return interest.RoundCents(d.FeesAUD + d.InterestAUD + d.PrincipalAUD)
+}
+
+// lockLoanDebt locks a loan row and returns the fees, interest and principal owed on it
+func lockLoanDebt(tx *sql.Tx, loanID int) (loanDebt, error) {
+	var debt loanDebt
+	var adminFee, feesPaid, accrued, interestPaid float64
+
+	err := tx.QueryRow(`
+		SELECT status, COALESCE(principal_outstanding_aud, amount_aud), COALESCE(admin_fee_aud, 0),
+			COALESCE(fees_paid_aud, 0), COALESCE(accrued_interest_aud, 0), COALESCE(interest_paid_aud, 0),
+			btc_return_address
+		FROM loans
+		WHERE id = $1
+		FOR UPDATE
+	`, loanID).Scan(&debt.Status, &debt.PrincipalAUD, &adminFee, &feesPaid, &accrued, &interestPaid, &debt.ReturnAddress)
+	if err == sql.ErrNoRows {
+		return debt, ErrLoanNotFound
+	}
+	if err != nil {
+		return debt, err
+	}
+
+	debt.FeesAUD = interest.RoundCents(math.Max(adminFee-feesPaid, 0))
+	debt.InterestAUD = interest.RoundCents(math.Max(accrued-interestPaid, 0))
+
+	return debt, nil
+}
+
+// RecordRepayment accrues interest on a loan up to asOf, allocates the repayment to
+// fees, interest and principal, and records it within tx. A disbursed loan becomes
+// active on its first repayment. When the balance reaches zero the loan is marked
+// repaid and a collateral release instruction is returned.
+func RecordRepayment(tx *sql.Tx, loanID int, in RepaymentInput, asOf time.Time) (models.LoanRepayment, *models.CollateralRelease, error) {
+	var repayment models.LoanRepayment
+
+	if _, err := interest.AccrueLoan(tx, loanID, asOf); err != nil {
+		if err == sql.ErrNoRows {
+			return repayment, nil, ErrLoanNotFound
+		}
+		return repayment, nil, fmt.Errorf("accruing interest: %w", err)
+	}
+
+	debt, err := lockLoanDebt(tx, loanID)
+	if err != nil {
+		return repayment, nil, err
+	}
+
+	if debt.Status != models.LoanStatusDisbursed && debt.Status != models.LoanStatusActive {
+		return repayment, nil, fmt.Errorf("%w: %s", ErrLoanNotRepayable, debt.Status)
+	}
+
+	amount := interest.RoundCents(in.AmountAUD)
+	if amount <= 0 {
+		return repayment, nil, ErrInvalidAmount
+	}
+
+	outstanding := debt.Outstanding()
+	if amount > outstanding {
+		return repayment, nil, fmt.Errorf("%w: %.2f AUD outstanding", ErrOverpayment, outstanding)
+	}
+
+	in.AmountAUD = amount
+	repayment, err = applyRepayment(tx, loanID, in, Allocate(amount, debt.FeesAUD, debt.InterestAUD, debt.PrincipalAUD))
+	if err != nil {
+		return repayment, nil, err
+	}
+
+	if debt.Status == models.LoanStatusDisbursed {
+		if _, err := TransitionLoanStatus(tx, loanID, models.LoanStatusActive, in.RecordedBy, "First repayment received"); err != nil {
+			return repayment, nil, err
+		}
+	}
+
+	if interest.RoundCents(outstanding-amount) > 0 {
+		return repayment, nil, nil
+	}
+
+	if _, err := TransitionLoanStatus(tx, loanID, models.LoanStatusRepaid, in.RecordedBy, "Loan repaid in full"); err != nil {
+		return repayment, nil, err
+	}
+
+	release, err := CreateCollateralRelease(tx, loanID, debt.ReturnAddress.String)
+	if err != nil {
+		return repayment, nil, fmt.Errorf("creating collateral release: %w", err)
+	}
+
+	return repayment, release, nil
+}
+
+// applyRepayment inserts a loan_repayments row split according to alloc and
+// reduces the fees, interest and principal owed on the loan
+func applyRepayment(tx *sql.Tx, loanID int, in RepaymentInput, alloc Allocation) (models.LoanRepayment, error) {
+	var repayment models.LoanRepayment
+	var reference, txHash sql.NullString
+	var recordedBy sql.NullInt64
+	if in.Reference != "" {
+		reference = sql.NullString{String: in.Reference, Valid: true}
+	}
+	if in.TxHash != "" {
+		txHash = sql.NullString{String: in.TxHash, Valid: true}
+	}
+	if in.RecordedBy != 0 {
+		recordedBy = sql.NullInt64{Int64: int64(in.RecordedBy), Valid: true}
+	}
+
+	err := tx.QueryRow(`
+		INSERT INTO loan_repayments (loan_id, currency, amount, amount_aud, fees_aud, interest_aud, principal_aud, reference, tx_hash, recorded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, loan_id, currency, amount, amount_aud, fees_aud, interest_aud, principal_aud, reference, tx_hash, recorded_by, created_at
+	`, loanID, in.Currency, in.Amount, in.AmountAUD, alloc.FeesAUD, alloc.InterestAUD, alloc.PrincipalAUD, reference, txHash, recordedBy).Scan(
+		&repayment.ID,
+		&repayment.LoanID,
+		&repayment.Currency,
+		&repayment.Amount,
+		&repayment.AmountAUD,
+		&repayment.FeesAUD,
+		&repayment.InterestAUD,
+		&repayment.PrincipalAUD,
+		&repayment.Reference,
+		&repayment.TxHash,
+		&repayment.RecordedBy,
+		&repayment.CreatedAt,
+	)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return repayment, ErrDuplicateTxHash
+	}
+	if err != nil {
+		return repayment, fmt.Errorf("recording repayment: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE loans
+		SET fees_paid_aud = COALESCE(fees_paid_aud, 0) + $1,
+			interest_paid_aud = COALESCE(interest_paid_aud, 0) + $2,
+			principal_outstanding_aud = COALESCE(principal_outstanding_aud, amount_aud) - $3,
+			updated_at = NOW()
+		WHERE id = $4
+	`, alloc.FeesAUD, alloc.InterestAUD, alloc.PrincipalAUD, loanID)
+	if err != nil {
+		return repayment, err
+	}
+
+	return repayment, nil
+}
+
+// CreateCollateralRelease records an instruction to return a loan's unspent collateral to
+// the borrower. Without a return address the release waits for the borrower to provide one.
+// Creating a release for a loan that already has one returns the existing release.
+func CreateCollateralRelease(tx *sql.Tx, loanID int, returnAddress string) (*models.CollateralRelease, error) {
+	var amountSats int64
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(amount_sats), 0)
+		FROM loan_collateral_utxos
+		WHERE loan_id = $1 AND NOT spent
+	`, loanID).Scan(&amountSats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fall back to the agreed collateral if no deposits were tracked on-chain
+	if amountSats == 0 {
+		err := tx.QueryRow("SELECT ROUND(collateral_btc * 100000000) FROM loans WHERE id = $1", loanID).Scan(&amountSats)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	status := models.CollateralReleaseAwaitingAddress
+	var address sql.NullString
+	if returnAddress != "" {
+		status = models.CollateralReleasePending
+		address = sql.NullString{String: returnAddress, Valid: true}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO collateral_releases (loan_id, return_address, amount_sats, status)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (loan_id) DO NOTHING
+	`, loanID, address, amountSats, status)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindCollateralRelease(tx, loanID)
+}
+
+// FindCollateralRelease returns the collateral release for a loan, or nil if there is none
+func FindCollateralRelease(q querier, loanID int) (*models.CollateralRelease, error) {
+	var release models.CollateralRelease
+	err := q.QueryRow(`
+		SELECT id, loan_id, return_address, amount_sats, status, psbt, fee_rate, fee_sats, psbt_created_at,
+			created_at, updated_at
+		FROM collateral_releases
+		WHERE loan_id = $1
+	`, loanID).Scan(
+		&release.ID,
+		&release.LoanID,
+		&release.ReturnAddress,
+		&release.AmountSats,
+		&release.Status,
+		&release.PSBT,
+		&release.FeeRate,
+		&release.FeeSats,
+		&release.PSBTCreatedAt,
+		&release.CreatedAt,
+		&release.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// SetReturnAddress stores the borrower's BTC return address on a loan and applies it to a
+// collateral release that has not been built yet. Once a release PSBT exists the address is
+// locked and ErrReleaseLocked is returned. It returns the updated release, if any.
+func SetReturnAddress(tx *sql.Tx, loanID int, address string) (*models.CollateralRelease, error) {
+	var status string
+	err := tx.QueryRow("SELECT status FROM collateral_releases WHERE loan_id = $1 FOR UPDATE", loanID).Scan(&status)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if status == models.CollateralReleaseAwaitingSignature || status == models.CollateralReleaseReleased {
+		return nil, ErrReleaseLocked
+	}
+
+	result, err := tx.Exec("UPDATE loans SET btc_return_address = $1, updated_at = NOW() WHERE id = $2", address, loanID)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, ErrLoanNotFound
+	}
+
+	_, err = tx.Exec(`
+		UPDATE collateral_releases
+		SET return_address = $1, status = $2, updated_at = NOW()
+		WHERE loan_id = $3 AND status IN ($4, $2)
+	`, address, models.CollateralReleasePending, loanID, models.CollateralReleaseAwaitingAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindCollateralRelease(tx, loanID)
+}
+
+// RecordReleasePSBT stores the unsigned release transaction built for a loan's collateral
+// and marks the release as awaiting signature
+func RecordReleasePSBT(tx *sql.Tx, loanID int, encoded string, feeRate, feeSats int64) (*models.CollateralRelease, error) {
+	_, err := tx.Exec(`
+		UPDATE collateral_releases
+		SET psbt = $1, fee_rate = $2, fee_sats = $3, psbt_created_at = NOW(), status = $4, updated_at = NOW()
+		WHERE loan_id = $5
+	`, encoded, feeRate, feeSats, models.CollateralReleaseAwaitingSignature, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindCollateralRelease(tx, loanID)
+}
+
+// MarkCollateralReleased marks a loan's collateral release as released once its transaction
+// has confirmed and flags the collateral outputs it spent. Nothing is updated unless the
+// release is still awaiting signature on encodedPSBT; it reports whether the release was marked.
+func MarkCollateralReleased(tx *sql.Tx, loanID int, encodedPSBT string, inputs []chain.Outpoint) (bool, error) {
+	result, err := tx.Exec(`
+		UPDATE collateral_releases
+		SET status = $1, updated_at = NOW()
+		WHERE loan_id = $2 AND status = $3 AND psbt = $4
+	`, models.CollateralReleaseReleased, loanID, models.CollateralReleaseAwaitingSignature, encodedPSBT)
+	if err != nil {
+		return false, err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return false, nil
+	}
+
+	for _, input := range inputs {
+		_, err := tx.Exec(`
+			UPDATE loan_collateral_utxos
+			SET spent = TRUE, updated_at = NOW()
+			WHERE loan_id = $1 AND txid = $2 AND vout = $3
+		`, loanID, input.TxID, input.Vout)
+		if err != nil {
+			return false, fmt.Errorf("marking utxo %s:%d spent: %w", input.TxID, input.Vout, err)
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name                          string
+		amount, fees, interest, princ float64
+		want                          Allocation
+	}{
+		{"fees first", 50, 100, 200, 10000, Allocation{FeesAUD: 50}},
+		{"fees then interest", 150, 100, 200, 10000, Allocation{FeesAUD: 100, InterestAUD: 50}},
+		{"fees, interest then principal", 1300, 100, 200, 10000, Allocation{FeesAUD: 100, InterestAUD: 200, PrincipalAUD: 1000}},
+		{"no fees owed", 300, 0, 200, 10000, Allocation{InterestAUD: 200, PrincipalAUD: 100}},
+		{"principal only", 300, 0, 0, 10000, Allocation{PrincipalAUD: 300}},
+		{"exact payoff", 10300, 100, 200, 10000, Allocation{FeesAUD: 100, InterestAUD: 200, PrincipalAUD: 10000}},
+		// Anything over the balance is left unallocated for the caller to reject or credit
+		{"overpayment", 20000, 100, 200, 10000, Allocation{FeesAUD: 100, InterestAUD: 200, PrincipalAUD: 10000}},
+		{"zero balance", 500, 0, 0, 0, Allocation{}},
+		{"zero amount", 0, 100, 200, 10000, Allocation{}},
+		// Amounts are rounded to the cent before they are split
+		{"sub-cent amount", 100.005, 0.004, 33.333, 10000, Allocation{InterestAUD: 33.33, PrincipalAUD: 66.68}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allocate(tt.amount, tt.fees, tt.interest, tt.princ); got != tt.want {
+				t.Errorf("Allocate(%v, %v, %v, %v) = %+v, want %+v", tt.amount, tt.fees, tt.interest, tt.princ, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"paperhands/api/models"
+)
+
+// Error definitions
+var (
+	ErrSweepNotFound       = errors.New("sweep not found")
+	ErrSweepSettled        = errors.New("sweep already settled")
+	ErrSweepNotCancellable = errors.New("only sweeps awaiting signature can be cancelled")
+)
+
+// SweepColumns is the column list scanned by ScanSweep, selected from SweepTables
+const SweepColumns = `
+	s.id, s.deposit_address_id, d.address, d.user_id, s.token, s.amount, s.amount_base_units,
+	s.treasury_address, s.unsigned_tx, s.gas_top_up_wei, s.from_block, s.status, s.tx_hash,
+	s.block_number, s.swept_at, s.created_at, s.updated_at
+`
+
+// SweepTables joins each sweep to its deposit address
+const SweepTables = `deposit_sweeps s JOIN deposit_addresses d ON d.id = s.deposit_address_id`
+
+// ScanSweep scans a row selected with SweepColumns
+func ScanSweep(row rowScanner) (models.DepositSweep, error) {
+	var s models.DepositSweep
+	err := row.Scan(
+		&s.ID,
+		&s.DepositAddressID,
+		&s.Address,
+		&s.UserID,
+		&s.Token,
+		&s.Amount,
+		&s.AmountBaseUnits,
+		&s.TreasuryAddress,
+		&s.UnsignedTx,
+		&s.GasTopUpWei,
+		&s.FromBlock,
+		&s.Status,
+		&s.TxHash,
+		&s.BlockNumber,
+		&s.SweptAt,
+		&s.CreatedAt,
+		&s.UpdatedAt,
+	)
+	return s, err
+}
+
+// SweepInput is a sweep built by the sweeper, ready to be stored
+type SweepInput struct {
+	DepositAddressID int
+	Token            string
+	Amount           float64
+	AmountBaseUnits  string
+	TreasuryAddress  string
+	UnsignedTx       string
+	GasTopUpWei      string
+	FromBlock        int64
+}
+
+// CreateSweep stores a sweep awaiting signature
+func CreateSweep(db *sql.DB, in SweepInput) (models.DepositSweep, error) {
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO deposit_sweeps
+			(deposit_address_id, token, amount, amount_base_units, treasury_address, unsigned_tx, gas_top_up_wei, from_block, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`, in.DepositAddressID, in.Token, in.Amount, in.AmountBaseUnits, in.TreasuryAddress, in.UnsignedTx,
+		in.GasTopUpWei, in.FromBlock, models.SweepStatusAwaitingSignature).Scan(&id)
+	if err != nil {
+		return models.DepositSweep{}, fmt.Errorf("storing sweep: %w", err)
+	}
+
+	return ScanSweep(db.QueryRow("SELECT "+SweepColumns+" FROM "+SweepTables+" WHERE s.id = $1", id))
+}
+
+// SettleSweep records the transaction that swept a deposit address, marks the address swept
+// and, if it was the user's only active address for the token, rotates the user to a fresh one.
+// The new address is nil when no rotation was needed.
+func SettleSweep(tx *sql.Tx, sweepID int, txHash string, blockNumber int64) (models.DepositSweep, *models.DepositAddress, error) {
+	sweep, err := ScanSweep(tx.QueryRow(
+		"SELECT "+SweepColumns+" FROM "+SweepTables+" WHERE s.id = $1 FOR UPDATE OF s", sweepID,
+	))
+	if err == sql.ErrNoRows {
+		return sweep, nil, ErrSweepNotFound
+	}
+	if err != nil {
+		return sweep, nil, err
+	}
+
+	// A cancelled sweep that was signed anyway still settles
+	if sweep.Status == models.SweepStatusSwept {
+		return sweep, nil, ErrSweepSettled
+	}
+
+	_, err = tx.Exec(`
+		UPDATE deposit_sweeps
+		SET status = $1, tx_hash = $2, block_number = $3, swept_at = NOW(), updated_at = NOW()
+		WHERE id = $4
+	`, models.SweepStatusSwept, txHash, blockNumber, sweepID)
+	if err != nil {
+		return sweep, nil, fmt.Errorf("settling sweep: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE deposit_addresses
+		SET swept = TRUE, sweep_tx_hash = $1, swept_at = NOW(), updated_at = NOW()
+		WHERE id = $2
+	`, txHash, sweep.DepositAddressID)
+	if err != nil {
+		return sweep, nil, fmt.Errorf("marking deposit address swept: %w", err)
+	}
+
+	var hasActive bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM deposit_addresses
+			WHERE user_id = $1 AND token = $2 AND status = $3 AND swept = FALSE AND derivation_index IS NOT NULL
+		)
+	`, sweep.UserID, sweep.Token, models.DepositAddressStatusActive).Scan(&hasActive)
+	if err != nil {
+		return sweep, nil, err
+	}
+
+	sweep, err = ScanSweep(tx.QueryRow("SELECT "+SweepColumns+" FROM "+SweepTables+" WHERE s.id = $1", sweepID))
+	if err != nil {
+		return sweep, nil, err
+	}
+
+	if hasActive {
+		return sweep, nil, nil
+	}
+
+	rotated, err := CreateDepositAddress(tx, sweep.UserID, sweep.Token)
+	if err != nil {
+		return sweep, nil, fmt.Errorf("rotating deposit address: %w", err)
+	}
+
+	return sweep, &rotated, nil
+}
+
+// CancelSweep discards a sweep awaiting signature, e.g. one priced for stale gas fees.
+// The sweeper builds a new one on its next run.
+func CancelSweep(tx *sql.Tx, sweepID int) (models.DepositSweep, error) {
+	sweep, err := ScanSweep(tx.QueryRow(
+		"SELECT "+SweepColumns+" FROM "+SweepTables+" WHERE s.id = $1 FOR UPDATE OF s", sweepID,
+	))
+	if err == sql.ErrNoRows {
+		return sweep, ErrSweepNotFound
+	}
+	if err != nil {
+		return sweep, err
+	}
+
+	if sweep.Status != models.SweepStatusAwaitingSignature {
+		return sweep, ErrSweepNotCancellable
+	}
+
+	_, err = tx.Exec(
+		"UPDATE deposit_sweeps SET status = $1, updated_at = NOW() WHERE id = $2",
+		models.SweepStatusCancelled, sweepID,
+	)
+	if err != nil {
+		return sweep, err
+	}
+
+	return ScanSweep(tx.QueryRow("SELECT "+SweepColumns+" FROM "+SweepTables+" WHERE s.id = $1", sweepID))
+}
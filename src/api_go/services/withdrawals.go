@@ -0,0 +1,218 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/models"
+)
+
+// Error definitions
+var (
+	ErrWithdrawalNotFound       = errors.New("withdrawal not found")
+	ErrWithdrawalNotCancellable = errors.New("only pending or queued withdrawals can be cancelled")
+	ErrWithdrawalNotReady       = errors.New("only ready withdrawals can be paid out")
+	ErrPayoutAlreadyRecorded    = errors.New("payout transaction already recorded for another withdrawal")
+)
+
+// WithdrawalTerms control when lenders can take capital out of the pools
+type WithdrawalTerms struct {
+	// NoticePeriod is how long a withdrawal waits before it can be approved
+	NoticePeriod time.Duration
+	// MaxUtilisation is the highest share of a pool that may be lent out after a withdrawal;
+	// withdrawals that would exceed it are queued until loans are repaid or capital supplied
+	MaxUtilisation float64
+}
+
+// WithdrawalTermsFromEnv reads CAPITAL_WITHDRAWAL_NOTICE_HOURS (default 24) and
+// CAPITAL_MAX_UTILISATION (default 90%)
+func WithdrawalTermsFromEnv() WithdrawalTerms {
+	notice := config.EnvFloatOrZero("CAPITAL_WITHDRAWAL_NOTICE_HOURS", 24)
+
+	maxUtilisation := config.EnvFloat("CAPITAL_MAX_UTILISATION", 0.90)
+	if maxUtilisation > 1 {
+		maxUtilisation = 1
+	}
+
+	return WithdrawalTerms{
+		NoticePeriod:   time.Duration(notice * float64(time.Hour)),
+		MaxUtilisation: maxUtilisation,
+	}
+}
+
+// WithdrawalColumns is the column list scanned by ScanWithdrawal
+const WithdrawalColumns = `
+	id, user_id, token, amount, wallet_address, status, available_at, shares, share_price,
+	approved_at, payout_tx_hash, paid_at, created_at, updated_at
+`
+
+// ScanWithdrawal scans a row selected with WithdrawalColumns
+func ScanWithdrawal(row rowScanner) (models.CapitalWithdrawal, error) {
+	var w models.CapitalWithdrawal
+	err := row.Scan(
+		&w.ID,
+		&w.UserID,
+		&w.Token,
+		&w.Amount,
+		&w.WalletAddress,
+		&w.Status,
+		&w.AvailableAt,
+		&w.Shares,
+		&w.SharePrice,
+		&w.ApprovedAt,
+		&w.PayoutTxHash,
+		&w.PaidAt,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+	return w, err
+}
+
+// WithdrawalInput is a withdrawal requested by a lender
+type WithdrawalInput struct {
+	UserID        int
+	Token         string
+	Amount        float64
+	WalletAddress string
+	// Status is pending, or queued if the pool lacks the liquidity to pay it now
+	Status      string
+	AvailableAt time.Time
+}
+
+// CreateWithdrawal stores a withdrawal request. The amount, together with the lender's other
+// open withdrawals of the token, must not exceed the current value of their pool position.
+func CreateWithdrawal(tx *sql.Tx, in WithdrawalInput) (models.CapitalWithdrawal, error) {
+	var value float64
+	err := tx.QueryRow(`
+		SELECT pp.shares * `+sharePriceSQL+`
+		FROM pool_positions pp
+		JOIN lending_pools p ON p.token = pp.token
+		WHERE pp.user_id = $1 AND pp.token = $2
+		FOR UPDATE OF pp
+	`, in.UserID, in.Token).Scan(&value)
+	if err == sql.ErrNoRows {
+		return models.CapitalWithdrawal{}, ErrInsufficientPosition
+	}
+	if err != nil {
+		return models.CapitalWithdrawal{}, fmt.Errorf("valuing pool position: %w", err)
+	}
+
+	var reserved float64
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0)
+		FROM capital_withdrawals
+		WHERE user_id = $1 AND token = $2 AND status IN ($3, $4)
+	`, in.UserID, in.Token, models.WithdrawalStatusPending, models.WithdrawalStatusQueued).Scan(&reserved)
+	if err != nil {
+		return models.CapitalWithdrawal{}, fmt.Errorf("summing open withdrawals: %w", err)
+	}
+
+	if in.Amount > value-reserved {
+		return models.CapitalWithdrawal{}, ErrInsufficientPosition
+	}
+
+	return ScanWithdrawal(tx.QueryRow(`
+		INSERT INTO capital_withdrawals (user_id, token, amount, wallet_address, status, available_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+WithdrawalColumns,
+		in.UserID, in.Token, in.Amount, in.WalletAddress, in.Status, in.AvailableAt,
+	))
+}
+
+// ApproveWithdrawal burns the shares of a pending or queued withdrawal at the current share
+// price and marks it ready to be paid out. The caller checks the pool's liquidity. A withdrawal
+// of a whole position is reduced to the value of its shares if rounding left it over.
+func ApproveWithdrawal(tx *sql.Tx, withdrawalID int) (models.CapitalWithdrawal, error) {
+	w, err := lockWithdrawal(tx, withdrawalID)
+	if err != nil {
+		return w, err
+	}
+
+	if w.Status != models.WithdrawalStatusPending && w.Status != models.WithdrawalStatusQueued {
+		return w, fmt.Errorf("withdrawal %d is %s", w.ID, w.Status)
+	}
+
+	assets, shares, sharePrice, err := BurnPoolShares(tx, w.ID, w.UserID, w.Token, w.Amount)
+	if err != nil {
+		return w, err
+	}
+
+	return ScanWithdrawal(tx.QueryRow(`
+		UPDATE capital_withdrawals
+		SET status = $1, amount = $2, shares = $3, share_price = $4, approved_at = NOW(), updated_at = NOW()
+		WHERE id = $5
+		RETURNING `+WithdrawalColumns,
+		models.WithdrawalStatusReady, assets, shares, sharePrice, w.ID,
+	))
+}
+
+// QueueWithdrawal marks a pending withdrawal whose notice period has ended as queued for liquidity
+func QueueWithdrawal(tx *sql.Tx, withdrawalID int) error {
+	_, err := tx.Exec(
+		"UPDATE capital_withdrawals SET status = $1, updated_at = NOW() WHERE id = $2 AND status = $3",
+		models.WithdrawalStatusQueued, withdrawalID, models.WithdrawalStatusPending,
+	)
+	return err
+}
+
+// PayWithdrawal records the transaction that paid out a ready withdrawal
+func PayWithdrawal(tx *sql.Tx, withdrawalID int, txHash string, paidBy int) (models.CapitalWithdrawal, error) {
+	w, err := lockWithdrawal(tx, withdrawalID)
+	if err != nil {
+		return w, err
+	}
+
+	if w.Status != models.WithdrawalStatusReady {
+		return w, ErrWithdrawalNotReady
+	}
+
+	var used bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM capital_withdrawals WHERE payout_tx_hash = $1)", txHash).Scan(&used)
+	if err != nil {
+		return w, err
+	}
+	if used {
+		return w, ErrPayoutAlreadyRecorded
+	}
+
+	return ScanWithdrawal(tx.QueryRow(`
+		UPDATE capital_withdrawals
+		SET status = $1, payout_tx_hash = $2, paid_by = $3, paid_at = NOW(), updated_at = NOW()
+		WHERE id = $4
+		RETURNING `+WithdrawalColumns,
+		models.WithdrawalStatusPaid, txHash, paidBy, w.ID,
+	))
+}
+
+// CancelWithdrawal cancels a withdrawal that has not burned its shares yet
+func CancelWithdrawal(tx *sql.Tx, withdrawalID int) (models.CapitalWithdrawal, error) {
+	w, err := lockWithdrawal(tx, withdrawalID)
+	if err != nil {
+		return w, err
+	}
+
+	if w.Status != models.WithdrawalStatusPending && w.Status != models.WithdrawalStatusQueued {
+		return w, ErrWithdrawalNotCancellable
+	}
+
+	return ScanWithdrawal(tx.QueryRow(`
+		UPDATE capital_withdrawals
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2
+		RETURNING `+WithdrawalColumns,
+		models.WithdrawalStatusCancelled, w.ID,
+	))
+}
+
+func lockWithdrawal(tx *sql.Tx, withdrawalID int) (models.CapitalWithdrawal, error) {
+	w, err := ScanWithdrawal(tx.QueryRow(
+		"SELECT "+WithdrawalColumns+" FROM capital_withdrawals WHERE id = $1 FOR UPDATE", withdrawalID,
+	))
+	if err == sql.ErrNoRows {
+		return w, ErrWithdrawalNotFound
+	}
+	return w, err
+}
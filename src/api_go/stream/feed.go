@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+
+	"paperhands/api/config"
+	"paperhands/api/models"
+	"paperhands/api/risk"
+)
+
+// PriceFunc returns the latest BTC/AUD price and whether it is stale
+type PriceFunc func() (price float64, stale bool, err error)
+
+// Feed is the single background fetcher behind the streams. Each interval it reads
+// the BTC/AUD price and the state of every open loan, and publishes whatever changed,
+// so connected clients never cause upstream or database calls of their own.
+type Feed struct {
+	DB         *sql.DB
+	Hub        *Hub
+	Price      PriceFunc
+	Thresholds risk.Thresholds
+	Interval   time.Duration
+
+	lastPoll time.Time
+}
+
+// NewFeedFromEnv creates a feed polling every STREAM_INTERVAL_SECONDS (default 5).
+// Prices are read from the price refresher, so this does not increase upstream calls.
+func NewFeedFromEnv(db *sql.DB, hub *Hub, price PriceFunc) *Feed {
+	return &Feed{
+		DB:         db,
+		Hub:        hub,
+		Price:      price,
+		Thresholds: risk.ThresholdsFromEnv(),
+		Interval:   config.EnvSeconds("STREAM_INTERVAL_SECONDS", 5*time.Second),
+	}
+}
+
+// Run publishes updates until ctx is cancelled, then disconnects every client
+func (f *Feed) Run(ctx context.Context) {
+	log.Printf("Stream feed started (interval %s)", f.Interval)
+	defer f.Hub.Close()
+
+	ticker := time.NewTicker(f.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.Poll(ctx, time.Now()); err != nil {
+			log.Printf("Stream feed poll failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Stream feed stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll publishes the current price if it changed, then every loan whose status,
+// debt or LVR changed since it was last published
+func (f *Feed) Poll(ctx context.Context, now time.Time) error {
+	price, stale, err := f.Price()
+	if err != nil {
+		return fmt.Errorf("fetching BTC price: %w", err)
+	}
+
+	if last, ok := f.Hub.LastPrice(); !ok || last.Price != price || last.Stale != stale {
+		f.Hub.PublishPrice(PriceTick{
+			Pair:      "BTC/AUD",
+			Price:     price,
+			Currency:  "AUD",
+			Stale:     stale,
+			Timestamp: now,
+		})
+	}
+
+	updates, err := f.loanUpdates(ctx, price, now)
+	if err != nil {
+		return err
+	}
+
+	previous := map[int]LoanUpdate{}
+	for _, update := range f.Hub.Loans(0) {
+		previous[update.LoanID] = update
+	}
+
+	for _, update := range updates {
+		if last, ok := previous[update.LoanID]; ok && !changed(last, update) {
+			continue
+		}
+		f.Hub.PublishLoan(update)
+	}
+
+	return nil
+}
+
+// loanUpdates returns the state of every open loan, plus loans closed since the last poll
+// so their final status is published
+func (f *Feed) loanUpdates(ctx context.Context, price float64, now time.Time) ([]LoanUpdate, error) {
+	since := f.lastPoll
+	if since.IsZero() {
+		since = now
+	}
+
+	rows, err := f.DB.QueryContext(ctx, `
+		SELECT id, customer_id, status,
+			COALESCE(principal_outstanding_aud, amount_aud)
+				+ COALESCE(accrued_interest_aud, 0) - COALESCE(interest_paid_aud, 0),
+			collateral_btc
+		FROM loans
+		WHERE status <> ALL($1) OR updated_at >= $2
+		ORDER BY id
+	`, pq.Array(models.FinalLoanStatuses()), since.Add(-f.Interval))
+	if err != nil {
+		return nil, fmt.Errorf("querying loans: %w", err)
+	}
+	defer rows.Close()
+
+	monitored := map[string]bool{}
+	for _, status := range risk.MonitoredStatuses {
+		monitored[status] = true
+	}
+
+	var updates []LoanUpdate
+	for rows.Next() {
+		var update LoanUpdate
+		var collateralBTC float64
+		if err := rows.Scan(&update.LoanID, &update.CustomerID, &update.Status, &update.DebtAUD, &collateralBTC); err != nil {
+			return nil, err
+		}
+
+		update.DebtAUD = math.Round(update.DebtAUD*100) / 100
+		update.BTCPrice = price
+		update.Timestamp = now
+
+		if monitored[update.Status] && collateralBTC > 0 {
+			lvr := math.Round(risk.LVR(update.DebtAUD, collateralBTC, price)*1e6) / 1e6
+			update.LVR = &lvr
+			update.RiskLevel = f.Thresholds.Classify(lvr)
+		}
+
+		updates = append(updates, update)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	f.lastPoll = now
+	return updates, nil
+}
+
+// changed reports whether an update differs from the last one published for the loan
+func changed(last, next LoanUpdate) bool {
+	if last.Status != next.Status || last.DebtAUD != next.DebtAUD || last.RiskLevel != next.RiskLevel {
+		return true
+	}
+	if (last.LVR == nil) != (next.LVR == nil) {
+		return true
+	}
+	return last.LVR != nil && *last.LVR != *next.LVR
+}
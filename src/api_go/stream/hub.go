@@ -0,0 +1,244 @@
+package stream
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event names sent to clients
+const (
+	EventPrice     = "price"
+	EventLoan      = "loan"
+	EventHeartbeat = "heartbeat"
+)
+
+// subscriberBuffer is how many events a slow client may fall behind before events are dropped
+const subscriberBuffer = 32
+
+// PriceTick is a BTC/AUD price pushed to /stream/price
+type PriceTick struct {
+	Pair      string    `json:"pair"`
+	Price     float64   `json:"price"`
+	Currency  string    `json:"currency"`
+	Stale     bool      `json:"stale,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LoanUpdate is the status and LVR of a loan pushed to /stream/loans
+type LoanUpdate struct {
+	LoanID     int     `json:"loanId"`
+	CustomerID int     `json:"customerId"`
+	Status     string  `json:"status"`
+	DebtAUD    float64 `json:"debtAud"`
+	// LVR and RiskLevel are only set for loans with collateral at risk
+	LVR       *float64  `json:"lvr,omitempty"`
+	RiskLevel string    `json:"riskLevel,omitempty"`
+	BTCPrice  float64   `json:"btcPrice"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Event is a named message delivered to subscribers
+type Event struct {
+	Name string
+	Data interface{}
+	// CustomerID scopes loan events to their borrower; 0 for public events
+	CustomerID int
+}
+
+// Subscriber receives events accepted by its filter until it unsubscribes
+type Subscriber struct {
+	Events <-chan Event
+
+	events chan Event
+	filter func(Event) bool
+	// customerID is set for subscribers to a single customer's loan events
+	customerID int
+}
+
+// Hub fans events out to subscribers and remembers the latest price and loan
+// states so new clients start with a snapshot
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+	// customers holds the subscribers to each customer's loan events, so a loan event
+	// is only offered to its borrower's subscribers
+	customers map[int]map[*Subscriber]struct{}
+	lastPrice *PriceTick
+	loans     map[int]LoanUpdate
+	closed    bool
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: map[*Subscriber]struct{}{},
+		customers:   map[int]map[*Subscriber]struct{}{},
+		loans:       map[int]LoanUpdate{},
+	}
+}
+
+// Subscribe registers a subscriber for events accepted by filter (all events if nil).
+// The subscriber's channel is closed when it unsubscribes or the hub closes.
+func (h *Hub) Subscribe(filter func(Event) bool) *Subscriber {
+	events := make(chan Event, subscriberBuffer)
+	sub := &Subscriber{Events: events, events: events, filter: filter}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(events)
+		return sub
+	}
+
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// SubscribeCustomer registers a subscriber for the loan events of customerID only
+func (h *Hub) SubscribeCustomer(customerID int) *Subscriber {
+	events := make(chan Event, subscriberBuffer)
+	sub := &Subscriber{Events: events, events: events, customerID: customerID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(events)
+		return sub
+	}
+
+	subs, ok := h.customers[customerID]
+	if !ok {
+		subs = map[*Subscriber]struct{}{}
+		h.customers[customerID] = subs
+	}
+	subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes a subscriber and closes its channel. A customer's entry is removed
+// with its last subscriber so disconnected borrowers do not accumulate.
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+		return
+	}
+
+	subs := h.customers[sub.customerID]
+	if _, ok := subs[sub]; ok {
+		delete(subs, sub)
+		close(sub.events)
+		if len(subs) == 0 {
+			delete(h.customers, sub.customerID)
+		}
+	}
+}
+
+// Subscribers returns the number of connected subscribers
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	n := len(h.subscribers)
+	for _, subs := range h.customers {
+		n += len(subs)
+	}
+	return n
+}
+
+// Close disconnects every subscriber; later subscriptions are closed immediately
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		close(sub.events)
+	}
+	for _, subs := range h.customers {
+		for sub := range subs {
+			close(sub.events)
+		}
+	}
+	h.subscribers = map[*Subscriber]struct{}{}
+	h.customers = map[int]map[*Subscriber]struct{}{}
+	h.closed = true
+}
+
+// Publish delivers an event to every interested subscriber without blocking.
+// Subscribers whose buffer is full miss the event.
+func (h *Hub) Publish(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		deliver(sub, event)
+	}
+
+	if event.Name == EventLoan && event.CustomerID != 0 {
+		for sub := range h.customers[event.CustomerID] {
+			deliver(sub, event)
+		}
+	}
+}
+
+// deliver sends event to sub unless its buffer is full
+func deliver(sub *Subscriber, event Event) {
+	select {
+	case sub.events <- event:
+	default:
+	}
+}
+
+// PublishPrice records and publishes a price tick
+func (h *Hub) PublishPrice(tick PriceTick) {
+	h.mu.Lock()
+	h.lastPrice = &tick
+	h.mu.Unlock()
+
+	h.Publish(Event{Name: EventPrice, Data: tick})
+}
+
+// PublishLoan records and publishes a loan update
+func (h *Hub) PublishLoan(update LoanUpdate) {
+	h.mu.Lock()
+	h.loans[update.LoanID] = update
+	h.mu.Unlock()
+
+	h.Publish(Event{Name: EventLoan, Data: update, CustomerID: update.CustomerID})
+}
+
+// LastPrice returns the latest price tick, if any
+func (h *Hub) LastPrice() (PriceTick, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.lastPrice == nil {
+		return PriceTick{}, false
+	}
+	return *h.lastPrice, true
+}
+
+// Loans returns the latest update of every loan of customerID (every loan if 0), by loan ID
+func (h *Hub) Loans(customerID int) []LoanUpdate {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var updates []LoanUpdate
+	for _, update := range h.loans {
+		if customerID == 0 || update.CustomerID == customerID {
+			updates = append(updates, update)
+		}
+	}
+
+	sort.Slice(updates, func(i, j int) bool { return updates[i].LoanID < updates[j].LoanID })
+	return updates
+}
@@ -0,0 +1,52 @@
+package stream
+
+import "testing"
+
+func TestCustomerSubscribers(t *testing.T) {
+	h := NewHub()
+	staff := h.Subscribe(func(e Event) bool { return e.Name == EventLoan })
+	alice := h.SubscribeCustomer(1)
+	bob := h.SubscribeCustomer(2)
+
+	h.PublishLoan(LoanUpdate{LoanID: 10, CustomerID: 1})
+
+	if got := len(staff.Events); got != 1 {
+		t.Errorf("staff received %d events, want 1", got)
+	}
+	if got := len(alice.Events); got != 1 {
+		t.Errorf("borrower received %d events of their loan, want 1", got)
+	}
+	if got := len(bob.Events); got != 0 {
+		t.Errorf("another borrower received %d events, want 0", got)
+	}
+
+	h.PublishPrice(PriceTick{Price: 100_000})
+	if got := len(alice.Events); got != 1 {
+		t.Errorf("borrower received %d events after a price tick, want 1", got)
+	}
+}
+
+func TestUnsubscribeRemovesEmptyCustomers(t *testing.T) {
+	h := NewHub()
+	first := h.SubscribeCustomer(1)
+	second := h.SubscribeCustomer(1)
+
+	h.Unsubscribe(first)
+	if _, ok := h.customers[1]; !ok {
+		t.Fatal("customer removed while a subscriber is still connected")
+	}
+
+	h.Unsubscribe(second)
+	if _, ok := h.customers[1]; ok {
+		t.Error("customer entry left behind after its last subscriber unsubscribed")
+	}
+	if n := h.Subscribers(); n != 0 {
+		t.Errorf("Subscribers() = %d, want 0", n)
+	}
+
+	// Unsubscribing twice does not close the channel again
+	h.Unsubscribe(second)
+	if _, ok := <-second.Events; ok {
+		t.Error("channel open after unsubscribing")
+	}
+}
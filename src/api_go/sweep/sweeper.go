@@ -0,0 +1,328 @@
+package sweep
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/evm"
+	"paperhands/api/models"
+	"paperhands/api/services"
+)
+
+// Sweeper moves stablecoins from funded deposit addresses to the treasury. The server only
+// holds the ETH xpub, so like release PSBTs the sweep transfers are built unsigned for an
+// offline signer, together with the ether each address needs topped up to pay for gas.
+// Once a sweep transfer is seen on chain the address is marked swept and its owner rotated
+// to a fresh address.
+type Sweeper struct {
+	DB               *sql.DB
+	Backend          evm.TxBackend
+	Tokens           []evm.Token
+	TreasuryAddress  string
+	Interval         time.Duration
+	MinConfirmations uint64
+	// GasLimit is the gas allowed for each ERC-20 transfer
+	GasLimit uint64
+	// PriorityFee is the tip per gas in wei; the max fee is twice the gas price plus the tip
+	PriorityFee *big.Int
+}
+
+type fundedAddress struct {
+	ID             int
+	UserID         int
+	Token          string
+	Address        string
+	DerivationPath string
+}
+
+// NewSweeperFromEnv creates a sweeper paying SWEEP_TREASURY_ADDRESS every
+// SWEEP_INTERVAL_SECONDS (default 300). Transfers use SWEEP_GAS_LIMIT (default 100000) and a
+// SWEEP_PRIORITY_FEE_GWEI tip (default 1), and are settled after SWEEP_MIN_CONFIRMATIONS
+// (default 12).
+func NewSweeperFromEnv(db *sql.DB, backend evm.TxBackend) *Sweeper {
+	priorityFeeGwei := config.EnvFloatOrZero("SWEEP_PRIORITY_FEE_GWEI", 1)
+	priorityFee, _ := new(big.Float).Mul(big.NewFloat(priorityFeeGwei), big.NewFloat(1e9)).Int(nil)
+
+	return &Sweeper{
+		DB:               db,
+		Backend:          backend,
+		Tokens:           evm.TokensFromEnv(),
+		TreasuryAddress:  strings.ToLower(os.Getenv("SWEEP_TREASURY_ADDRESS")),
+		Interval:         config.EnvSeconds("SWEEP_INTERVAL_SECONDS", 300*time.Second),
+		MinConfirmations: config.EnvUint("SWEEP_MIN_CONFIRMATIONS", 12),
+		GasLimit:         config.EnvUint("SWEEP_GAS_LIMIT", 100000),
+		PriorityFee:      priorityFee,
+	}
+}
+
+// Run sweeps until ctx is cancelled. It returns immediately if no treasury or token
+// contract is configured.
+func (s *Sweeper) Run(ctx context.Context) {
+	if s.TreasuryAddress == "" || len(s.Tokens) == 0 {
+		log.Println("Deposit sweeper disabled: SWEEP_TREASURY_ADDRESS or TOKEN_<SYMBOL>_ADDRESS not configured")
+		return
+	}
+
+	log.Printf("Deposit sweeper started (interval %s, treasury %s)", s.Interval, s.TreasuryAddress)
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Poll(ctx); err != nil {
+			log.Printf("Deposit sweeper poll failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Deposit sweeper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll settles sweeps that reached the chain, then builds sweeps for funded addresses
+func (s *Sweeper) Poll(ctx context.Context) error {
+	latest, err := s.Backend.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching latest block: %w", err)
+	}
+
+	if err := s.settleSweeps(ctx, latest); err != nil {
+		return err
+	}
+
+	addresses, err := s.fundedAddresses(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addresses {
+		if err := s.buildSweep(ctx, addr, latest); err != nil {
+			log.Printf("Error building sweep for deposit address %d: %v", addr.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// fundedAddresses returns the deposit addresses with a confirmed capital supply newer than
+// their last sweep and no sweep awaiting signature
+func (s *Sweeper) fundedAddresses(ctx context.Context) ([]fundedAddress, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT d.id, d.user_id, d.token, d.address, d.derivation_path
+		FROM deposit_addresses d
+		WHERE d.derivation_index IS NOT NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM deposit_sweeps w
+				WHERE w.deposit_address_id = d.id AND w.status = $1
+			)
+			AND EXISTS (
+				SELECT 1 FROM capital_supplies c
+				WHERE c.deposit_address_id = d.id AND c.status = $2
+					AND c.block_number > COALESCE((
+						SELECT MAX(w.from_block) FROM deposit_sweeps w
+						WHERE w.deposit_address_id = d.id AND w.status = $3
+					), -1)
+			)
+		ORDER BY d.id
+	`, models.SweepStatusAwaitingSignature, models.CapitalStatusConfirmed, models.SweepStatusSwept)
+	if err != nil {
+		return nil, fmt.Errorf("querying funded deposit addresses: %w", err)
+	}
+	defer rows.Close()
+
+	var addresses []fundedAddress
+	for rows.Next() {
+		var addr fundedAddress
+		if err := rows.Scan(&addr.ID, &addr.UserID, &addr.Token, &addr.Address, &addr.DerivationPath); err != nil {
+			return nil, fmt.Errorf("scanning deposit address: %w", err)
+		}
+		addresses = append(addresses, addr)
+	}
+
+	return addresses, rows.Err()
+}
+
+// buildSweep builds and stores the unsigned transfer of an address's whole token balance to
+// the treasury, with the ether top-up it needs to pay for gas at the current fees
+func (s *Sweeper) buildSweep(ctx context.Context, addr fundedAddress, latest uint64) error {
+	token, ok := s.token(addr.Token)
+	if !ok {
+		return fmt.Errorf("no contract configured for %s", addr.Token)
+	}
+
+	balance, err := s.Backend.TokenBalance(ctx, token.Contract, addr.Address)
+	if err != nil {
+		return fmt.Errorf("fetching %s balance: %w", token.Symbol, err)
+	}
+	if balance.Sign() == 0 {
+		return nil
+	}
+
+	chainID, err := s.Backend.ChainID(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching chain ID: %w", err)
+	}
+
+	nonce, err := s.Backend.PendingNonce(ctx, addr.Address)
+	if err != nil {
+		return fmt.Errorf("fetching nonce: %w", err)
+	}
+
+	gasPrice, err := s.Backend.GasPrice(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching gas price: %w", err)
+	}
+
+	// Twice the current price leaves room for the base fee to rise before the sweep is signed
+	maxFee := new(big.Int).Add(new(big.Int).Mul(gasPrice, big.NewInt(2)), s.PriorityFee)
+
+	ethBalance, err := s.Backend.Balance(ctx, addr.Address)
+	if err != nil {
+		return fmt.Errorf("fetching ether balance: %w", err)
+	}
+
+	topUp := new(big.Int).Mul(maxFee, new(big.Int).SetUint64(s.GasLimit))
+	topUp.Sub(topUp, ethBalance)
+	if topUp.Sign() < 0 {
+		topUp.SetInt64(0)
+	}
+
+	unsigned, err := json.Marshal(evm.TransferTx{
+		ChainID:              chainID,
+		Token:                token.Contract,
+		From:                 addr.Address,
+		To:                   s.TreasuryAddress,
+		Value:                balance,
+		Nonce:                nonce,
+		Gas:                  s.GasLimit,
+		MaxFeePerGas:         maxFee,
+		MaxPriorityFeePerGas: s.PriorityFee,
+		DerivationPath:       addr.DerivationPath,
+	}.Unsigned())
+	if err != nil {
+		return err
+	}
+
+	sweep, err := services.CreateSweep(s.DB, services.SweepInput{
+		DepositAddressID: addr.ID,
+		Token:            token.Symbol,
+		Amount:           token.Amount(balance),
+		AmountBaseUnits:  balance.String(),
+		TreasuryAddress:  s.TreasuryAddress,
+		UnsignedTx:       string(unsigned),
+		GasTopUpWei:      topUp.String(),
+		FromBlock:        int64(latest),
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Built sweep %d of %g %s from %s (gas top-up %s wei)", sweep.ID, sweep.Amount, sweep.Token, addr.Address, topUp)
+	return nil
+}
+
+// settleSweeps looks for the transfer of each sweep awaiting signature and settles it once it
+// has MinConfirmations. Any transfer of the token from the deposit address to the treasury
+// counts, so a sweep signed with different fees is still recognised.
+func (s *Sweeper) settleSweeps(ctx context.Context, latest uint64) error {
+	rows, err := s.DB.QueryContext(ctx,
+		"SELECT "+services.SweepColumns+" FROM "+services.SweepTables+" WHERE s.status = $1 ORDER BY s.id",
+		models.SweepStatusAwaitingSignature,
+	)
+	if err != nil {
+		return fmt.Errorf("querying sweeps awaiting signature: %w", err)
+	}
+
+	var sweeps []models.DepositSweep
+	for rows.Next() {
+		sweep, err := services.ScanSweep(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning sweep: %w", err)
+		}
+		sweeps = append(sweeps, sweep)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, sweep := range sweeps {
+		if err := s.settleSweep(ctx, sweep, latest); err != nil {
+			log.Printf("Error settling sweep %d: %v", sweep.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Sweeper) settleSweep(ctx context.Context, sweep models.DepositSweep, latest uint64) error {
+	token, ok := s.token(sweep.Token)
+	if !ok {
+		return fmt.Errorf("no contract configured for %s", sweep.Token)
+	}
+
+	logs, err := s.Backend.Logs(ctx, evm.FilterQuery{
+		FromBlock: uint64(sweep.FromBlock),
+		ToBlock:   latest,
+		Addresses: []string{token.Contract},
+		Topics: [][]string{
+			{evm.TransferTopic},
+			{evm.AddressTopic(sweep.Address)},
+			{evm.AddressTopic(sweep.TreasuryAddress)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("fetching sweep transfers: %w", err)
+	}
+
+	for _, l := range logs {
+		if l.Removed || evm.Confirmations(l.BlockNumber, latest) < s.MinConfirmations {
+			continue
+		}
+
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		settled, rotated, err := services.SettleSweep(tx, sweep.ID, l.TxHash, int64(l.BlockNumber))
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		log.Printf("Sweep %d settled in %s; deposit address %s marked swept", settled.ID, l.TxHash, settled.Address)
+		if rotated != nil {
+			log.Printf("Rotated user %d to deposit address %s (%s)", rotated.UserID, rotated.Address, rotated.DerivationPath.String)
+		}
+		return nil
+	}
+
+	return nil
+}
+
+func (s *Sweeper) token(symbol string) (evm.Token, bool) {
+	for _, token := range s.Tokens {
+		if token.Symbol == symbol {
+			return token, true
+		}
+	}
+	return evm.Token{}, false
+}
@@ -13,6 +13,7 @@ import (
 type JWTClaims struct {
 	UserID int    `json:"user_id"`
 	Email  string `json:"email"`
+	Role   string `json:"role"`
 	jwt.RegisteredClaims
 }
 
@@ -23,8 +24,11 @@ var (
 	ErrMissingSecret = errors.New("JWT secret not configured")
 )
 
+// StreamAudience is the audience of stream tokens, which only authenticate event streams
+const StreamAudience = "stream"
+
 // GenerateToken creates a new JWT token for a user
-func GenerateToken(userID int, email string) (string, error) {
+func GenerateToken(userID int, email, role string) (string, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		return "", ErrMissingSecret
@@ -42,6 +46,7 @@ func GenerateToken(userID int, email string) (string, error) {
 	claims := JWTClaims{
 		UserID: userID,
 		Email:  email,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiryHours) * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -58,8 +63,58 @@ func GenerateToken(userID int, email string) (string, error) {
 	return token.SignedString([]byte(secret))
 }
 
-// ValidateToken parses and validates a JWT token
+// GenerateStreamToken creates a short-lived token that is only accepted by event streams.
+// Browsers' EventSource cannot set headers, so it is passed in the URL, where it may be
+// logged; it expires after ttl and cannot be used as a bearer token.
+func GenerateStreamToken(userID int, email, role string, ttl time.Duration) (string, time.Time, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return "", time.Time{}, ErrMissingSecret
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := JWTClaims{
+		UserID: userID,
+		Email:  email,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "paperhands-api",
+			Subject:   strconv.Itoa(userID),
+			Audience:  jwt.ClaimStrings{StreamAudience},
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	return token, expiresAt, err
+}
+
+// ValidateToken parses and validates a JWT token. Stream tokens are rejected.
 func ValidateToken(tokenString string) (*JWTClaims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, aud := range claims.Audience {
+		if aud == StreamAudience {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	return claims, nil
+}
+
+// ValidateStreamToken parses and validates a token from GenerateStreamToken
+func ValidateStreamToken(tokenString string) (*JWTClaims, error) {
+	return parseToken(tokenString, jwt.WithAudience(StreamAudience))
+}
+
+// parseToken parses and validates a JWT token signed with JWT_SECRET
+func parseToken(tokenString string, opts ...jwt.ParserOption) (*JWTClaims, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		return nil, ErrMissingSecret
@@ -72,7 +127,7 @@ func ValidateToken(tokenString string) (*JWTClaims, error) {
 			return nil, ErrInvalidToken
 		}
 		return []byte(secret), nil
-	})
+	}, opts...)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
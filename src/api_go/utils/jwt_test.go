@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamTokensAreSinglePurpose(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	login, err := GenerateToken(7, "alice@example.com", "borrower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, _, err := GenerateStreamToken(7, "alice@example.com", "borrower", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := GenerateStreamToken(7, "alice@example.com", "borrower", -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims, err := ValidateStreamToken(stream); err != nil || claims.UserID != 7 {
+		t.Errorf("ValidateStreamToken(stream token) = %v, %v; want user 7", claims, err)
+	}
+	if _, err := ValidateToken(stream); err != ErrInvalidToken {
+		t.Errorf("ValidateToken(stream token) error = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := ValidateStreamToken(login); err != ErrInvalidToken {
+		t.Errorf("ValidateStreamToken(login token) error = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := ValidateStreamToken(expired); err != ErrExpiredToken {
+		t.Errorf("ValidateStreamToken(expired token) error = %v, want %v", err, ErrExpiredToken)
+	}
+	if _, err := ValidateToken(login); err != nil {
+		t.Errorf("ValidateToken(login token) error = %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package wallet
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// ErrInvalidAddress is returned for addresses that are not valid mainnet Bitcoin addresses
+var ErrInvalidAddress = errors.New("invalid bitcoin address")
+
+// ValidateAddress checks that address is a mainnet Bitcoin address we can pay to
+func ValidateAddress(address string) error {
+	decoded, err := btcutil.DecodeAddress(address, &chaincfg.MainNetParams)
+	if err != nil || !decoded.IsForNet(&chaincfg.MainNetParams) {
+		return ErrInvalidAddress
+	}
+	return nil
+}
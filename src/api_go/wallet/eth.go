@@ -0,0 +1,145 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"golang.org/x/crypto/sha3"
+)
+
+// Error definitions
+var (
+	ErrEthNotConfigured = errors.New("ETH_XPUB or SEED not configured")
+	ErrInvalidEthXPUB   = errors.New("invalid ETH_XPUB")
+	ErrInvalidEthIndex  = errors.New("invalid ETH derivation index")
+)
+
+// EthAddress is a stablecoin deposit address derived at m/44'/60'/0'/0/{index}
+type EthAddress struct {
+	Address string
+	Index   int
+	Path    string
+}
+
+// EthAccountKey returns the BIP-44 Ethereum account key (m/44'/60'/0').
+// Like AccountKey it prefers an extended public key (ETH_XPUB) so the server never
+// holds private keys, and falls back to deriving the account from SEED.
+func EthAccountKey() (*hdkeychain.ExtendedKey, error) {
+	xpub := os.Getenv("ETH_XPUB")
+	if xpub != "" {
+		accountKey, err := hdkeychain.NewKeyFromString(xpub)
+		if err != nil {
+			log.Printf("Error parsing ETH_XPUB: %v", err)
+			return nil, ErrInvalidEthXPUB
+		}
+
+		if accountKey.IsPrivate() {
+			log.Println("Warning: ETH_XPUB contains private key, consider using public key only for security")
+		}
+
+		return accountKey, nil
+	}
+
+	masterKey, err := masterKeyFromSeed()
+	if errors.Is(err, ErrNotConfigured) {
+		return nil, ErrEthNotConfigured
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive to account level: m/44'/60'/0'
+	// 44' = purpose (BIP-44)
+	// 60' = coin type (Ethereum)
+	// 0' = account
+	hardenedPath := []uint32{
+		44 + hdkeychain.HardenedKeyStart,
+		60 + hdkeychain.HardenedKeyStart,
+		0 + hdkeychain.HardenedKeyStart,
+	}
+
+	accountKey := masterKey
+	for _, index := range hardenedPath {
+		accountKey, err = accountKey.Derive(index)
+		if err != nil {
+			return nil, fmt.Errorf("deriving hardened key at index %d: %w", index, err)
+		}
+	}
+
+	return accountKey, nil
+}
+
+// DeriveEthAddress derives the EIP-55 checksummed address at m/44'/60'/0'/0/{index}
+func DeriveEthAddress(index int) (*EthAddress, error) {
+	if index < 0 || index >= hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidEthIndex, index)
+	}
+
+	accountKey, err := EthAccountKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive non-hardened path: 0 (external chain) / {index}
+	key := accountKey
+	for _, i := range []uint32{0, uint32(index)} {
+		key, err = key.Derive(i)
+		if err != nil {
+			return nil, fmt.Errorf("deriving key at index %d: %w", i, err)
+		}
+	}
+
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %w", err)
+	}
+
+	// The address is the last 20 bytes of the Keccak-256 hash of the uncompressed
+	// public key without its 0x04 prefix
+	hash := keccak256(pubKey.SerializeUncompressed()[1:])
+
+	return &EthAddress{
+		Address: ChecksumEthAddress(hash[12:]),
+		Index:   index,
+		Path:    FormatEthDerivationPath(index),
+	}, nil
+}
+
+// FormatEthDerivationPath returns the full BIP-44 path for a deposit address index
+func FormatEthDerivationPath(index int) string {
+	return fmt.Sprintf("m/44'/60'/0'/0/%d", index)
+}
+
+// ChecksumEthAddress encodes a 20-byte address with the EIP-55 mixed-case checksum:
+// each hex letter is upper-cased when the matching nibble of the Keccak-256 hash of
+// the lower-case hex address is 8 or more
+func ChecksumEthAddress(address []byte) string {
+	lower := hex.EncodeToString(address)
+	hash := keccak256([]byte(lower))
+
+	var b strings.Builder
+	b.WriteString("0x")
+	for i, ch := range lower {
+		nibble := hash[i/2]
+		if i%2 == 0 {
+			nibble >>= 4
+		}
+		if ch >= 'a' && nibble&0x0f >= 8 {
+			ch -= 'a' - 'A'
+		}
+		b.WriteRune(ch)
+	}
+
+	return b.String()
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// testMnemonic is the BIP-39 test mnemonic used by most wallet test vectors
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func TestChecksumEthAddress(t *testing.T) {
+	// The test cases of EIP-55
+	vectors := []string{
+		// All caps
+		"0x52908400098527886E0F7030069857D2E4169EE7",
+		"0x8617E340B3D01FA5F11F306F4090FD50E238070D",
+		// All lower
+		"0xde709f2102306220921060314715629080e2fb77",
+		"0x27b1fdb04752bbc536007a920d24acb045561c26",
+		// Normal
+		"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+		"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+		"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+		"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+	}
+
+	for _, want := range vectors {
+		address, err := hex.DecodeString(strings.ToLower(want[2:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ChecksumEthAddress(address); got != want {
+			t.Errorf("ChecksumEthAddress(%s) = %s, want %s", strings.ToLower(want), got, want)
+		}
+	}
+}
+
+func TestDeriveEthAddress(t *testing.T) {
+	// The addresses wallets such as MetaMask derive from testMnemonic at m/44'/60'/0'/0/{index}
+	vectors := []struct {
+		index int
+		want  string
+		path  string
+	}{
+		{0, "0x9858EfFD232B4033E47d90003D41EC34EcaEda94", "m/44'/60'/0'/0/0"},
+		{1, "0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0", "m/44'/60'/0'/0/1"},
+	}
+
+	t.Setenv("ETH_XPUB", "")
+	t.Setenv("SEED", testMnemonic)
+
+	account, err := EthAccountKey()
+	if err != nil {
+		t.Fatalf("EthAccountKey: %v", err)
+	}
+	xpub, err := account.Neuter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The account xpub must derive the same addresses as the seed it came from
+	for _, mode := range []struct{ name, xpub string }{{"seed", ""}, {"xpub", xpub.String()}} {
+		t.Run(mode.name, func(t *testing.T) {
+			t.Setenv("ETH_XPUB", mode.xpub)
+
+			for _, v := range vectors {
+				got, err := DeriveEthAddress(v.index)
+				if err != nil {
+					t.Fatalf("DeriveEthAddress(%d): %v", v.index, err)
+				}
+				if got.Address != v.want {
+					t.Errorf("DeriveEthAddress(%d) = %s, want %s", v.index, got.Address, v.want)
+				}
+				if got.Path != v.path {
+					t.Errorf("DeriveEthAddress(%d) path = %s, want %s", v.index, got.Path, v.path)
+				}
+			}
+		})
+	}
+}
+
+func TestDeriveEthAddressInvalidIndex(t *testing.T) {
+	t.Setenv("SEED", testMnemonic)
+	for _, index := range []int{-1, 1 << 31} {
+		if _, err := DeriveEthAddress(index); err == nil {
+			t.Errorf("DeriveEthAddress(%d) succeeded, want an error", index)
+		}
+	}
+}
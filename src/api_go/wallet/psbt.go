@@ -0,0 +1,261 @@
+package wallet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+
+	"paperhands/api/chain"
+)
+
+// Error definitions
+var (
+	ErrNoFingerprint  = errors.New("XPUB_FINGERPRINT not configured")
+	ErrInvalidPath    = errors.New("invalid loan derivation path")
+	ErrNoInputs       = errors.New("no confirmed UTXOs to spend")
+	ErrDustOutput     = errors.New("output after fees is below the dust limit")
+	ErrInvalidFeeRate = errors.New("invalid fee rate")
+	ErrPathMismatch   = errors.New("derivation path does not match deposit address")
+)
+
+// Size estimates (in vbytes) for a transaction spending BIP-86 key-path inputs
+const (
+	txOverheadVBytes  = 10.5 // version, locktime, input/output counts, segwit marker
+	taprootInputVSize = 57.5 // outpoint, sequence, empty scriptSig, 64-byte schnorr witness
+
+	// dustLimitSats is the smallest output we will create, matching Bitcoin Core's P2PKH dust limit
+	dustLimitSats = 546
+
+	// MaxFeeRate caps the fee rate (sat/vB) to guard against fat-fingered requests
+	MaxFeeRate = 1000
+)
+
+// SweepPSBT is an unsigned transaction spending a loan's collateral to a single address
+type SweepPSBT struct {
+	PSBT        string `json:"psbt"`
+	InputCount  int    `json:"inputCount"`
+	InputSats   int64  `json:"inputSats"`
+	OutputSats  int64  `json:"outputSats"`
+	FeeSats     int64  `json:"feeSats"`
+	FeeRate     int64  `json:"feeRate"`
+	VSize       int64  `json:"vsize"`
+	Destination string `json:"destination"`
+}
+
+// SweepTx is the transaction a sweep PSBT becomes once signed
+type SweepTx struct {
+	TxID   string
+	Inputs []chain.Outpoint
+}
+
+// MasterFingerprint returns the BIP-32 fingerprint of the master key the loan addresses
+// derive from. In XPUB mode it is read from XPUB_FINGERPRINT (8 hex characters, as shown
+// by most wallets); in SEED mode it is computed from the seed.
+func MasterFingerprint() (uint32, error) {
+	if env := os.Getenv("XPUB_FINGERPRINT"); env != "" {
+		raw, err := hex.DecodeString(strings.TrimPrefix(env, "0x"))
+		if err != nil || len(raw) != 4 {
+			return 0, fmt.Errorf("invalid XPUB_FINGERPRINT %q", env)
+		}
+		return binary.LittleEndian.Uint32(raw), nil
+	}
+
+	if os.Getenv("XPUB") != "" {
+		return 0, ErrNoFingerprint
+	}
+
+	masterKey, err := masterKeyFromSeed()
+	if err != nil {
+		return 0, err
+	}
+
+	pubKey, err := masterKey.ECPubKey()
+	if err != nil {
+		return 0, fmt.Errorf("getting master public key: %w", err)
+	}
+
+	return binary.LittleEndian.Uint32(btcutil.Hash160(pubKey.SerializeCompressed())[:4]), nil
+}
+
+// ParseDerivationPath parses a loan path of the form m/86'/0'/0'/{customerId}/{loanId}
+// into BIP-32 child indexes and the customer and loan IDs
+func ParseDerivationPath(path string) ([]uint32, int, int, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 6 || parts[0] != "m" || parts[1] != "86'" || parts[2] != "0'" || parts[3] != "0'" {
+		return nil, 0, 0, ErrInvalidPath
+	}
+
+	customerID, err := strconv.ParseUint(parts[4], 10, 31)
+	if err != nil {
+		return nil, 0, 0, ErrInvalidPath
+	}
+
+	loanID, err := strconv.ParseUint(parts[5], 10, 31)
+	if err != nil {
+		return nil, 0, 0, ErrInvalidPath
+	}
+
+	indexes := []uint32{
+		hdkeychain.HardenedKeyStart + 86,
+		hdkeychain.HardenedKeyStart + 0,
+		hdkeychain.HardenedKeyStart + 0,
+		uint32(customerID),
+		uint32(loanID),
+	}
+
+	return indexes, int(customerID), int(loanID), nil
+}
+
+// LoanAddressFromPath re-derives a loan's deposit key from its stored derivation path
+// and checks that it still produces the stored deposit address
+func LoanAddressFromPath(path, depositAddress string) (*LoanAddress, error) {
+	_, customerID, loanID, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	loanAddress, err := DeriveLoanAddress(customerID, loanID)
+	if err != nil {
+		return nil, err
+	}
+
+	if loanAddress.Address != depositAddress {
+		return nil, fmt.Errorf("%w: derived %s, stored %s", ErrPathMismatch, loanAddress.Address, depositAddress)
+	}
+
+	return loanAddress, nil
+}
+
+// BuildSweepPSBT builds an unsigned BIP-174 PSBT spending every confirmed UTXO of a
+// loan address to destination at feeRate sat/vB, e.g. to return collateral to a borrower
+// or sweep it to the exchange on liquidation. Each input carries the BIP-86 internal key
+// and Taproot BIP-32 derivation so an offline signer holding the seed can sign it.
+func BuildSweepPSBT(loan *LoanAddress, utxos []chain.UTXO, destination string, feeRate int64) (*SweepPSBT, error) {
+	if feeRate < 1 || feeRate > MaxFeeRate {
+		return nil, ErrInvalidFeeRate
+	}
+
+	destAddress, err := btcutil.DecodeAddress(destination, &chaincfg.MainNetParams)
+	if err != nil || !destAddress.IsForNet(&chaincfg.MainNetParams) {
+		return nil, ErrInvalidAddress
+	}
+
+	destScript, err := txscript.PayToAddrScript(destAddress)
+	if err != nil {
+		return nil, fmt.Errorf("creating output script: %w", err)
+	}
+
+	path, _, _, err := ParseDerivationPath(loan.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := MasterFingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	var outpoints []*wire.OutPoint
+	var sequences []uint32
+	var spent []chain.UTXO
+	var inputSats int64
+
+	for _, utxo := range utxos {
+		if !utxo.Confirmed {
+			continue
+		}
+
+		hash, err := chainhash.NewHashFromStr(utxo.TxID)
+		if err != nil {
+			return nil, fmt.Errorf("parsing txid %s: %w", utxo.TxID, err)
+		}
+
+		outpoints = append(outpoints, wire.NewOutPoint(hash, utxo.Vout))
+		sequences = append(sequences, wire.MaxTxInSequenceNum-2) // signal RBF so the fee can be bumped
+		spent = append(spent, utxo)
+		inputSats += utxo.Value
+	}
+
+	if len(spent) == 0 {
+		return nil, ErrNoInputs
+	}
+
+	// Output: 8-byte value, script length, script
+	outputVSize := float64(8 + wire.VarIntSerializeSize(uint64(len(destScript))) + len(destScript))
+	vsize := int64(math.Ceil(txOverheadVBytes + taprootInputVSize*float64(len(spent)) + outputVSize))
+	fee := vsize * feeRate
+
+	outputSats := inputSats - fee
+	if outputSats < dustLimitSats {
+		return nil, fmt.Errorf("%w: %d sats in, %d sats fee", ErrDustOutput, inputSats, fee)
+	}
+
+	packet, err := psbt.New(outpoints, []*wire.TxOut{wire.NewTxOut(outputSats, destScript)}, 2, 0, sequences)
+	if err != nil {
+		return nil, fmt.Errorf("creating psbt: %w", err)
+	}
+
+	for i, utxo := range spent {
+		packet.Inputs[i].WitnessUtxo = wire.NewTxOut(utxo.Value, loan.PkScript)
+		packet.Inputs[i].SighashType = txscript.SigHashDefault
+		packet.Inputs[i].TaprootInternalKey = loan.InternalKey
+		packet.Inputs[i].TaprootBip32Derivation = []*psbt.TaprootBip32Derivation{{
+			XOnlyPubKey:          loan.InternalKey,
+			MasterKeyFingerprint: fingerprint,
+			Bip32Path:            path,
+		}}
+	}
+
+	if err := packet.SanityCheck(); err != nil {
+		return nil, fmt.Errorf("invalid psbt: %w", err)
+	}
+
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		return nil, fmt.Errorf("encoding psbt: %w", err)
+	}
+
+	return &SweepPSBT{
+		PSBT:        encoded,
+		InputCount:  len(spent),
+		InputSats:   inputSats,
+		OutputSats:  outputSats,
+		FeeSats:     fee,
+		FeeRate:     feeRate,
+		VSize:       vsize,
+		Destination: destAddress.EncodeAddress(),
+	}, nil
+}
+
+// DecodeSweepPSBT returns the transaction an unsigned sweep PSBT will broadcast as. Inputs
+// are BIP-86 key-path spends whose signatures live only in the witness, so the txid of the
+// unsigned transaction is the txid of the signed one.
+func DecodeSweepPSBT(encoded string) (*SweepTx, error) {
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(encoded), true)
+	if err != nil {
+		return nil, fmt.Errorf("decoding psbt: %w", err)
+	}
+
+	sweep := &SweepTx{TxID: packet.UnsignedTx.TxHash().String()}
+	for _, in := range packet.UnsignedTx.TxIn {
+		sweep.Inputs = append(sweep.Inputs, chain.Outpoint{
+			TxID: in.PreviousOutPoint.Hash.String(),
+			Vout: in.PreviousOutPoint.Index,
+		})
+	}
+
+	return sweep, nil
+}
@@ -0,0 +1,180 @@
+package wallet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/wire"
+
+	"paperhands/api/chain"
+)
+
+// testLoanAddress derives a loan address from testMnemonic in SEED mode
+func testLoanAddress(t *testing.T, customerID, loanID int) *LoanAddress {
+	t.Helper()
+	t.Setenv("XPUB", "")
+	t.Setenv("XPUB_FINGERPRINT", "")
+	t.Setenv("SEED", testMnemonic)
+
+	loan, err := DeriveLoanAddress(customerID, loanID)
+	if err != nil {
+		t.Fatalf("DeriveLoanAddress: %v", err)
+	}
+	return loan
+}
+
+func TestDeriveLoanAddress(t *testing.T) {
+	// The first receiving address of the BIP-86 test vectors, at m/86'/0'/0'/0/0
+	loan := testLoanAddress(t, 0, 0)
+	if want := "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"; loan.Address != want {
+		t.Errorf("address = %s, want %s", loan.Address, want)
+	}
+}
+
+func TestMasterFingerprint(t *testing.T) {
+	testLoanAddress(t, 0, 0)
+	fromSeed, err := MasterFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wallets show the fingerprint of testMnemonic as 73c5da0a
+	t.Setenv("XPUB_FINGERPRINT", "73c5da0a")
+	fromEnv, err := MasterFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromSeed != fromEnv {
+		t.Errorf("fingerprint from seed = %08x, from XPUB_FINGERPRINT = %08x", fromSeed, fromEnv)
+	}
+
+	t.Setenv("XPUB_FINGERPRINT", "")
+	t.Setenv("XPUB", "xpub-set")
+	if _, err := MasterFingerprint(); !errors.Is(err, ErrNoFingerprint) {
+		t.Errorf("XPUB without XPUB_FINGERPRINT: error = %v, want %v", err, ErrNoFingerprint)
+	}
+}
+
+func TestBuildSweepPSBT(t *testing.T) {
+	loan := testLoanAddress(t, 3, 7)
+	destination := testLoanAddress(t, 0, 0).Address
+	utxos := []chain.UTXO{
+		{TxID: strings.Repeat("aa", 32), Vout: 0, Value: 60_000_000, Confirmed: true, BlockHeight: 90},
+		{TxID: strings.Repeat("bb", 32), Vout: 2, Value: 40_000_000, Confirmed: true, BlockHeight: 95},
+		{TxID: strings.Repeat("cc", 32), Vout: 1, Value: 90_000_000},
+	}
+
+	sweep, err := BuildSweepPSBT(loan, utxos, destination, 10)
+	if err != nil {
+		t.Fatalf("BuildSweepPSBT: %v", err)
+	}
+
+	// 10.5 overhead + 2 * 57.5 per input + 43 for the P2TR output, rounded up
+	if sweep.VSize != 169 {
+		t.Errorf("vsize = %d, want 169", sweep.VSize)
+	}
+	if sweep.InputCount != 2 || sweep.InputSats != 100_000_000 {
+		t.Errorf("inputs = %d totalling %d sats, want the 2 confirmed totalling 100000000", sweep.InputCount, sweep.InputSats)
+	}
+	if sweep.FeeSats != 1690 || sweep.OutputSats != 100_000_000-1690 {
+		t.Errorf("fee = %d, output = %d; want 1690, %d", sweep.FeeSats, sweep.OutputSats, 100_000_000-1690)
+	}
+	if sweep.Destination != destination {
+		t.Errorf("destination = %s, want %s", sweep.Destination, destination)
+	}
+
+	packet, err := psbt.NewFromRawBytes(strings.NewReader(sweep.PSBT), true)
+	if err != nil {
+		t.Fatalf("decoding psbt: %v", err)
+	}
+
+	tx := packet.UnsignedTx
+	if len(tx.TxOut) != 1 || tx.TxOut[0].Value != sweep.OutputSats {
+		t.Fatalf("outputs = %+v, want one of %d sats", tx.TxOut, sweep.OutputSats)
+	}
+	if len(tx.TxIn) != 2 {
+		t.Fatalf("inputs = %d, want 2", len(tx.TxIn))
+	}
+
+	fingerprint, err := MasterFingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPath := []uint32{hdkeychain.HardenedKeyStart + 86, hdkeychain.HardenedKeyStart, hdkeychain.HardenedKeyStart, 3, 7}
+
+	for i, in := range packet.Inputs {
+		if seq := tx.TxIn[i].Sequence; seq >= wire.MaxTxInSequenceNum-1 {
+			t.Errorf("input %d sequence %x does not signal RBF", i, seq)
+		}
+		if in.WitnessUtxo == nil || in.WitnessUtxo.Value != utxos[i].Value || string(in.WitnessUtxo.PkScript) != string(loan.PkScript) {
+			t.Errorf("input %d witness utxo = %+v, want %d sats at the loan script", i, in.WitnessUtxo, utxos[i].Value)
+		}
+		if string(in.TaprootInternalKey) != string(loan.InternalKey) {
+			t.Errorf("input %d internal key = %x, want %x", i, in.TaprootInternalKey, loan.InternalKey)
+		}
+		if len(in.TaprootBip32Derivation) != 1 {
+			t.Fatalf("input %d has %d derivations, want 1", i, len(in.TaprootBip32Derivation))
+		}
+		derivation := in.TaprootBip32Derivation[0]
+		if derivation.MasterKeyFingerprint != fingerprint {
+			t.Errorf("input %d fingerprint = %08x, want %08x", i, derivation.MasterKeyFingerprint, fingerprint)
+		}
+		if len(derivation.Bip32Path) != len(wantPath) {
+			t.Fatalf("input %d path = %v, want %v", i, derivation.Bip32Path, wantPath)
+		}
+		for j := range wantPath {
+			if derivation.Bip32Path[j] != wantPath[j] {
+				t.Errorf("input %d path = %v, want %v", i, derivation.Bip32Path, wantPath)
+				break
+			}
+		}
+	}
+
+	decoded, err := DecodeSweepPSBT(sweep.PSBT)
+	if err != nil {
+		t.Fatalf("DecodeSweepPSBT: %v", err)
+	}
+	if decoded.TxID != tx.TxHash().String() {
+		t.Errorf("decoded txid = %s, want %s", decoded.TxID, tx.TxHash())
+	}
+	wantInputs := []chain.Outpoint{{TxID: utxos[0].TxID, Vout: 0}, {TxID: utxos[1].TxID, Vout: 2}}
+	if len(decoded.Inputs) != len(wantInputs) || decoded.Inputs[0] != wantInputs[0] || decoded.Inputs[1] != wantInputs[1] {
+		t.Errorf("decoded inputs = %+v, want %+v", decoded.Inputs, wantInputs)
+	}
+}
+
+func TestBuildSweepPSBTErrors(t *testing.T) {
+	loan := testLoanAddress(t, 3, 7)
+	destination := testLoanAddress(t, 0, 0).Address
+	confirmed := []chain.UTXO{{TxID: strings.Repeat("aa", 32), Value: 100_000, Confirmed: true, BlockHeight: 90}}
+
+	tests := []struct {
+		name        string
+		utxos       []chain.UTXO
+		destination string
+		feeRate     int64
+		wantErr     error
+	}{
+		{"zero fee rate", confirmed, destination, 0, ErrInvalidFeeRate},
+		{"fee rate above the cap", confirmed, destination, MaxFeeRate + 1, ErrInvalidFeeRate},
+		{"testnet destination", confirmed, "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", 10, ErrInvalidAddress},
+		{"invalid destination", confirmed, "not-an-address", 10, ErrInvalidAddress},
+		{"no utxos", nil, destination, 10, ErrNoInputs},
+		{"only unconfirmed utxos", []chain.UTXO{{TxID: strings.Repeat("aa", 32), Value: 100_000}}, destination, 10, ErrNoInputs},
+		// One input is 111 vbytes, so 1000 sat/vB costs more than the input
+		{"fee exceeds the input", confirmed, destination, 1000, ErrDustOutput},
+		// 1655 - 1110 sats leaves 545, one below the dust limit
+		{"output below dust", []chain.UTXO{{TxID: strings.Repeat("aa", 32), Value: 1_655, Confirmed: true}}, destination, 10, ErrDustOutput},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := BuildSweepPSBT(loan, tt.utxos, tt.destination, tt.feeRate); !errors.Is(err, tt.wantErr) {
+				t.Errorf("BuildSweepPSBT error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Error definitions
+var (
+	ErrNotConfigured = errors.New("XPUB or SEED not configured")
+	ErrInvalidXPUB   = errors.New("invalid XPUB")
+	ErrInvalidSeed   = errors.New("failed to process seed")
+)
+
+// LoanAddress is a Taproot (P2TR) deposit address derived for a customer/loan
+type LoanAddress struct {
+	Address     string
+	Path        string
+	InternalKey []byte // 32-byte x-only internal key (BIP-86)
+	PkScript    []byte
+}
+
+// AccountKey returns the BIP-86 account key (m/86'/0'/0')
+// It supports two modes:
+//  1. XPUB mode (recommended): Uses an extended public key derived at m/86'/0'/0'
+//     This is more secure as the server never has access to private keys
+//  2. SEED mode (fallback): Uses a mnemonic seed phrase to derive keys
+//     Less secure as the server has access to private keys
+func AccountKey() (*hdkeychain.ExtendedKey, error) {
+	// Try XPUB first (more secure - public keys only)
+	xpub := os.Getenv("XPUB")
+	if xpub != "" {
+		accountKey, err := hdkeychain.NewKeyFromString(xpub)
+		if err != nil {
+			log.Printf("Error parsing XPUB: %v", err)
+			return nil, ErrInvalidXPUB
+		}
+
+		// Verify it's a public key (not private)
+		if accountKey.IsPrivate() {
+			log.Println("Warning: XPUB contains private key, consider using public key only for security")
+		}
+
+		return accountKey, nil
+	}
+
+	// Fall back to SEED (less secure - has private keys)
+	masterKey, err := masterKeyFromSeed()
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive to account level: m/86'/0'/0'
+	// 86' = purpose (Taproot/BIP86)
+	// 0' = coin type (Bitcoin)
+	// 0' = account
+	hardenedPath := []uint32{
+		86 + hdkeychain.HardenedKeyStart,
+		0 + hdkeychain.HardenedKeyStart,
+		0 + hdkeychain.HardenedKeyStart,
+	}
+
+	accountKey := masterKey
+	for _, index := range hardenedPath {
+		accountKey, err = accountKey.Derive(index)
+		if err != nil {
+			return nil, fmt.Errorf("deriving hardened key at index %d: %w", index, err)
+		}
+	}
+
+	return accountKey, nil
+}
+
+func masterKeyFromSeed() (*hdkeychain.ExtendedKey, error) {
+	seed := os.Getenv("SEED")
+	if seed == "" {
+		return nil, ErrNotConfigured
+	}
+
+	// Convert mnemonic to seed
+	seedBytes, err := bip39.NewSeedWithErrorChecking(seed, "")
+	if err != nil {
+		log.Printf("Error converting mnemonic to seed: %v", err)
+		return nil, ErrInvalidSeed
+	}
+
+	// Create HD wallet from seed (mainnet)
+	masterKey, err := hdkeychain.NewMaster(seedBytes, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, fmt.Errorf("creating master key: %w", err)
+	}
+
+	return masterKey, nil
+}
+
+// DeriveLoanAddress derives the Taproot address at m/86'/0'/0'/{customerId}/{loanId}
+func DeriveLoanAddress(customerID, loanID int) (*LoanAddress, error) {
+	if customerID < 0 || loanID < 0 {
+		return nil, fmt.Errorf("invalid derivation indexes %d/%d", customerID, loanID)
+	}
+
+	accountKey, err := AccountKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// Derive non-hardened path: {customerId}/{loanId}
+	// This works with both xpub and full keys
+	key := accountKey
+	for _, index := range []uint32{uint32(customerID), uint32(loanID)} {
+		key, err = key.Derive(index)
+		if err != nil {
+			return nil, fmt.Errorf("deriving key at index %d: %w", index, err)
+		}
+	}
+
+	pubKey, err := key.ECPubKey()
+	if err != nil {
+		return nil, fmt.Errorf("getting public key: %w", err)
+	}
+
+	// For a simple key-path spend, we use the public key directly as the internal key
+	// and tweak it with an empty script tree
+	taprootKey := txscript.ComputeTaprootKeyNoScript(pubKey)
+
+	address, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(taprootKey), &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, fmt.Errorf("creating taproot address: %w", err)
+	}
+
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return nil, fmt.Errorf("creating output script: %w", err)
+	}
+
+	return &LoanAddress{
+		Address:     address.EncodeAddress(),
+		Path:        FormatDerivationPath(customerID, loanID),
+		InternalKey: schnorr.SerializePubKey(pubKey),
+		PkScript:    pkScript,
+	}, nil
+}
+
+// FormatDerivationPath returns the full BIP-86 path for a customer/loan
+func FormatDerivationPath(customerID, loanID int) string {
+	return fmt.Sprintf("m/86'/0'/0'/%d/%d", customerID, loanID)
+}
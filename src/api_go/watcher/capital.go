@@ -0,0 +1,647 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"paperhands/api/config"
+	"paperhands/api/evm"
+	"paperhands/api/models"
+	"paperhands/api/services"
+)
+
+// capitalCursor names the scan cursor of the capital watcher
+const capitalCursor = "capital_deposits"
+
+// maxTopicAddresses caps the deposit addresses filtered on in one eth_getLogs call
+const maxTopicAddresses = 500
+
+// CapitalWatcher scans ERC-20 Transfer logs of the supported stablecoins for payments to
+// capital deposit addresses. Each transfer becomes a capital supply, or funds the pending
+// supply the user recorded for it, and is confirmed once it has enough confirmations.
+// Supplies recorded with a tx hash that does not pay the user's deposit address are rejected.
+type CapitalWatcher struct {
+	DB               *sql.DB
+	Backend          evm.Backend
+	Tokens           []evm.Token
+	Interval         time.Duration
+	MinConfirmations uint64
+	// StartBlock is where scanning starts when there is no cursor; 0 starts at the latest block
+	StartBlock uint64
+	// BatchBlocks is the number of blocks requested per eth_getLogs call
+	BatchBlocks uint64
+	// ClaimTimeout is how long a recorded tx hash may stay unknown to the node before the
+	// supply is rejected
+	ClaimTimeout time.Duration
+}
+
+type watchedDepositAddress struct {
+	ID     int
+	UserID int
+}
+
+type pendingClaim struct {
+	ID              int
+	UserID          int
+	Token           string
+	Amount          float64
+	AmountBaseUnits sql.NullString
+	TxHash          string
+	CreatedAt       time.Time
+}
+
+// NewCapitalWatcherFromEnv creates a watcher for the tokens configured in
+// TOKEN_<SYMBOL>_ADDRESS, polling every CAPITAL_WATCH_INTERVAL_SECONDS (default 15) and
+// confirming after CAPITAL_MIN_CONFIRMATIONS (default 12). EVM_START_BLOCK,
+// EVM_LOG_BATCH_BLOCKS (default 2000) and CAPITAL_CLAIM_TIMEOUT_MINUTES (default 60)
+// tune scanning.
+func NewCapitalWatcherFromEnv(db *sql.DB, backend evm.Backend) *CapitalWatcher {
+	return &CapitalWatcher{
+		DB:               db,
+		Backend:          backend,
+		Tokens:           evm.TokensFromEnv(),
+		Interval:         config.EnvSeconds("CAPITAL_WATCH_INTERVAL_SECONDS", 15*time.Second),
+		MinConfirmations: config.EnvUint("CAPITAL_MIN_CONFIRMATIONS", 12),
+		StartBlock:       config.EnvUint("EVM_START_BLOCK", 0),
+		BatchBlocks:      config.EnvUint("EVM_LOG_BATCH_BLOCKS", 2000),
+		ClaimTimeout:     time.Duration(config.EnvInt("CAPITAL_CLAIM_TIMEOUT_MINUTES", 60)) * time.Minute,
+	}
+}
+
+// Run polls until ctx is cancelled. It returns immediately if no token contract is configured.
+func (w *CapitalWatcher) Run(ctx context.Context) {
+	if len(w.Tokens) == 0 {
+		log.Println("Capital watcher disabled: no TOKEN_<SYMBOL>_ADDRESS configured")
+		return
+	}
+
+	log.Printf("Capital watcher started for %d tokens (interval %s, %d confirmations)", len(w.Tokens), w.Interval, w.MinConfirmations)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Poll(ctx); err != nil {
+			log.Printf("Capital watcher poll failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Capital watcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll scans new blocks for deposits, verifies the tx hashes users recorded and confirms
+// supplies with enough confirmations
+func (w *CapitalWatcher) Poll(ctx context.Context) error {
+	latest, err := w.Backend.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching latest block: %w", err)
+	}
+
+	addresses, err := w.depositAddresses(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := w.fillBaseUnits(ctx); err != nil {
+		return err
+	}
+
+	if err := w.scan(ctx, addresses, latest); err != nil {
+		return err
+	}
+
+	if err := w.verifyClaims(ctx, addresses); err != nil {
+		return err
+	}
+
+	return w.confirmSupplies(ctx, latest)
+}
+
+// fillBaseUnits converts the amount of pending supplies recorded without base units, e.g.
+// before their token's contract was configured, so they can be matched to transfers
+func (w *CapitalWatcher) fillBaseUnits(ctx context.Context) error {
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT id, token, amount::text
+		FROM capital_supplies
+		WHERE status = $1 AND amount_base_units IS NULL
+		ORDER BY id
+	`, models.CapitalStatusPending)
+	if err != nil {
+		return fmt.Errorf("querying capital supplies without base units: %w", err)
+	}
+
+	// Amounts are read as text so 18-decimal tokens convert without float rounding
+	type unconverted struct {
+		ID     int
+		Token  string
+		Amount string
+	}
+
+	var supplies []unconverted
+	for rows.Next() {
+		var s unconverted
+		if err := rows.Scan(&s.ID, &s.Token, &s.Amount); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning capital supply: %w", err)
+		}
+		supplies = append(supplies, s)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range supplies {
+		token, ok := w.tokenBySymbol(s.Token)
+		if !ok {
+			continue
+		}
+		// A supply more precise than its token cannot match a transfer and stays pending
+		units, err := token.ParseBaseUnits(s.Amount)
+		if err != nil {
+			log.Printf("Error converting capital supply %d: %v", s.ID, err)
+			continue
+		}
+		if _, err := w.DB.ExecContext(ctx,
+			"UPDATE capital_supplies SET amount_base_units = $1, updated_at = NOW() WHERE id = $2 AND amount_base_units IS NULL",
+			units.String(), s.ID,
+		); err != nil {
+			return fmt.Errorf("converting capital supply %d: %w", s.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// depositAddresses returns the derived deposit addresses by lower-case address
+func (w *CapitalWatcher) depositAddresses(ctx context.Context) (map[string]watchedDepositAddress, error) {
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT id, user_id, LOWER(address)
+		FROM deposit_addresses
+		WHERE derivation_index IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("querying deposit addresses: %w", err)
+	}
+	defer rows.Close()
+
+	addresses := map[string]watchedDepositAddress{}
+	for rows.Next() {
+		var addr watchedDepositAddress
+		var address string
+		if err := rows.Scan(&addr.ID, &addr.UserID, &address); err != nil {
+			return nil, fmt.Errorf("scanning deposit address: %w", err)
+		}
+		addresses[address] = addr
+	}
+
+	return addresses, rows.Err()
+}
+
+// scan records every transfer to a deposit address from the block after the cursor up to
+// latest. The cursor only advances to blocks that already have MinConfirmations, so blocks
+// that could still be reorganised are scanned again on the next poll.
+func (w *CapitalWatcher) scan(ctx context.Context, addresses map[string]watchedDepositAddress, latest uint64) error {
+	cursor, err := w.cursor(ctx, latest)
+	if err != nil {
+		return err
+	}
+
+	if len(addresses) > 0 {
+		var topics []string
+		for address := range addresses {
+			topics = append(topics, evm.AddressTopic(address))
+		}
+
+		contracts := make([]string, len(w.Tokens))
+		for i, token := range w.Tokens {
+			contracts[i] = token.Contract
+		}
+
+		for from := cursor + 1; from <= latest; from += w.BatchBlocks {
+			to := from + w.BatchBlocks - 1
+			if to > latest {
+				to = latest
+			}
+
+			for start := 0; start < len(topics); start += maxTopicAddresses {
+				end := start + maxTopicAddresses
+				if end > len(topics) {
+					end = len(topics)
+				}
+
+				logs, err := w.Backend.Logs(ctx, evm.FilterQuery{
+					FromBlock: from,
+					ToBlock:   to,
+					Addresses: contracts,
+					Topics:    [][]string{{evm.TransferTopic}, nil, topics[start:end]},
+				})
+				if err != nil {
+					return fmt.Errorf("fetching logs for blocks %d-%d: %w", from, to, err)
+				}
+
+				for _, l := range logs {
+					if err := w.recordLog(ctx, addresses, l); err != nil {
+						log.Printf("Error recording transfer %s:%d: %v", l.TxHash, l.LogIndex, err)
+					}
+				}
+			}
+		}
+	}
+
+	// Saved even when unchanged so the first scan's starting point persists
+	if latest >= w.MinConfirmations && latest-w.MinConfirmations > cursor {
+		cursor = latest - w.MinConfirmations
+	}
+	return w.setCursor(ctx, cursor)
+}
+
+// cursor returns the last block scanned beyond reorganisation, starting from StartBlock
+// (or the latest block) the first time
+func (w *CapitalWatcher) cursor(ctx context.Context, latest uint64) (uint64, error) {
+	var block int64
+	err := w.DB.QueryRowContext(ctx, "SELECT block_number FROM evm_scan_cursors WHERE name = $1", capitalCursor).Scan(&block)
+	if err == nil {
+		return uint64(block), nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, fmt.Errorf("reading scan cursor: %w", err)
+	}
+
+	start := latest
+	if w.StartBlock > 0 {
+		start = w.StartBlock
+	}
+	if start == 0 {
+		return 0, nil
+	}
+	return start - 1, nil
+}
+
+func (w *CapitalWatcher) setCursor(ctx context.Context, block uint64) error {
+	_, err := w.DB.ExecContext(ctx, `
+		INSERT INTO evm_scan_cursors (name, block_number)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET block_number = EXCLUDED.block_number, updated_at = NOW()
+	`, capitalCursor, int64(block))
+	if err != nil {
+		return fmt.Errorf("saving scan cursor: %w", err)
+	}
+	return nil
+}
+
+// recordLog records l if it is a transfer of a watched token to a deposit address
+func (w *CapitalWatcher) recordLog(ctx context.Context, addresses map[string]watchedDepositAddress, l evm.Log) error {
+	if l.Removed || len(l.Topics) == 0 || l.Topics[0] != evm.TransferTopic {
+		return nil
+	}
+
+	token, ok := w.token(l.Address)
+	if !ok {
+		return nil
+	}
+
+	transfer, err := evm.ParseTransfer(l)
+	if err != nil {
+		return err
+	}
+
+	addr, ok := addresses[transfer.To]
+	if !ok {
+		return nil
+	}
+
+	return w.recordTransfer(ctx, token, addr, transfer)
+}
+
+func (w *CapitalWatcher) token(contract string) (evm.Token, bool) {
+	for _, token := range w.Tokens {
+		if token.Contract == contract {
+			return token, true
+		}
+	}
+	return evm.Token{}, false
+}
+
+func (w *CapitalWatcher) tokenBySymbol(symbol string) (evm.Token, bool) {
+	for _, token := range w.Tokens {
+		if token.Symbol == symbol {
+			return token, true
+		}
+	}
+	return evm.Token{}, false
+}
+
+// recordTransfer stores a transfer to a deposit address as a pending capital supply. A
+// transfer already recorded only has its block number refreshed, since a reorganisation
+// may have moved it. Otherwise it funds the user's pending supply recorded with its tx
+// hash, or without a tx hash for the same token and base-unit amount, before a new supply
+// is created.
+func (w *CapitalWatcher) recordTransfer(ctx context.Context, token evm.Token, addr watchedDepositAddress, t evm.Transfer) error {
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var existingID int
+	var existingStatus string
+	err = tx.QueryRowContext(ctx,
+		"SELECT id, status FROM capital_supplies WHERE tx_hash = $1 AND log_index = $2",
+		t.TxHash, t.LogIndex,
+	).Scan(&existingID, &existingStatus)
+	if err == nil {
+		if existingStatus == models.CapitalStatusPending {
+			if _, err := tx.ExecContext(ctx,
+				"UPDATE capital_supplies SET block_number = $1, updated_at = NOW() WHERE id = $2 AND block_number IS DISTINCT FROM $1",
+				int64(t.BlockNumber), existingID,
+			); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	amount := token.Amount(t.Value)
+
+	var claimID int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM capital_supplies
+		WHERE user_id = $1 AND status = $2 AND log_index IS NULL
+			AND token = $3 AND amount_base_units = $4 AND (tx_hash = $5 OR tx_hash IS NULL)
+		ORDER BY tx_hash IS NULL, created_at
+		LIMIT 1
+		FOR UPDATE
+	`, addr.UserID, models.CapitalStatusPending, token.Symbol, t.Value.String(), t.TxHash).Scan(&claimID)
+
+	switch {
+	case err == nil:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE capital_supplies
+			SET tx_hash = $1, log_index = $2, block_number = $3, deposit_address_id = $4, updated_at = NOW()
+			WHERE id = $5
+		`, t.TxHash, t.LogIndex, int64(t.BlockNumber), addr.ID, claimID)
+		if err != nil {
+			return err
+		}
+		log.Printf("Transfer %s:%d of %g %s funds capital supply %d", t.TxHash, t.LogIndex, amount, token.Symbol, claimID)
+
+	case err == sql.ErrNoRows:
+		var id int
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO capital_supplies
+				(user_id, token, amount, amount_base_units, wallet_address, tx_hash, log_index, block_number, deposit_address_id, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (tx_hash, log_index) DO NOTHING
+			RETURNING id
+		`, addr.UserID, token.Symbol, amount, t.Value.String(), t.From, t.TxHash, t.LogIndex, int64(t.BlockNumber), addr.ID,
+			models.CapitalStatusPending).Scan(&id)
+		if err == sql.ErrNoRows {
+			return tx.Commit()
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Detected capital supply %d for user %d: %g %s in %s:%d", id, addr.UserID, amount, token.Symbol, t.TxHash, t.LogIndex)
+
+	default:
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// verifyClaims checks the receipt of every pending supply recorded with a tx hash that has
+// not been matched to a transfer yet. A matching transfer funds the supply; a missing or
+// reverted transaction, or one that does not pay the user's deposit address the claimed
+// token and amount, rejects it.
+func (w *CapitalWatcher) verifyClaims(ctx context.Context, addresses map[string]watchedDepositAddress) error {
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT id, user_id, token, amount, amount_base_units, tx_hash, created_at
+		FROM capital_supplies
+		WHERE status = $1 AND tx_hash IS NOT NULL AND log_index IS NULL
+		ORDER BY id
+	`, models.CapitalStatusPending)
+	if err != nil {
+		return fmt.Errorf("querying unverified capital supplies: %w", err)
+	}
+
+	var claims []pendingClaim
+	for rows.Next() {
+		var claim pendingClaim
+		if err := rows.Scan(&claim.ID, &claim.UserID, &claim.Token, &claim.Amount, &claim.AmountBaseUnits, &claim.TxHash, &claim.CreatedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning capital supply: %w", err)
+		}
+		claims = append(claims, claim)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, claim := range claims {
+		if err := w.verifyClaim(ctx, addresses, claim); err != nil {
+			log.Printf("Error verifying capital supply %d: %v", claim.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (w *CapitalWatcher) verifyClaim(ctx context.Context, addresses map[string]watchedDepositAddress, claim pendingClaim) error {
+	receipt, err := w.Backend.TransactionReceipt(ctx, claim.TxHash)
+	if errors.Is(err, evm.ErrNotFound) {
+		// The transaction may still be in the mempool
+		if time.Since(claim.CreatedAt) < w.ClaimTimeout {
+			return nil
+		}
+		return w.reject(ctx, claim.ID, "Transaction not found on chain")
+	}
+	if err != nil {
+		return fmt.Errorf("fetching receipt: %w", err)
+	}
+
+	if !receipt.Success {
+		return w.reject(ctx, claim.ID, "Transaction reverted")
+	}
+
+	// Transfers in the transaction to this user's deposit addresses
+	var transfers []evm.Transfer
+	for _, l := range receipt.Logs {
+		if l.Removed || len(l.Topics) == 0 || l.Topics[0] != evm.TransferTopic {
+			continue
+		}
+		if _, ok := w.token(l.Address); !ok {
+			continue
+		}
+		transfer, err := evm.ParseTransfer(l)
+		if err != nil {
+			continue
+		}
+		if addr, ok := addresses[transfer.To]; ok && addr.UserID == claim.UserID {
+			transfers = append(transfers, transfer)
+		}
+	}
+
+	if len(transfers) == 0 {
+		return w.reject(ctx, claim.ID, "Transaction does not transfer a supported token to the user's deposit address")
+	}
+
+	matched := false
+	for _, transfer := range transfers {
+		token, _ := w.token(transfer.Token)
+		if token.Symbol == claim.Token && claim.AmountBaseUnits.String == transfer.Value.String() {
+			matched = true
+		}
+	}
+
+	if !matched {
+		first := transfers[0]
+		token, _ := w.token(first.Token)
+		reason := fmt.Sprintf("Transaction transfers %g %s, not %g %s", token.Amount(first.Value), token.Symbol, claim.Amount, claim.Token)
+		if err := w.reject(ctx, claim.ID, reason); err != nil {
+			return err
+		}
+	}
+
+	// Record every transfer; the matching one funds this supply, others become their own
+	for _, transfer := range transfers {
+		token, _ := w.token(transfer.Token)
+		if err := w.recordTransfer(ctx, token, addresses[transfer.To], transfer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *CapitalWatcher) reject(ctx context.Context, id int, reason string) error {
+	_, err := w.DB.ExecContext(ctx, `
+		UPDATE capital_supplies
+		SET status = $1, rejection_reason = $2, updated_at = NOW()
+		WHERE id = $3 AND status = $4
+	`, models.CapitalStatusRejected, reason, id, models.CapitalStatusPending)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Capital supply %d rejected: %s", id, reason)
+	return nil
+}
+
+// confirmSupplies confirms pending supplies funded by a transfer with at least
+// MinConfirmations, after checking the transaction is still in the block it was seen in
+func (w *CapitalWatcher) confirmSupplies(ctx context.Context, latest uint64) error {
+	if latest+1 < w.MinConfirmations {
+		return nil
+	}
+
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT id, tx_hash, block_number
+		FROM capital_supplies
+		WHERE status = $1 AND log_index IS NOT NULL AND block_number <= $2
+		ORDER BY id
+	`, models.CapitalStatusPending, int64(latest+1-w.MinConfirmations))
+	if err != nil {
+		return fmt.Errorf("querying capital supplies to confirm: %w", err)
+	}
+
+	type fundedSupply struct {
+		ID          int
+		TxHash      string
+		BlockNumber int64
+	}
+
+	var supplies []fundedSupply
+	for rows.Next() {
+		var s fundedSupply
+		if err := rows.Scan(&s.ID, &s.TxHash, &s.BlockNumber); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning capital supply: %w", err)
+		}
+		supplies = append(supplies, s)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range supplies {
+		receipt, err := w.Backend.TransactionReceipt(ctx, s.TxHash)
+		if err != nil {
+			log.Printf("Error fetching receipt for capital supply %d: %v", s.ID, err)
+			continue
+		}
+
+		if !receipt.Success {
+			if err := w.reject(ctx, s.ID, "Transaction reverted"); err != nil {
+				log.Printf("Error rejecting capital supply %d: %v", s.ID, err)
+			}
+			continue
+		}
+
+		if int64(receipt.BlockNumber) != s.BlockNumber {
+			// Reorganised into another block; confirm once that block is deep enough
+			if _, err := w.DB.ExecContext(ctx,
+				"UPDATE capital_supplies SET block_number = $1, updated_at = NOW() WHERE id = $2",
+				int64(receipt.BlockNumber), s.ID,
+			); err != nil {
+				log.Printf("Error updating block of capital supply %d: %v", s.ID, err)
+			}
+			continue
+		}
+
+		if err := w.confirm(ctx, s.ID); err != nil {
+			log.Printf("Error confirming capital supply %d: %v", s.ID, err)
+			continue
+		}
+
+		log.Printf("Capital supply %d confirmed with %d confirmations", s.ID, evm.Confirmations(receipt.BlockNumber, latest))
+	}
+
+	return nil
+}
+
+// confirm confirms a pending capital supply and mints its pool shares
+func (w *CapitalWatcher) confirm(ctx context.Context, supplyID int) error {
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE capital_supplies
+		SET status = $1, updated_at = NOW()
+		WHERE id = $2 AND status = $3
+	`, models.CapitalStatusConfirmed, supplyID, models.CapitalStatusPending)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		// Confirmed or rejected concurrently
+		return nil
+	}
+
+	if _, err := services.MintPoolShares(tx, supplyID); err != nil {
+		return fmt.Errorf("minting pool shares: %w", err)
+	}
+
+	return tx.Commit()
+}
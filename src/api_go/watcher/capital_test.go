@@ -0,0 +1,327 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"paperhands/api/dbtest"
+	"paperhands/api/evm"
+	"paperhands/api/models"
+)
+
+var (
+	usdc = evm.Token{Symbol: "USDC", Contract: "0x" + strings.Repeat("aa", 20), Decimals: 6}
+
+	userDeposit  = "0x" + strings.Repeat("11", 20)
+	otherDeposit = "0x" + strings.Repeat("12", 20)
+	sender       = "0x" + strings.Repeat("22", 20)
+	stranger     = "0x" + strings.Repeat("33", 20)
+
+	claimHash = "0x" + strings.Repeat("c1", 32)
+
+	testAddresses = map[string]watchedDepositAddress{
+		userDeposit:  {ID: 3, UserID: 42},
+		otherDeposit: {ID: 4, UserID: 43},
+	}
+)
+
+// fakeBackend is an evm.Backend serving fixed receipts
+type fakeBackend struct {
+	latest   uint64
+	receipts map[string]*evm.Receipt
+}
+
+func (b *fakeBackend) BlockNumber(context.Context) (uint64, error) { return b.latest, nil }
+
+func (b *fakeBackend) Logs(context.Context, evm.FilterQuery) ([]evm.Log, error) { return nil, nil }
+
+func (b *fakeBackend) TransactionReceipt(_ context.Context, txHash string) (*evm.Receipt, error) {
+	receipt, ok := b.receipts[txHash]
+	if !ok {
+		return nil, evm.ErrNotFound
+	}
+	return receipt, nil
+}
+
+// transferLog builds the Transfer log of value base units of token from sender to to
+func transferLog(token evm.Token, to string, value int64, block uint64) evm.Log {
+	return evm.Log{
+		Address:     token.Contract,
+		Topics:      []string{evm.TransferTopic, evm.AddressTopic(sender), evm.AddressTopic(to)},
+		Data:        fmt.Sprintf("0x%064x", value),
+		BlockNumber: block,
+		TxHash:      claimHash,
+		LogIndex:    1,
+	}
+}
+
+func transfer(t *testing.T, to string, value int64, block uint64) evm.Transfer {
+	t.Helper()
+	parsed, err := evm.ParseTransfer(transferLog(usdc, to, value, block))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func newTestCapitalWatcher(t *testing.T, backend *fakeBackend) (*CapitalWatcher, *dbtest.Mock) {
+	db, mock := dbtest.New(t)
+	return &CapitalWatcher{
+		DB:               db,
+		Backend:          backend,
+		Tokens:           []evm.Token{usdc},
+		MinConfirmations: 12,
+		ClaimTimeout:     time.Hour,
+	}, mock
+}
+
+// expectNewSupply scripts recording a transfer that matches no claim
+func expectNewSupply(mock *dbtest.Mock, value string, amount float64, block int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, status FROM capital_supplies WHERE tx_hash = $1 AND log_index = $2").
+		WithArgs(claimHash, uint(1)).
+		WillReturnRows([]string{"id", "status"})
+	mock.ExpectQuery("AND token = $3 AND amount_base_units = $4").
+		WithArgs(42, models.CapitalStatusPending, "USDC", value, claimHash).
+		WillReturnRows([]string{"id"})
+	mock.ExpectQuery("INSERT INTO capital_supplies").
+		WithArgs(42, "USDC", amount, value, sender, claimHash, uint(1), block, 3, models.CapitalStatusPending).
+		WillReturnRows([]string{"id"}, []interface{}{9})
+	mock.ExpectCommit()
+}
+
+// expectFundsClaim scripts recording a transfer that funds claim 5
+func expectFundsClaim(mock *dbtest.Mock, value string, block int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, status FROM capital_supplies WHERE tx_hash = $1 AND log_index = $2").
+		WillReturnRows([]string{"id", "status"})
+	mock.ExpectQuery("AND token = $3 AND amount_base_units = $4").
+		WithArgs(42, models.CapitalStatusPending, "USDC", value, claimHash).
+		WillReturnRows([]string{"id"}, []interface{}{5})
+	mock.ExpectExec("SET tx_hash = $1, log_index = $2, block_number = $3, deposit_address_id = $4").
+		WithArgs(claimHash, uint(1), block, 3, 5)
+	mock.ExpectCommit()
+}
+
+func expectReject(mock *dbtest.Mock, id int, reason string) {
+	mock.ExpectExec("SET status = $1, rejection_reason = $2").
+		WithArgs(models.CapitalStatusRejected, reason, id, models.CapitalStatusPending)
+}
+
+func TestRecordTransfer(t *testing.T) {
+	tests := []struct {
+		name   string
+		script func(mock *dbtest.Mock)
+	}{
+		{
+			name: "new supply",
+			script: func(mock *dbtest.Mock) {
+				expectNewSupply(mock, "10000000", 10, 80)
+			},
+		},
+		{
+			name: "funds claim",
+			script: func(mock *dbtest.Mock) {
+				expectFundsClaim(mock, "10000000", 80)
+			},
+		},
+		{
+			name: "reorged into another block",
+			script: func(mock *dbtest.Mock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT id, status FROM capital_supplies WHERE tx_hash = $1 AND log_index = $2").
+					WillReturnRows([]string{"id", "status"}, []interface{}{9, models.CapitalStatusPending})
+				mock.ExpectExec("UPDATE capital_supplies SET block_number = $1").
+					WithArgs(int64(80), 9)
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "already confirmed",
+			script: func(mock *dbtest.Mock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT id, status FROM capital_supplies WHERE tx_hash = $1 AND log_index = $2").
+					WillReturnRows([]string{"id", "status"}, []interface{}{9, models.CapitalStatusConfirmed})
+				mock.ExpectCommit()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, mock := newTestCapitalWatcher(t, &fakeBackend{latest: 100})
+			tt.script(mock)
+
+			err := w.recordTransfer(context.Background(), usdc, testAddresses[userDeposit], transfer(t, userDeposit, 10_000_000, 80))
+			if err != nil {
+				t.Fatalf("recordTransfer: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyClaim(t *testing.T) {
+	tests := []struct {
+		name    string
+		receipt *evm.Receipt
+		age     time.Duration
+		script  func(mock *dbtest.Mock)
+	}{
+		{
+			name: "unknown within the timeout",
+			age:  time.Minute,
+		},
+		{
+			name: "forged",
+			age:  2 * time.Hour,
+			script: func(mock *dbtest.Mock) {
+				expectReject(mock, 5, "Transaction not found on chain")
+			},
+		},
+		{
+			name:    "reverted",
+			receipt: &evm.Receipt{TxHash: claimHash, BlockNumber: 80},
+			script: func(mock *dbtest.Mock) {
+				expectReject(mock, 5, "Transaction reverted")
+			},
+		},
+		{
+			name: "pays another address",
+			receipt: &evm.Receipt{TxHash: claimHash, BlockNumber: 80, Success: true, Logs: []evm.Log{
+				transferLog(usdc, stranger, 10_000_000, 80),
+			}},
+			script: func(mock *dbtest.Mock) {
+				expectReject(mock, 5, "Transaction does not transfer a supported token to the user's deposit address")
+			},
+		},
+		{
+			name: "pays another user's deposit address",
+			receipt: &evm.Receipt{TxHash: claimHash, BlockNumber: 80, Success: true, Logs: []evm.Log{
+				transferLog(usdc, otherDeposit, 10_000_000, 80),
+			}},
+			script: func(mock *dbtest.Mock) {
+				expectReject(mock, 5, "Transaction does not transfer a supported token to the user's deposit address")
+			},
+		},
+		{
+			name: "mismatched amount",
+			receipt: &evm.Receipt{TxHash: claimHash, BlockNumber: 80, Success: true, Logs: []evm.Log{
+				transferLog(usdc, userDeposit, 5_000_000, 80),
+			}},
+			script: func(mock *dbtest.Mock) {
+				expectReject(mock, 5, "Transaction transfers 5 USDC, not 10 USDC")
+				// The transfer still becomes a supply of its own
+				expectNewSupply(mock, "5000000", 5, 80)
+			},
+		},
+		{
+			name: "matched",
+			receipt: &evm.Receipt{TxHash: claimHash, BlockNumber: 80, Success: true, Logs: []evm.Log{
+				transferLog(usdc, userDeposit, 10_000_000, 80),
+			}},
+			script: func(mock *dbtest.Mock) {
+				expectFundsClaim(mock, "10000000", 80)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakeBackend{latest: 100, receipts: map[string]*evm.Receipt{}}
+			if tt.receipt != nil {
+				backend.receipts[claimHash] = tt.receipt
+			}
+
+			w, mock := newTestCapitalWatcher(t, backend)
+			if tt.script != nil {
+				tt.script(mock)
+			}
+
+			claim := pendingClaim{
+				ID:              5,
+				UserID:          42,
+				Token:           "USDC",
+				Amount:          10,
+				AmountBaseUnits: sql.NullString{String: "10000000", Valid: true},
+				TxHash:          claimHash,
+				CreatedAt:       time.Now().Add(-tt.age),
+			}
+			if err := w.verifyClaim(context.Background(), testAddresses, claim); err != nil {
+				t.Fatalf("verifyClaim: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfirmSupplies(t *testing.T) {
+	tests := []struct {
+		name    string
+		receipt *evm.Receipt
+		script  func(mock *dbtest.Mock)
+	}{
+		{
+			name:    "confirmed",
+			receipt: &evm.Receipt{TxHash: claimHash, BlockNumber: 80, Success: true},
+			script: func(mock *dbtest.Mock) {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE capital_supplies SET status = $1").
+					WithArgs(models.CapitalStatusConfirmed, 9, models.CapitalStatusPending)
+				mock.ExpectQuery("SELECT user_id, token, amount::text, status FROM capital_supplies").
+					WithArgs(9).
+					WillReturnRows([]string{"user_id", "token", "amount", "status"}, []interface{}{42, "USDC", "10.00000000", models.CapitalStatusConfirmed})
+				mock.ExpectQuery("FROM lending_pools WHERE token = $1 FOR UPDATE").
+					WithArgs("USDC").
+					WillReturnRows([]string{"total_assets", "total_shares"}, []interface{}{"0", "0"})
+				mock.ExpectExec("INSERT INTO pool_ledger").
+					WithArgs("USDC", 42, models.PoolEntryDeposit, 9, "10.00000000", "10.000000000000000000", 1.0)
+				mock.ExpectExec("UPDATE lending_pools")
+				mock.ExpectExec("INSERT INTO pool_positions")
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:    "reorged into another block",
+			receipt: &evm.Receipt{TxHash: claimHash, BlockNumber: 95, Success: true},
+			script: func(mock *dbtest.Mock) {
+				mock.ExpectExec("UPDATE capital_supplies SET block_number = $1").
+					WithArgs(int64(95), 9)
+			},
+		},
+		{
+			name:    "reverted after a reorganisation",
+			receipt: &evm.Receipt{TxHash: claimHash, BlockNumber: 80},
+			script: func(mock *dbtest.Mock) {
+				expectReject(mock, 9, "Transaction reverted")
+			},
+		},
+		{
+			// Dropped from the chain; the supply stays pending until it is mined again
+			name: "reorged out",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakeBackend{latest: 100, receipts: map[string]*evm.Receipt{}}
+			if tt.receipt != nil {
+				backend.receipts[claimHash] = tt.receipt
+			}
+
+			w, mock := newTestCapitalWatcher(t, backend)
+			mock.ExpectQuery("WHERE status = $1 AND log_index IS NOT NULL AND block_number <= $2").
+				WithArgs(models.CapitalStatusPending, int64(89)).
+				WillReturnRows([]string{"id", "tx_hash", "block_number"}, []interface{}{9, claimHash, int64(80)})
+			if tt.script != nil {
+				tt.script(mock)
+			}
+
+			if err := w.confirmSupplies(context.Background(), 100); err != nil {
+				t.Fatalf("confirmSupplies: %v", err)
+			}
+		})
+	}
+}
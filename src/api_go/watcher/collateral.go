@@ -0,0 +1,354 @@
+package watcher
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"paperhands/api/chain"
+	"paperhands/api/config"
+	"paperhands/api/models"
+	"paperhands/api/services"
+	"paperhands/api/wallet"
+)
+
+// CollateralWatcher polls the chain for BTC arriving at loan deposit addresses
+// and moves loans to collateralised once enough confirmed BTC has arrived. It also
+// marks collateral releases released and liquidation sweeps swept once their
+// transaction has confirmed.
+type CollateralWatcher struct {
+	DB               *sql.DB
+	Backend          chain.Backend
+	Interval         time.Duration
+	MinConfirmations int64
+}
+
+type watchedLoan struct {
+	ID             int
+	DepositAddress string
+	CollateralBTC  float64
+}
+
+type watchedRelease struct {
+	LoanID int
+	PSBT   string
+}
+
+type watchedLiquidation struct {
+	LoanID int
+	PSBT   string
+}
+
+// NewCollateralWatcherFromEnv creates a watcher configured from
+// COLLATERAL_WATCH_INTERVAL_SECONDS (default 60) and COLLATERAL_MIN_CONFIRMATIONS (default 3)
+func NewCollateralWatcherFromEnv(db *sql.DB, backend chain.Backend) *CollateralWatcher {
+	return &CollateralWatcher{
+		DB:               db,
+		Backend:          backend,
+		Interval:         config.EnvSeconds("COLLATERAL_WATCH_INTERVAL_SECONDS", 60*time.Second),
+		MinConfirmations: int64(config.EnvInt("COLLATERAL_MIN_CONFIRMATIONS", 3)),
+	}
+}
+
+// Run polls until ctx is cancelled
+func (w *CollateralWatcher) Run(ctx context.Context) {
+	log.Printf("Collateral watcher started (interval %s, %d confirmations)", w.Interval, w.MinConfirmations)
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Poll(ctx); err != nil {
+			log.Printf("Collateral watcher poll failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("Collateral watcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll checks every loan awaiting collateral and every release and liquidation awaiting
+// signature once
+func (w *CollateralWatcher) Poll(ctx context.Context) error {
+	if err := w.pollDeposits(ctx); err != nil {
+		return err
+	}
+	if err := w.pollReleases(ctx); err != nil {
+		return err
+	}
+	return w.pollLiquidations(ctx)
+}
+
+// pollDeposits checks every loan awaiting collateral once
+func (w *CollateralWatcher) pollDeposits(ctx context.Context) error {
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT id, deposit_address, collateral_btc
+		FROM loans
+		WHERE status = $1 AND deposit_address IS NOT NULL AND collateral_btc > 0
+		ORDER BY id
+	`, models.LoanStatusAwaitingCollateral)
+	if err != nil {
+		return fmt.Errorf("querying loans awaiting collateral: %w", err)
+	}
+
+	var loans []watchedLoan
+	for rows.Next() {
+		var loan watchedLoan
+		if err := rows.Scan(&loan.ID, &loan.DepositAddress, &loan.CollateralBTC); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning loan: %w", err)
+		}
+		loans = append(loans, loan)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(loans) == 0 {
+		return nil
+	}
+
+	tip, err := w.Backend.TipHeight(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching tip height: %w", err)
+	}
+
+	for _, loan := range loans {
+		if err := w.checkLoan(ctx, loan, tip); err != nil {
+			log.Printf("Error checking collateral for loan %d: %v", loan.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkLoan records the UTXOs paying to a loan's address and transitions the loan
+// once the confirmed amount covers the required collateral
+func (w *CollateralWatcher) checkLoan(ctx context.Context, loan watchedLoan, tip int64) error {
+	// A loan without a collateral requirement is never collateralised by the watcher
+	requiredSats := int64(math.Round(loan.CollateralBTC * 1e8))
+	if requiredSats <= 0 {
+		return nil
+	}
+
+	utxos, err := w.Backend.AddressUTXOs(ctx, loan.DepositAddress)
+	if err != nil {
+		return fmt.Errorf("fetching utxos: %w", err)
+	}
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := services.RecordCollateralUTXOs(tx, loan.ID, loan.DepositAddress, utxos, tip); err != nil {
+		return err
+	}
+
+	var confirmedSats int64
+	for _, utxo := range utxos {
+		if utxo.Confirmations(tip) >= w.MinConfirmations {
+			confirmedSats += utxo.Value
+		}
+	}
+
+	if confirmedSats >= requiredSats {
+		reason := fmt.Sprintf("Received %.8f BTC with at least %d confirmations", float64(confirmedSats)/1e8, w.MinConfirmations)
+		if _, err := services.TransitionLoanStatus(tx, loan.ID, models.LoanStatusCollateralised, 0, reason); err != nil {
+			return err
+		}
+		log.Printf("Loan %d collateralised: %s", loan.ID, reason)
+	}
+
+	return tx.Commit()
+}
+
+// pollReleases checks every collateral release whose PSBT has been built once
+func (w *CollateralWatcher) pollReleases(ctx context.Context) error {
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT loan_id, psbt
+		FROM collateral_releases
+		WHERE status = $1 AND return_address IS NOT NULL AND psbt IS NOT NULL
+		ORDER BY loan_id
+	`, models.CollateralReleaseAwaitingSignature)
+	if err != nil {
+		return fmt.Errorf("querying releases awaiting signature: %w", err)
+	}
+
+	var releases []watchedRelease
+	for rows.Next() {
+		var release watchedRelease
+		if err := rows.Scan(&release.LoanID, &release.PSBT); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning release: %w", err)
+		}
+		releases = append(releases, release)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(releases) == 0 {
+		return nil
+	}
+
+	tip, err := w.Backend.TipHeight(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching tip height: %w", err)
+	}
+
+	for _, release := range releases {
+		if err := w.checkRelease(ctx, release, tip); err != nil {
+			log.Printf("Error checking collateral release for loan %d: %v", release.LoanID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkRelease marks a release released once the transaction built from its PSBT has
+// enough confirmations. The transaction is looked up by txid rather than by the output it
+// pays, which the borrower may already have spent. A PSBT rebuilt at a higher fee produces
+// a new txid and is picked up on the next poll once recorded.
+func (w *CollateralWatcher) checkRelease(ctx context.Context, release watchedRelease, tip int64) error {
+	sweep, err := wallet.DecodeSweepPSBT(release.PSBT)
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Backend.TxStatus(ctx, sweep.TxID)
+	if errors.Is(err, chain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fetching status of %s: %w", sweep.TxID, err)
+	}
+
+	confirmations := status.Confirmations(tip)
+	if confirmations < w.MinConfirmations {
+		return nil
+	}
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	marked, err := services.MarkCollateralReleased(tx, release.LoanID, release.PSBT, sweep.Inputs)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		return nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Loan %d collateral released in %s with %d confirmations", release.LoanID, sweep.TxID, confirmations)
+	return nil
+}
+
+// pollLiquidations checks every liquidation sweep awaiting signature once
+func (w *CollateralWatcher) pollLiquidations(ctx context.Context) error {
+	rows, err := w.DB.QueryContext(ctx, `
+		SELECT loan_id, psbt
+		FROM loan_liquidations
+		WHERE status = $1
+		ORDER BY loan_id
+	`, models.LiquidationStatusAwaitingSignature)
+	if err != nil {
+		return fmt.Errorf("querying liquidations awaiting signature: %w", err)
+	}
+
+	var liquidations []watchedLiquidation
+	for rows.Next() {
+		var liquidation watchedLiquidation
+		if err := rows.Scan(&liquidation.LoanID, &liquidation.PSBT); err != nil {
+			rows.Close()
+			return fmt.Errorf("scanning liquidation: %w", err)
+		}
+		liquidations = append(liquidations, liquidation)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(liquidations) == 0 {
+		return nil
+	}
+
+	tip, err := w.Backend.TipHeight(ctx)
+	if err != nil {
+		return fmt.Errorf("fetching tip height: %w", err)
+	}
+
+	for _, liquidation := range liquidations {
+		if err := w.checkLiquidation(ctx, liquidation, tip); err != nil {
+			log.Printf("Error checking liquidation sweep for loan %d: %v", liquidation.LoanID, err)
+		}
+	}
+
+	return nil
+}
+
+// checkLiquidation marks a liquidation swept once the transaction built from its PSBT has
+// enough confirmations, recording the txid and marking only the UTXOs the sweep spent.
+// Settlement then waits on staff entering the proceeds of selling the BTC.
+func (w *CollateralWatcher) checkLiquidation(ctx context.Context, liquidation watchedLiquidation, tip int64) error {
+	sweep, err := wallet.DecodeSweepPSBT(liquidation.PSBT)
+	if err != nil {
+		return err
+	}
+
+	status, err := w.Backend.TxStatus(ctx, sweep.TxID)
+	if errors.Is(err, chain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fetching status of %s: %w", sweep.TxID, err)
+	}
+
+	confirmations := status.Confirmations(tip)
+	if confirmations < w.MinConfirmations {
+		return nil
+	}
+
+	tx, err := w.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	marked, err := services.MarkLiquidationSwept(tx, liquidation.LoanID, liquidation.PSBT, sweep.TxID, sweep.Inputs)
+	if err != nil {
+		return err
+	}
+	if !marked {
+		return nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Loan %d liquidation swept in %s with %d confirmations", liquidation.LoanID, sweep.TxID, confirmations)
+	return nil
+}
@@ -0,0 +1,247 @@
+package watcher
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"paperhands/api/chain"
+	"paperhands/api/dbtest"
+	"paperhands/api/models"
+)
+
+func TestCheckLoan(t *testing.T) {
+	const address = "bc1pdeposit"
+	const tip = 100
+
+	tests := []struct {
+		name  string
+		utxos []chain.UTXO
+		// wantConfirmations is the confirmations recorded for each utxo
+		wantConfirmations  []int64
+		wantCollateralised bool
+	}{
+		{
+			name: "under-funded",
+			utxos: []chain.UTXO{
+				{TxID: "aa", Vout: 0, Value: 60_000_000, Confirmed: true, BlockHeight: 90},
+			},
+			wantConfirmations: []int64{11},
+		},
+		{
+			name: "exactly funded",
+			utxos: []chain.UTXO{
+				{TxID: "aa", Vout: 0, Value: 60_000_000, Confirmed: true, BlockHeight: 90},
+				{TxID: "bb", Vout: 1, Value: 40_000_000, Confirmed: true, BlockHeight: 98},
+			},
+			wantConfirmations:  []int64{11, 3},
+			wantCollateralised: true,
+		},
+		{
+			name: "unconfirmed",
+			utxos: []chain.UTXO{
+				{TxID: "aa", Vout: 0, Value: 60_000_000, Confirmed: true, BlockHeight: 90},
+				{TxID: "bb", Vout: 0, Value: 40_000_000, Confirmed: true, BlockHeight: 99},
+				{TxID: "cc", Vout: 0, Value: 90_000_000},
+			},
+			wantConfirmations: []int64{11, 2, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := chain.NewMemoryBackend(tip)
+			for _, utxo := range tt.utxos {
+				backend.AddUTXO(address, utxo)
+			}
+
+			db, mock := dbtest.New(t)
+			mock.ExpectBegin()
+			for i, utxo := range tt.utxos {
+				mock.ExpectExec("INSERT INTO loan_collateral_utxos").
+					WithArgs(7, address, utxo.TxID, utxo.Vout, utxo.Value, dbtest.Any, tt.wantConfirmations[i])
+			}
+			mock.ExpectQuery("SELECT id, txid, vout FROM loan_collateral_utxos").
+				WillReturnRows([]string{"id", "txid", "vout"})
+			if tt.wantCollateralised {
+				mock.ExpectQuery("SELECT status FROM loans WHERE id = $1 FOR UPDATE").
+					WithArgs(7).
+					WillReturnRows([]string{"status"}, []interface{}{models.LoanStatusAwaitingCollateral})
+				mock.ExpectExec("UPDATE loans SET status = $1").
+					WithArgs(models.LoanStatusCollateralised, 7)
+				mock.ExpectExec("INSERT INTO loan_status_history").
+					WithArgs(7, models.LoanStatusAwaitingCollateral, models.LoanStatusCollateralised, nil, dbtest.Any)
+			}
+			mock.ExpectCommit()
+
+			w := &CollateralWatcher{DB: db, Backend: backend, MinConfirmations: 3}
+			loan := watchedLoan{ID: 7, DepositAddress: address, CollateralBTC: 1}
+			if err := w.checkLoan(context.Background(), loan, tip); err != nil {
+				t.Fatalf("checkLoan: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckLoanWithoutRequirement(t *testing.T) {
+	backend := chain.NewMemoryBackend(100)
+	backend.AddUTXO("bc1pdeposit", chain.UTXO{TxID: "aa", Value: 1, Confirmed: true, BlockHeight: 90})
+
+	// No statements are expected: the loan is skipped before touching the database
+	db, _ := dbtest.New(t)
+	w := &CollateralWatcher{DB: db, Backend: backend, MinConfirmations: 3}
+	if err := w.checkLoan(context.Background(), watchedLoan{ID: 7, DepositAddress: "bc1pdeposit"}, 100); err != nil {
+		t.Fatalf("checkLoan: %v", err)
+	}
+}
+
+// releasePSBT builds an unsigned release spending one collateral output to the return address
+func releasePSBT(t *testing.T, fundingTxID string) (string, string) {
+	t.Helper()
+
+	hash, err := chainhash.NewHashFromStr(fundingTxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script := append([]byte{0x51, 0x20}, make([]byte, 32)...)
+	packet, err := psbt.New([]*wire.OutPoint{wire.NewOutPoint(hash, 1)}, []*wire.TxOut{wire.NewTxOut(99_000_000, script)}, 2, 0, []uint32{wire.MaxTxInSequenceNum - 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := packet.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded, packet.UnsignedTx.TxHash().String()
+}
+
+func TestCheckRelease(t *testing.T) {
+	const returnAddress = "bc1preturn"
+	const tip = 100
+	fundingTxID := strings.Repeat("ab", 32)
+	encoded, releaseTxID := releasePSBT(t, fundingTxID)
+
+	tests := []struct {
+		name string
+		// utxo is the release output still unspent at the return address, if any
+		utxo         *chain.UTXO
+		status       *chain.TxStatus
+		wantReleased bool
+	}{
+		{
+			name:         "confirmed",
+			utxo:         &chain.UTXO{TxID: releaseTxID, Value: 99_000_000, Confirmed: true, BlockHeight: 98},
+			wantReleased: true,
+		},
+		{
+			name:         "confirmed and already spent by the borrower",
+			status:       &chain.TxStatus{Confirmed: true, BlockHeight: 95},
+			wantReleased: true,
+		},
+		{
+			name: "too few confirmations",
+			utxo: &chain.UTXO{TxID: releaseTxID, Value: 99_000_000, Confirmed: true, BlockHeight: 99},
+		},
+		{
+			name:   "unconfirmed",
+			status: &chain.TxStatus{},
+		},
+		{
+			name: "not broadcast",
+			utxo: &chain.UTXO{TxID: strings.Repeat("cd", 32), Value: 99_000_000, Confirmed: true, BlockHeight: 90},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := chain.NewMemoryBackend(tip)
+			if tt.utxo != nil {
+				backend.AddUTXO(returnAddress, *tt.utxo)
+			}
+			if tt.status != nil {
+				backend.SetTxStatus(releaseTxID, *tt.status)
+			}
+
+			db, mock := dbtest.New(t)
+			if tt.wantReleased {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE collateral_releases SET status = $1").
+					WithArgs(models.CollateralReleaseReleased, 7, models.CollateralReleaseAwaitingSignature, encoded)
+				mock.ExpectExec("UPDATE loan_collateral_utxos SET spent = TRUE").
+					WithArgs(7, fundingTxID, 1)
+				mock.ExpectCommit()
+			}
+
+			w := &CollateralWatcher{DB: db, Backend: backend, MinConfirmations: 3}
+			release := watchedRelease{LoanID: 7, PSBT: encoded}
+			if err := w.checkRelease(context.Background(), release, tip); err != nil {
+				t.Fatalf("checkRelease: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckReleaseRebuilt(t *testing.T) {
+	encoded, releaseTxID := releasePSBT(t, strings.Repeat("ab", 32))
+	backend := chain.NewMemoryBackend(100)
+	backend.SetTxStatus(releaseTxID, chain.TxStatus{Confirmed: true, BlockHeight: 90})
+
+	// The PSBT was replaced after it was read, so the release is left for the next poll
+	db, mock := dbtest.New(t)
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE collateral_releases SET status = $1").WillAffect(0)
+
+	w := &CollateralWatcher{DB: db, Backend: backend, MinConfirmations: 3}
+	release := watchedRelease{LoanID: 7, PSBT: encoded}
+	if err := w.checkRelease(context.Background(), release, 100); err != nil {
+		t.Fatalf("checkRelease: %v", err)
+	}
+}
+
+func TestCheckLiquidation(t *testing.T) {
+	fundingTxID := strings.Repeat("ab", 32)
+	encoded, sweepTxID := releasePSBT(t, fundingTxID)
+
+	tests := []struct {
+		name      string
+		status    *chain.TxStatus
+		wantSwept bool
+	}{
+		{"confirmed", &chain.TxStatus{Confirmed: true, BlockHeight: 98}, true},
+		{"too few confirmations", &chain.TxStatus{Confirmed: true, BlockHeight: 99}, false},
+		{"unconfirmed", &chain.TxStatus{}, false},
+		{"not broadcast", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := chain.NewMemoryBackend(100)
+			if tt.status != nil {
+				backend.SetTxStatus(sweepTxID, *tt.status)
+			}
+
+			db, mock := dbtest.New(t)
+			if tt.wantSwept {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE loan_liquidations SET status = $1, sweep_txid = $2").
+					WithArgs(models.LiquidationStatusSwept, sweepTxID, 7, models.LiquidationStatusAwaitingSignature, encoded)
+				// Only the input the sweep spends is marked, not every collateral UTXO of the loan
+				mock.ExpectExec("UPDATE loan_collateral_utxos SET spent = TRUE").
+					WithArgs(7, fundingTxID, 1)
+				mock.ExpectCommit()
+			}
+
+			w := &CollateralWatcher{DB: db, Backend: backend, MinConfirmations: 3}
+			liquidation := watchedLiquidation{LoanID: 7, PSBT: encoded}
+			if err := w.checkLiquidation(context.Background(), liquidation, 100); err != nil {
+				t.Fatalf("checkLiquidation: %v", err)
+			}
+		})
+	}
+}
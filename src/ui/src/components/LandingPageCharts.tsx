@@ -14,7 +14,7 @@ import {
   Legend,
   ResponsiveContainer,
 } from "recharts";
-import api from "../services/api";
+import api2 from "../services/api2";
 
 interface LVRData {
   lvr: string;
@@ -57,10 +57,10 @@ export function LandingPageCharts() {
     try {
       setLoading(true);
       const [lvrRes, capitalRes, interestRes, summaryRes] = await Promise.all([
-        api.get<LVRData[]>("/analytics/loans-lvr"),
-        api.get<CapitalUtilizationData[]>("/analytics/capital-utilization"),
-        api.get<InterestEarnedData[]>("/analytics/interest-earned"),
-        api.get<SummaryData>("/analytics/summary"),
+        api2.get<LVRData[]>("/analytics/loans-lvr"),
+        api2.get<CapitalUtilizationData[]>("/analytics/capital-utilization"),
+        api2.get<InterestEarnedData[]>("/analytics/interest-earned"),
+        api2.get<SummaryData>("/analytics/summary"),
       ]);
 
       setLvrData(lvrRes.data);
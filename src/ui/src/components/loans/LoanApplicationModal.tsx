@@ -29,6 +29,7 @@ export function LoanApplicationModal({ show, onHide, onSuccess }: LoanApplicatio
   // Two-step flow state
   const [step, setStep] = useState<'form' | 'deposit'>('form');
   const [depositAddress, setDepositAddress] = useState<string | null>(null);
+  const [depositBtc, setDepositBtc] = useState(0);
   const [timeRemaining, setTimeRemaining] = useState(DEPOSIT_TIMEOUT_SECONDS);
 
   const { price: btcPrice, loading: priceLoading } = useBtcPrice();
@@ -54,6 +55,7 @@ export function LoanApplicationModal({ show, onHide, onSuccess }: LoanApplicatio
     if (!loading) {
       setStep('form');
       setDepositAddress(null);
+      setDepositBtc(0);
       setTimeRemaining(DEPOSIT_TIMEOUT_SECONDS);
       setError(null);
       setLoanAmount(5000);
@@ -90,12 +92,14 @@ export function LoanApplicationModal({ show, onHide, onSuccess }: LoanApplicatio
         throw new Error("BTC price not available");
       }
 
-      // Step 1: Create loan via Go API
-      const loanResponse = await api2.post("/loans", {
-        customerId: userId,
+      // Step 1: Lock the price and collateral with a quote, then create the loan from it
+      const quoteResponse = await api2.post("/quotes", {
         amountAud: loanAmount,
-        collateralBtc: collateralBtc,
-        btcPriceAtCreation: btcPrice,
+        lvr: lvr / 100,
+      });
+
+      const loanResponse = await api2.post("/loans", {
+        quoteId: quoteResponse.data.quoteId,
       });
 
       const newLoanId = loanResponse.data.id;
@@ -108,6 +112,7 @@ export function LoanApplicationModal({ show, onHide, onSuccess }: LoanApplicatio
       });
 
       setDepositAddress(addressResponse.data.address);
+      setDepositBtc(loanResponse.data.collateralBtc);
       setStep('deposit');
       setTimeRemaining(DEPOSIT_TIMEOUT_SECONDS);
     } catch (err) {
@@ -135,7 +140,7 @@ export function LoanApplicationModal({ show, onHide, onSuccess }: LoanApplicatio
           {depositAddress && (
             <div className="mb-3">
               <QRCodeSVG
-                value={`bitcoin:${depositAddress}?amount=${collateralBtc.toFixed(8)}`}
+                value={`bitcoin:${depositAddress}?amount=${depositBtc.toFixed(8)}`}
                 size={200}
                 level="M"
               />
@@ -145,7 +150,7 @@ export function LoanApplicationModal({ show, onHide, onSuccess }: LoanApplicatio
           {/* Amount */}
           <div className="mb-3">
             <div className="text-muted small">Amount to send</div>
-            <div className="h4">{collateralBtc.toFixed(8)} BTC</div>
+            <div className="h4">{depositBtc.toFixed(8)} BTC</div>
           </div>
 
           {/* Address */}